@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"github.com/r4stl1n/condext/pkg/managers"
+	"github.com/r4stl1n/condext/pkg/util"
+	"io/ioutil"
+	"os"
+)
+
+// runConfigCommand handles config validate and config init, it returns the exit code
+func runConfigCommand(configFlags util.ConfigFlags, args []string) int {
+
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, "usage: condext config validate [file] | condext config init [file]")
+		return managers.CliExitUsage
+	}
+
+	switch args[0] {
+	case "validate":
+
+		if len(args) == 2 {
+			configFlags.ConfigFile = args[1]
+		}
+
+		configStruct, configFile, configLoadError := util.LoadConfig(configFlags)
+
+		if configLoadError != nil {
+			fmt.Fprintln(os.Stderr, configLoadError.Error())
+			return managers.CliExitFailure
+		}
+
+		if configFile == "" {
+			configFile = "environment variables"
+		}
+
+		configValidateError := configStruct.Validate()
+
+		if configValidateError != nil {
+			fmt.Fprintln(os.Stderr, configFile+": "+configValidateError.Error())
+			return managers.CliExitFailure
+		}
+
+		environmentName, environment, _ := configStruct.ResolveEnvironment()
+
+		fmt.Println(configFile + " is valid, environment " + environmentName + " using " + environment.DatabaseLabel())
+
+		return managers.CliExitOk
+	case "init":
+
+		configFile := "config.yaml"
+
+		if len(args) == 2 {
+			configFile = args[1]
+		}
+
+		_, statError := os.Stat(configFile)
+
+		if statError == nil {
+			fmt.Fprintln(os.Stderr, configFile+" already exists")
+			return managers.CliExitFailure
+		}
+
+		writeError := ioutil.WriteFile(configFile, []byte(util.ConfigTemplate), 0600)
+
+		if writeError != nil {
+			fmt.Fprintln(os.Stderr, writeError.Error())
+			return managers.CliExitFailure
+		}
+
+		fmt.Println("Wrote " + configFile + ", fill in the credentials and run condext config validate")
+
+		return managers.CliExitOk
+	}
+
+	fmt.Fprintln(os.Stderr, "unknown config command "+args[0]+", use validate or init")
+
+	return managers.CliExitUsage
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"github.com/r4stl1n/condext/pkg/managers"
+	"github.com/r4stl1n/condext/pkg/util"
+	"os"
+	"strconv"
+)
+
+const dbUsage = "usage: condext db migrate [--dry-run] | condext db version | condext db backup [label] | condext db backups | " +
+	"condext db restore <file> | condext db verify"
+
+// runDbCommand handles the schema and backup commands, they only need the database so the broker is never contacted
+func runDbCommand(configStruct *util.ConfigStruct, environment util.EnvironmentConfig, args []string) int {
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, dbUsage)
+		return managers.CliExitUsage
+	}
+
+	argLimits := map[string][2]int{
+		"migrate": {1, 2},
+		"version": {1, 1},
+		"backup":  {1, 2},
+		"backups": {1, 1},
+		"restore": {2, 2},
+		"verify":  {1, 1},
+	}
+
+	argLimit, knownCommand := argLimits[args[0]]
+
+	if knownCommand == false || len(args) < argLimit[0] || len(args) > argLimit[1] || (args[0] == "migrate" && len(args) == 2 && args[1] != "--dry-run") {
+		fmt.Fprintln(os.Stderr, dbUsage)
+		return managers.CliExitUsage
+	}
+
+	dryRun := args[0] == "migrate" && len(args) == 2
+
+	databaseManager, databaseManagerError := managers.OpenDatabaseManager(environment.DatabaseSource())
+
+	if databaseManagerError != nil {
+		fmt.Fprintln(os.Stderr, databaseManagerError.Error())
+		return managers.CliExitFailure
+	}
+
+	defer databaseManager.Close()
+
+	// Migrating or restoring under a running instance would change tables it is using
+	if (args[0] == "migrate" && dryRun == false) || args[0] == "restore" {
+
+		instanceLock, instanceLockError := databaseManager.AcquireInstanceLock(environment.Database + ".lock")
+
+		if instanceLockError != nil {
+			fmt.Fprintln(os.Stderr, instanceLockError.Error())
+			return managers.CliExitFailure
+		}
+
+		defer instanceLock.Release()
+	}
+
+	switch args[0] {
+	case "backup", "backups", "restore", "verify":
+		return runBackupCommand(managers.CreateBackupManager(databaseManager, configStruct, environment.Database), args)
+	}
+
+	schemaVersion, schemaVersionError := databaseManager.GetSchemaVersion()
+
+	if schemaVersionError != nil {
+		fmt.Fprintln(os.Stderr, schemaVersionError.Error())
+		return managers.CliExitFailure
+	}
+
+	if args[0] == "version" {
+		fmt.Println(environment.DatabaseLabel() + " schema version " + strconv.FormatInt(schemaVersion, 10) + ", this build supports " +
+			strconv.FormatInt(managers.LatestSchemaVersion(), 10))
+		return managers.CliExitOk
+	}
+
+	var migrations []managers.DatabaseMigration
+	var migrateError error
+
+	if dryRun == true {
+		migrations, migrateError = databaseManager.GetPendingMigrations()
+	} else {
+		migrations, migrateError = databaseManager.Migrate()
+	}
+
+	for _, element := range migrations {
+
+		migrationAction := "Applied"
+
+		if dryRun == true {
+			migrationAction = "Would apply"
+		}
+
+		fmt.Println(migrationAction + " " + strconv.FormatInt(element.Version, 10) + " " + element.Name)
+	}
+
+	if migrateError != nil {
+		fmt.Fprintln(os.Stderr, migrateError.Error())
+		return managers.CliExitFailure
+	}
+
+	if len(migrations) == 0 {
+		fmt.Println(environment.DatabaseLabel() + " is at schema version " + strconv.FormatInt(schemaVersion, 10) + ", nothing to migrate")
+	}
+
+	return managers.CliExitOk
+}
+
+// runBackupCommand handles db backup, backups, restore and verify
+func runBackupCommand(backupManager *managers.BackupManager, args []string) int {
+
+	switch args[0] {
+	case "backup":
+
+		label := managers.BackupLabelManual
+
+		if len(args) == 2 {
+			label = args[1]
+		}
+
+		backupPath, backupError := backupManager.CreateBackup(label)
+
+		if backupError != nil {
+			fmt.Fprintln(os.Stderr, backupError.Error())
+			return managers.CliExitFailure
+		}
+
+		fmt.Println(backupPath)
+	case "backups":
+
+		backupFiles, listError := backupManager.ListBackups()
+
+		if listError != nil {
+			fmt.Fprintln(os.Stderr, listError.Error())
+			return managers.CliExitFailure
+		}
+
+		for _, element := range backupFiles {
+			fmt.Println(element.CreatedAt.Format("2006-01-02 15:04:05") + " " + element.Label + " " + element.Path)
+		}
+	case "restore":
+
+		preRestorePath, restoreError := backupManager.Restore(args[1])
+
+		if restoreError != nil {
+			fmt.Fprintln(os.Stderr, restoreError.Error())
+			return managers.CliExitFailure
+		}
+
+		fmt.Println("Restored " + args[1] + ", the previous database is in " + preRestorePath)
+	case "verify":
+
+		problems, verifyError := backupManager.Verify()
+
+		if verifyError != nil {
+			fmt.Fprintln(os.Stderr, verifyError.Error())
+			return managers.CliExitFailure
+		}
+
+		for _, element := range problems {
+			fmt.Println(element)
+		}
+
+		if len(problems) > 0 {
+			return managers.CliExitFailure
+		}
+
+		fmt.Println("Database verified, no problems found")
+	}
+
+	return managers.CliExitOk
+}
@@ -1,118 +1,319 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
+	"fmt"
 	broker_integrations "github.com/r4stl1n/condext/pkg/broker-integrations"
 	"github.com/r4stl1n/condext/pkg/managers"
 	"github.com/r4stl1n/condext/pkg/util"
 	"github.com/sirupsen/logrus"
-	"io/ioutil"
+	"os"
+	"strings"
 )
 
+// confirmLiveTrading asks for a typed confirmation before a live session may send orders
+func confirmLiveTrading() bool {
+
+	fmt.Print("Type LIVE to allow real money orders this session: ")
+
+	confirmation, readError := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	if readError != nil {
+		return false
+	}
+
+	return strings.TrimSpace(confirmation) == "LIVE"
+}
+
 func main() {
 
-	configStruct := util.ConfigStruct{}
+	configFlags, cliArgs, configFlagsError := util.ParseGlobalFlags(os.Args[1:])
 
-	util.PrintBanner()
+	if configFlagsError != nil {
+		fmt.Fprintln(os.Stderr, configFlagsError.Error())
+		os.Exit(managers.CliExitUsage)
+	}
 
-	logrus.SetLevel(logrus.DebugLevel)
+	// Config commands only look at the files so they run before anything connects
+	// config set and config history need the database and go through the cli manager
+	if len(cliArgs) > 1 && cliArgs[0] == "config" && (cliArgs[1] == "validate" || cliArgs[1] == "init") {
+		os.Exit(runConfigCommand(configFlags, cliArgs[1:]))
+	}
 
-	logrus.Info("Loading configuration file")
+	if len(cliArgs) > 0 && cliArgs[0] == "secrets" {
+		os.Exit(runSecretsCommand(configFlags, cliArgs[1:]))
+	}
 
-	configFile, configLoadError := ioutil.ReadFile("config.json")
+	configStruct, configFile, configLoadError := util.LoadConfig(configFlags)
 
 	if configLoadError != nil {
+		logrus.Fatal(configLoadError.Error())
+	}
 
-		logrus.Warn("Could not load the config file")
-		logrus.Info("Creating new config file, modify and run again")
+	if configFile == "" {
+		logrus.Warn("No config file found, looked for " + strings.Join([]string{"config.yaml", "config.yml", "config.toml", "config.json"}, ", ") +
+			". Run condext config init to create one")
+	}
 
-		marshaledStruct, marshaledStructError := json.MarshalIndent(configStruct, "", "")
+	configValidateError := configStruct.Validate()
 
-		if marshaledStructError != nil {
-			logrus.Fatal("Failed to marshal blank structure")
-		}
+	if configValidateError != nil {
+		logrus.Error(configValidateError.Error())
+		os.Exit(managers.CliExitFailure)
+	}
 
-		writeFileError := ioutil.WriteFile("config.json", marshaledStruct, 0644)
+	loggingError := configStruct.ApplyLogging()
 
-		if writeFileError != nil {
-			logrus.Fatal("Could not write empty config file")
-		}
+	if loggingError != nil {
+		logrus.Fatal(loggingError.Error())
+	}
 
-		return
+	if configFile != "" {
+		logrus.Info("Loaded configuration from " + configFile)
+	}
+
+	environmentName, environment, environmentError := configStruct.ResolveEnvironment()
+
+	if environmentError != nil {
+		logrus.Fatal(environmentError.Error())
+	}
+
+	if len(cliArgs) > 0 && cliArgs[0] == "db" {
+		os.Exit(runDbCommand(&configStruct, environment, cliArgs[1:]))
 	}
 
-	logrus.Info("config file loaded")
-	configUnmarshalError := json.Unmarshal(configFile, &configStruct)
+	if configStruct.HasPlaintextCredentials() == true {
+		logrus.Warn("Broker credentials are stored in plain text in " + configFile + ", move them with condext secrets set")
+	}
+
+	credentialsError := configStruct.LoadCredentials(environmentName, &environment)
 
-	if configUnmarshalError != nil {
-		logrus.Fatal("Could not unmarshal config file")
+	if credentialsError != nil {
+		logrus.Fatal(credentialsError.Error())
+	}
+
+	// Cli output may be parsed so the environment only goes to the log there
+	if len(cliArgs) == 0 {
+		util.PrintBanner()
+		util.PrintEnvironment(environmentName, environment)
+	} else {
+		logrus.Info("Environment " + environmentName + " using " + environment.DatabaseLabel())
 	}
 
 	logrus.Info("Connecting to database")
 
-	databaseManager, databaseManagerError := managers.CreateDatabaseManager("data.db")
+	databaseManager, databaseManagerError := managers.OpenDatabaseManager(environment.DatabaseSource())
 
 	if databaseManagerError != nil {
-		logrus.Panic(databaseManagerError.Error())
-		return
+		logrus.Fatal(databaseManagerError.Error())
 	}
 
-	// Create the config model if missing
-	configModelError := databaseManager.CreateCondextConfigAndFirstSymbolModel()
+	daemonMode := len(cliArgs) > 0 && cliArgs[0] == "daemon"
 
-	if configModelError != nil {
-		logrus.Error(configModelError)
-		return
+	// Anything that can trade or write holds the lock so two instances never work the same portfolio, it is taken
+	// before anything below writes to the database
+	var instanceLock managers.InstanceLock
+
+	if len(cliArgs) == 0 || daemonMode == true || managers.CommandRequiresLock(cliArgs) == true {
+
+		var instanceLockError error
+
+		instanceLock, instanceLockError = databaseManager.AcquireInstanceLock(environment.Database + ".lock")
+
+		if instanceLockError != nil {
+			logrus.Fatal(instanceLockError.Error())
+		}
+	}
+
+	// Only the instance holding the lock upgrades the schema, a read only command could run under an older daemon
+	if instanceLock != nil {
+
+		_, migrateError := databaseManager.Migrate()
+
+		if migrateError != nil {
+			logrus.Fatal(migrateError.Error())
+		}
+
+		// Create the config model if missing
+		configModelError := databaseManager.CreateCondextConfigAndFirstSymbolModel()
+
+		if configModelError != nil {
+			logrus.Fatal(configModelError)
+		}
+	} else {
+
+		schemaError := databaseManager.CheckSchemaCurrent()
+
+		if schemaError != nil {
+			logrus.Fatal(schemaError.Error())
+		}
 	}
 
-	// Create the broker integration
-	brokerIntegration := broker_integrations.CreateAlpacaBrokerIntegration()
+	// Create the broker integration, the sim environment never reaches a real broker
+	var brokerIntegration broker_integrations.BrokerIntegrationInterface = broker_integrations.CreateAlpacaBrokerIntegration()
+
+	if environmentName == util.EnvironmentSim {
+		brokerIntegration = broker_integrations.CreateSimBrokerIntegration()
+	}
 
 	logrus.Info("Setting the broker credentials")
 
-	brokerCredsError := brokerIntegration.SetCredentials([]string{configStruct.AlpacaApi, configStruct.AlpacaSecret})
+	brokerCredsError := brokerIntegration.SetCredentials([]string{environment.AlpacaApi, environment.AlpacaSecret})
 
 	if brokerCredsError != nil {
-		logrus.Error(brokerCredsError.Error())
-		return
+		logrus.Fatal(brokerCredsError.Error())
 	}
 
 	logrus.Info("Connecting to the broker")
-	brokerConnectionError := brokerIntegration.Connect("https://paper-api.alpaca.markets")
+	brokerConnectionError := brokerIntegration.Connect(environment.BrokerUrl)
 
 	if brokerConnectionError != nil {
-		logrus.Error(brokerConnectionError.Error())
-		return
+		logrus.Fatal(brokerConnectionError.Error())
 	}
 
 	logrus.Info("Validating credentials to the broker")
 	brokerValidCredentials, brokerValidateCredentialsError := brokerIntegration.ValidateCredentials()
 
 	if brokerValidateCredentialsError != nil {
-		logrus.Error(brokerValidateCredentialsError.Error())
-		return
+		logrus.Fatal(brokerValidateCredentialsError.Error())
 	}
 
 	if brokerValidCredentials == false {
-		logrus.Error("Invalid broker credentials")
-		return
+		logrus.Fatal("Invalid broker credentials")
+	}
+
+	// Create the risk manager every order passes through
+	riskManager := managers.CreateRiskManager(databaseManager, brokerIntegration)
+
+	if util.IsLiveTrading(environmentName, environment) == true && environment.ConfirmLive == false {
+
+		riskManager.RequireLiveConfirmation()
+
+		if len(cliArgs) == 0 && confirmLiveTrading() == true {
+			riskManager.ConfirmLiveTrading()
+			logrus.Warn("Live trading confirmed for this session")
+		} else {
+			logrus.Warn("Live orders are blocked, confirm at the shell prompt or set ConfirmLive on the live environment")
+		}
 	}
 
+	// Create the tax manager
+	taxManager := managers.CreateTaxManager(databaseManager, riskManager, brokerIntegration)
+
+	// Create the performance manager
+	performanceManager := managers.CreatePerformanceManager(databaseManager, brokerIntegration)
+
+	// Create the attribution manager
+	attributionManager := managers.CreateAttributionManager(databaseManager, performanceManager)
+
+	// Create the market calendar manager
+	marketCalendarManager := managers.CreateMarketCalendarManager(databaseManager, brokerIntegration)
+
+	// Create the backup manager used for the pre-rebalance snapshots
+	backupManager := managers.CreateBackupManager(databaseManager, &configStruct, environment.Database)
+
+	// Create the order intent manager that settles orders sent before a restart
+	orderIntentManager := managers.CreateOrderIntentManager(databaseManager, taxManager, brokerIntegration)
+
 	// Create the rebalance manager
-	rebalanceManager := managers.CreateRebalanceManager(databaseManager, brokerIntegration)
+	rebalanceManager := managers.CreateRebalanceManager(databaseManager, taxManager, performanceManager, marketCalendarManager, riskManager, backupManager, orderIntentManager, brokerIntegration)
+
+	// Create the config manager
+	configManager := managers.CreateConfigManager(databaseManager, rebalanceManager)
+
+	// A read only command may run next to a daemon, the config file is saved by the instance holding the lock
+	if instanceLock != nil {
+
+		applyConfigError := configManager.ApplyConfigStruct(&configStruct)
+
+		if applyConfigError != nil {
+			logrus.Fatal(applyConfigError.Error())
+		}
+	} else {
+		logrus.Debug("Not holding the instance lock, the config file settings are not saved")
+	}
 
 	// Create the command manager
-	showCommandManager := managers.CreateShowCommandManager(databaseManager, brokerIntegration)
-	indexCommandManager := managers.CreateIndexCommandManager(databaseManager, rebalanceManager, brokerIntegration)
+	showCommandManager := managers.CreateShowCommandManager(databaseManager, performanceManager, attributionManager, brokerIntegration)
+	indexCommandManager := managers.CreateIndexCommandManager(databaseManager, rebalanceManager, taxManager, marketCalendarManager, riskManager, brokerIntegration)
+	riskCommandManager := managers.CreateRiskCommandManager(databaseManager, riskManager)
+	configCommandManager := managers.CreateConfigCommandManager(configManager)
+	backupCommandManager := managers.CreateBackupCommandManager(backupManager, rebalanceManager)
+	eventCommandManager := managers.CreateEventCommandManager(managers.CreateEventManager(databaseManager), rebalanceManager)
+	taxCommandManager := managers.CreateTaxCommandManager(databaseManager, taxManager, rebalanceManager, marketCalendarManager, brokerIntegration)
+
+	cliManager := managers.CreateCliManager(showCommandManager, indexCommandManager, taxCommandManager, riskCommandManager, configCommandManager, eventCommandManager, rebalanceManager,
+		performanceManager, attributionManager, taxManager)
+
+	// Only the instance holding the lock may settle orders, a read only command leaves them alone
+	if instanceLock != nil {
+
+		recoverError := orderIntentManager.RecoverOrderIntents()
+
+		if recoverError != nil {
+			logrus.Error("Could not settle the orders sent before the restart, " + recoverError.Error())
+		}
+	}
 
-	serviceManager := managers.CreateServiceManager(&configStruct, databaseManager, showCommandManager, indexCommandManager)
+	releaseInstanceLock := func() {
+		if instanceLock != nil {
+			releaseError := instanceLock.Release()
+
+			if releaseError != nil {
+				logrus.Error(releaseError.Error())
+			}
+		}
+	}
+
+	if len(cliArgs) > 0 && daemonMode == false {
+		exitCode := cliManager.Execute(cliArgs)
+		releaseInstanceLock()
+		os.Exit(exitCode)
+	}
+
+	// Create the api manager
+	apiManager := managers.CreateApiManager(&configStruct, showCommandManager, indexCommandManager, riskCommandManager, rebalanceManager)
+
+	// Create the dashboard manager
+	dashboardManager := managers.CreateDashboardManager(&configStruct, showCommandManager, performanceManager, rebalanceManager)
+
+	serviceManager := managers.CreateServiceManager(&configStruct, databaseManager, showCommandManager, indexCommandManager, taxCommandManager, riskCommandManager, configCommandManager, backupCommandManager, eventCommandManager, rebalanceManager, apiManager, dashboardManager)
 
 	serviceInitError := serviceManager.Initialize()
 
 	if serviceInitError != nil {
+		releaseInstanceLock()
 		logrus.Fatal(serviceInitError)
 	}
 
-	serviceManager.Run()
+	if configStruct.AutoResume == true {
+
+		autoResumeError := rebalanceManager.AutoResumeRebalanceProcess()
+
+		if autoResumeError != nil {
+			logrus.Error("Could not resume the rebalance process, " + autoResumeError.Error())
+		}
+	} else if daemonMode == false {
 
+		rebalanceStatus, rebalanceStatusError := rebalanceManager.GetRebalanceStatus()
+
+		if rebalanceStatusError == nil && rebalanceStatus.SavedMode != "stopped" {
+			logrus.Warn("Rebalance process was " + rebalanceStatus.SavedMode + " before shutdown, run index_start or set AutoResume in the config")
+		}
+	}
+
+	if daemonMode == true {
+
+		daemonError := serviceManager.RunDaemon()
+		releaseInstanceLock()
+
+		if daemonError != nil {
+			logrus.Fatal(daemonError.Error())
+		}
+
+		return
+	}
+
+	serviceManager.Run()
+	releaseInstanceLock()
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"github.com/r4stl1n/condext/pkg/managers"
+	"github.com/r4stl1n/condext/pkg/util"
+	"os"
+)
+
+const secretsUsage = "usage: condext secrets set <name> [file|-] | condext secrets get <name> | condext secrets list | condext secrets rotate"
+
+// runSecretsCommand handles secrets set, get, list and rotate, it returns the exit code
+func runSecretsCommand(configFlags util.ConfigFlags, args []string) int {
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return managers.CliExitUsage
+	}
+
+	argLimits := map[string][2]int{
+		"set":    {2, 3},
+		"get":    {2, 2},
+		"list":   {1, 1},
+		"rotate": {1, 1},
+	}
+
+	argLimit, knownCommand := argLimits[args[0]]
+
+	if knownCommand == false || len(args) < argLimit[0] || len(args) > argLimit[1] {
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return managers.CliExitUsage
+	}
+
+	configStruct, _, configLoadError := util.LoadConfig(configFlags)
+
+	if configLoadError != nil {
+		fmt.Fprintln(os.Stderr, configLoadError.Error())
+		return managers.CliExitFailure
+	}
+
+	passphrase, passphraseError := util.ReadSecretsPassphrase("CONDEXT_SECRETS_PASSPHRASE", "Secrets passphrase: ")
+
+	if passphraseError != nil {
+		fmt.Fprintln(os.Stderr, passphraseError.Error())
+		return managers.CliExitFailure
+	}
+
+	secretsStore, openError := util.OpenSecretsStore(configStruct.SecretsPath(), passphrase)
+
+	if openError != nil {
+		fmt.Fprintln(os.Stderr, openError.Error())
+		return managers.CliExitFailure
+	}
+
+	switch args[0] {
+	case "set":
+
+		// The value is never taken from the arguments so it does not end up in the shell history
+		secretSource := "-"
+
+		if len(args) == 3 {
+			secretSource = args[2]
+		}
+
+		secretValue, readError := util.ReadSecret(secretSource, "Value for "+args[1]+": ")
+
+		if readError != nil {
+			fmt.Fprintln(os.Stderr, readError.Error())
+			return managers.CliExitFailure
+		}
+
+		if secretValue == "" {
+			fmt.Fprintln(os.Stderr, "refusing to store an empty value for "+args[1])
+			return managers.CliExitFailure
+		}
+
+		secretsStore.Set(args[1], secretValue)
+
+		saveError := secretsStore.Save()
+
+		if saveError != nil {
+			fmt.Fprintln(os.Stderr, saveError.Error())
+			return managers.CliExitFailure
+		}
+
+		fmt.Println("Stored " + args[1] + " in " + configStruct.SecretsPath())
+	case "get":
+
+		secretValue, secretFound := secretsStore.Get(args[1])
+
+		if secretFound == false {
+			fmt.Fprintln(os.Stderr, args[1]+" is not in "+configStruct.SecretsPath())
+			return managers.CliExitFailure
+		}
+
+		fmt.Println(secretValue)
+	case "list":
+
+		for _, secretName := range secretsStore.Names() {
+			fmt.Println(secretName)
+		}
+	case "rotate":
+
+		newPassphrase, newPassphraseError := util.ReadSecretsPassphrase("CONDEXT_SECRETS_NEW_PASSPHRASE", "New secrets passphrase: ")
+
+		if newPassphraseError != nil {
+			fmt.Fprintln(os.Stderr, newPassphraseError.Error())
+			return managers.CliExitFailure
+		}
+
+		rotateError := secretsStore.Rotate(newPassphrase)
+
+		if rotateError != nil {
+			fmt.Fprintln(os.Stderr, rotateError.Error())
+			return managers.CliExitFailure
+		}
+
+		fmt.Println("Re-encrypted " + configStruct.SecretsPath() + " with the new passphrase")
+	}
+
+	return managers.CliExitOk
+}
@@ -1,17 +1,65 @@
 package broker_integrations
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"github.com/alpacahq/alpaca-trade-api-go/alpaca"
 	"github.com/alpacahq/alpaca-trade-api-go/common"
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// The most activities the broker returns in one page
+const alpacaActivityPageSize = 100
+
+var errAlpacaNotFound = errors.New("not found at the broker")
+
+// alpacaCashActivity is a deposit or withdrawal, its id is "<yyyymmddhhmmssmmm>::<uuid>" in exchange time
+type alpacaCashActivity struct {
+	ID        string          `json:"id"`
+	Date      string          `json:"date"`
+	NetAmount decimal.Decimal `json:"net_amount"`
+}
+
+// transactionTime reads the time from the id, an id in another format falls back to the start of the date
+func (activity alpacaCashActivity) transactionTime(marketLocation *time.Location) (time.Time, error) {
+
+	idParts := strings.SplitN(activity.ID, "::", 2)
+
+	if len(idParts) == 2 && len(idParts[0]) == len("20060102150405000") {
+
+		idTime, idTimeError := time.ParseInLocation("20060102150405.000", idParts[0][:14]+"."+idParts[0][14:], marketLocation)
+
+		if idTimeError == nil {
+			return idTime, nil
+		}
+	}
+
+	return time.ParseInLocation("2006-01-02", activity.Date, marketLocation)
+}
+
+// Orders in one of these states will not fill, a canceled or expired order may have filled part of the amount
+var alpacaOrderEndStatuses = map[string]bool{
+	"canceled":     true,
+	"expired":      true,
+	"done_for_day": true,
+	"rejected":     true,
+	"replaced":     true,
+}
+
 type AlpacaBrokerIntegration struct {
 	AccessKey    string
 	AccessSecret string
+
+	// Kept for the endpoints the alpaca client does not wrap
+	BaseUrl string
 }
 
 func CreateAlpacaBrokerIntegration() *AlpacaBrokerIntegration {
@@ -20,6 +68,7 @@ func CreateAlpacaBrokerIntegration() *AlpacaBrokerIntegration {
 
 func (alpacaBrokerIntegration *AlpacaBrokerIntegration) Connect(connectionUrl string) error {
 	alpaca.SetBaseUrl(connectionUrl)
+	alpacaBrokerIntegration.BaseUrl = strings.TrimSuffix(connectionUrl, "/")
 	return nil
 }
 
@@ -74,6 +123,79 @@ func (alpacaBrokerIntegration *AlpacaBrokerIntegration) GetAccountValue() (float
 
 }
 
+func (alpacaBrokerIntegration *AlpacaBrokerIntegration) GetAccountCash() (float64, error) {
+
+	alpacaClient := alpaca.NewClient(&common.APIKey{
+		ID:           alpacaBrokerIntegration.AccessKey,
+		Secret:       alpacaBrokerIntegration.AccessSecret,
+		PolygonKeyID: alpacaBrokerIntegration.AccessKey,
+	})
+
+	accountInfo, accountError := alpacaClient.GetAccount()
+
+	if accountError != nil {
+		return 0, accountError
+	}
+
+	accountCashConv, _ := accountInfo.Cash.Float64()
+
+	return accountCashConv, nil
+}
+
+// GetNetExternalFlows adds up the deposits and withdrawals made after since. Cash activities only carry a date, the
+// time they happened comes from their id, which starts with it in exchange time
+func (alpacaBrokerIntegration *AlpacaBrokerIntegration) GetNetExternalFlows(since time.Time) (float64, error) {
+
+	marketLocation, marketLocationError := time.LoadLocation("America/New_York")
+
+	if marketLocationError != nil {
+		return 0, marketLocationError
+	}
+
+	// The broker filters on the date alone, a day earlier keeps the activities from the day since falls on
+	activitiesQuery := url.Values{}
+	activitiesQuery.Set("activity_types", "CSD,CSW")
+	activitiesQuery.Set("after", since.In(marketLocation).AddDate(0, 0, -1).Format("2006-01-02"))
+	activitiesQuery.Set("direction", "asc")
+	activitiesQuery.Set("page_size", strconv.Itoa(alpacaActivityPageSize))
+
+	netFlows := decimal.NewFromFloat(0.0)
+
+	for {
+
+		activities := []alpacaCashActivity{}
+
+		activitiesError := alpacaBrokerIntegration.getJson("/v2/account/activities", activitiesQuery, &activities)
+
+		if activitiesError != nil {
+			return 0, activitiesError
+		}
+
+		for _, activity := range activities {
+
+			activityTime, activityTimeError := activity.transactionTime(marketLocation)
+
+			if activityTimeError != nil {
+				return 0, activityTimeError
+			}
+
+			if activityTime.After(since) {
+				netFlows = netFlows.Add(activity.NetAmount)
+			}
+		}
+
+		if len(activities) < alpacaActivityPageSize {
+			break
+		}
+
+		activitiesQuery.Set("page_token", activities[len(activities)-1].ID)
+	}
+
+	netFlowsConv, _ := netFlows.Float64()
+
+	return netFlowsConv, nil
+}
+
 func (alpacaBrokerIntegration *AlpacaBrokerIntegration) CheckIfSymbolIsValid(symbol string) (bool, error) {
 	alpacaClient := alpaca.NewClient(&common.APIKey{
 		ID:           alpacaBrokerIntegration.AccessKey,
@@ -108,7 +230,8 @@ func (alpacaBrokerIntegration *AlpacaBrokerIntegration) GetSymbolQuotePrice(symb
 	return midQuoteValue, nil
 }
 
-func (alpacaBrokerIntegration *AlpacaBrokerIntegration) FulFillMarketOrderBuy(symbol string, amount int64) error {
+// GetPositions returns the share count the broker holds for every open position
+func (alpacaBrokerIntegration *AlpacaBrokerIntegration) GetPositions() (map[string]int64, error) {
 
 	alpacaClient := alpaca.NewClient(&common.APIKey{
 		ID:           alpacaBrokerIntegration.AccessKey,
@@ -116,62 +239,117 @@ func (alpacaBrokerIntegration *AlpacaBrokerIntegration) FulFillMarketOrderBuy(sy
 		PolygonKeyID: alpacaBrokerIntegration.AccessKey,
 	})
 
-	accountInfo, accountError := alpacaClient.GetAccount()
+	positions, positionsError := alpacaClient.ListPositions()
 
-	if accountError != nil {
-		return accountError
+	if positionsError != nil {
+		return nil, positionsError
 	}
 
-	placeOrderRequest := alpaca.PlaceOrderRequest{
-		AccountID:   accountInfo.ID,
-		AssetKey:    &symbol,
-		Qty:         decimal.NewFromInt(amount),
-		TimeInForce: "gtc",
-		Type:        alpaca.Market,
-		Side:        alpaca.Buy,
+	positionAmounts := map[string]int64{}
+
+	for _, position := range positions {
+		positionAmounts[position.Symbol] = position.Qty.IntPart()
 	}
 
-	order, orderError := alpacaClient.PlaceOrder(placeOrderRequest)
+	return positionAmounts, nil
+}
 
-	logrus.Info("Placed Market Buy - Symbol: " + symbol + " Amount: " + decimal.NewFromInt(amount).String())
+func (alpacaBrokerIntegration *AlpacaBrokerIntegration) GetMarketClock() (MarketClock, error) {
 
-	if orderError != nil {
-		return orderError
+	alpacaClient := alpaca.NewClient(&common.APIKey{
+		ID:           alpacaBrokerIntegration.AccessKey,
+		Secret:       alpacaBrokerIntegration.AccessSecret,
+		PolygonKeyID: alpacaBrokerIntegration.AccessKey,
+	})
+
+	clock, clockError := alpacaClient.GetClock()
+
+	if clockError != nil {
+		return MarketClock{}, clockError
 	}
 
-	filled := false
+	return MarketClock{
+		Timestamp: clock.Timestamp,
+		IsOpen:    clock.IsOpen,
+		NextOpen:  clock.NextOpen,
+		NextClose: clock.NextClose,
+	}, nil
+}
 
-	for filled != true {
+// GetPreviousClose returns the close of the last daily bar before today in exchange time
+func (alpacaBrokerIntegration *AlpacaBrokerIntegration) GetPreviousClose(symbol string) (float64, error) {
 
-		time.Sleep(time.Duration(1) * time.Second)
+	alpacaClient := alpaca.NewClient(&common.APIKey{
+		ID:           alpacaBrokerIntegration.AccessKey,
+		Secret:       alpacaBrokerIntegration.AccessSecret,
+		PolygonKeyID: alpacaBrokerIntegration.AccessKey,
+	})
 
-		orderInfo, orderInfoError := alpacaClient.GetOrder(order.ID)
+	marketLocation, marketLocationError := time.LoadLocation("America/New_York")
 
-		if orderInfoError != nil {
-			logrus.Error(orderError.Error())
-			continue
-		}
+	if marketLocationError != nil {
+		return 0, marketLocationError
+	}
 
-		if orderInfo.Status == "filled" {
+	barLimit := 3
 
-			logrus.Info("Market Buy For - Symbol: " + symbol + " Amount: " + decimal.NewFromInt(amount).String() + " - Filled")
+	bars, barsError := alpacaClient.GetSymbolBars(symbol, alpaca.ListBarParams{
+		Timeframe: "1D",
+		Limit:     &barLimit,
+	})
 
-			filled = true
-			break
-		}
+	if barsError != nil {
+		return 0, barsError
+	}
 
-		if orderInfo.Status == "rejected" {
-			return errors.New("Market Buy For - Symbol: " + symbol + " Amount: " + decimal.NewFromInt(amount).String() + " - Rejected")
+	today := time.Now().In(marketLocation).Format("2006-01-02")
+
+	for index := len(bars) - 1; index >= 0; index-- {
+		if time.Unix(bars[index].Time, 0).In(marketLocation).Format("2006-01-02") < today {
+			return float64(bars[index].Close), nil
 		}
+	}
+
+	return 0, errors.New("no previous close found for " + symbol)
+}
+
+func (alpacaBrokerIntegration *AlpacaBrokerIntegration) FulFillMarketOrderBuy(orderContext context.Context, symbol string, amount int64, clientOrderId string) (float64, error) {
+
+	alpacaClient := alpaca.NewClient(&common.APIKey{
+		ID:           alpacaBrokerIntegration.AccessKey,
+		Secret:       alpacaBrokerIntegration.AccessSecret,
+		PolygonKeyID: alpacaBrokerIntegration.AccessKey,
+	})
 
-		logrus.Info("Market Buy For - Symbol: " + symbol + " Amount: " + decimal.NewFromInt(amount).String() + " - Not filled yet")
+	accountInfo, accountError := alpacaClient.GetAccount()
 
+	if accountError != nil {
+		return 0.0, accountError
 	}
 
-	return nil
+	placeOrderRequest := alpaca.PlaceOrderRequest{
+		AccountID:     accountInfo.ID,
+		AssetKey:      &symbol,
+		Qty:           decimal.NewFromInt(amount),
+		TimeInForce:   "gtc",
+		Type:          alpaca.Market,
+		Side:          alpaca.Buy,
+		ClientOrderID: clientOrderId,
+	}
+
+	order, orderError := alpacaClient.PlaceOrder(placeOrderRequest)
+
+	logrus.Info("Placed Market Buy - Symbol: " + symbol + " Amount: " + decimal.NewFromInt(amount).String())
+
+	if orderError != nil {
+		return 0.0, orderError
+	}
+
+	return alpacaBrokerIntegration.waitForOrderFill(orderContext, alpacaClient, order.ID,
+		"Market Buy For - Symbol: "+symbol+" Amount: "+decimal.NewFromInt(amount).String())
 }
 
-func (alpacaBrokerIntegration *AlpacaBrokerIntegration) FulFillMarketOrderSell(symbol string, amount int64) error {
+func (alpacaBrokerIntegration *AlpacaBrokerIntegration) FulFillMarketOrderSell(orderContext context.Context, symbol string, amount int64, clientOrderId string) (float64, error) {
 
 	alpacaClient := alpaca.NewClient(&common.APIKey{
 		ID:           alpacaBrokerIntegration.AccessKey,
@@ -182,16 +360,17 @@ func (alpacaBrokerIntegration *AlpacaBrokerIntegration) FulFillMarketOrderSell(s
 	accountInfo, accountError := alpacaClient.GetAccount()
 
 	if accountError != nil {
-		return accountError
+		return 0.0, accountError
 	}
 
 	placeOrderRequest := alpaca.PlaceOrderRequest{
-		AccountID:   accountInfo.ID,
-		AssetKey:    &symbol,
-		Qty:         decimal.NewFromInt(amount),
-		TimeInForce: "gtc",
-		Type:        alpaca.Market,
-		Side:        alpaca.Sell,
+		AccountID:     accountInfo.ID,
+		AssetKey:      &symbol,
+		Qty:           decimal.NewFromInt(amount),
+		TimeInForce:   "gtc",
+		Type:          alpaca.Market,
+		Side:          alpaca.Sell,
+		ClientOrderID: clientOrderId,
 	}
 
 	order, orderError := alpacaClient.PlaceOrder(placeOrderRequest)
@@ -199,37 +378,126 @@ func (alpacaBrokerIntegration *AlpacaBrokerIntegration) FulFillMarketOrderSell(s
 	logrus.Info("Placed Market Sell - Symbol: " + symbol + " Amount: " + decimal.NewFromInt(amount).String())
 
 	if orderError != nil {
-		return orderError
+		return 0.0, orderError
 	}
 
-	filled := false
+	return alpacaBrokerIntegration.waitForOrderFill(orderContext, alpacaClient, order.ID,
+		"Market Sell For - Symbol: "+symbol+" Amount: "+decimal.NewFromInt(amount).String())
+}
+
+// waitForOrderFill polls the order until it fills or ends without filling, when the context ends first the order is
+// canceled at the broker and whatever filled before that is left for the caller to look up
+func (alpacaBrokerIntegration *AlpacaBrokerIntegration) waitForOrderFill(orderContext context.Context, alpacaClient *alpaca.Client, orderId string, orderLabel string) (float64, error) {
+
+	for {
+
+		select {
+		case <-orderContext.Done():
 
-	for filled != true {
+			cancelError := alpacaClient.CancelOrder(orderId)
 
-		time.Sleep(time.Duration(1) * time.Second)
+			if cancelError != nil {
+				return 0.0, errors.New(orderLabel + " - Not filled, canceling it failed, " + cancelError.Error())
+			}
 
-		orderInfo, orderInfoError := alpacaClient.GetOrder(order.ID)
+			logrus.Warn(orderLabel + " - Canceled")
+
+			return 0.0, errors.New(orderLabel + " - Canceled before it filled, " + orderContext.Err().Error())
+		case <-time.After(time.Duration(1) * time.Second):
+		}
+
+		orderInfo, orderInfoError := alpacaClient.GetOrder(orderId)
 
 		if orderInfoError != nil {
-			logrus.Error(orderError.Error())
+			logrus.Error(orderInfoError.Error())
 			continue
 		}
 
 		if orderInfo.Status == "filled" {
-			filled = true
 
-			logrus.Info("Market Sell For - Symbol: " + symbol + " Amount: " + decimal.NewFromInt(amount).String() + " - Filled")
+			logrus.Info(orderLabel + " - Filled")
 
-			break
+			fillPrice := 0.0
+
+			if orderInfo.FilledAvgPrice != nil {
+				fillPrice, _ = orderInfo.FilledAvgPrice.Float64()
+			}
+
+			return fillPrice, nil
 		}
 
-		if orderInfo.Status == "rejected" {
-			return errors.New("Market Sell For - Symbol: " + symbol + " Amount: " + decimal.NewFromInt(amount).String() + " - Rejected")
+		if alpacaOrderEndStatuses[orderInfo.Status] == true {
+			return 0.0, errors.New(orderLabel + " - " + strings.Title(strings.Replace(orderInfo.Status, "_", " ", -1)))
 		}
 
-		logrus.Info("Market Sell For - Symbol: " + symbol + " Amount: " + decimal.NewFromInt(amount).String() + " - Not filled yet")
+		logrus.Info(orderLabel + " - Not filled yet")
+	}
+}
+
+// GetOrderByClientOrderId asks the broker for the order directly, the alpaca client has no call for it. Only a not
+// found answer reports the order as missing, any other failure is an error so the intent is not closed on a guess
+func (alpacaBrokerIntegration *AlpacaBrokerIntegration) GetOrderByClientOrderId(clientOrderId string) (BrokerOrder, bool, error) {
+
+	orderQuery := url.Values{}
+	orderQuery.Set("client_order_id", clientOrderId)
 
+	order := alpaca.Order{}
+
+	orderError := alpacaBrokerIntegration.getJson("/v2/orders:by_client_order_id", orderQuery, &order)
+
+	if orderError == errAlpacaNotFound {
+		return BrokerOrder{}, false, nil
 	}
 
-	return nil
+	if orderError != nil {
+		return BrokerOrder{}, false, orderError
+	}
+
+	brokerOrder := BrokerOrder{
+		ClientOrderId: order.ClientOrderID,
+		Symbol:        order.Symbol,
+		Side:          string(order.Side),
+		Status:        order.Status,
+		FilledAmount:  order.FilledQty.IntPart(),
+	}
+
+	if order.FilledAvgPrice != nil {
+		brokerOrder.FillPrice, _ = order.FilledAvgPrice.Float64()
+	}
+
+	return brokerOrder, true, nil
+}
+
+// getJson calls an endpoint the alpaca client does not wrap and decodes the answer, a 404 is errAlpacaNotFound
+func (alpacaBrokerIntegration *AlpacaBrokerIntegration) getJson(path string, query url.Values, target interface{}) error {
+
+	restRequest, restRequestError := http.NewRequest(http.MethodGet, alpacaBrokerIntegration.BaseUrl+path+"?"+query.Encode(), nil)
+
+	if restRequestError != nil {
+		return restRequestError
+	}
+
+	restRequest.Header.Set("APCA-API-KEY-ID", alpacaBrokerIntegration.AccessKey)
+	restRequest.Header.Set("APCA-API-SECRET-KEY", alpacaBrokerIntegration.AccessSecret)
+
+	restResponse, restResponseError := http.DefaultClient.Do(restRequest)
+
+	if restResponseError != nil {
+		return restResponseError
+	}
+
+	defer restResponse.Body.Close()
+
+	if restResponse.StatusCode == http.StatusNotFound {
+		return errAlpacaNotFound
+	}
+
+	if restResponse.StatusCode != http.StatusOK {
+
+		responseBody, _ := ioutil.ReadAll(restResponse.Body)
+
+		return errors.New(path + " returned status " + strconv.Itoa(restResponse.StatusCode) + " " + strings.TrimSpace(string(responseBody)))
+	}
+
+	return json.NewDecoder(restResponse.Body).Decode(target)
 }
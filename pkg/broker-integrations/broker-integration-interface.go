@@ -1,13 +1,46 @@
 package broker_integrations
 
+import (
+	"context"
+	"time"
+)
+
+// MarketClock is the broker's view of whether the market is open and when that next changes
+type MarketClock struct {
+	Timestamp time.Time
+	IsOpen    bool
+	NextOpen  time.Time
+	NextClose time.Time
+}
+
+// BrokerOrder is the broker's view of an order placed with a client order id
+type BrokerOrder struct {
+	ClientOrderId string
+	Symbol        string
+	Side          string
+	Status        string
+	FilledAmount  int64
+	FillPrice     float64
+}
+
 type BrokerIntegrationInterface interface {
 	Connect(connectionUrl string) error
 	SetCredentials(credentials []string) error
 	ValidateCredentials() (bool, error)
 	GetAccountValue() (float64, error)
+	GetAccountCash() (float64, error)
+	GetNetExternalFlows(since time.Time) (float64, error)
 	GetSymbolQuotePrice(symbol string) (float64, error)
+	GetPreviousClose(symbol string) (float64, error)
 	CheckIfSymbolIsValid(symbol string) (bool, error)
+	GetPositions() (map[string]int64, error)
+	GetMarketClock() (MarketClock, error)
+
+	// The client order id is unique per order, the broker refuses a second order with the same one. The order is
+	// canceled when the context ends before it fills
+	FulFillMarketOrderBuy(orderContext context.Context, symbol string, amount int64, clientOrderId string) (float64, error)
+	FulFillMarketOrderSell(orderContext context.Context, symbol string, amount int64, clientOrderId string) (float64, error)
 
-	FulFillMarketOrderBuy(symbol string, amount int64) error
-	FulFillMarketOrderSell(symbol string, amount int64) error
+	// GetOrderByClientOrderId looks an order up by its client order id, false when the broker never received it
+	GetOrderByClientOrderId(clientOrderId string) (BrokerOrder, bool, error)
 }
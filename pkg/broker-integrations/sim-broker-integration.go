@@ -0,0 +1,323 @@
+package broker_integrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A new simulated account starts with this much cash and prices a symbol it has not seen at the default price
+const (
+	SimStartingCash   = 100000.0
+	SimDefaultPrice   = 100.0
+	simFilePrefix     = "file://"
+	simStatusFilled   = "filled"
+	simStatusRejected = "rejected"
+)
+
+var simSymbolPattern = regexp.MustCompile(`^[A-Z][A-Z.]{0,9}$`)
+
+// simAccount is what the simulator keeps in its file, editing Prices there moves the simulated market
+type simAccount struct {
+	Cash      float64
+	Prices    map[string]float64
+	Positions map[string]int64
+	Orders    map[string]BrokerOrder
+}
+
+// SimBrokerIntegration fills every market order at once at the account price, nothing leaves the machine
+type SimBrokerIntegration struct {
+	AccountFile string
+
+	account      simAccount
+	accountMutex sync.Mutex
+}
+
+func CreateSimBrokerIntegration() *SimBrokerIntegration {
+	return &SimBrokerIntegration{}
+}
+
+// Connect opens the account file at the path or file:// url, a missing file starts a new account
+func (simBrokerIntegration *SimBrokerIntegration) Connect(connectionUrl string) error {
+
+	simBrokerIntegration.accountMutex.Lock()
+	defer simBrokerIntegration.accountMutex.Unlock()
+
+	simBrokerIntegration.AccountFile = strings.TrimPrefix(connectionUrl, simFilePrefix)
+
+	simBrokerIntegration.account = simAccount{
+		Cash:      SimStartingCash,
+		Prices:    map[string]float64{},
+		Positions: map[string]int64{},
+		Orders:    map[string]BrokerOrder{},
+	}
+
+	accountData, readError := ioutil.ReadFile(simBrokerIntegration.AccountFile)
+
+	if os.IsNotExist(readError) == true {
+		return simBrokerIntegration.saveAccount()
+	}
+
+	if readError != nil {
+		return readError
+	}
+
+	unmarshalError := json.Unmarshal(accountData, &simBrokerIntegration.account)
+
+	if unmarshalError != nil {
+		return errors.New("simulated account " + simBrokerIntegration.AccountFile + " can not be read, " + unmarshalError.Error())
+	}
+
+	// A hand edited file may leave a map out
+	if simBrokerIntegration.account.Prices == nil {
+		simBrokerIntegration.account.Prices = map[string]float64{}
+	}
+
+	if simBrokerIntegration.account.Positions == nil {
+		simBrokerIntegration.account.Positions = map[string]int64{}
+	}
+
+	if simBrokerIntegration.account.Orders == nil {
+		simBrokerIntegration.account.Orders = map[string]BrokerOrder{}
+	}
+
+	return nil
+}
+
+// SetCredentials accepts anything, the simulator has no one to log in to
+func (simBrokerIntegration *SimBrokerIntegration) SetCredentials(credentials []string) error {
+	return nil
+}
+
+func (simBrokerIntegration *SimBrokerIntegration) ValidateCredentials() (bool, error) {
+	return true, nil
+}
+
+func (simBrokerIntegration *SimBrokerIntegration) GetAccountValue() (float64, error) {
+
+	simBrokerIntegration.accountMutex.Lock()
+	defer simBrokerIntegration.accountMutex.Unlock()
+
+	accountValue := simBrokerIntegration.account.Cash
+
+	for symbol, amount := range simBrokerIntegration.account.Positions {
+		accountValue = accountValue + float64(amount)*simBrokerIntegration.symbolPrice(symbol)
+	}
+
+	return roundCents(accountValue), nil
+}
+
+func (simBrokerIntegration *SimBrokerIntegration) GetAccountCash() (float64, error) {
+
+	simBrokerIntegration.accountMutex.Lock()
+	defer simBrokerIntegration.accountMutex.Unlock()
+
+	return simBrokerIntegration.account.Cash, nil
+}
+
+// GetNetExternalFlows is always zero, the simulated account is only funded when it is created
+func (simBrokerIntegration *SimBrokerIntegration) GetNetExternalFlows(since time.Time) (float64, error) {
+	return 0, nil
+}
+
+// GetSymbolQuotePrice returns the account price, a symbol seen for the first time is saved at the default price so
+// it can be edited in the file
+func (simBrokerIntegration *SimBrokerIntegration) GetSymbolQuotePrice(symbol string) (float64, error) {
+
+	simBrokerIntegration.accountMutex.Lock()
+	defer simBrokerIntegration.accountMutex.Unlock()
+
+	if _, priceFound := simBrokerIntegration.account.Prices[symbol]; priceFound == false {
+
+		simBrokerIntegration.account.Prices[symbol] = SimDefaultPrice
+
+		saveError := simBrokerIntegration.saveAccount()
+
+		if saveError != nil {
+			return 0, saveError
+		}
+	}
+
+	return simBrokerIntegration.account.Prices[symbol], nil
+}
+
+// GetPreviousClose is the quote price, the simulated market does not move on its own
+func (simBrokerIntegration *SimBrokerIntegration) GetPreviousClose(symbol string) (float64, error) {
+	return simBrokerIntegration.GetSymbolQuotePrice(symbol)
+}
+
+func (simBrokerIntegration *SimBrokerIntegration) CheckIfSymbolIsValid(symbol string) (bool, error) {
+	return simSymbolPattern.MatchString(symbol), nil
+}
+
+func (simBrokerIntegration *SimBrokerIntegration) GetPositions() (map[string]int64, error) {
+
+	simBrokerIntegration.accountMutex.Lock()
+	defer simBrokerIntegration.accountMutex.Unlock()
+
+	positions := map[string]int64{}
+
+	for symbol, amount := range simBrokerIntegration.account.Positions {
+		positions[symbol] = amount
+	}
+
+	return positions, nil
+}
+
+// GetMarketClock reports the simulated market as always open
+func (simBrokerIntegration *SimBrokerIntegration) GetMarketClock() (MarketClock, error) {
+
+	now := time.Now()
+
+	return MarketClock{
+		Timestamp: now,
+		IsOpen:    true,
+		NextOpen:  now,
+		NextClose: now.Add(24 * time.Hour),
+	}, nil
+}
+
+func (simBrokerIntegration *SimBrokerIntegration) FulFillMarketOrderBuy(orderContext context.Context, symbol string, amount int64, clientOrderId string) (float64, error) {
+	return simBrokerIntegration.fillOrder(orderContext, symbol, "buy", amount, clientOrderId)
+}
+
+func (simBrokerIntegration *SimBrokerIntegration) FulFillMarketOrderSell(orderContext context.Context, symbol string, amount int64, clientOrderId string) (float64, error) {
+	return simBrokerIntegration.fillOrder(orderContext, symbol, "sell", amount, clientOrderId)
+}
+
+func (simBrokerIntegration *SimBrokerIntegration) GetOrderByClientOrderId(clientOrderId string) (BrokerOrder, bool, error) {
+
+	simBrokerIntegration.accountMutex.Lock()
+	defer simBrokerIntegration.accountMutex.Unlock()
+
+	brokerOrder, brokerOrderFound := simBrokerIntegration.account.Orders[clientOrderId]
+
+	return brokerOrder, brokerOrderFound, nil
+}
+
+// fillOrder fills the whole amount at the account price, an order the cash or position can not cover is rejected
+// and kept so it can be looked up like any other
+func (simBrokerIntegration *SimBrokerIntegration) fillOrder(orderContext context.Context, symbol string, side string, amount int64, clientOrderId string) (float64, error) {
+
+	orderLabel := fmt.Sprintf("%s %d %s", side, amount, symbol)
+
+	if orderContext.Err() != nil {
+		return 0, errors.New(orderLabel + " - " + orderContext.Err().Error())
+	}
+
+	if amount <= 0 {
+		return 0, errors.New(orderLabel + " - amount must be above zero")
+	}
+
+	fillPrice, priceError := simBrokerIntegration.GetSymbolQuotePrice(symbol)
+
+	if priceError != nil {
+		return 0, priceError
+	}
+
+	simBrokerIntegration.accountMutex.Lock()
+	defer simBrokerIntegration.accountMutex.Unlock()
+
+	if _, orderExists := simBrokerIntegration.account.Orders[clientOrderId]; orderExists == true {
+		return 0, errors.New(orderLabel + " - client order id " + clientOrderId + " was already used")
+	}
+
+	brokerOrder := BrokerOrder{
+		ClientOrderId: clientOrderId,
+		Symbol:        symbol,
+		Side:          side,
+		Status:        simStatusFilled,
+		FilledAmount:  amount,
+		FillPrice:     fillPrice,
+	}
+
+	orderCost := roundCents(float64(amount) * fillPrice)
+	rejectReason := ""
+
+	if side == "buy" && orderCost > simBrokerIntegration.account.Cash {
+		rejectReason = fmt.Sprintf("insufficient cash, the order costs %.2f and the account has %.2f", orderCost, simBrokerIntegration.account.Cash)
+	}
+
+	if side == "sell" && amount > simBrokerIntegration.account.Positions[symbol] {
+		rejectReason = fmt.Sprintf("insufficient position, the account holds %d", simBrokerIntegration.account.Positions[symbol])
+	}
+
+	if rejectReason != "" {
+
+		brokerOrder.Status = simStatusRejected
+		brokerOrder.FilledAmount = 0
+		brokerOrder.FillPrice = 0
+
+		simBrokerIntegration.account.Orders[clientOrderId] = brokerOrder
+
+		saveError := simBrokerIntegration.saveAccount()
+
+		if saveError != nil {
+			return 0, saveError
+		}
+
+		return 0, errors.New(orderLabel + " - " + rejectReason)
+	}
+
+	if side == "buy" {
+		simBrokerIntegration.account.Cash = roundCents(simBrokerIntegration.account.Cash - orderCost)
+		simBrokerIntegration.account.Positions[symbol] = simBrokerIntegration.account.Positions[symbol] + amount
+	} else {
+		simBrokerIntegration.account.Cash = roundCents(simBrokerIntegration.account.Cash + orderCost)
+		simBrokerIntegration.account.Positions[symbol] = simBrokerIntegration.account.Positions[symbol] - amount
+	}
+
+	if simBrokerIntegration.account.Positions[symbol] == 0 {
+		delete(simBrokerIntegration.account.Positions, symbol)
+	}
+
+	simBrokerIntegration.account.Orders[clientOrderId] = brokerOrder
+
+	saveError := simBrokerIntegration.saveAccount()
+
+	if saveError != nil {
+		return 0, saveError
+	}
+
+	return fillPrice, nil
+}
+
+// saveAccount replaces the file in one rename so a crash never leaves half an account, the caller holds the mutex
+func (simBrokerIntegration *SimBrokerIntegration) saveAccount() error {
+
+	accountData, marshalError := json.MarshalIndent(simBrokerIntegration.account, "", "  ")
+
+	if marshalError != nil {
+		return marshalError
+	}
+
+	writeError := ioutil.WriteFile(simBrokerIntegration.AccountFile+".tmp", accountData, 0600)
+
+	if writeError != nil {
+		return writeError
+	}
+
+	return os.Rename(simBrokerIntegration.AccountFile+".tmp", simBrokerIntegration.AccountFile)
+}
+
+// symbolPrice is the account price without saving a new symbol, the caller holds the mutex
+func (simBrokerIntegration *SimBrokerIntegration) symbolPrice(symbol string) float64 {
+
+	if price, priceFound := simBrokerIntegration.account.Prices[symbol]; priceFound == true {
+		return price
+	}
+
+	return SimDefaultPrice
+}
+
+func roundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,105 @@
+package broker_integrations
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func connectSimBroker(t *testing.T, accountFile string) *SimBrokerIntegration {
+
+	t.Helper()
+
+	simBroker := CreateSimBrokerIntegration()
+
+	connectError := simBroker.Connect("file://" + accountFile)
+
+	if connectError != nil {
+		t.Fatal(connectError)
+	}
+
+	return simBroker
+}
+
+func TestSimBrokerIntegration(t *testing.T) {
+
+	testCases := []struct {
+		name         string
+		side         string
+		amount       int64
+		status       string
+		filledAmount int64
+		cash         float64
+		position     int64
+	}{
+		{"buy within the cash", "buy", 100, "filled", 100, SimStartingCash - 20000, 200},
+		{"buy beyond the cash", "buy", 1000, "rejected", 0, SimStartingCash - 10000, 100},
+		{"sell part of the position", "sell", 40, "filled", 40, SimStartingCash - 10000 + 4000, 60},
+		{"sell beyond the position", "sell", 101, "rejected", 0, SimStartingCash - 10000, 100},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			accountDirectory, directoryError := ioutil.TempDir("", "condext-sim")
+
+			if directoryError != nil {
+				t.Fatal(directoryError)
+			}
+
+			t.Cleanup(func() {
+				os.RemoveAll(accountDirectory)
+			})
+
+			accountFile := filepath.Join(accountDirectory, "account.json")
+
+			simBroker := connectSimBroker(t, accountFile)
+
+			_, openingError := simBroker.FulFillMarketOrderBuy(context.Background(), "VTI", 100, "opening")
+
+			if openingError != nil {
+				t.Fatal(openingError)
+			}
+
+			if testCase.side == "buy" {
+				_, _ = simBroker.FulFillMarketOrderBuy(context.Background(), "VTI", testCase.amount, "tested")
+			} else {
+				_, _ = simBroker.FulFillMarketOrderSell(context.Background(), "VTI", testCase.amount, "tested")
+			}
+
+			// The account and its orders have to survive a restart
+			simBroker = connectSimBroker(t, accountFile)
+
+			brokerOrder, brokerOrderFound, brokerOrderError := simBroker.GetOrderByClientOrderId("tested")
+
+			if brokerOrderError != nil || brokerOrderFound == false {
+				t.Fatalf("order not found, %v", brokerOrderError)
+			}
+
+			if brokerOrder.Status != testCase.status || brokerOrder.FilledAmount != testCase.filledAmount {
+				t.Errorf("order is %s with %d filled, want %s with %d", brokerOrder.Status, brokerOrder.FilledAmount, testCase.status, testCase.filledAmount)
+			}
+
+			cash, _ := simBroker.GetAccountCash()
+			positions, _ := simBroker.GetPositions()
+
+			if cash != testCase.cash || positions["VTI"] != testCase.position {
+				t.Errorf("account has %v cash and %d VTI, want %v and %d", cash, positions["VTI"], testCase.cash, testCase.position)
+			}
+
+			accountValue, _ := simBroker.GetAccountValue()
+
+			if accountValue != testCase.cash+float64(testCase.position)*SimDefaultPrice {
+				t.Errorf("account value is %v, want %v", accountValue, testCase.cash+float64(testCase.position)*SimDefaultPrice)
+			}
+
+			_, reusedError := simBroker.FulFillMarketOrderBuy(context.Background(), "VTI", 1, "tested")
+
+			if reusedError == nil {
+				t.Error("a client order id was accepted twice")
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type ClosedLotModel struct {
+	gorm.Model
+
+	UUID       string
+	LotUUID    string
+	FillUUID   string
+	Symbol     string
+	Amount     int64
+	AcquiredAt time.Time
+	SoldAt     time.Time
+	Proceeds   float64
+	CostBasis  float64
+
+	WashSaleAdjustment float64
+	// Shares of this lot already matched to replacement buys, the loss on the rest can still be disallowed
+	WashSaleMatchedAmount int64
+}
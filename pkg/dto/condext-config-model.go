@@ -11,4 +11,23 @@ type CondextConfigModel struct {
 	RebalanceFrequency int64
 	StartingBalance    float64
 	FloatingPercentage float64
+
+	HarvestLossThreshold float64
+	ShortTermTaxRate     float64
+	LongTermTaxRate      float64
+	TaxDriftTradeoff     float64
+
+	SnapshotFrequency int64
+	RiskFreeRate      float64
+	BenchmarkSymbol   string
+
+	// Trading window in exchange time as HH:MM, empty trades the whole session
+	TradeWindowStart string
+	TradeWindowEnd   string
+
+	// Pre-trade limits, zero turns a check off
+	MaxOrderNotional  float64
+	MaxDailyNotional  float64
+	MaxPositionWeight float64
+	MaxPriceDeviation float64
 }
@@ -0,0 +1,16 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type ConfigChangeModel struct {
+	gorm.Model
+
+	Key       string
+	OldValue  string
+	NewValue  string
+	Source    string
+	ChangedAt time.Time
+}
@@ -0,0 +1,20 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// EventModel is one entry of the append-only audit log, each hash covers the entry and the hash before it
+type EventModel struct {
+	gorm.Model
+
+	Sequence     int64  `gorm:"unique_index"`
+	Type         string `gorm:"index"`
+	Actor        string
+	Symbol       string `gorm:"index"`
+	Payload      string
+	OccurredAt   time.Time
+	PreviousHash string
+	Hash         string
+}
@@ -0,0 +1,17 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type FillModel struct {
+	gorm.Model
+
+	UUID     string
+	Symbol   string
+	Side     string
+	Amount   int64
+	Price    float64
+	FilledAt time.Time
+}
@@ -0,0 +1,22 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type HarvestSwapModel struct {
+	gorm.Model
+
+	UUID             string
+	Symbol           string
+	SubstituteSymbol string
+	Amount           int64
+	SubstituteAmount int64
+	HarvestedLoss    float64
+	SwappedAt        time.Time
+	Completed        bool
+
+	// Cash raised for the symbol that still has to be bought back, set once the substitute is sold or was never bought
+	BuyBackCash float64
+}
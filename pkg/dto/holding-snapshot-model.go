@@ -0,0 +1,19 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type HoldingSnapshotModel struct {
+	gorm.Model
+
+	PortfolioSnapshotID uint
+	Symbol              string
+	Sector              string
+	Amount              int64
+	Price               float64
+	Value               float64
+	DesiredPercentage   float64
+	TakenAt             time.Time
+}
@@ -12,4 +12,5 @@ type IndexedSymbolModel struct {
 	CurrentPercentage float64
 	CurrentPrice      float64
 	Amount            int64
+	Sector            string
 }
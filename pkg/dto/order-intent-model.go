@@ -0,0 +1,28 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// OrderIntentModel is saved before an order goes to the broker so an order sent before a crash can be found again
+type OrderIntentModel struct {
+	gorm.Model
+
+	ClientOrderId string `gorm:"index"`
+	Symbol        string `gorm:"index"`
+	Side          string
+	Amount        int64
+	Price         float64
+	Source        string
+	Status        string `gorm:"index"`
+	FilledAmount  int64
+	FillPrice     float64
+	Reason        string
+	ResolvedAt    *time.Time
+
+	// The tax lots a sell was planned against, comma separated in sale order, empty sells the oldest lots first
+	LotUUIDs string
+	// The harvest swap a swap back order belongs to
+	SwapID uint
+}
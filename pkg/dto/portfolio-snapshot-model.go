@@ -0,0 +1,18 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type PortfolioSnapshotModel struct {
+	gorm.Model
+
+	Value   float64
+	Cash    float64
+	NetFlow float64
+	TakenAt time.Time
+
+	BenchmarkSymbol string
+	BenchmarkPrice  float64
+}
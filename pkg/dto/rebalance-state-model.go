@@ -0,0 +1,14 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type RebalanceStateModel struct {
+	gorm.Model
+
+	Mode       string
+	LastTickAt time.Time
+	LastError  string
+}
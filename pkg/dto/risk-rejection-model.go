@@ -0,0 +1,19 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type RiskRejectionModel struct {
+	gorm.Model
+
+	Symbol     string
+	Side       string
+	Amount     int64
+	Price      float64
+	Source     string
+	Rule       string
+	Reason     string
+	RejectedAt time.Time
+}
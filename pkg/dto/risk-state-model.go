@@ -0,0 +1,14 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type RiskStateModel struct {
+	gorm.Model
+
+	Halted     bool
+	HaltReason string
+	HaltedAt   time.Time
+}
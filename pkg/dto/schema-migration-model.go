@@ -0,0 +1,15 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// SchemaMigrationModel records each numbered migration applied to the database
+type SchemaMigrationModel struct {
+	gorm.Model
+
+	Version   int64 `gorm:"unique_index"`
+	Name      string
+	AppliedAt time.Time
+}
@@ -0,0 +1,10 @@
+package dto
+
+import "github.com/jinzhu/gorm"
+
+type SubstituteSymbolModel struct {
+	gorm.Model
+
+	Symbol           string
+	SubstituteSymbol string
+}
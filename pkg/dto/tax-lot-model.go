@@ -0,0 +1,18 @@
+package dto
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type TaxLotModel struct {
+	gorm.Model
+
+	UUID            string
+	Symbol          string
+	FillUUID        string
+	Amount          int64
+	RemainingAmount int64
+	CostBasis       float64
+	AcquiredAt      time.Time
+}
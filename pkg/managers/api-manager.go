@@ -0,0 +1,652 @@
+package managers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/util"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type apiIndexedSymbol struct {
+	Symbol            string  `json:"symbol"`
+	Sector            string  `json:"sector"`
+	Amount            int64   `json:"amount"`
+	CurrentPrice      float64 `json:"currentPrice"`
+	CurrentValue      float64 `json:"currentValue"`
+	Locked            bool    `json:"locked"`
+	DesiredPercentage float64 `json:"desiredPercentage"`
+	CurrentPercentage float64 `json:"currentPercentage"`
+}
+
+type apiConfig struct {
+	Active               bool    `json:"active"`
+	ReBalanceThreshold   float64 `json:"rebalanceThreshold"`
+	OrderTimeout         int64   `json:"orderTimeout"`
+	RebalanceFrequency   int64   `json:"rebalanceFrequency"`
+	StartingBalance      float64 `json:"startingBalance"`
+	HarvestLossThreshold float64 `json:"harvestLossThreshold"`
+	ShortTermTaxRate     float64 `json:"shortTermTaxRate"`
+	LongTermTaxRate      float64 `json:"longTermTaxRate"`
+	TaxDriftTradeoff     float64 `json:"taxDriftTradeoff"`
+	SnapshotFrequency    int64   `json:"snapshotFrequency"`
+	RiskFreeRate         float64 `json:"riskFreeRate"`
+	BenchmarkSymbol      string  `json:"benchmarkSymbol"`
+	TradeWindowStart     string  `json:"tradeWindowStart"`
+	TradeWindowEnd       string  `json:"tradeWindowEnd"`
+}
+
+type apiStats struct {
+	AccountValue     float64 `json:"accountValue"`
+	IndexedSymbols   int     `json:"indexedSymbols"`
+	RebalanceRunning bool    `json:"rebalanceRunning"`
+}
+
+type apiTrade struct {
+	Symbol   string    `json:"symbol"`
+	Side     string    `json:"side"`
+	Amount   int64     `json:"amount"`
+	Price    float64   `json:"price"`
+	FilledAt time.Time `json:"filledAt"`
+}
+
+type apiPlannedTrade struct {
+	Symbol               string  `json:"symbol"`
+	Side                 string  `json:"side"`
+	Amount               int64   `json:"amount"`
+	Price                float64 `json:"price"`
+	PercentageDifference float64 `json:"percentageDifference"`
+	ShortTermGain        float64 `json:"shortTermGain"`
+	LongTermGain         float64 `json:"longTermGain"`
+	EstimatedTax         float64 `json:"estimatedTax"`
+	Deferred             bool    `json:"deferred"`
+	DeferReason          string  `json:"deferReason"`
+}
+
+type apiAddSymbolRequest struct {
+	Symbol     string  `json:"symbol"`
+	Percentage float64 `json:"percentage"`
+	Locked     bool    `json:"locked"`
+}
+
+type apiRebalanceStatus struct {
+	Mode       string     `json:"mode"`
+	SavedMode  string     `json:"savedMode"`
+	LastTickAt *time.Time `json:"lastTickAt"`
+	NextTickAt *time.Time `json:"nextTickAt"`
+	LastError  string     `json:"lastError"`
+}
+
+type apiRiskState struct {
+	Halted            bool       `json:"halted"`
+	HaltReason        string     `json:"haltReason"`
+	HaltedAt          *time.Time `json:"haltedAt"`
+	MaxOrderNotional  float64    `json:"maxOrderNotional"`
+	MaxDailyNotional  float64    `json:"maxDailyNotional"`
+	MaxPositionWeight float64    `json:"maxPositionWeight"`
+	MaxPriceDeviation float64    `json:"maxPriceDeviation"`
+}
+
+type apiRiskRejection struct {
+	Symbol     string    `json:"symbol"`
+	Side       string    `json:"side"`
+	Amount     int64     `json:"amount"`
+	Price      float64   `json:"price"`
+	Source     string    `json:"source"`
+	Rule       string    `json:"rule"`
+	Reason     string    `json:"reason"`
+	RejectedAt time.Time `json:"rejectedAt"`
+}
+
+type apiConfigChange struct {
+	Key       string    `json:"key"`
+	OldValue  string    `json:"oldValue"`
+	NewValue  string    `json:"newValue"`
+	Source    string    `json:"source"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+type apiEvent struct {
+	Sequence     int64           `json:"sequence"`
+	Type         string          `json:"type"`
+	Actor        string          `json:"actor"`
+	Symbol       string          `json:"symbol"`
+	Payload      json.RawMessage `json:"payload"`
+	OccurredAt   time.Time       `json:"occurredAt"`
+	PreviousHash string          `json:"previousHash"`
+	Hash         string          `json:"hash"`
+}
+
+type apiHaltRequest struct {
+	Reason string `json:"reason"`
+}
+
+type apiMessage struct {
+	Message string `json:"message"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type ApiManager struct {
+	config          *util.ConfigStruct
+	showCommandMgr  *ShowCommandManager
+	indexCommandMgr *IndexCommandManager
+	riskCommandMgr  *RiskCommandManager
+	rebalanceMgr    *RebalanceManager
+}
+
+func CreateApiManager(config *util.ConfigStruct, showCommandManager *ShowCommandManager, indexCommandManager *IndexCommandManager, riskCommandManager *RiskCommandManager, rebalanceManager *RebalanceManager) *ApiManager {
+
+	return &ApiManager{
+		config:          config,
+		showCommandMgr:  showCommandManager,
+		indexCommandMgr: indexCommandManager,
+		riskCommandMgr:  riskCommandManager,
+		rebalanceMgr:    rebalanceManager,
+	}
+}
+
+func toApiIndexedSymbol(indexedSymbol dto.IndexedSymbolModel) apiIndexedSymbol {
+
+	return apiIndexedSymbol{
+		Symbol:            indexedSymbol.Symbol,
+		Sector:            indexedSymbol.Sector,
+		Amount:            indexedSymbol.Amount,
+		CurrentPrice:      indexedSymbol.CurrentPrice,
+		CurrentValue:      util.DecimalToFloat(decimal.NewFromInt(indexedSymbol.Amount).Mul(decimal.NewFromFloat(indexedSymbol.CurrentPrice))),
+		Locked:            indexedSymbol.Locked,
+		DesiredPercentage: indexedSymbol.DesiredPercentage,
+		CurrentPercentage: indexedSymbol.CurrentPercentage,
+	}
+}
+
+func toApiConfig(configModel dto.CondextConfigModel) apiConfig {
+
+	return apiConfig{
+		Active:               configModel.Active,
+		ReBalanceThreshold:   configModel.ReBalanceThreshold,
+		OrderTimeout:         configModel.OrderTimeout,
+		RebalanceFrequency:   configModel.RebalanceFrequency,
+		StartingBalance:      configModel.StartingBalance,
+		HarvestLossThreshold: configModel.HarvestLossThreshold,
+		ShortTermTaxRate:     configModel.ShortTermTaxRate,
+		LongTermTaxRate:      configModel.LongTermTaxRate,
+		TaxDriftTradeoff:     configModel.TaxDriftTradeoff,
+		SnapshotFrequency:    configModel.SnapshotFrequency,
+		RiskFreeRate:         configModel.RiskFreeRate,
+		BenchmarkSymbol:      configModel.BenchmarkSymbol,
+		TradeWindowStart:     configModel.TradeWindowStart,
+		TradeWindowEnd:       configModel.TradeWindowEnd,
+	}
+}
+
+func toApiTrades(fills []dto.FillModel) []apiTrade {
+
+	trades := []apiTrade{}
+
+	for _, element := range fills {
+		trades = append(trades, apiTrade{
+			Symbol:   element.Symbol,
+			Side:     element.Side,
+			Amount:   element.Amount,
+			Price:    element.Price,
+			FilledAt: element.FilledAt,
+		})
+	}
+
+	return trades
+}
+
+func toApiPlannedTrades(plannedTrades []PlannedTrade) []apiPlannedTrade {
+
+	apiPlannedTrades := []apiPlannedTrade{}
+
+	for _, element := range plannedTrades {
+		apiPlannedTrades = append(apiPlannedTrades, apiPlannedTrade{
+			Symbol:               element.Symbol,
+			Side:                 element.Side,
+			Amount:               element.Amount,
+			Price:                element.Price,
+			PercentageDifference: element.PercentageDifference,
+			ShortTermGain:        element.TaxImpact.ShortTermGain,
+			LongTermGain:         element.TaxImpact.LongTermGain,
+			EstimatedTax:         element.TaxImpact.EstimatedTax,
+			Deferred:             element.Deferred,
+			DeferReason:          element.DeferReason,
+		})
+	}
+
+	return apiPlannedTrades
+}
+
+func writeJson(w http.ResponseWriter, statusCode int, body interface{}) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	encodeError := json.NewEncoder(w).Encode(body)
+
+	if encodeError != nil {
+		logrus.Error(encodeError.Error())
+	}
+}
+
+func writeJsonError(w http.ResponseWriter, statusCode int, err error) {
+	writeJson(w, statusCode, apiError{Error: err.Error()})
+}
+
+// authorize wraps a handler so it only runs for the expected method with a matching bearer token
+func (apiManager *ApiManager) authorize(method string, handler http.HandlerFunc) http.HandlerFunc {
+
+	expectedHeader := []byte("Bearer " + apiManager.config.ApiToken)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expectedHeader) != 1 {
+			writeJsonError(w, http.StatusUnauthorized, errors.New("invalid or missing api token"))
+			return
+		}
+
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJsonError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (apiManager *ApiManager) getIndexHandler(w http.ResponseWriter, r *http.Request) {
+
+	indexedSymbols, indexedSymbolsError := apiManager.showCommandMgr.GetIndex()
+
+	if indexedSymbolsError != nil {
+		writeJsonError(w, http.StatusInternalServerError, indexedSymbolsError)
+		return
+	}
+
+	response := []apiIndexedSymbol{}
+
+	for _, element := range indexedSymbols {
+		response = append(response, toApiIndexedSymbol(element))
+	}
+
+	writeJson(w, http.StatusOK, response)
+}
+
+func (apiManager *ApiManager) getConfigHandler(w http.ResponseWriter, r *http.Request) {
+
+	configModel, configModelError := apiManager.showCommandMgr.GetConfig()
+
+	if configModelError != nil {
+		writeJsonError(w, http.StatusInternalServerError, configModelError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, toApiConfig(configModel))
+}
+
+func (apiManager *ApiManager) getStatsHandler(w http.ResponseWriter, r *http.Request) {
+
+	indexStats, indexStatsError := apiManager.showCommandMgr.GetStats()
+
+	if indexStatsError != nil {
+		writeJsonError(w, http.StatusBadGateway, indexStatsError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, apiStats{
+		AccountValue:     indexStats.AccountValue,
+		IndexedSymbols:   indexStats.IndexedSymbols,
+		RebalanceRunning: apiManager.rebalanceMgr.IsRebalanceProcessRunning(),
+	})
+}
+
+func (apiManager *ApiManager) getTradesHandler(w http.ResponseWriter, r *http.Request) {
+
+	limit := 100
+
+	if r.URL.Query().Get("limit") != "" {
+
+		parsedLimit, parsedLimitError := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		if parsedLimitError != nil || parsedLimit <= 0 {
+			writeJsonError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return
+		}
+
+		limit = parsedLimit
+	}
+
+	fills, fillsError := apiManager.showCommandMgr.GetTrades(limit)
+
+	if fillsError != nil {
+		writeJsonError(w, http.StatusInternalServerError, fillsError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, toApiTrades(fills))
+}
+
+func (apiManager *ApiManager) addSymbolHandler(w http.ResponseWriter, r *http.Request) {
+
+	addSymbolRequest := apiAddSymbolRequest{}
+
+	decodeError := json.NewDecoder(r.Body).Decode(&addSymbolRequest)
+
+	if decodeError != nil {
+		writeJsonError(w, http.StatusBadRequest, decodeError)
+		return
+	}
+
+	if addSymbolRequest.Symbol == "" || addSymbolRequest.Percentage <= 0 {
+		writeJsonError(w, http.StatusBadRequest, errors.New("symbol and a positive percentage are required"))
+		return
+	}
+
+	indexedSymbol, addSymbolError := apiManager.indexCommandMgr.AddSymbolToIndex(addSymbolRequest.Symbol,
+		decimal.NewFromFloat(addSymbolRequest.Percentage), addSymbolRequest.Locked, SourceApi)
+
+	if addSymbolError != nil {
+		writeJsonError(w, http.StatusBadRequest, addSymbolError)
+		return
+	}
+
+	writeJson(w, http.StatusCreated, toApiIndexedSymbol(indexedSymbol))
+}
+
+func (apiManager *ApiManager) rebalancePlanHandler(w http.ResponseWriter, r *http.Request) {
+
+	plannedTrades, plannedTradesError := apiManager.rebalanceMgr.GenerateRebalancePlan()
+
+	if plannedTradesError != nil {
+		writeJsonError(w, http.StatusBadRequest, plannedTradesError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, toApiPlannedTrades(plannedTrades))
+}
+
+func (apiManager *ApiManager) rebalanceStartHandler(w http.ResponseWriter, r *http.Request) {
+
+	startError := apiManager.indexCommandMgr.StartIndex()
+
+	if startError != nil {
+		writeJsonError(w, http.StatusConflict, startError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, apiMessage{Message: "rebalance process started"})
+}
+
+func (apiManager *ApiManager) rebalanceStopHandler(w http.ResponseWriter, r *http.Request) {
+
+	stopError := apiManager.indexCommandMgr.StopIndex()
+
+	if stopError != nil {
+		writeJsonError(w, http.StatusConflict, stopError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, apiMessage{Message: "rebalance process stopped"})
+}
+
+func optionalTime(value time.Time) *time.Time {
+
+	if value.IsZero() {
+		return nil
+	}
+
+	return &value
+}
+
+func toApiRebalanceStatus(rebalanceStatus RebalanceStatus) apiRebalanceStatus {
+
+	return apiRebalanceStatus{
+		Mode:       rebalanceStatus.Mode,
+		SavedMode:  rebalanceStatus.SavedMode,
+		LastTickAt: optionalTime(rebalanceStatus.LastTickAt),
+		NextTickAt: optionalTime(rebalanceStatus.NextTickAt),
+		LastError:  rebalanceStatus.LastError,
+	}
+}
+
+func (apiManager *ApiManager) rebalancePauseHandler(w http.ResponseWriter, r *http.Request) {
+
+	pauseError := apiManager.indexCommandMgr.PauseIndex()
+
+	if pauseError != nil {
+		writeJsonError(w, http.StatusConflict, pauseError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, apiMessage{Message: "rebalance process paused"})
+}
+
+func (apiManager *ApiManager) rebalanceResumeHandler(w http.ResponseWriter, r *http.Request) {
+
+	resumeError := apiManager.indexCommandMgr.ResumeIndex()
+
+	if resumeError != nil {
+		writeJsonError(w, http.StatusConflict, resumeError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, apiMessage{Message: "rebalance process resumed"})
+}
+
+func (apiManager *ApiManager) rebalanceStatusHandler(w http.ResponseWriter, r *http.Request) {
+
+	rebalanceStatus, rebalanceStatusError := apiManager.indexCommandMgr.GetIndexStatus()
+
+	if rebalanceStatusError != nil {
+		writeJsonError(w, http.StatusInternalServerError, rebalanceStatusError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, toApiRebalanceStatus(rebalanceStatus))
+}
+
+func toApiRiskState(riskState dto.RiskStateModel, configModel dto.CondextConfigModel) apiRiskState {
+
+	apiState := apiRiskState{
+		Halted:            riskState.Halted,
+		HaltReason:        riskState.HaltReason,
+		MaxOrderNotional:  configModel.MaxOrderNotional,
+		MaxDailyNotional:  configModel.MaxDailyNotional,
+		MaxPositionWeight: configModel.MaxPositionWeight,
+		MaxPriceDeviation: configModel.MaxPriceDeviation,
+	}
+
+	if riskState.Halted == true {
+		apiState.HaltedAt = optionalTime(riskState.HaltedAt)
+	}
+
+	return apiState
+}
+
+func toApiRiskRejections(riskRejections []dto.RiskRejectionModel) []apiRiskRejection {
+
+	apiRejections := []apiRiskRejection{}
+
+	for _, element := range riskRejections {
+		apiRejections = append(apiRejections, apiRiskRejection{
+			Symbol:     element.Symbol,
+			Side:       element.Side,
+			Amount:     element.Amount,
+			Price:      element.Price,
+			Source:     element.Source,
+			Rule:       element.Rule,
+			Reason:     element.Reason,
+			RejectedAt: element.RejectedAt,
+		})
+	}
+
+	return apiRejections
+}
+
+func toApiConfigChanges(configChanges []dto.ConfigChangeModel) []apiConfigChange {
+
+	apiChanges := []apiConfigChange{}
+
+	for _, element := range configChanges {
+		apiChanges = append(apiChanges, apiConfigChange{
+			Key:       element.Key,
+			OldValue:  element.OldValue,
+			NewValue:  element.NewValue,
+			Source:    element.Source,
+			ChangedAt: element.ChangedAt,
+		})
+	}
+
+	return apiChanges
+}
+
+func toApiEvents(eventModels []dto.EventModel) []apiEvent {
+
+	apiEvents := []apiEvent{}
+
+	for _, element := range eventModels {
+		apiEvents = append(apiEvents, apiEvent{
+			Sequence:     element.Sequence,
+			Type:         element.Type,
+			Actor:        element.Actor,
+			Symbol:       element.Symbol,
+			Payload:      json.RawMessage(element.Payload),
+			OccurredAt:   element.OccurredAt,
+			PreviousHash: element.PreviousHash,
+			Hash:         element.Hash,
+		})
+	}
+
+	return apiEvents
+}
+
+func (apiManager *ApiManager) getRiskHandler(w http.ResponseWriter, r *http.Request) {
+
+	riskState, configModel, riskStateError := apiManager.riskCommandMgr.GetRiskState()
+
+	if riskStateError != nil {
+		writeJsonError(w, http.StatusInternalServerError, riskStateError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, toApiRiskState(riskState, configModel))
+}
+
+func (apiManager *ApiManager) getRiskRejectionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	limit := 25
+
+	if r.URL.Query().Get("limit") != "" {
+
+		parsedLimit, parsedLimitError := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		if parsedLimitError != nil || parsedLimit <= 0 {
+			writeJsonError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return
+		}
+
+		limit = parsedLimit
+	}
+
+	riskRejections, riskRejectionsError := apiManager.riskCommandMgr.GetRejections(limit)
+
+	if riskRejectionsError != nil {
+		writeJsonError(w, http.StatusInternalServerError, riskRejectionsError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, toApiRiskRejections(riskRejections))
+}
+
+func (apiManager *ApiManager) riskHaltHandler(w http.ResponseWriter, r *http.Request) {
+
+	haltRequest := apiHaltRequest{}
+
+	// The reason is optional so an empty body still halts
+	if r.ContentLength != 0 {
+
+		decodeError := json.NewDecoder(r.Body).Decode(&haltRequest)
+
+		if decodeError != nil {
+			writeJsonError(w, http.StatusBadRequest, decodeError)
+			return
+		}
+	}
+
+	haltError := apiManager.riskCommandMgr.Halt(haltRequest.Reason, SourceApi)
+
+	if haltError != nil {
+		writeJsonError(w, http.StatusConflict, haltError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, apiMessage{Message: "trading halted"})
+}
+
+func (apiManager *ApiManager) riskResumeHandler(w http.ResponseWriter, r *http.Request) {
+
+	resumeError := apiManager.riskCommandMgr.Resume(SourceApi)
+
+	if resumeError != nil {
+		writeJsonError(w, http.StatusConflict, resumeError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, apiMessage{Message: "trading resumed"})
+}
+
+func (apiManager *ApiManager) Handler() http.Handler {
+
+	serveMux := http.NewServeMux()
+
+	serveMux.HandleFunc("/index", apiManager.authorize(http.MethodGet, apiManager.getIndexHandler))
+	serveMux.HandleFunc("/config", apiManager.authorize(http.MethodGet, apiManager.getConfigHandler))
+	serveMux.HandleFunc("/stats", apiManager.authorize(http.MethodGet, apiManager.getStatsHandler))
+	serveMux.HandleFunc("/trades", apiManager.authorize(http.MethodGet, apiManager.getTradesHandler))
+	serveMux.HandleFunc("/index/symbols", apiManager.authorize(http.MethodPost, apiManager.addSymbolHandler))
+	serveMux.HandleFunc("/rebalance/plan", apiManager.authorize(http.MethodPost, apiManager.rebalancePlanHandler))
+	serveMux.HandleFunc("/rebalance/start", apiManager.authorize(http.MethodPost, apiManager.rebalanceStartHandler))
+	serveMux.HandleFunc("/rebalance/stop", apiManager.authorize(http.MethodPost, apiManager.rebalanceStopHandler))
+	serveMux.HandleFunc("/rebalance/pause", apiManager.authorize(http.MethodPost, apiManager.rebalancePauseHandler))
+	serveMux.HandleFunc("/rebalance/resume", apiManager.authorize(http.MethodPost, apiManager.rebalanceResumeHandler))
+	serveMux.HandleFunc("/rebalance/status", apiManager.authorize(http.MethodGet, apiManager.rebalanceStatusHandler))
+	serveMux.HandleFunc("/risk", apiManager.authorize(http.MethodGet, apiManager.getRiskHandler))
+	serveMux.HandleFunc("/risk/rejections", apiManager.authorize(http.MethodGet, apiManager.getRiskRejectionsHandler))
+	serveMux.HandleFunc("/risk/halt", apiManager.authorize(http.MethodPost, apiManager.riskHaltHandler))
+	serveMux.HandleFunc("/risk/resume", apiManager.authorize(http.MethodPost, apiManager.riskResumeHandler))
+
+	return serveMux
+}
+
+// Server returns the api server unstarted so the caller can shut it down
+func (apiManager *ApiManager) Server() (*http.Server, error) {
+
+	if apiManager.config.ApiToken == "" {
+		return nil, errors.New("an api token is required to start the api")
+	}
+
+	return &http.Server{Addr: apiManager.config.ApiListen, Handler: apiManager.Handler()}, nil
+}
+
+func (apiManager *ApiManager) ListenAndServe() error {
+
+	apiServer, apiServerError := apiManager.Server()
+
+	if apiServerError != nil {
+		return apiServerError
+	}
+
+	logrus.Info("Api listening on " + apiManager.config.ApiListen)
+
+	return apiServer.ListenAndServe()
+}
@@ -0,0 +1,324 @@
+package managers
+
+import (
+	"errors"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"sort"
+	"strings"
+	"time"
+)
+
+type AttributionRow struct {
+	Name            string
+	PortfolioWeight float64
+	BenchmarkWeight float64
+	Contribution    float64
+	Allocation      float64
+	Selection       float64
+	Interaction     float64
+}
+
+type AttributionReport struct {
+	Period          string
+	Start           time.Time
+	End             time.Time
+	PortfolioReturn float64
+	BenchmarkReturn float64
+	Symbols         []AttributionRow
+	Sectors         []AttributionRow
+}
+
+type attributionInput struct {
+	sector          string
+	portfolioWeight float64
+	benchmarkWeight float64
+	portfolioReturn float64
+	benchmarkReturn float64
+
+	// The gain over the interval as a share of the start value, the weight times the return unless the symbol was
+	// bought into during the interval
+	contribution float64
+}
+
+type AttributionManager struct {
+	databaseMgr    *DatabaseManager
+	performanceMgr *PerformanceManager
+}
+
+func CreateAttributionManager(databaseManager *DatabaseManager, performanceManager *PerformanceManager) *AttributionManager {
+
+	return &AttributionManager{
+		databaseMgr:    databaseManager,
+		performanceMgr: performanceManager,
+	}
+}
+
+// getIntervalInputs works out the weights and returns of each symbol between two holdings snapshots. A symbol sold out
+// during the interval ends at zero and one bought into starts at zero, the fill price stands in for the snapshot price
+// it is missing and the sale proceeds or the cost for its value
+func (attributionManager *AttributionManager) getIntervalInputs(startSnapshot dto.PortfolioSnapshotModel, endSnapshot dto.PortfolioSnapshotModel) (map[string]attributionInput, error) {
+
+	intervalInputs := map[string]attributionInput{}
+
+	startHoldings, startHoldingsError := attributionManager.databaseMgr.GetHoldingSnapshotsByPortfolioSnapshotID(startSnapshot.ID)
+
+	if startHoldingsError != nil {
+		return intervalInputs, startHoldingsError
+	}
+
+	endHoldings, endHoldingsError := attributionManager.databaseMgr.GetHoldingSnapshotsByPortfolioSnapshotID(endSnapshot.ID)
+
+	if endHoldingsError != nil {
+		return intervalInputs, endHoldingsError
+	}
+
+	fills, fillsError := attributionManager.databaseMgr.GetFillsBetween(startSnapshot.TakenAt, endSnapshot.TakenAt)
+
+	if fillsError != nil {
+		return intervalInputs, fillsError
+	}
+
+	// Money traded into a symbol during the interval is not part of its return
+	netTraded := map[string]float64{}
+	firstFillPrices := map[string]float64{}
+	lastFillPrices := map[string]float64{}
+
+	for _, fill := range fills {
+
+		if fill.Side == "buy" {
+			netTraded[fill.Symbol] = netTraded[fill.Symbol] + float64(fill.Amount)*fill.Price
+		} else {
+			netTraded[fill.Symbol] = netTraded[fill.Symbol] - float64(fill.Amount)*fill.Price
+		}
+
+		if _, firstFillExist := firstFillPrices[fill.Symbol]; firstFillExist == false {
+			firstFillPrices[fill.Symbol] = fill.Price
+		}
+
+		lastFillPrices[fill.Symbol] = fill.Price
+	}
+
+	startHoldingsBySymbol := map[string]dto.HoldingSnapshotModel{}
+	endHoldingsBySymbol := map[string]dto.HoldingSnapshotModel{}
+
+	for _, holding := range startHoldings {
+		startHoldingsBySymbol[holding.Symbol] = holding
+	}
+
+	for _, holding := range endHoldings {
+		endHoldingsBySymbol[holding.Symbol] = holding
+	}
+
+	totalStartValue := 0.0
+	totalDesiredPercentage := 0.0
+
+	for _, holding := range startHoldings {
+		totalStartValue = totalStartValue + holding.Value
+		totalDesiredPercentage = totalDesiredPercentage + holding.DesiredPercentage
+	}
+
+	if totalStartValue == 0 || totalDesiredPercentage == 0 {
+		return intervalInputs, nil
+	}
+
+	symbols := map[string]bool{}
+
+	for symbol := range startHoldingsBySymbol {
+		symbols[symbol] = true
+	}
+
+	for symbol := range endHoldingsBySymbol {
+		symbols[symbol] = true
+	}
+
+	for symbol := range symbols {
+
+		startHolding, startHoldingExist := startHoldingsBySymbol[symbol]
+		endHolding, endHoldingExist := endHoldingsBySymbol[symbol]
+
+		startPrice := startHolding.Price
+		endPrice := endHolding.Price
+
+		if startHoldingExist == false {
+			startPrice = firstFillPrices[symbol]
+		}
+
+		if endHoldingExist == false {
+			endPrice = lastFillPrices[symbol]
+		}
+
+		if startPrice == 0 || endPrice == 0 {
+			continue
+		}
+
+		sector := startHolding.Sector
+
+		if sector == "" {
+			sector = endHolding.Sector
+		}
+
+		if sector == "" {
+			sector = "Unassigned"
+		}
+
+		gain := endHolding.Value - startHolding.Value - netTraded[symbol]
+
+		benchmarkReturn := endPrice/startPrice - 1
+		portfolioReturn := benchmarkReturn
+
+		if startHolding.Value != 0 {
+			portfolioReturn = gain / startHolding.Value
+		} else if netTraded[symbol] > 0 {
+			portfolioReturn = gain / netTraded[symbol]
+		}
+
+		intervalInputs[symbol] = attributionInput{
+			sector:          sector,
+			portfolioWeight: startHolding.Value / totalStartValue,
+			benchmarkWeight: startHolding.DesiredPercentage / totalDesiredPercentage,
+			portfolioReturn: portfolioReturn,
+			benchmarkReturn: benchmarkReturn,
+			contribution:    gain / totalStartValue,
+		}
+	}
+
+	return intervalInputs, nil
+}
+
+// addBrinsonEffects adds the allocation, selection and interaction effects of a group against the benchmark total return.
+// Interaction is the rest of the contribution so the effects always add up to the active return, it equals the
+// active weight times the active return unless the group was bought into during the interval
+func addBrinsonEffects(row AttributionRow, input attributionInput, totalBenchmarkReturn float64) AttributionRow {
+
+	activeWeight := input.portfolioWeight - input.benchmarkWeight
+	selection := input.benchmarkWeight * (input.portfolioReturn - input.benchmarkReturn)
+
+	row.PortfolioWeight = row.PortfolioWeight + input.portfolioWeight
+	row.BenchmarkWeight = row.BenchmarkWeight + input.benchmarkWeight
+	row.Contribution = row.Contribution + input.contribution
+	row.Allocation = row.Allocation + activeWeight*(input.benchmarkReturn-totalBenchmarkReturn)
+	row.Selection = row.Selection + selection
+	row.Interaction = row.Interaction + input.contribution - input.portfolioWeight*input.benchmarkReturn - selection
+
+	return row
+}
+
+func finalizeAttributionRows(rows map[string]AttributionRow, intervals int) []AttributionRow {
+
+	finalRows := []AttributionRow{}
+
+	for name, row := range rows {
+		row.Name = name
+		row.PortfolioWeight = row.PortfolioWeight / float64(intervals) * 100
+		row.BenchmarkWeight = row.BenchmarkWeight / float64(intervals) * 100
+		row.Contribution = row.Contribution * 100
+		row.Allocation = row.Allocation * 100
+		row.Selection = row.Selection * 100
+		row.Interaction = row.Interaction * 100
+
+		finalRows = append(finalRows, row)
+	}
+
+	sort.Slice(finalRows, func(i, j int) bool {
+		return finalRows[i].Contribution > finalRows[j].Contribution
+	})
+
+	return finalRows
+}
+
+// GenerateAttributionReport sums the daily brinson effects over the period against the index targets
+func (attributionManager *AttributionManager) GenerateAttributionReport(period string) (AttributionReport, error) {
+
+	attributionReport := AttributionReport{Period: strings.ToUpper(period)}
+
+	periodStart, periodStartError := GetPeriodStart(period, time.Now())
+
+	if periodStartError != nil {
+		return attributionReport, periodStartError
+	}
+
+	dailySnapshots, dailySnapshotsError := attributionManager.performanceMgr.GetDailySnapshots(periodStart)
+
+	if dailySnapshotsError != nil {
+		return attributionReport, dailySnapshotsError
+	}
+
+	if len(dailySnapshots) < 2 {
+		return attributionReport, errors.New("not enough holdings snapshots in the period")
+	}
+
+	attributionReport.Start = dailySnapshots[0].TakenAt
+	attributionReport.End = dailySnapshots[len(dailySnapshots)-1].TakenAt
+
+	symbolRows := map[string]AttributionRow{}
+	sectorRows := map[string]AttributionRow{}
+	portfolioGrowth := 1.0
+	benchmarkGrowth := 1.0
+	intervals := 0
+
+	for i := 1; i < len(dailySnapshots); i++ {
+
+		intervalInputs, intervalInputsError := attributionManager.getIntervalInputs(dailySnapshots[i-1], dailySnapshots[i])
+
+		if intervalInputsError != nil {
+			return attributionReport, intervalInputsError
+		}
+
+		if len(intervalInputs) == 0 {
+			continue
+		}
+
+		sectorInputs := map[string]attributionInput{}
+		totalPortfolioReturn := 0.0
+		totalBenchmarkReturn := 0.0
+
+		for _, input := range intervalInputs {
+
+			totalPortfolioReturn = totalPortfolioReturn + input.contribution
+			totalBenchmarkReturn = totalBenchmarkReturn + input.benchmarkWeight*input.benchmarkReturn
+
+			// Sector returns are built up weighted and divided back out below
+			sectorInput := sectorInputs[input.sector]
+			sectorInput.portfolioWeight = sectorInput.portfolioWeight + input.portfolioWeight
+			sectorInput.benchmarkWeight = sectorInput.benchmarkWeight + input.benchmarkWeight
+			sectorInput.benchmarkReturn = sectorInput.benchmarkReturn + input.benchmarkWeight*input.benchmarkReturn
+			sectorInput.contribution = sectorInput.contribution + input.contribution
+			sectorInputs[input.sector] = sectorInput
+		}
+
+		for symbol, input := range intervalInputs {
+			symbolRows[symbol] = addBrinsonEffects(symbolRows[symbol], input, totalBenchmarkReturn)
+		}
+
+		for sector, input := range sectorInputs {
+
+			if input.benchmarkWeight != 0 {
+				input.benchmarkReturn = input.benchmarkReturn / input.benchmarkWeight
+			}
+
+			// A sector only bought into during the interval has no weight to divide by, its gain is all interaction
+			input.portfolioReturn = input.benchmarkReturn
+
+			if input.portfolioWeight != 0 {
+				input.portfolioReturn = input.contribution / input.portfolioWeight
+			}
+
+			sectorRows[sector] = addBrinsonEffects(sectorRows[sector], input, totalBenchmarkReturn)
+		}
+
+		portfolioGrowth = portfolioGrowth * (1 + totalPortfolioReturn)
+		benchmarkGrowth = benchmarkGrowth * (1 + totalBenchmarkReturn)
+		intervals = intervals + 1
+	}
+
+	if intervals == 0 {
+		return attributionReport, errors.New("not enough holdings snapshots in the period")
+	}
+
+	attributionReport.PortfolioReturn = (portfolioGrowth - 1) * 100
+	attributionReport.BenchmarkReturn = (benchmarkGrowth - 1) * 100
+	attributionReport.Symbols = finalizeAttributionRows(symbolRows, intervals)
+	attributionReport.Sectors = finalizeAttributionRows(sectorRows, intervals)
+
+	return attributionReport, nil
+}
@@ -0,0 +1,174 @@
+package managers
+
+import (
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/util"
+	"math"
+	"testing"
+	"time"
+)
+
+type attributionTestHolding struct {
+	symbol  string
+	amount  int64
+	price   float64
+	desired float64
+}
+
+type attributionTestFill struct {
+	symbol string
+	side   string
+	amount int64
+	price  float64
+}
+
+// createAttributionSnapshot saves a portfolio snapshot with no cash worth exactly its holdings
+func createAttributionSnapshot(t *testing.T, databaseManager *DatabaseManager, takenAt time.Time, holdings []attributionTestHolding) float64 {
+
+	t.Helper()
+
+	totalValue := 0.0
+
+	for _, holding := range holdings {
+		totalValue = totalValue + float64(holding.amount)*holding.price
+	}
+
+	portfolioSnapshot, portfolioSnapshotError := databaseManager.CreatePortfolioSnapshotModel(dto.PortfolioSnapshotModel{Value: totalValue, TakenAt: takenAt})
+
+	if portfolioSnapshotError != nil {
+		t.Fatal(portfolioSnapshotError)
+	}
+
+	for _, holding := range holdings {
+
+		_, holdingError := databaseManager.CreateHoldingSnapshotModel(dto.HoldingSnapshotModel{
+			PortfolioSnapshotID: portfolioSnapshot.ID,
+			Symbol:              holding.symbol,
+			Sector:              "Sector " + holding.symbol,
+			Amount:              holding.amount,
+			Price:               holding.price,
+			Value:               float64(holding.amount) * holding.price,
+			DesiredPercentage:   holding.desired,
+			TakenAt:             takenAt,
+		})
+
+		if holdingError != nil {
+			t.Fatal(holdingError)
+		}
+	}
+
+	return totalValue
+}
+
+func TestGenerateAttributionReport(t *testing.T) {
+
+	testCases := []struct {
+		name           string
+		startHoldings  []attributionTestHolding
+		fills          []attributionTestFill
+		endHoldings    []attributionTestHolding
+		portfolioTotal float64
+	}{
+		{
+			name:           "no trades",
+			startHoldings:  []attributionTestHolding{{"VTI", 10, 100, 50}, {"BND", 10, 100, 50}},
+			endHoldings:    []attributionTestHolding{{"VTI", 10, 110, 50}, {"BND", 10, 95, 50}},
+			portfolioTotal: 2.5,
+		},
+		{
+			name:           "symbol sold out",
+			startHoldings:  []attributionTestHolding{{"VTI", 10, 100, 50}, {"BND", 10, 100, 50}},
+			fills:          []attributionTestFill{{"VTI", "sell", 10, 110}, {"BND", "buy", 10, 110}},
+			endHoldings:    []attributionTestHolding{{"BND", 20, 105, 50}},
+			portfolioTotal: 5,
+		},
+		{
+			name:           "symbol bought into",
+			startHoldings:  []attributionTestHolding{{"VTI", 10, 100, 50}, {"BND", 10, 100, 50}},
+			fills:          []attributionTestFill{{"VTI", "sell", 5, 100}, {"VXUS", "buy", 5, 100}},
+			endHoldings:    []attributionTestHolding{{"VTI", 5, 100, 50}, {"BND", 10, 100, 50}, {"VXUS", 5, 120, 0}},
+			portfolioTotal: 5,
+		},
+		{
+			name:           "symbol sold out and another bought into",
+			startHoldings:  []attributionTestHolding{{"VTI", 10, 100, 50}, {"BND", 10, 100, 50}},
+			fills:          []attributionTestFill{{"VTI", "sell", 10, 110}, {"VXUS", "buy", 10, 110}},
+			endHoldings:    []attributionTestHolding{{"BND", 10, 105, 50}, {"VXUS", 10, 120, 0}},
+			portfolioTotal: 12.5,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			startedAt := time.Now().AddDate(0, 0, -2)
+			endedAt := time.Now().AddDate(0, 0, -1)
+
+			startValue := createAttributionSnapshot(t, databaseManager, startedAt, testCase.startHoldings)
+
+			for _, fill := range testCase.fills {
+
+				_, fillError := databaseManager.CreateFillModel(dto.FillModel{
+					Symbol:   fill.symbol,
+					Side:     fill.side,
+					Amount:   fill.amount,
+					Price:    fill.price,
+					FilledAt: startedAt.Add(time.Hour),
+				})
+
+				if fillError != nil {
+					t.Fatal(fillError)
+				}
+			}
+
+			endValue := createAttributionSnapshot(t, databaseManager, endedAt, testCase.endHoldings)
+
+			attributionManager := CreateAttributionManager(databaseManager, CreatePerformanceManager(databaseManager, nil))
+
+			attributionReport, reportError := attributionManager.GenerateAttributionReport("1M")
+
+			if reportError != nil {
+				t.Fatal(reportError)
+			}
+
+			timeWeightedReturn := util.GetTimeWeightedReturn(util.GetPeriodReturns([]float64{startValue, endValue}, []float64{0, 0})) * 100
+
+			if math.Abs(attributionReport.PortfolioReturn-timeWeightedReturn) > 1e-9 || math.Abs(timeWeightedReturn-testCase.portfolioTotal) > 1e-9 {
+				t.Errorf("portfolio return = %v, the time weighted return is %v, want %v", attributionReport.PortfolioReturn, timeWeightedReturn, testCase.portfolioTotal)
+			}
+
+			for _, rows := range [][]AttributionRow{attributionReport.Symbols, attributionReport.Sectors} {
+
+				totalContribution := 0.0
+				totalEffects := 0.0
+
+				for _, row := range rows {
+					totalContribution = totalContribution + row.Contribution
+					totalEffects = totalEffects + row.Allocation + row.Selection + row.Interaction
+				}
+
+				if math.Abs(totalContribution-timeWeightedReturn) > 1e-9 {
+					t.Errorf("contributions add up to %v, want the time weighted return %v", totalContribution, timeWeightedReturn)
+				}
+
+				activeReturn := attributionReport.PortfolioReturn - attributionReport.BenchmarkReturn
+
+				if math.Abs(totalEffects-activeReturn) > 1e-9 {
+					t.Errorf("effects add up to %v, want the active return %v", totalEffects, activeReturn)
+				}
+			}
+
+			symbolCount := map[string]bool{}
+
+			for _, holding := range append(testCase.startHoldings, testCase.endHoldings...) {
+				symbolCount[holding.symbol] = true
+			}
+
+			if len(attributionReport.Symbols) != len(symbolCount) {
+				t.Errorf("report has %d symbols, want %d", len(attributionReport.Symbols), len(symbolCount))
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package managers
+
+import (
+	"errors"
+	"github.com/r4stl1n/condext/pkg/renderers"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/abiosoft/ishell.v2"
+	"strconv"
+)
+
+type BackupCommandManager struct {
+	backupMgr    *BackupManager
+	rebalanceMgr *RebalanceManager
+}
+
+func CreateBackupCommandManager(backupManager *BackupManager, rebalanceManager *RebalanceManager) *BackupCommandManager {
+
+	return &BackupCommandManager{
+		backupMgr:    backupManager,
+		rebalanceMgr: rebalanceManager,
+	}
+}
+
+func (backupCommandManager *BackupCommandManager) BackupCommand(c *ishell.Context) {
+
+	if len(c.Args) > 1 {
+		logrus.Warn("Too many parameters submitted")
+		return
+	}
+
+	label := BackupLabelManual
+
+	if len(c.Args) == 1 {
+		label = c.Args[0]
+	}
+
+	_, backupError := backupCommandManager.backupMgr.CreateBackup(label)
+
+	if backupError != nil {
+		logrus.Error(backupError.Error())
+	}
+}
+
+// Restore swaps the database under the running process so it is refused while the rebalance loop can write to it
+func (backupCommandManager *BackupCommandManager) Restore(backupName string) (string, error) {
+
+	if backupCommandManager.rebalanceMgr.IsRebalanceProcessRunning() == true {
+		return "", errors.New("stop the rebalance process with index_stop before restoring")
+	}
+
+	preRestorePath, restoreError := backupCommandManager.backupMgr.Restore(backupName)
+
+	if restoreError != nil {
+		return preRestorePath, restoreError
+	}
+
+	return preRestorePath, backupCommandManager.rebalanceMgr.ReloadConfig()
+}
+
+func (backupCommandManager *BackupCommandManager) RestoreCommand(c *ishell.Context) {
+
+	if len(c.Args) != 1 {
+		logrus.Warn("Not enough parameters submitted")
+		return
+	}
+
+	_, restoreError := backupCommandManager.Restore(c.Args[0])
+
+	if restoreError != nil {
+		logrus.Error(restoreError.Error())
+	}
+}
+
+func (backupCommandManager *BackupCommandManager) VerifyCommand(c *ishell.Context) {
+
+	problems, verifyError := backupCommandManager.backupMgr.Verify()
+
+	if verifyError != nil {
+		logrus.Error(verifyError.Error())
+		return
+	}
+
+	if len(problems) == 0 {
+		logrus.Info("Database verified, no problems found")
+		return
+	}
+
+	for _, element := range problems {
+		logrus.Error(element)
+	}
+}
+
+func BackupsView(backupFiles []BackupFile) renderers.View {
+
+	view := renderers.View{
+		Name: "Backups",
+		Columns: []renderers.ViewColumn{
+			{Key: "created_at", Title: "Created At"},
+			{Key: "label", Title: "Label"},
+			{Key: "size", Title: "Size"},
+			{Key: "path", Title: "Path"},
+		},
+	}
+
+	for _, element := range backupFiles {
+		view.Rows = append(view.Rows, []string{element.CreatedAt.Format("2006-01-02 15:04:05"), element.Label,
+			strconv.FormatInt(element.Size, 10), element.Path})
+	}
+
+	return view
+}
+
+func (backupCommandManager *BackupCommandManager) ShowBackupsCommand(c *ishell.Context) {
+
+	_, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	backupFiles, listError := backupCommandManager.backupMgr.ListBackups()
+
+	if listError != nil {
+		logrus.Error(listError.Error())
+		return
+	}
+
+	renderError := RenderView(BackupsView(backupFiles), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
@@ -0,0 +1,403 @@
+package managers
+
+import (
+	"errors"
+	"github.com/r4stl1n/condext/pkg/util"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BackupLabelManual       = "manual"
+	BackupLabelPreRebalance = "pre_rebalance"
+	BackupLabelPreRestore   = "pre_restore"
+)
+
+// Backups are named <database>-<label>-<timestamp>.db, the timestamp sorts in the order they were taken
+const backupTimeFormat = "20060102-150405"
+
+var backupLabelPattern = regexp.MustCompile("^[a-z0-9_]+$")
+
+type BackupFile struct {
+	Path      string
+	Label     string
+	CreatedAt time.Time
+	Size      int64
+}
+
+type BackupManager struct {
+	databaseMgr  *DatabaseManager
+	config       *util.ConfigStruct
+	databasePath string
+
+	postgresSnapshotWarned bool
+}
+
+func CreateBackupManager(databaseManager *DatabaseManager, config *util.ConfigStruct, databasePath string) *BackupManager {
+
+	return &BackupManager{
+		databaseMgr:  databaseManager,
+		config:       config,
+		databasePath: databasePath,
+	}
+}
+
+// checkSqlite refuses backups of a postgres database, it is backed up and restored with pg_dump and pg_restore
+func (backupManager *BackupManager) checkSqlite() error {
+
+	if backupManager.databaseMgr.dialect == util.DatabaseDialectPostgres {
+		return errors.New("condext only backs up sqlite databases, use pg_dump and pg_restore for postgres")
+	}
+
+	return nil
+}
+
+func (backupManager *BackupManager) backupPrefix() string {
+
+	databaseName := filepath.Base(backupManager.databasePath)
+
+	return strings.TrimSuffix(databaseName, filepath.Ext(databaseName)) + "-"
+}
+
+// CreateBackup copies the database into the backup directory and drops the oldest backups with the same label
+func (backupManager *BackupManager) CreateBackup(label string) (string, error) {
+
+	sqliteError := backupManager.checkSqlite()
+
+	if sqliteError != nil {
+		return "", sqliteError
+	}
+
+	if backupLabelPattern.MatchString(label) == false {
+		return "", errors.New("backup label can only use lower case letters, digits and underscores")
+	}
+
+	mkdirError := os.MkdirAll(backupManager.config.BackupDirectory(), 0700)
+
+	if mkdirError != nil {
+		return "", mkdirError
+	}
+
+	backupPath := filepath.Join(backupManager.config.BackupDirectory(),
+		backupManager.backupPrefix()+label+"-"+time.Now().Format(backupTimeFormat)+".db")
+
+	backupError := backupManager.databaseMgr.BackupTo(backupPath)
+
+	if backupError != nil {
+		return "", backupError
+	}
+
+	logrus.Info("Backed up the database to " + backupPath)
+
+	pruneError := backupManager.pruneBackups(label)
+
+	if pruneError != nil {
+		// The new backup is there, only the old ones are left behind
+		logrus.Warn("Could not remove old " + label + " backups, " + pruneError.Error())
+	}
+
+	return backupPath, nil
+}
+
+// ListBackups returns the backups of this database, newest first
+func (backupManager *BackupManager) ListBackups() ([]BackupFile, error) {
+
+	sqliteError := backupManager.checkSqlite()
+
+	if sqliteError != nil {
+		return nil, sqliteError
+	}
+
+	backupPaths, globError := filepath.Glob(filepath.Join(backupManager.config.BackupDirectory(), backupManager.backupPrefix()+"*.db"))
+
+	if globError != nil {
+		return nil, globError
+	}
+
+	backupFiles := []BackupFile{}
+
+	for _, backupPath := range backupPaths {
+
+		backupName := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(backupPath), backupManager.backupPrefix()), ".db")
+
+		// Anything that does not end in -<timestamp> was not written by CreateBackup
+		if len(backupName) <= len(backupTimeFormat)+1 {
+			continue
+		}
+
+		createdAt, parseError := time.ParseInLocation(backupTimeFormat, backupName[len(backupName)-len(backupTimeFormat):], time.Local)
+
+		if parseError != nil {
+			continue
+		}
+
+		backupLabel := backupName[:len(backupName)-len(backupTimeFormat)-1]
+
+		// data-live.db backups also match the data.db prefix, their label has a dash in it
+		if backupLabelPattern.MatchString(backupLabel) == false {
+			continue
+		}
+
+		fileInfo, statError := os.Stat(backupPath)
+
+		if statError != nil {
+			continue
+		}
+
+		backupFiles = append(backupFiles, BackupFile{
+			Path:      backupPath,
+			Label:     backupLabel,
+			CreatedAt: createdAt,
+			Size:      fileInfo.Size(),
+		})
+	}
+
+	sort.SliceStable(backupFiles, func(i, j int) bool {
+		return backupFiles[i].CreatedAt.After(backupFiles[j].CreatedAt)
+	})
+
+	return backupFiles, nil
+}
+
+func (backupManager *BackupManager) pruneBackups(label string) error {
+
+	retention := backupManager.config.BackupRetention()
+
+	if retention == 0 {
+		return nil
+	}
+
+	backupFiles, listError := backupManager.ListBackups()
+
+	if listError != nil {
+		return listError
+	}
+
+	keptBackups := 0
+
+	for _, element := range backupFiles {
+
+		if element.Label != label {
+			continue
+		}
+
+		keptBackups = keptBackups + 1
+
+		if keptBackups <= retention {
+			continue
+		}
+
+		removeError := os.Remove(element.Path)
+
+		if removeError != nil {
+			return removeError
+		}
+
+		logrus.Debug("Removed old backup " + element.Path)
+	}
+
+	return nil
+}
+
+// SnapshotBeforeRebalance takes the pre-rebalance backup unless it is turned off, postgres has its own tooling
+func (backupManager *BackupManager) SnapshotBeforeRebalance() error {
+
+	if backupManager.config.BackupBeforeRebalance() == false {
+		return nil
+	}
+
+	if backupManager.databaseMgr.dialect == util.DatabaseDialectPostgres {
+
+		// Once per process, the rebalance still runs without the snapshot
+		if backupManager.postgresSnapshotWarned == false {
+			logrus.Warn("No pre-rebalance backup is taken of a postgres database, back it up with pg_dump or set Backup.BeforeRebalance to false")
+			backupManager.postgresSnapshotWarned = true
+		}
+
+		return nil
+	}
+
+	_, backupError := backupManager.CreateBackup(BackupLabelPreRebalance)
+
+	return backupError
+}
+
+// ResolveBackupPath accepts a path or the name of a file in the backup directory
+func (backupManager *BackupManager) ResolveBackupPath(backupName string) string {
+
+	_, statError := os.Stat(backupName)
+
+	if statError == nil {
+		return backupName
+	}
+
+	return filepath.Join(backupManager.config.BackupDirectory(), backupName)
+}
+
+// Restore checks the backup, keeps a pre_restore copy of the current database and then replaces it with the backup,
+// it returns the path of the pre_restore copy
+func (backupManager *BackupManager) Restore(backupName string) (string, error) {
+
+	sqliteError := backupManager.checkSqlite()
+
+	if sqliteError != nil {
+		return "", sqliteError
+	}
+
+	backupPath := backupManager.ResolveBackupPath(backupName)
+
+	schemaVersion, problems, inspectError := InspectBackup(backupPath)
+
+	if inspectError != nil {
+		return "", inspectError
+	}
+
+	if len(problems) > 0 {
+		return "", errors.New(backupPath + " fails the integrity check, " + strings.Join(problems, ", "))
+	}
+
+	if schemaVersion > LatestSchemaVersion() {
+		return "", errors.New(backupPath + " has schema version " + strconv.FormatInt(schemaVersion, 10) + ", newer than the " +
+			strconv.FormatInt(LatestSchemaVersion(), 10) + " this build supports")
+	}
+
+	preRestorePath, preRestoreError := backupManager.CreateBackup(BackupLabelPreRestore)
+
+	if preRestoreError != nil {
+		return "", errors.New("could not back up the current database before restoring, " + preRestoreError.Error())
+	}
+
+	restoreError := backupManager.databaseMgr.RestoreFrom(backupPath)
+
+	if restoreError != nil {
+		return preRestorePath, errors.New("restore failed, the previous database is in " + preRestorePath + ", " + restoreError.Error())
+	}
+
+	// Backups from an older build are brought up to the current schema
+	_, migrateError := backupManager.databaseMgr.Migrate()
+
+	if migrateError != nil {
+		return preRestorePath, migrateError
+	}
+
+	logrus.Info("Restored the database from " + backupPath + ", the previous database is in " + preRestorePath)
+
+	return preRestorePath, nil
+}
+
+// Verify runs the database integrity check and cross-checks the index, an empty list means nothing was found
+func (backupManager *BackupManager) Verify() ([]string, error) {
+
+	integrityProblems, integrityError := backupManager.databaseMgr.IntegrityProblems()
+
+	if integrityError != nil {
+		return nil, integrityError
+	}
+
+	problems := []string{}
+
+	for _, element := range integrityProblems {
+		problems = append(problems, "integrity check: "+element)
+	}
+
+	// A corrupt database can fail the queries below in ways that hide the real problem
+	if len(problems) > 0 {
+		return problems, nil
+	}
+
+	indexedSymbols, indexedSymbolsError := backupManager.databaseMgr.GetAllIndexedSymbols()
+
+	if indexedSymbolsError != nil {
+		return nil, indexedSymbolsError
+	}
+
+	seenSymbols := map[string]bool{}
+	totalDesiredPercentage := decimal.NewFromFloat(0)
+
+	for _, element := range indexedSymbols {
+
+		if seenSymbols[element.Symbol] == true {
+			problems = append(problems, element.Symbol+" is indexed more than once")
+			continue
+		}
+
+		seenSymbols[element.Symbol] = true
+
+		if element.DesiredPercentage < 0 {
+			problems = append(problems, element.Symbol+" has a negative desired percentage")
+		}
+
+		if element.Amount < 0 {
+			problems = append(problems, element.Symbol+" has a negative amount "+strconv.FormatInt(element.Amount, 10))
+		}
+
+		totalDesiredPercentage = totalDesiredPercentage.Add(decimal.NewFromFloat(element.DesiredPercentage))
+
+		openLots, openLotsError := backupManager.databaseMgr.GetOpenTaxLotsBySymbol(element.Symbol)
+
+		if openLotsError != nil {
+			return nil, openLotsError
+		}
+
+		openLotAmount := int64(0)
+
+		for _, lot := range openLots {
+			openLotAmount = openLotAmount + lot.RemainingAmount
+		}
+
+		// Holdings bought before lots were tracked have no lots, more lots than shares is always wrong
+		if openLotAmount > 0 && openLotAmount > element.Amount {
+			problems = append(problems, element.Symbol+" has "+strconv.FormatInt(openLotAmount, 10)+" shares in open tax lots but holds "+
+				strconv.FormatInt(element.Amount, 10))
+		}
+	}
+
+	// Each reweight rounds to two decimals so every symbol may add up to a hundredth
+	weightTolerance := decimal.NewFromFloat(0.01).Mul(decimal.NewFromInt(int64(len(indexedSymbols))))
+
+	if len(indexedSymbols) > 0 && totalDesiredPercentage.Sub(decimal.NewFromInt(100)).Abs().GreaterThan(weightTolerance) {
+		problems = append(problems, "desired percentages add up to "+totalDesiredPercentage.Round(2).String()+", not 100")
+	}
+
+	openIntents, openIntentsError := backupManager.databaseMgr.GetOpenOrderIntents("")
+
+	if openIntentsError != nil {
+		return nil, openIntentsError
+	}
+
+	for _, element := range openIntents {
+		problems = append(problems, "order "+element.ClientOrderId+" to "+element.Side+" "+strconv.FormatInt(element.Amount, 10)+" "+
+			element.Symbol+" is "+element.Status+" but not settled, it is settled by the order recovery")
+	}
+
+	eventManager := CreateEventManager(backupManager.databaseMgr)
+
+	chainProblems, chainError := eventManager.VerifyChain()
+
+	if chainError != nil {
+		return nil, chainError
+	}
+
+	for _, element := range chainProblems {
+		problems = append(problems, "event log: "+element)
+	}
+
+	_, replayDifferences, replayError := eventManager.CompareReplay()
+
+	if replayError != nil {
+		return nil, replayError
+	}
+
+	for _, element := range replayDifferences {
+		problems = append(problems, element.Symbol+" "+element.Field+" is "+element.Saved+" but the event log replays to "+element.Replayed)
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,71 @@
+package managers
+
+import (
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/util"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDesiredPercentages(t *testing.T) {
+
+	testCases := []struct {
+		name        string
+		percentages []float64
+		problem     string
+	}{
+		{"empty index", []float64{}, ""},
+		{"whole index", []float64{60, 40}, ""},
+		{"rounded reweight", []float64{33.33, 33.33, 33.33}, ""},
+		{"over by the rounding tolerance", []float64{50.01, 50}, ""},
+		{"under 100", []float64{50, 30}, "desired percentages add up to 80, not 100"},
+		{"over 100", []float64{70, 40}, "desired percentages add up to 110, not 100"},
+		{"under by more than the tolerance", []float64{49.97, 50}, "desired percentages add up to 99.97, not 100"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			for index, percentage := range testCase.percentages {
+
+				indexedSymbol, createError := databaseManager.CreateIndexSymbolModel(dto.IndexedSymbolModel{
+					Symbol:            "SYM" + strconv.Itoa(index),
+					DesiredPercentage: percentage,
+				})
+
+				if createError != nil {
+					t.Fatal(createError)
+				}
+
+				recordError := recordSymbolAdded(databaseManager, SourceShell, indexedSymbol)
+
+				if recordError != nil {
+					t.Fatal(recordError)
+				}
+			}
+
+			backupManager := CreateBackupManager(databaseManager, &util.ConfigStruct{}, "condext.db")
+
+			problems, verifyError := backupManager.Verify()
+
+			if verifyError != nil {
+				t.Fatal(verifyError)
+			}
+
+			percentageProblem := ""
+
+			for _, element := range problems {
+				if strings.HasPrefix(element, "desired percentages") == true {
+					percentageProblem = element
+				}
+			}
+
+			if percentageProblem != testCase.problem {
+				t.Errorf("Verify reported %q, want %q", percentageProblem, testCase.problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,900 @@
+package managers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/r4stl1n/condext/pkg/renderers"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Exit codes returned by the non interactive commands
+const (
+	CliExitOk      = 0
+	CliExitFailure = 1
+	CliExitUsage   = 2
+)
+
+type cliUsageError struct {
+	message string
+}
+
+func (usageError cliUsageError) Error() string {
+	return usageError.message
+}
+
+type cliCommand struct {
+	path       []string
+	shellName  string
+	usage      string
+	minArgs    int
+	maxArgs    int
+	flags      []string
+	valueFlags []string
+	readOnly   bool
+	skipLock   bool   // only flips a saved flag, has to work while a daemon holds the lock
+	writeFlag  string // a read only command that writes when this flag is given
+	run        func(args []string, flags map[string]string) error
+}
+
+type CliManager struct {
+	showCommandMgr  *ShowCommandManager
+	indexCommandMgr *IndexCommandManager
+	taxCommandMgr   *TaxCommandManager
+	riskCommandMgr  *RiskCommandManager
+	configCmdMgr    *ConfigCommandManager
+	eventCmdMgr     *EventCommandManager
+	rebalanceMgr    *RebalanceManager
+	performanceMgr  *PerformanceManager
+	attributionMgr  *AttributionManager
+	taxMgr          *TaxManager
+
+	commands []cliCommand
+}
+
+func CreateCliManager(showCommandManager *ShowCommandManager, indexCommandManager *IndexCommandManager, taxCommandManager *TaxCommandManager,
+	riskCommandManager *RiskCommandManager, configCommandManager *ConfigCommandManager, eventCommandManager *EventCommandManager, rebalanceManager *RebalanceManager, performanceManager *PerformanceManager, attributionManager *AttributionManager, taxManager *TaxManager) *CliManager {
+
+	cliManager := &CliManager{
+		showCommandMgr:  showCommandManager,
+		indexCommandMgr: indexCommandManager,
+		taxCommandMgr:   taxCommandManager,
+		riskCommandMgr:  riskCommandManager,
+		configCmdMgr:    configCommandManager,
+		eventCmdMgr:     eventCommandManager,
+		rebalanceMgr:    rebalanceManager,
+		performanceMgr:  performanceManager,
+		attributionMgr:  attributionManager,
+		taxMgr:          taxManager,
+	}
+
+	cliManager.commands = []cliCommand{
+		{path: []string{"index", "add"}, shellName: "index_add", usage: "index add <symbol> <percentage> [--locked]", minArgs: 2, maxArgs: 3, flags: []string{"locked", "json"}, run: cliManager.indexAdd},
+		{path: []string{"index", "gen"}, shellName: "index_gen", usage: "index gen", flags: []string{"json"}, run: cliManager.indexGen},
+		{path: []string{"index", "benchmark"}, shellName: "index_benchmark", usage: "index benchmark <symbol>", minArgs: 1, maxArgs: 1, flags: []string{"json"}, run: cliManager.indexBenchmark},
+		{path: []string{"index", "window"}, shellName: "index_trade_window", usage: "index window <start HH:MM> <end HH:MM> | off", minArgs: 1, maxArgs: 2, flags: []string{"json"}, run: cliManager.indexWindow},
+		{path: []string{"index", "sector"}, shellName: "index_sector", usage: "index sector <symbol> <sector>", minArgs: 2, maxArgs: -1, flags: []string{"json"}, run: cliManager.indexSector},
+		{path: []string{"index", "status"}, shellName: "index_status", usage: "index status [--json] [--format table|json|csv|markdown] [--output file]", flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.indexStatus},
+		{path: []string{"show", "index"}, shellName: "show_index", usage: "show index [--json] [--format table|json|csv|markdown] [--output file]", flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.showIndex},
+		{path: []string{"show", "stats"}, shellName: "show_stats", usage: "show stats [--json] [--format table|json|csv|markdown] [--output file]", flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.showStats},
+		{path: []string{"show", "config"}, shellName: "show_config", usage: "show config [--json] [--format table|json|csv|markdown] [--output file]", flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.showConfig},
+		{path: []string{"show", "trades"}, shellName: "show_trades", usage: "show trades [limit] [--json] [--format table|json|csv|markdown] [--output file]", maxArgs: 1, flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.showTrades},
+		{path: []string{"show", "performance"}, shellName: "show_performance", usage: "show performance [period] [--json] [--format table|json|csv|markdown] [--output file]", maxArgs: 1, flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.showPerformance},
+		{path: []string{"show", "benchmark"}, shellName: "show_benchmark", usage: "show benchmark [period] [--json] [--format table|json|csv|markdown] [--output file]", maxArgs: 1, flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.showBenchmark},
+		{path: []string{"show", "attribution"}, shellName: "show_attribution", usage: "show attribution [period] [csv file] [--json] [--format table|json|csv|markdown] [--output file]", maxArgs: 2, flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.showAttribution},
+		{path: []string{"rebalance", "plan"}, usage: "rebalance plan [--json] [--format table|json|csv|markdown] [--output file]", flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.rebalancePlan},
+		{path: []string{"rebalance", "run"}, usage: "rebalance run", flags: []string{"json"}, run: cliManager.rebalanceRun},
+		{path: []string{"tax", "substitute", "add"}, shellName: "tax_substitute_add", usage: "tax substitute add <symbol> <substitute>", minArgs: 2, maxArgs: 2, flags: []string{"json"}, run: cliManager.taxSubstituteAdd},
+		{path: []string{"tax", "harvest", "scan"}, shellName: "tax_harvest_scan", usage: "tax harvest scan [--json]", flags: []string{"json"}, readOnly: true, run: cliManager.taxHarvestScan},
+		{path: []string{"tax", "harvest", "run"}, shellName: "tax_harvest_run", usage: "tax harvest run [--json]", flags: []string{"json"}, run: cliManager.taxHarvestRun},
+		{path: []string{"tax", "impact"}, shellName: "show_tax_impact", usage: "tax impact [--json] [--format table|json|csv|markdown] [--output file]", flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.taxImpact},
+		{path: []string{"tax", "report"}, shellName: "tax_report", usage: "tax report <year> <csv file> [--json]", minArgs: 2, maxArgs: 2, flags: []string{"json"}, readOnly: true, run: cliManager.taxReport},
+		{path: []string{"risk", "halt"}, shellName: "risk_halt", usage: "risk halt [reason]", maxArgs: -1, flags: []string{"json"}, skipLock: true, run: cliManager.riskHalt},
+		{path: []string{"risk", "resume"}, shellName: "risk_resume", usage: "risk resume", flags: []string{"json"}, skipLock: true, run: cliManager.riskResume},
+		{path: []string{"risk", "limit"}, shellName: "risk_limit", usage: "risk limit <order_notional|daily_notional|position_weight|price_deviation> <value>", minArgs: 2, maxArgs: 2, flags: []string{"json"}, run: cliManager.riskLimit},
+		{path: []string{"show", "risk"}, shellName: "show_risk", usage: "show risk [--json] [--format table|json|csv|markdown] [--output file]", flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.showRisk},
+		{path: []string{"config", "set"}, shellName: "config_set", usage: "config set <rebalance_threshold|order_timeout|rebalance_frequency|starting_balance> <value>", minArgs: 2, maxArgs: 2, flags: []string{"json"}, run: cliManager.configSet},
+		{path: []string{"config", "history"}, shellName: "config_history", usage: "config history [limit] [--json] [--format table|json|csv|markdown] [--output file]", maxArgs: 1, flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.configHistory},
+		{path: []string{"show", "rejections"}, shellName: "show_risk_rejections", usage: "show rejections [limit] [--json] [--format table|json|csv|markdown] [--output file]", maxArgs: 1, flags: []string{"json"}, valueFlags: []string{"format", "output"}, readOnly: true, run: cliManager.showRejections},
+		{path: []string{"show", "events"}, shellName: "show_events", usage: "show events [limit] [--type t] [--symbol s] [--actor a] [--since YYYY-MM-DD] [--json] [--format table|json|csv|markdown] [--output file]", maxArgs: 1, flags: []string{"json"}, valueFlags: []string{"type", "symbol", "actor", "since", "format", "output"}, readOnly: true, run: cliManager.showEvents},
+		{path: []string{"events", "replay"}, shellName: "events_replay", usage: "events replay [--apply] [--json] [--format table|json|csv|markdown] [--output file]", flags: []string{"apply", "json"}, valueFlags: []string{"format", "output"}, readOnly: true, writeFlag: "apply", run: cliManager.eventsReplay},
+	}
+
+	return cliManager
+}
+
+func writeCliJson(body interface{}) error {
+
+	marshaledBody, marshaledBodyError := json.MarshalIndent(body, "", "  ")
+
+	if marshaledBodyError != nil {
+		return marshaledBodyError
+	}
+
+	fmt.Println(string(marshaledBody))
+
+	return nil
+}
+
+// writeCliMessage logs the message for people and prints it as json for scripts
+func writeCliMessage(message string, flags map[string]string) error {
+
+	if flags["json"] != "" {
+		return writeCliJson(apiMessage{Message: message})
+	}
+
+	logrus.Info(message)
+
+	return nil
+}
+
+func (cliManager *CliManager) indexAdd(args []string, flags map[string]string) error {
+
+	symbolPercentage, symbolPercentageError := decimal.NewFromString(args[1])
+
+	if symbolPercentageError != nil {
+		return cliUsageError{message: "percentage must be a number"}
+	}
+
+	symbolLocked := flags["locked"] != ""
+
+	// The shell form takes locked as a third argument
+	if len(args) == 3 {
+
+		parsedLocked, parsedLockedError := strconv.ParseBool(args[2])
+
+		if parsedLockedError != nil {
+			return cliUsageError{message: "locked must be true or false"}
+		}
+
+		symbolLocked = symbolLocked || parsedLocked
+	}
+
+	indexedSymbol, addSymbolError := cliManager.indexCommandMgr.AddSymbolToIndex(args[0], symbolPercentage, symbolLocked, SourceCli)
+
+	if addSymbolError != nil {
+		return addSymbolError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(toApiIndexedSymbol(indexedSymbol))
+	}
+
+	logrus.Info("Symbol " + indexedSymbol.Symbol + " added to index")
+
+	return nil
+}
+
+func (cliManager *CliManager) indexGen(args []string, flags map[string]string) error {
+
+	generateError := cliManager.indexCommandMgr.GenerateIndex()
+
+	if generateError != nil {
+		return generateError
+	}
+
+	return writeCliMessage("Index generated", flags)
+}
+
+func (cliManager *CliManager) indexBenchmark(args []string, flags map[string]string) error {
+
+	benchmarkError := cliManager.indexCommandMgr.SetBenchmark(args[0], SourceCli)
+
+	if benchmarkError != nil {
+		return benchmarkError
+	}
+
+	return writeCliMessage("Index benchmark set to "+strings.ToUpper(args[0]), flags)
+}
+
+func (cliManager *CliManager) indexWindow(args []string, flags map[string]string) error {
+
+	windowEnd := ""
+
+	if len(args) > 1 {
+		windowEnd = args[1]
+	}
+
+	windowError := cliManager.indexCommandMgr.SetTradeWindow(args[0], windowEnd, SourceCli)
+
+	if windowError != nil {
+		return windowError
+	}
+
+	return writeCliMessage(tradeWindowMessage(args[0], windowEnd), flags)
+}
+
+func (cliManager *CliManager) indexSector(args []string, flags map[string]string) error {
+
+	indexedSymbol, sectorError := cliManager.indexCommandMgr.SetSector(args[0], strings.Join(args[1:], " "), SourceCli)
+
+	if sectorError != nil {
+		return sectorError
+	}
+
+	return writeCliMessage("Symbol "+indexedSymbol.Symbol+" sector set to "+indexedSymbol.Sector, flags)
+}
+
+func (cliManager *CliManager) showIndex(args []string, flags map[string]string) error {
+
+	indexedSymbols, indexedSymbolsError := cliManager.showCommandMgr.GetIndex()
+
+	if indexedSymbolsError != nil {
+		return indexedSymbolsError
+	}
+
+	if flags["json"] != "" {
+
+		response := []apiIndexedSymbol{}
+
+		for _, element := range indexedSymbols {
+			response = append(response, toApiIndexedSymbol(element))
+		}
+
+		return writeCliJson(response)
+	}
+
+	return RenderView(IndexView(indexedSymbols), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) indexStatus(args []string, flags map[string]string) error {
+
+	rebalanceStatus, rebalanceStatusError := cliManager.indexCommandMgr.GetIndexStatus()
+
+	if rebalanceStatusError != nil {
+		return rebalanceStatusError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(toApiRebalanceStatus(rebalanceStatus))
+	}
+
+	return RenderView(IndexStatusView(rebalanceStatus), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) showStats(args []string, flags map[string]string) error {
+
+	indexStats, indexStatsError := cliManager.showCommandMgr.GetStats()
+
+	if indexStatsError != nil {
+		return indexStatsError
+	}
+
+	if flags["json"] != "" {
+
+		// A one shot command does not run the loop itself, the daemon that does saves its state
+		rebalanceStatus, rebalanceStatusError := cliManager.rebalanceMgr.GetRebalanceStatus()
+
+		if rebalanceStatusError != nil {
+			return rebalanceStatusError
+		}
+
+		return writeCliJson(apiStats{
+			AccountValue:     indexStats.AccountValue,
+			IndexedSymbols:   indexStats.IndexedSymbols,
+			RebalanceRunning: rebalanceStatus.Mode == "running" || rebalanceStatus.SavedMode == "running",
+		})
+	}
+
+	return RenderView(StatsView(indexStats), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) showConfig(args []string, flags map[string]string) error {
+
+	configModel, configModelError := cliManager.showCommandMgr.GetConfig()
+
+	if configModelError != nil {
+		return configModelError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(toApiConfig(configModel))
+	}
+
+	return RenderView(ConfigView(configModel), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) showTrades(args []string, flags map[string]string) error {
+
+	limit := 25
+
+	if len(args) > 0 {
+
+		parsedLimit, parsedLimitError := strconv.Atoi(args[0])
+
+		if parsedLimitError != nil || parsedLimit <= 0 {
+			return cliUsageError{message: "limit must be a positive number"}
+		}
+
+		limit = parsedLimit
+	}
+
+	fills, fillsError := cliManager.showCommandMgr.GetTrades(limit)
+
+	if fillsError != nil {
+		return fillsError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(toApiTrades(fills))
+	}
+
+	return RenderView(TradesView(fills), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) showPerformance(args []string, flags map[string]string) error {
+
+	performanceReport, performanceReportError := cliManager.performanceMgr.GeneratePerformanceReport(getPeriodArg(args))
+
+	if performanceReportError != nil {
+		return performanceReportError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(performanceReport)
+	}
+
+	return RenderView(PerformanceView(performanceReport), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) showBenchmark(args []string, flags map[string]string) error {
+
+	benchmarkReport, benchmarkReportError := cliManager.performanceMgr.GenerateBenchmarkReport(getPeriodArg(args))
+
+	if benchmarkReportError != nil {
+		return benchmarkReportError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(benchmarkReport)
+	}
+
+	return RenderView(BenchmarkView(benchmarkReport), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) showAttribution(args []string, flags map[string]string) error {
+
+	attributionReport, attributionReportError := cliManager.attributionMgr.GenerateAttributionReport(getPeriodArg(args))
+
+	if attributionReportError != nil {
+		return attributionReportError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(attributionReport)
+	}
+
+	format := flags["format"]
+	outputFile := flags["output"]
+
+	// The csv file argument predates --format and is kept for existing scripts
+	if len(args) > 1 {
+		format = "csv"
+		outputFile = args[1]
+	}
+
+	return RenderView(AttributionView(attributionReport), format, outputFile)
+}
+
+func RebalancePlanView(plannedTrades []PlannedTrade) renderers.View {
+
+	view := renderers.View{
+		Name: "Rebalance plan",
+		Columns: []renderers.ViewColumn{
+			{Key: "symbol", Title: "Symbol"},
+			{Key: "side", Title: "Side"},
+			{Key: "amount", Title: "Amount"},
+			{Key: "price", Title: "Price"},
+			{Key: "percentage_difference", Title: "Drift %"},
+			{Key: "estimated_tax", Title: "Est. Tax"},
+			{Key: "deferred", Title: "Deferred"},
+			{Key: "defer_reason", Title: "Reason"},
+		},
+	}
+
+	for _, element := range plannedTrades {
+		view.Rows = append(view.Rows, []string{element.Symbol, element.Side, decimal.NewFromInt(element.Amount).String(),
+			decimal.NewFromFloat(element.Price).String(), decimal.NewFromFloat(element.PercentageDifference).String(),
+			decimal.NewFromFloat(element.TaxImpact.EstimatedTax).String(), strconv.FormatBool(element.Deferred), element.DeferReason})
+	}
+
+	return view
+}
+
+func (cliManager *CliManager) rebalancePlan(args []string, flags map[string]string) error {
+
+	plannedTrades, plannedTradesError := cliManager.rebalanceMgr.GenerateRebalancePlan()
+
+	if plannedTradesError != nil {
+		return plannedTradesError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(toApiPlannedTrades(plannedTrades))
+	}
+
+	return RenderView(RebalancePlanView(plannedTrades), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) rebalanceRun(args []string, flags map[string]string) error {
+
+	rebalanceError := cliManager.rebalanceMgr.RunRebalanceOnce()
+
+	if rebalanceError != nil {
+		return rebalanceError
+	}
+
+	return writeCliMessage("Rebalance completed", flags)
+}
+
+func (cliManager *CliManager) taxSubstituteAdd(args []string, flags map[string]string) error {
+
+	substituteError := cliManager.taxCommandMgr.AddSubstitute(args[0], args[1])
+
+	if substituteError != nil {
+		return substituteError
+	}
+
+	return writeCliMessage("Substitute "+strings.ToUpper(args[1])+" set for "+strings.ToUpper(args[0]), flags)
+}
+
+func (cliManager *CliManager) taxHarvestScan(args []string, flags map[string]string) error {
+
+	harvestProposals, harvestProposalsError := cliManager.taxMgr.ScanHarvestOpportunities()
+
+	if harvestProposalsError != nil {
+		return harvestProposalsError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(harvestProposals)
+	}
+
+	PrintHarvestProposals(harvestProposals)
+
+	return nil
+}
+
+func (cliManager *CliManager) taxHarvestRun(args []string, flags map[string]string) error {
+
+	harvestProposals, harvestError := cliManager.taxCommandMgr.RunHarvest()
+
+	if harvestError != nil {
+		return harvestError
+	}
+
+	return writeCliMessage("Harvested "+strconv.Itoa(len(harvestProposals))+" symbols", flags)
+}
+
+func (cliManager *CliManager) taxImpact(args []string, flags map[string]string) error {
+
+	plannedTrades, plannedTradesError := cliManager.rebalanceMgr.GenerateRebalancePlan()
+
+	if plannedTradesError != nil {
+		return plannedTradesError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(toApiPlannedTrades(plannedTrades))
+	}
+
+	return RenderView(TaxImpactView(plannedTrades), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) taxReport(args []string, flags map[string]string) error {
+
+	reportYear, reportYearError := strconv.Atoi(args[0])
+
+	if reportYearError != nil {
+		return cliUsageError{message: "year must be a number"}
+	}
+
+	realizedGains, reportError := cliManager.taxCommandMgr.WriteTaxReport(reportYear, args[1])
+
+	if reportError != nil {
+		return reportError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(realizedGains)
+	}
+
+	logrus.Info("Wrote " + strconv.Itoa(len(realizedGains)) + " closed lots to " + args[1])
+
+	PrintTaxReportSummary(reportYear, realizedGains)
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+
+	for _, element := range values {
+		if element == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findCommand matches the words of a command or its shell name and returns the remaining arguments
+func (cliManager *CliManager) findCommand(args []string) (cliCommand, []string, bool) {
+
+	for _, command := range cliManager.commands {
+
+		if command.shellName != "" && args[0] == command.shellName {
+			return command, args[1:], true
+		}
+
+		if len(args) < len(command.path) {
+			continue
+		}
+
+		matched := true
+
+		for index, word := range command.path {
+			if args[index] != word {
+				matched = false
+				break
+			}
+		}
+
+		if matched == true {
+			return command, args[len(command.path):], true
+		}
+	}
+
+	return cliCommand{}, nil, false
+}
+
+func (cliManager *CliManager) runCommand(args []string) error {
+
+	if len(args) == 0 {
+		return cliUsageError{message: "no command given"}
+	}
+
+	command, commandArgs, commandFound := cliManager.findCommand(args)
+
+	if commandFound == false {
+		return cliUsageError{message: "unknown command " + strings.Join(args, " ")}
+	}
+
+	positionalArgs := []string{}
+	flags := map[string]string{}
+
+	for index := 0; index < len(commandArgs); index++ {
+
+		arg := commandArgs[index]
+
+		if strings.HasPrefix(arg, "--") == false {
+			positionalArgs = append(positionalArgs, arg)
+			continue
+		}
+
+		flagName := strings.TrimPrefix(arg, "--")
+
+		if containsString(command.flags, flagName) == true {
+			flags[flagName] = "true"
+			continue
+		}
+
+		if containsString(command.valueFlags, flagName) == false {
+			return cliUsageError{message: "unknown flag " + arg + ", usage: " + command.usage}
+		}
+
+		if index+1 >= len(commandArgs) {
+			return cliUsageError{message: arg + " needs a value, usage: " + command.usage}
+		}
+
+		flags[flagName] = commandArgs[index+1]
+		index = index + 1
+	}
+
+	if len(positionalArgs) < command.minArgs || (command.maxArgs >= 0 && len(positionalArgs) > command.maxArgs) {
+		return cliUsageError{message: "usage: " + command.usage}
+	}
+
+	return command.run(positionalArgs, flags)
+}
+
+func getExitCode(commandError error) int {
+
+	if commandError == nil {
+		return CliExitOk
+	}
+
+	logrus.Error(commandError.Error())
+
+	if _, isUsageError := commandError.(cliUsageError); isUsageError == true {
+		return CliExitUsage
+	}
+
+	return CliExitFailure
+}
+
+// RunScript executes each line of the file as a command and stops at the first failure
+func (cliManager *CliManager) RunScript(fileName string) int {
+
+	scriptFile, scriptFileError := os.Open(fileName)
+
+	if scriptFileError != nil {
+		logrus.Error(scriptFileError.Error())
+		return CliExitFailure
+	}
+
+	defer scriptFile.Close()
+
+	scanner := bufio.NewScanner(scriptFile)
+	lineNumber := 0
+
+	for scanner.Scan() {
+
+		lineNumber = lineNumber + 1
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		logrus.Info(fileName + ":" + strconv.Itoa(lineNumber) + " " + line)
+
+		exitCode := getExitCode(cliManager.runCommand(strings.Fields(line)))
+
+		if exitCode != CliExitOk {
+			logrus.Error("Script stopped at " + fileName + ":" + strconv.Itoa(lineNumber))
+			return exitCode
+		}
+	}
+
+	if scanError := scanner.Err(); scanError != nil {
+		logrus.Error(scanError.Error())
+		return CliExitFailure
+	}
+
+	return CliExitOk
+}
+
+func (cliManager *CliManager) PrintUsage() {
+
+	fmt.Println("Usage: condext [--config file] [--env paper|live|sim] [--database file] [--log-level level] [command]")
+	fmt.Println()
+	fmt.Println("Without a command the interactive shell is started.")
+	fmt.Println("The config file is config.yaml, config.yml, config.toml or config.json unless --config or CONDEXT_CONFIG is set.")
+	fmt.Println("Broker credentials missing from the config are read from the secrets store as <environment>.alpaca_key and <environment>.alpaca_secret,")
+	fmt.Println("its passphrase comes from CONDEXT_SECRETS_PASSPHRASE, the file in CONDEXT_SECRETS_PASSPHRASE_FILE or a prompt.")
+	fmt.Println()
+	fmt.Println("Commands:")
+
+	for _, command := range cliManager.commands {
+		fmt.Println("  " + command.usage)
+	}
+
+	fmt.Println("  config validate [file]")
+	fmt.Println("  config init [file]")
+	fmt.Println("  secrets set <name> [file|-]")
+	fmt.Println("  secrets get <name>")
+	fmt.Println("  secrets list")
+	fmt.Println("  secrets rotate")
+	fmt.Println("  db migrate [--dry-run]")
+	fmt.Println("  db version")
+	fmt.Println("  db backup [label]")
+	fmt.Println("  db backups")
+	fmt.Println("  db restore <file>")
+	fmt.Println("  db verify")
+	fmt.Println("  daemon")
+	fmt.Println("  run-script <file>")
+	fmt.Println("  help")
+}
+
+// RequiresLock reports whether the command can trade or write so it has to hold the instance lock
+func (cliManager *CliManager) RequiresLock(args []string) bool {
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "--help" || args[0] == "-h" {
+		return false
+	}
+
+	command, _, commandFound := cliManager.findCommand(args)
+
+	if commandFound == false {
+		return args[0] == "run-script"
+	}
+
+	if command.writeFlag != "" && containsString(args, "--"+command.writeFlag) == true {
+		return true
+	}
+
+	return command.readOnly == false && command.skipLock == false
+}
+
+// CommandRequiresLock answers RequiresLock before the managers exist, looking a command up never runs it
+func CommandRequiresLock(args []string) bool {
+	return CreateCliManager(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil).RequiresLock(args)
+}
+
+// Execute runs a single command and returns the exit code for the process
+func (cliManager *CliManager) Execute(args []string) int {
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "--help" || args[0] == "-h" {
+		cliManager.PrintUsage()
+		return CliExitOk
+	}
+
+	if args[0] == "run-script" {
+
+		if len(args) != 2 {
+			logrus.Error("usage: run-script <file>")
+			return CliExitUsage
+		}
+
+		return cliManager.RunScript(args[1])
+	}
+
+	return getExitCode(cliManager.runCommand(args))
+}
+
+func (cliManager *CliManager) riskHalt(args []string, flags map[string]string) error {
+
+	haltError := cliManager.riskCommandMgr.Halt(strings.Join(args, " "), SourceCli)
+
+	if haltError != nil {
+		return haltError
+	}
+
+	return writeCliMessage("Trading halted", flags)
+}
+
+func (cliManager *CliManager) riskResume(args []string, flags map[string]string) error {
+
+	resumeError := cliManager.riskCommandMgr.Resume(SourceCli)
+
+	if resumeError != nil {
+		return resumeError
+	}
+
+	return writeCliMessage("Trading resumed", flags)
+}
+
+func (cliManager *CliManager) riskLimit(args []string, flags map[string]string) error {
+
+	limitError := cliManager.riskCommandMgr.SetLimit(args[0], args[1], SourceCli)
+
+	if limitError != nil {
+		return cliUsageError{message: limitError.Error()}
+	}
+
+	return writeCliMessage("Risk limit "+strings.ToLower(args[0])+" set to "+args[1], flags)
+}
+
+func (cliManager *CliManager) showRisk(args []string, flags map[string]string) error {
+
+	riskState, configModel, riskStateError := cliManager.riskCommandMgr.GetRiskState()
+
+	if riskStateError != nil {
+		return riskStateError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(toApiRiskState(riskState, configModel))
+	}
+
+	return RenderView(RiskView(riskState, configModel), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) showRejections(args []string, flags map[string]string) error {
+
+	limit := 25
+
+	if len(args) > 0 {
+
+		parsedLimit, parsedLimitError := strconv.Atoi(args[0])
+
+		if parsedLimitError != nil || parsedLimit <= 0 {
+			return cliUsageError{message: "limit must be a positive number"}
+		}
+
+		limit = parsedLimit
+	}
+
+	riskRejections, riskRejectionsError := cliManager.riskCommandMgr.GetRejections(limit)
+
+	if riskRejectionsError != nil {
+		return riskRejectionsError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(toApiRiskRejections(riskRejections))
+	}
+
+	return RenderView(RiskRejectionsView(riskRejections), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) configSet(args []string, flags map[string]string) error {
+
+	setError := cliManager.configCmdMgr.SetValue(args[0], args[1], SourceCli)
+
+	if setError != nil {
+		return cliUsageError{message: setError.Error()}
+	}
+
+	return writeCliMessage("Config "+strings.ToLower(args[0])+" set to "+args[1], flags)
+}
+
+func (cliManager *CliManager) configHistory(args []string, flags map[string]string) error {
+
+	limit := 25
+
+	if len(args) > 0 {
+
+		parsedLimit, parsedLimitError := strconv.Atoi(args[0])
+
+		if parsedLimitError != nil || parsedLimit <= 0 {
+			return cliUsageError{message: "limit must be a positive number"}
+		}
+
+		limit = parsedLimit
+	}
+
+	configChanges, configChangesError := cliManager.configCmdMgr.GetHistory(limit)
+
+	if configChangesError != nil {
+		return configChangesError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(toApiConfigChanges(configChanges))
+	}
+
+	return RenderView(ConfigHistoryView(configChanges), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) showEvents(args []string, flags map[string]string) error {
+
+	filterArgs := append([]string{}, args...)
+
+	for _, filterName := range []string{"type", "symbol", "actor", "since"} {
+		if flags[filterName] != "" {
+			filterArgs = append(filterArgs, "--"+filterName, flags[filterName])
+		}
+	}
+
+	eventFilter, eventFilterError := ParseEventFilter(filterArgs)
+
+	if eventFilterError != nil {
+		return cliUsageError{message: eventFilterError.Error()}
+	}
+
+	eventModels, eventModelsError := cliManager.eventCmdMgr.GetEvents(eventFilter)
+
+	if eventModelsError != nil {
+		return eventModelsError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(toApiEvents(eventModels))
+	}
+
+	return RenderView(EventsView(eventModels), flags["format"], flags["output"])
+}
+
+func (cliManager *CliManager) eventsReplay(args []string, flags map[string]string) error {
+
+	replayDifferences, replayError := cliManager.eventCmdMgr.Replay(flags["apply"] != "", SourceCli)
+
+	if replayError != nil {
+		return replayError
+	}
+
+	if flags["json"] != "" {
+		return writeCliJson(replayDifferences)
+	}
+
+	if len(replayDifferences) == 0 {
+		return writeCliMessage("The index rebuilt from the event log matches the saved index", flags)
+	}
+
+	return RenderView(ReplayView(replayDifferences), flags["format"], flags["output"])
+}
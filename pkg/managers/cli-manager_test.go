@@ -0,0 +1,32 @@
+package managers
+
+import (
+	"testing"
+)
+
+func TestCommandRequiresLock(t *testing.T) {
+
+	testCases := []struct {
+		name         string
+		args         []string
+		requiresLock bool
+	}{
+		{"tax report only reads", []string{"tax", "report", "2021", "gains.csv"}, false},
+		{"show stats only reads", []string{"show", "stats", "--json"}, false},
+		{"risk halt runs next to a daemon", []string{"risk", "halt"}, false},
+		{"index add writes", []string{"index", "add", "VTI", "50"}, true},
+		{"events replay reads", []string{"events", "replay"}, false},
+		{"events replay with apply writes", []string{"events", "replay", "--apply"}, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			requiresLock := CommandRequiresLock(testCase.args)
+
+			if requiresLock != testCase.requiresLock {
+				t.Errorf("CommandRequiresLock = %v, want %v", requiresLock, testCase.requiresLock)
+			}
+		})
+	}
+}
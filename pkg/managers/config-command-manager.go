@@ -0,0 +1,104 @@
+package managers
+
+import (
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/renderers"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/abiosoft/ishell.v2"
+	"strconv"
+	"strings"
+)
+
+type ConfigCommandManager struct {
+	configMgr *ConfigManager
+}
+
+func CreateConfigCommandManager(configManager *ConfigManager) *ConfigCommandManager {
+
+	return &ConfigCommandManager{
+		configMgr: configManager,
+	}
+}
+
+func (configCommandManager *ConfigCommandManager) SetValue(settingKey string, settingValue string, source string) error {
+	return configCommandManager.configMgr.SetValue(settingKey, settingValue, source)
+}
+
+func (configCommandManager *ConfigCommandManager) SetValueCommand(c *ishell.Context) {
+
+	if len(c.Args) != 2 {
+		logrus.Warn("Not enough parameters submitted")
+		return
+	}
+
+	setError := configCommandManager.SetValue(c.Args[0], c.Args[1], SourceShell)
+
+	if setError != nil {
+		logrus.Error(setError.Error())
+		return
+	}
+
+	logrus.Info("Config " + strings.ToLower(c.Args[0]) + " set to " + c.Args[1])
+}
+
+func (configCommandManager *ConfigCommandManager) GetHistory(limit int) ([]dto.ConfigChangeModel, error) {
+	return configCommandManager.configMgr.GetHistory(limit)
+}
+
+func ConfigHistoryView(configChanges []dto.ConfigChangeModel) renderers.View {
+
+	view := renderers.View{
+		Name: "Config history",
+		Columns: []renderers.ViewColumn{
+			{Key: "changed_at", Title: "Changed At"},
+			{Key: "key", Title: "Key"},
+			{Key: "old_value", Title: "Old Value"},
+			{Key: "new_value", Title: "New Value"},
+			{Key: "source", Title: "Source"},
+		},
+	}
+
+	for _, element := range configChanges {
+		view.Rows = append(view.Rows, []string{element.ChangedAt.Format("2006-01-02 15:04:05"), element.Key, element.OldValue,
+			element.NewValue, element.Source})
+	}
+
+	return view
+}
+
+func (configCommandManager *ConfigCommandManager) HistoryCommand(c *ishell.Context) {
+
+	positionalArgs, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	limit := 25
+
+	if len(positionalArgs) > 0 {
+
+		parsedLimit, parseError := strconv.Atoi(positionalArgs[0])
+
+		if parseError != nil || parsedLimit <= 0 {
+			logrus.Error("limit must be a positive number")
+			return
+		}
+
+		limit = parsedLimit
+	}
+
+	configChanges, configChangesError := configCommandManager.GetHistory(limit)
+
+	if configChangesError != nil {
+		logrus.Error(configChangesError.Error())
+		return
+	}
+
+	renderError := RenderView(ConfigHistoryView(configChanges), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
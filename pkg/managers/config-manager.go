@@ -0,0 +1,290 @@
+package managers
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/util"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configSetting is a value config_set may change, min and max are inclusive and a max of zero has no upper bound
+type configSetting struct {
+	key   string
+	isInt bool
+	min   float64
+	max   float64
+	get   func(configModel *dto.CondextConfigModel) float64
+	set   func(configModel *dto.CondextConfigModel, value float64)
+}
+
+var configSettings = []configSetting{
+	{
+		key: "rebalance_threshold", min: 0.01, max: 100,
+		get: func(configModel *dto.CondextConfigModel) float64 { return configModel.ReBalanceThreshold },
+		set: func(configModel *dto.CondextConfigModel, value float64) {
+			configModel.ReBalanceThreshold = value
+		},
+	},
+	{
+		key: "order_timeout", isInt: true, min: 1, max: 3600,
+		get: func(configModel *dto.CondextConfigModel) float64 { return float64(configModel.OrderTimeout) },
+		set: func(configModel *dto.CondextConfigModel, value float64) {
+			configModel.OrderTimeout = int64(value)
+		},
+	},
+	{
+		key: "rebalance_frequency", isInt: true, min: 1, max: 86400,
+		get: func(configModel *dto.CondextConfigModel) float64 { return float64(configModel.RebalanceFrequency) },
+		set: func(configModel *dto.CondextConfigModel, value float64) {
+			configModel.RebalanceFrequency = int64(value)
+		},
+	},
+	{
+		key: "starting_balance", min: 1,
+		get: func(configModel *dto.CondextConfigModel) float64 { return configModel.StartingBalance },
+		set: func(configModel *dto.CondextConfigModel, value float64) {
+			configModel.StartingBalance = value
+		},
+	},
+}
+
+// ConfigSettingKeys lists the keys config_set accepts
+func ConfigSettingKeys() []string {
+
+	settingKeys := []string{}
+
+	for _, element := range configSettings {
+		settingKeys = append(settingKeys, element.key)
+	}
+
+	return settingKeys
+}
+
+type ConfigManager struct {
+	databaseMgr  *DatabaseManager
+	rebalanceMgr *RebalanceManager
+}
+
+func CreateConfigManager(databaseManager *DatabaseManager, rebalanceManager *RebalanceManager) *ConfigManager {
+
+	return &ConfigManager{
+		databaseMgr:  databaseManager,
+		rebalanceMgr: rebalanceManager,
+	}
+}
+
+func parseConfigValue(setting configSetting, settingValue string) (float64, error) {
+
+	var parsedValue float64
+
+	if setting.isInt == true {
+
+		parsedInt, parseError := strconv.ParseInt(settingValue, 10, 64)
+
+		if parseError != nil {
+			return 0, errors.New(setting.key + " must be a whole number")
+		}
+
+		parsedValue = float64(parsedInt)
+	} else {
+
+		parsedFloat, parseError := strconv.ParseFloat(settingValue, 64)
+
+		if parseError != nil {
+			return 0, errors.New(setting.key + " must be a number")
+		}
+
+		parsedValue = parsedFloat
+	}
+
+	if parsedValue < setting.min || (setting.max > 0 && parsedValue > setting.max) {
+
+		rangeText := "at least " + decimal.NewFromFloat(setting.min).String()
+
+		if setting.max > 0 {
+			rangeText = "between " + decimal.NewFromFloat(setting.min).String() + " and " + decimal.NewFromFloat(setting.max).String()
+		}
+
+		return 0, errors.New(setting.key + " must be " + rangeText)
+	}
+
+	return parsedValue, nil
+}
+
+// saveChanges stores the updated config with a history row and an event per change and hands it to a running rebalance process
+func (configManager *ConfigManager) saveChanges(configModel dto.CondextConfigModel, configChanges []dto.ConfigChangeModel) error {
+
+	saveError := configManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		_, updateError := transactionManager.UpdateCondextConfig(configModel)
+
+		if updateError != nil {
+			return updateError
+		}
+
+		for _, element := range configChanges {
+
+			_, createError := transactionManager.CreateConfigChangeModel(element)
+
+			if createError != nil {
+				return createError
+			}
+
+			eventError := recordConfigChange(transactionManager, element.Source, element.Key, element.OldValue, element.NewValue)
+
+			if eventError != nil {
+				return eventError
+			}
+		}
+
+		return nil
+	})
+
+	if saveError != nil {
+		return saveError
+	}
+
+	return configManager.rebalanceMgr.ReloadConfig()
+}
+
+// SetValue validates and saves one setting, the source is recorded in the history
+func (configManager *ConfigManager) SetValue(settingKey string, settingValue string, source string) error {
+
+	settingKey = strings.ToLower(settingKey)
+
+	for _, setting := range configSettings {
+
+		if setting.key != settingKey {
+			continue
+		}
+
+		parsedValue, parseError := parseConfigValue(setting, settingValue)
+
+		if parseError != nil {
+			return parseError
+		}
+
+		configModel, configModelError := configManager.databaseMgr.GetCondextConfigModel()
+
+		if configModelError != nil {
+			return configModelError
+		}
+
+		oldValue := setting.get(&configModel)
+
+		if oldValue == parsedValue {
+			return errors.New(setting.key + " is already " + decimal.NewFromFloat(parsedValue).String())
+		}
+
+		setting.set(&configModel, parsedValue)
+
+		logrus.Info("Config " + setting.key + " changed from " + decimal.NewFromFloat(oldValue).String() + " to " + decimal.NewFromFloat(parsedValue).String())
+
+		return configManager.saveChanges(configModel, []dto.ConfigChangeModel{
+			{
+				Key:       setting.key,
+				OldValue:  decimal.NewFromFloat(oldValue).String(),
+				NewValue:  decimal.NewFromFloat(parsedValue).String(),
+				Source:    source,
+				ChangedAt: time.Now(),
+			},
+		})
+	}
+
+	return errors.New("unknown config key, use one of " + strings.Join(ConfigSettingKeys(), ", "))
+}
+
+func (configManager *ConfigManager) GetHistory(limit int) ([]dto.ConfigChangeModel, error) {
+	return configManager.databaseMgr.GetRecentConfigChanges(limit)
+}
+
+// ApplyConfigStruct copies the risk limits and rebalance policy set in the config file or CONDEXT_ variables over the
+// saved ones. A value is only copied when it differs from what the file set at an earlier startup, a setting changed
+// since with config_set, the shell or the API keeps its newer value until the file value is edited
+func (configManager *ConfigManager) ApplyConfigStruct(config *util.ConfigStruct) error {
+
+	configModel, configModelError := configManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return configModelError
+	}
+
+	configChanges := []dto.ConfigChangeModel{}
+
+	var lookupError error
+
+	applyValue := func(name string, oldValue string, newValue string) bool {
+
+		if lookupError != nil || oldValue == newValue {
+			return false
+		}
+
+		lastApplied, lastAppliedError := configManager.databaseMgr.GetLastConfigChange(name, SourceConfigFile)
+
+		if lastAppliedError != nil && gorm.IsRecordNotFoundError(lastAppliedError) == false {
+			lookupError = lastAppliedError
+			return false
+		}
+
+		if lastAppliedError == nil && lastApplied.NewValue == newValue {
+			logrus.Warn("Config file sets " + name + " to " + newValue + " but it was changed to " + oldValue +
+				" since, keeping " + oldValue + ", edit the file value to change it again")
+			return false
+		}
+
+		logrus.Info("Config file sets " + name)
+
+		configChanges = append(configChanges, dto.ConfigChangeModel{
+			Key:       name,
+			OldValue:  oldValue,
+			NewValue:  newValue,
+			Source:    SourceConfigFile,
+			ChangedAt: time.Now(),
+		})
+
+		return true
+	}
+
+	applyFloat := func(name string, value *float64, target *float64) {
+		if value != nil && applyValue(name, decimal.NewFromFloat(*target).String(), decimal.NewFromFloat(*value).String()) == true {
+			*target = *value
+		}
+	}
+
+	applyInt := func(name string, value *int64, target *int64) {
+		if value != nil && applyValue(name, strconv.FormatInt(*target, 10), strconv.FormatInt(*value, 10)) == true {
+			*target = *value
+		}
+	}
+
+	applyString := func(name string, value *string, target *string) {
+		if value != nil && applyValue(name, *target, *value) == true {
+			*target = *value
+		}
+	}
+
+	applyFloat("Risk.MaxOrderNotional", config.Risk.MaxOrderNotional, &configModel.MaxOrderNotional)
+	applyFloat("Risk.MaxDailyNotional", config.Risk.MaxDailyNotional, &configModel.MaxDailyNotional)
+	applyFloat("Risk.MaxPositionWeight", config.Risk.MaxPositionWeight, &configModel.MaxPositionWeight)
+	applyFloat("Risk.MaxPriceDeviation", config.Risk.MaxPriceDeviation, &configModel.MaxPriceDeviation)
+	applyFloat("Rebalance.Threshold", config.Rebalance.Threshold, &configModel.ReBalanceThreshold)
+	applyInt("Rebalance.Frequency", config.Rebalance.Frequency, &configModel.RebalanceFrequency)
+	applyInt("Rebalance.OrderTimeout", config.Rebalance.OrderTimeout, &configModel.OrderTimeout)
+	applyString("Rebalance.TradeWindowStart", config.Rebalance.TradeWindowStart, &configModel.TradeWindowStart)
+	applyString("Rebalance.TradeWindowEnd", config.Rebalance.TradeWindowEnd, &configModel.TradeWindowEnd)
+
+	if lookupError != nil {
+		return lookupError
+	}
+
+	if len(configChanges) == 0 {
+		return nil
+	}
+
+	return configManager.saveChanges(configModel, configChanges)
+}
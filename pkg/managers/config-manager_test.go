@@ -0,0 +1,143 @@
+package managers
+
+import (
+	"github.com/r4stl1n/condext/pkg/util"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func TestParseConfigValue(t *testing.T) {
+
+	settingsByKey := map[string]configSetting{}
+
+	for _, element := range configSettings {
+		settingsByKey[element.key] = element
+	}
+
+	testCases := []struct {
+		name   string
+		key    string
+		value  string
+		parsed float64
+		error  string
+	}{
+		{"threshold inside the range", "rebalance_threshold", "2.5", 2.5, ""},
+		{"threshold at the minimum", "rebalance_threshold", "0.01", 0.01, ""},
+		{"threshold at the maximum", "rebalance_threshold", "100", 100, ""},
+		{"threshold below the minimum", "rebalance_threshold", "0", 0, "rebalance_threshold must be between 0.01 and 100"},
+		{"threshold above the maximum", "rebalance_threshold", "100.5", 0, "rebalance_threshold must be between 0.01 and 100"},
+		{"threshold not a number", "rebalance_threshold", "high", 0, "rebalance_threshold must be a number"},
+		{"timeout whole number", "order_timeout", "30", 30, ""},
+		{"timeout fraction", "order_timeout", "30.5", 0, "order_timeout must be a whole number"},
+		{"timeout below the minimum", "order_timeout", "0", 0, "order_timeout must be between 1 and 3600"},
+		{"timeout above the maximum", "order_timeout", "3601", 0, "order_timeout must be between 1 and 3600"},
+		{"frequency at the maximum", "rebalance_frequency", "86400", 86400, ""},
+		{"frequency negative", "rebalance_frequency", "-1", 0, "rebalance_frequency must be between 1 and 86400"},
+		{"balance has no upper bound", "starting_balance", "1000000000", 1000000000, ""},
+		{"balance below the minimum", "starting_balance", "0.5", 0, "starting_balance must be at least 1"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			setting, settingFound := settingsByKey[testCase.key]
+
+			if settingFound == false {
+				t.Fatalf("no config setting %s", testCase.key)
+			}
+
+			parsed, parseError := parseConfigValue(setting, testCase.value)
+
+			if testCase.error != "" {
+
+				if parseError == nil || parseError.Error() != testCase.error {
+					t.Errorf("parseConfigValue error = %v, want %s", parseError, testCase.error)
+				}
+
+				return
+			}
+
+			if parseError != nil {
+				t.Fatal(parseError)
+			}
+
+			if parsed != testCase.parsed {
+				t.Errorf("parseConfigValue = %v, want %v", parsed, testCase.parsed)
+			}
+		})
+	}
+}
+
+func TestApplyConfigStruct(t *testing.T) {
+
+	type configStep struct {
+		source string
+		value  float64
+	}
+
+	testCases := []struct {
+		name        string
+		steps       []configStep
+		threshold   float64
+		fileChanges int
+	}{
+		{"first startup applies the file", []configStep{{SourceConfigFile, 2}}, 2, 1},
+		{"unchanged file is applied once", []configStep{{SourceConfigFile, 2}, {SourceConfigFile, 2}}, 2, 1},
+		{"value changed since is kept", []configStep{{SourceConfigFile, 2}, {SourceCli, 3}, {SourceConfigFile, 2}}, 3, 1},
+		{"edited file replaces a changed value", []configStep{{SourceConfigFile, 2}, {SourceCli, 3}, {SourceConfigFile, 4}}, 4, 2},
+		{"file set back to an earlier value", []configStep{{SourceConfigFile, 2}, {SourceConfigFile, 4}, {SourceConfigFile, 2}}, 2, 3},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			configManager := CreateConfigManager(databaseManager, CreateRebalanceManager(databaseManager, nil, nil, nil, nil, nil, nil, nil))
+
+			for _, step := range testCase.steps {
+
+				var stepError error
+
+				if step.source == SourceConfigFile {
+					threshold := step.value
+					stepError = configManager.ApplyConfigStruct(&util.ConfigStruct{Rebalance: util.RebalanceConfig{Threshold: &threshold}})
+				} else {
+					stepError = configManager.SetValue("rebalance_threshold", decimal.NewFromFloat(step.value).String(), step.source)
+				}
+
+				if stepError != nil {
+					t.Fatal(stepError)
+				}
+			}
+
+			configModel, configModelError := databaseManager.GetCondextConfigModel()
+
+			if configModelError != nil {
+				t.Fatal(configModelError)
+			}
+
+			if configModel.ReBalanceThreshold != testCase.threshold {
+				t.Errorf("threshold = %v, want %v", configModel.ReBalanceThreshold, testCase.threshold)
+			}
+
+			configChanges, configChangesError := databaseManager.GetRecentConfigChanges(100)
+
+			if configChangesError != nil {
+				t.Fatal(configChangesError)
+			}
+
+			fileChanges := 0
+
+			for _, element := range configChanges {
+				if element.Source == SourceConfigFile {
+					fileChanges = fileChanges + 1
+				}
+			}
+
+			if fileChanges != testCase.fileChanges {
+				t.Errorf("config file changed the threshold %d times, want %d", fileChanges, testCase.fileChanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package managers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/r4stl1n/condext/pkg/util"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// How often connected dashboards are sent a fresh state
+const dashboardUpdateInterval = 5 * time.Second
+
+type dashboardEquityPoint struct {
+	TakenAt time.Time `json:"takenAt"`
+	Value   float64   `json:"value"`
+}
+
+type dashboardHolding struct {
+	apiIndexedSymbol
+
+	Drift float64 `json:"drift"`
+}
+
+type dashboardState struct {
+	AccountValue       float64                `json:"accountValue"`
+	AccountValueError  string                 `json:"accountValueError,omitempty"`
+	RebalanceRunning   bool                   `json:"rebalanceRunning"`
+	RebalanceMode      string                 `json:"rebalanceMode"`
+	LastTickError      string                 `json:"lastTickError,omitempty"`
+	Active             bool                   `json:"active"`
+	ReBalanceThreshold float64                `json:"rebalanceThreshold"`
+	Holdings           []dashboardHolding     `json:"holdings"`
+	EquityCurve        []dashboardEquityPoint `json:"equityCurve"`
+	Trades             []apiTrade             `json:"trades"`
+	UpdatedAt          time.Time              `json:"updatedAt"`
+}
+
+type DashboardManager struct {
+	config         *util.ConfigStruct
+	showCommandMgr *ShowCommandManager
+	performanceMgr *PerformanceManager
+	rebalanceMgr   *RebalanceManager
+}
+
+func CreateDashboardManager(config *util.ConfigStruct, showCommandManager *ShowCommandManager, performanceManager *PerformanceManager, rebalanceManager *RebalanceManager) *DashboardManager {
+
+	return &DashboardManager{
+		config:         config,
+		showCommandMgr: showCommandManager,
+		performanceMgr: performanceManager,
+		rebalanceMgr:   rebalanceManager,
+	}
+}
+
+func (dashboardManager *DashboardManager) getState() (dashboardState, error) {
+
+	state := dashboardState{
+		Holdings:    []dashboardHolding{},
+		EquityCurve: []dashboardEquityPoint{},
+		Trades:      []apiTrade{},
+		UpdatedAt:   time.Now(),
+	}
+
+	configModel, configModelError := dashboardManager.showCommandMgr.GetConfig()
+
+	if configModelError != nil {
+		return state, configModelError
+	}
+
+	state.Active = configModel.Active
+	state.ReBalanceThreshold = configModel.ReBalanceThreshold
+	state.RebalanceRunning = dashboardManager.rebalanceMgr.IsRebalanceProcessRunning()
+
+	rebalanceStatus, rebalanceStatusError := dashboardManager.rebalanceMgr.GetRebalanceStatus()
+
+	if rebalanceStatusError != nil {
+		return state, rebalanceStatusError
+	}
+
+	state.RebalanceMode = rebalanceStatus.Mode
+	state.LastTickError = rebalanceStatus.LastError
+
+	// A broker outage should not blank the whole dashboard
+	indexStats, indexStatsError := dashboardManager.showCommandMgr.GetStats()
+
+	if indexStatsError != nil {
+		state.AccountValueError = indexStatsError.Error()
+	} else {
+		state.AccountValue = indexStats.AccountValue
+	}
+
+	indexedSymbols, indexedSymbolsError := dashboardManager.showCommandMgr.GetIndex()
+
+	if indexedSymbolsError != nil {
+		return state, indexedSymbolsError
+	}
+
+	for _, element := range indexedSymbols {
+		state.Holdings = append(state.Holdings, dashboardHolding{
+			apiIndexedSymbol: toApiIndexedSymbol(element),
+			// Current percentage is stored as the desired percentage plus the drift the rebalancer compares to the threshold
+			Drift: element.CurrentPercentage - element.DesiredPercentage,
+		})
+	}
+
+	dailySnapshots, dailySnapshotsError := dashboardManager.performanceMgr.GetDailySnapshots(time.Time{})
+
+	if dailySnapshotsError != nil {
+		return state, dailySnapshotsError
+	}
+
+	for _, snapshot := range dailySnapshots {
+		state.EquityCurve = append(state.EquityCurve, dashboardEquityPoint{TakenAt: snapshot.TakenAt, Value: snapshot.Value})
+	}
+
+	fills, fillsError := dashboardManager.showCommandMgr.GetTrades(20)
+
+	if fillsError != nil {
+		return state, fillsError
+	}
+
+	state.Trades = toApiTrades(fills)
+
+	return state, nil
+}
+
+// authorize checks the token query parameter since EventSource can not send headers
+func (dashboardManager *DashboardManager) authorize(handler http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if dashboardManager.config.DashboardToken == "" ||
+			subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(dashboardManager.config.DashboardToken)) != 1 {
+			http.Error(w, "invalid or missing dashboard token", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (dashboardManager *DashboardManager) pageHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	_, writeError := w.Write([]byte(dashboardPage))
+
+	if writeError != nil {
+		logrus.Error(writeError.Error())
+	}
+}
+
+func (dashboardManager *DashboardManager) stateHandler(w http.ResponseWriter, r *http.Request) {
+
+	state, stateError := dashboardManager.getState()
+
+	if stateError != nil {
+		writeJsonError(w, http.StatusInternalServerError, stateError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, state)
+}
+
+func (dashboardManager *DashboardManager) eventsHandler(w http.ResponseWriter, r *http.Request) {
+
+	flusher, flusherOk := w.(http.Flusher)
+
+	if flusherOk == false {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ticker := time.NewTicker(dashboardUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+
+		state, stateError := dashboardManager.getState()
+
+		if stateError != nil {
+			logrus.Error(stateError.Error())
+		} else {
+
+			marshaledState, marshaledStateError := json.Marshal(state)
+
+			if marshaledStateError != nil {
+				logrus.Error(marshaledStateError.Error())
+				return
+			}
+
+			_, writeError := fmt.Fprintf(w, "data: %s\n\n", marshaledState)
+
+			if writeError != nil {
+				return
+			}
+
+			flusher.Flush()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (dashboardManager *DashboardManager) Handler() http.Handler {
+
+	serveMux := http.NewServeMux()
+
+	serveMux.HandleFunc("/", dashboardManager.authorize(dashboardManager.pageHandler))
+	serveMux.HandleFunc("/state", dashboardManager.authorize(dashboardManager.stateHandler))
+	serveMux.HandleFunc("/events", dashboardManager.authorize(dashboardManager.eventsHandler))
+
+	return serveMux
+}
+
+func (dashboardManager *DashboardManager) ListenAndServe() error {
+
+	if dashboardManager.config.DashboardListen == "" {
+		return errors.New("no dashboard listen address is set")
+	}
+
+	if dashboardManager.config.DashboardToken == "" {
+		return errors.New("a dashboard token is required to start the dashboard")
+	}
+
+	logrus.Info("Dashboard listening on " + dashboardManager.config.DashboardListen)
+
+	return http.ListenAndServe(dashboardManager.config.DashboardListen, dashboardManager.Handler())
+}
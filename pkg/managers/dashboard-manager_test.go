@@ -0,0 +1,50 @@
+package managers
+
+import (
+	"github.com/r4stl1n/condext/pkg/util"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDashboardAuthorize(t *testing.T) {
+
+	testCases := []struct {
+		name           string
+		dashboardToken string
+		requestToken   string
+		method         string
+		status         int
+	}{
+		{"matching token", "secret", "secret", http.MethodGet, http.StatusOK},
+		{"wrong token", "secret", "guess", http.MethodGet, http.StatusUnauthorized},
+		{"missing token", "secret", "", http.MethodGet, http.StatusUnauthorized},
+		{"no token configured", "", "", http.MethodGet, http.StatusUnauthorized},
+		{"not a get", "secret", "secret", http.MethodPost, http.StatusMethodNotAllowed},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			dashboardManager := CreateDashboardManager(&util.ConfigStruct{DashboardToken: testCase.dashboardToken}, nil, nil, nil)
+
+			handler := dashboardManager.authorize(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			recorder := httptest.NewRecorder()
+
+			handler(recorder, httptest.NewRequest(testCase.method, "/state?token="+testCase.requestToken, nil))
+
+			if recorder.Code != testCase.status {
+				t.Errorf("status = %d, want %d", recorder.Code, testCase.status)
+			}
+		})
+	}
+
+	noTokenError := CreateDashboardManager(&util.ConfigStruct{DashboardListen: "127.0.0.1:0"}, nil, nil, nil).ListenAndServe()
+
+	if noTokenError == nil || noTokenError.Error() != "a dashboard token is required to start the dashboard" {
+		t.Errorf("ListenAndServe without a token = %v, want it refused", noTokenError)
+	}
+}
@@ -0,0 +1,173 @@
+package managers
+
+// dashboardPage is served as is, it reads the token from its own url and streams state from /events
+const dashboardPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Condext</title>
+<style>
+	body { font-family: -apple-system, Helvetica, Arial, sans-serif; margin: 24px; color: #222; background: #fafafa; }
+	h1 { margin: 0 0 4px 0; }
+	h2 { font-size: 16px; margin: 24px 0 8px 0; }
+	.status { color: #666; margin-bottom: 16px; }
+	.status span { margin-right: 16px; }
+	.running { color: #1a7f37; }
+	.stopped { color: #b42318; }
+	.paused { color: #b54708; }
+	.card { background: #fff; border: 1px solid #ddd; border-radius: 4px; padding: 12px; }
+	table { border-collapse: collapse; width: 100%; }
+	th, td { text-align: right; padding: 4px 8px; border-bottom: 1px solid #eee; }
+	th:first-child, td:first-child { text-align: left; }
+	.bar { position: relative; height: 12px; width: 160px; background: #f0f0f0; display: inline-block; }
+	.bar .fill { position: absolute; top: 0; height: 12px; }
+	.bar .mid { position: absolute; left: 50%; top: -2px; width: 1px; height: 16px; background: #999; }
+	.over { background: #d92d20; }
+	.under { background: #2e90fa; }
+	.within { background: #12b76a; }
+	svg { width: 100%; height: 200px; }
+</style>
+</head>
+<body>
+<h1>Condext</h1>
+<div class="status">
+	<span id="rebalancer">Rebalancer: -</span>
+	<span id="account">Account value: -</span>
+	<span id="threshold">Threshold: -</span>
+	<span id="updated">Updated: -</span>
+</div>
+
+<h2>Holdings vs Targets</h2>
+<div class="card">
+	<table>
+		<thead><tr><th>Symbol</th><th>Sector</th><th>Amount</th><th>Price</th><th>Value</th><th>Desired %</th><th>Current %</th><th>Drift</th><th></th></tr></thead>
+		<tbody id="holdings"></tbody>
+	</table>
+</div>
+
+<h2>Equity Curve</h2>
+<div class="card"><svg id="equity" viewBox="0 0 800 200" preserveAspectRatio="none"></svg></div>
+
+<h2>Recent Trades</h2>
+<div class="card">
+	<table>
+		<thead><tr><th>Filled At</th><th>Symbol</th><th>Side</th><th>Amount</th><th>Price</th></tr></thead>
+		<tbody id="trades"></tbody>
+	</table>
+</div>
+
+<script>
+	var token = new URLSearchParams(window.location.search).get("token") || "";
+	var query = token ? "?token=" + encodeURIComponent(token) : "";
+
+	function cell(text) {
+		var td = document.createElement("td");
+		td.textContent = text;
+		return td;
+	}
+
+	function money(value) {
+		return value.toLocaleString(undefined, { minimumFractionDigits: 2, maximumFractionDigits: 2 });
+	}
+
+	function driftBar(drift, threshold) {
+		var bar = document.createElement("div");
+		var fill = document.createElement("div");
+		var mid = document.createElement("div");
+		var scale = Math.max(threshold * 2, Math.abs(drift), 1);
+		var width = Math.min(Math.abs(drift) / scale, 1) * 50;
+
+		bar.className = "bar";
+		mid.className = "mid";
+		fill.className = "fill " + (Math.abs(drift) <= threshold ? "within" : (drift > 0 ? "over" : "under"));
+		fill.style.width = width + "%";
+		fill.style.left = drift >= 0 ? "50%" : (50 - width) + "%";
+
+		bar.appendChild(fill);
+		bar.appendChild(mid);
+
+		var td = document.createElement("td");
+		td.appendChild(bar);
+		return td;
+	}
+
+	function renderEquity(points) {
+		var svg = document.getElementById("equity");
+		svg.innerHTML = "";
+
+		if (points.length < 2) {
+			return;
+		}
+
+		var values = points.map(function (p) { return p.value; });
+		var min = Math.min.apply(null, values);
+		var max = Math.max.apply(null, values);
+		var range = max - min || 1;
+
+		var path = points.map(function (p, i) {
+			var x = i / (points.length - 1) * 800;
+			var y = 190 - (p.value - min) / range * 180;
+			return (i === 0 ? "M" : "L") + x.toFixed(1) + " " + y.toFixed(1);
+		}).join(" ");
+
+		var line = document.createElementNS("http://www.w3.org/2000/svg", "path");
+		line.setAttribute("d", path);
+		line.setAttribute("fill", "none");
+		line.setAttribute("stroke", "#2e90fa");
+		line.setAttribute("stroke-width", "2");
+		line.setAttribute("vector-effect", "non-scaling-stroke");
+		svg.appendChild(line);
+	}
+
+	function render(state) {
+		var rebalancer = document.getElementById("rebalancer");
+		rebalancer.textContent = "Rebalancer: " + state.rebalanceMode + (state.lastTickError ? " (last tick failed: " + state.lastTickError + ")" : "");
+		rebalancer.className = state.rebalanceMode;
+
+		document.getElementById("account").textContent = "Account value: " +
+			(state.accountValueError ? "unavailable" : money(state.accountValue));
+		document.getElementById("threshold").textContent = "Threshold: " + state.rebalanceThreshold + "%";
+		document.getElementById("updated").textContent = "Updated: " + new Date(state.updatedAt).toLocaleTimeString();
+
+		var holdings = document.getElementById("holdings");
+		holdings.innerHTML = "";
+
+		state.holdings.forEach(function (h) {
+			var tr = document.createElement("tr");
+			tr.appendChild(cell(h.symbol + (h.locked ? " (locked)" : "")));
+			tr.appendChild(cell(h.sector));
+			tr.appendChild(cell(h.amount));
+			tr.appendChild(cell(money(h.currentPrice)));
+			tr.appendChild(cell(money(h.currentValue)));
+			tr.appendChild(cell(h.desiredPercentage.toFixed(2)));
+			tr.appendChild(cell(h.currentPercentage.toFixed(2)));
+			tr.appendChild(cell(h.drift.toFixed(2)));
+			tr.appendChild(driftBar(h.drift, state.rebalanceThreshold));
+			holdings.appendChild(tr);
+		});
+
+		var trades = document.getElementById("trades");
+		trades.innerHTML = "";
+
+		state.trades.forEach(function (t) {
+			var tr = document.createElement("tr");
+			tr.appendChild(cell(new Date(t.filledAt).toLocaleString()));
+			tr.appendChild(cell(t.symbol));
+			tr.appendChild(cell(t.side));
+			tr.appendChild(cell(t.amount));
+			tr.appendChild(cell(money(t.price)));
+			trades.appendChild(tr);
+		});
+
+		renderEquity(state.equityCurve);
+	}
+
+	var events = new EventSource("/events" + query);
+
+	events.onmessage = function (message) {
+		render(JSON.parse(message.data));
+	};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,229 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/mattn/go-sqlite3"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/util"
+	"os"
+)
+
+// copySqliteDatabase copies every page of the source into the destination with the sqlite online backup api,
+// the source stays readable and writable while it runs and the copy is one consistent point in time
+func copySqliteDatabase(destinationConnection *sql.Conn, sourceConnection *sql.Conn) error {
+
+	return destinationConnection.Raw(func(destinationDriver interface{}) error {
+		return sourceConnection.Raw(func(sourceDriver interface{}) error {
+
+			destinationSqlite, destinationOk := destinationDriver.(*sqlite3.SQLiteConn)
+			sourceSqlite, sourceOk := sourceDriver.(*sqlite3.SQLiteConn)
+
+			if destinationOk == false || sourceOk == false {
+				return errors.New("backups need a sqlite3 connection")
+			}
+
+			backup, backupError := destinationSqlite.Backup("main", sourceSqlite, "main")
+
+			if backupError != nil {
+				return backupError
+			}
+
+			// A negative page count copies the whole database in one step
+			_, stepError := backup.Step(-1)
+
+			finishError := backup.Finish()
+
+			if stepError != nil {
+				return stepError
+			}
+
+			return finishError
+		})
+	})
+}
+
+// sqliteIntegrityProblems runs the sqlite integrity check, an intact database has no problems
+func sqliteIntegrityProblems(database *sql.DB) ([]string, error) {
+
+	rows, queryError := database.Query("PRAGMA integrity_check")
+
+	if queryError != nil {
+		return nil, queryError
+	}
+
+	defer rows.Close()
+
+	problems := []string{}
+
+	for rows.Next() {
+
+		checkResult := ""
+
+		scanError := rows.Scan(&checkResult)
+
+		if scanError != nil {
+			return nil, scanError
+		}
+
+		if checkResult != "ok" {
+			problems = append(problems, checkResult)
+		}
+	}
+
+	return problems, rows.Err()
+}
+
+// BackupTo writes a consistent copy of a sqlite database to a new file, postgres is backed up with pg_dump
+func (databaseManager *DatabaseManager) BackupTo(backupPath string) error {
+
+	if databaseManager.dialect == util.DatabaseDialectPostgres {
+		return errors.New("postgres databases are backed up with pg_dump, not by condext")
+	}
+
+	_, statError := os.Stat(backupPath)
+
+	if statError == nil {
+		return errors.New("backup " + backupPath + " already exists")
+	}
+
+	backupDatabase, openError := sql.Open(util.DatabaseDialectSqlite, backupPath)
+
+	if openError != nil {
+		return openError
+	}
+
+	defer backupDatabase.Close()
+
+	backupConnection, backupConnectionError := backupDatabase.Conn(context.Background())
+
+	if backupConnectionError != nil {
+		return backupConnectionError
+	}
+
+	defer backupConnection.Close()
+
+	sourceConnection, sourceConnectionError := databaseManager.gormClient.DB().Conn(context.Background())
+
+	if sourceConnectionError != nil {
+		return sourceConnectionError
+	}
+
+	defer sourceConnection.Close()
+
+	copyError := copySqliteDatabase(backupConnection, sourceConnection)
+
+	if copyError != nil {
+		// Half a backup is worse than none since it looks like one
+		backupConnection.Close()
+		os.Remove(backupPath)
+		return copyError
+	}
+
+	return nil
+}
+
+// RestoreFrom replaces the whole database with the contents of a backup file, the file itself is only read
+func (databaseManager *DatabaseManager) RestoreFrom(backupPath string) error {
+
+	if databaseManager.dialect == util.DatabaseDialectPostgres {
+		return errors.New("postgres databases are restored with pg_restore, not by condext")
+	}
+
+	backupDatabase, openError := openBackupFile(backupPath)
+
+	if openError != nil {
+		return openError
+	}
+
+	defer backupDatabase.Close()
+
+	backupConnection, backupConnectionError := backupDatabase.Conn(context.Background())
+
+	if backupConnectionError != nil {
+		return backupConnectionError
+	}
+
+	defer backupConnection.Close()
+
+	destinationConnection, destinationConnectionError := databaseManager.gormClient.DB().Conn(context.Background())
+
+	if destinationConnectionError != nil {
+		return destinationConnectionError
+	}
+
+	defer destinationConnection.Close()
+
+	copyError := copySqliteDatabase(destinationConnection, backupConnection)
+
+	if copyError != nil {
+		return copyError
+	}
+
+	// Backups taken before schema versioning do not have the table Migrate reads the version from
+	return databaseManager.gormClient.AutoMigrate(&dto.SchemaMigrationModel{}).Error
+}
+
+// IntegrityProblems runs the sqlite integrity check on the open database, postgres has none to run
+func (databaseManager *DatabaseManager) IntegrityProblems() ([]string, error) {
+
+	if databaseManager.dialect == util.DatabaseDialectPostgres {
+		return []string{}, nil
+	}
+
+	return sqliteIntegrityProblems(databaseManager.gormClient.DB())
+}
+
+// openBackupFile opens a backup read only so checking or restoring it never changes it
+func openBackupFile(backupPath string) (*sql.DB, error) {
+
+	_, statError := os.Stat(backupPath)
+
+	if statError != nil {
+		return nil, errors.New("backup " + backupPath + " can not be read, " + statError.Error())
+	}
+
+	return sql.Open(util.DatabaseDialectSqlite, "file:"+backupPath+"?mode=ro")
+}
+
+// InspectBackup returns the schema version of a backup file and any integrity problems in it
+func InspectBackup(backupPath string) (int64, []string, error) {
+
+	backupDatabase, openError := openBackupFile(backupPath)
+
+	if openError != nil {
+		return 0, nil, openError
+	}
+
+	defer backupDatabase.Close()
+
+	problems, integrityError := sqliteIntegrityProblems(backupDatabase)
+
+	if integrityError != nil {
+		return 0, nil, errors.New(backupPath + " is not a readable sqlite database, " + integrityError.Error())
+	}
+
+	tableCount := 0
+
+	countError := backupDatabase.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migration_models'").Scan(&tableCount)
+
+	if countError != nil {
+		return 0, nil, countError
+	}
+
+	// Backups taken before schema versioning have no migrations table, the baseline migration upgrades them
+	if tableCount == 0 {
+		return 0, problems, nil
+	}
+
+	var schemaVersion sql.NullInt64
+
+	versionError := backupDatabase.QueryRow("SELECT max(version) FROM schema_migration_models WHERE deleted_at IS NULL").Scan(&schemaVersion)
+
+	if versionError != nil {
+		return 0, nil, versionError
+	}
+
+	return schemaVersion.Int64, problems, nil
+}
@@ -0,0 +1,96 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/r4stl1n/condext/pkg/util"
+	"hash/fnv"
+)
+
+// InstanceLock is held by the one process allowed to trade against a database
+type InstanceLock interface {
+	Release() error
+}
+
+// advisoryLock keeps the connection that took the postgres session lock, the lock goes away with it
+type advisoryLock struct {
+	connection *sql.Conn
+	key        int64
+}
+
+func (lock *advisoryLock) Release() error {
+
+	_, unlockError := lock.connection.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lock.key)
+
+	closeError := lock.connection.Close()
+
+	if unlockError != nil {
+		return unlockError
+	}
+
+	return closeError
+}
+
+// AcquireInstanceLock locks the lock file next to a sqlite database, a shared postgres database is locked in the database itself
+func (databaseManager *DatabaseManager) AcquireInstanceLock(lockPath string) (InstanceLock, error) {
+
+	if databaseManager.dialect != util.DatabaseDialectPostgres {
+
+		fileLock, fileLockError := util.AcquireFileLock(lockPath)
+
+		if fileLockError != nil {
+			return nil, fileLockError
+		}
+
+		return fileLock, nil
+	}
+
+	connection, connectionError := databaseManager.gormClient.DB().Conn(context.Background())
+
+	if connectionError != nil {
+		return nil, connectionError
+	}
+
+	// Advisory locks are already per database, keying on the schema the tables live in lets instances that keep their
+	// state in separate schemas of one database run side by side while two on the same tables still exclude each other
+	schemaName := sql.NullString{}
+
+	schemaError := connection.QueryRowContext(context.Background(), "SELECT current_schema()").Scan(&schemaName)
+
+	if schemaError != nil || schemaName.Valid == false {
+		connection.Close()
+
+		if schemaError != nil {
+			return nil, schemaError
+		}
+
+		return nil, errors.New("the database search_path names no schema that exists")
+	}
+
+	lockKey := instanceLockKey(schemaName.String)
+	locked := false
+
+	lockError := connection.QueryRowContext(context.Background(), "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&locked)
+
+	if lockError != nil || locked == false {
+		connection.Close()
+
+		if lockError != nil {
+			return nil, lockError
+		}
+
+		return nil, errors.New("another condext instance holds the database lock on schema " + schemaName.String)
+	}
+
+	return &advisoryLock{connection: connection, key: lockKey}, nil
+}
+
+// instanceLockKey is the advisory lock key of the condext tables in a schema
+func instanceLockKey(schemaName string) int64 {
+
+	keyHash := fnv.New64a()
+	keyHash.Write([]byte("condext:" + schemaName))
+
+	return int64(keyHash.Sum64())
+}
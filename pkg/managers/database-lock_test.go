@@ -0,0 +1,266 @@
+package managers
+
+import (
+	"database/sql"
+	"github.com/r4stl1n/condext/pkg/util"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// The postgres tests run against the database in CONDEXT_TEST_POSTGRES_URL and are skipped without it, every test
+// works in schemas of its own that are dropped afterwards
+const testPostgresUrlVariable = "CONDEXT_TEST_POSTGRES_URL"
+
+// openTestPostgresDatabaseManager opens the test database with the search_path set to a new schema
+func openTestPostgresDatabaseManager(t *testing.T, schemaName string) *DatabaseManager {
+
+	t.Helper()
+
+	postgresUrl := os.Getenv(testPostgresUrlVariable)
+
+	if postgresUrl == "" {
+		t.Skip(testPostgresUrlVariable + " is not set")
+	}
+
+	databaseClient, openError := sql.Open(util.DatabaseDialectPostgres, postgresUrl)
+
+	if openError != nil {
+		t.Fatal(openError)
+	}
+
+	defer databaseClient.Close()
+
+	_, createError := databaseClient.Exec("CREATE SCHEMA IF NOT EXISTS " + schemaName)
+
+	if createError != nil {
+		t.Fatal(createError)
+	}
+
+	t.Cleanup(func() {
+
+		cleanupClient, cleanupOpenError := sql.Open(util.DatabaseDialectPostgres, postgresUrl)
+
+		if cleanupOpenError != nil {
+			t.Error(cleanupOpenError)
+			return
+		}
+
+		defer cleanupClient.Close()
+
+		_, dropError := cleanupClient.Exec("DROP SCHEMA IF EXISTS " + schemaName + " CASCADE")
+
+		if dropError != nil {
+			t.Error(dropError)
+		}
+	})
+
+	schemaUrl, parseError := url.Parse(postgresUrl)
+
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	schemaQuery := schemaUrl.Query()
+	schemaQuery.Set("search_path", schemaName)
+	schemaUrl.RawQuery = schemaQuery.Encode()
+
+	databaseManager, managerError := OpenDatabaseManager(util.DatabaseDialectPostgres, schemaUrl.String())
+
+	if managerError != nil {
+		t.Fatal(managerError)
+	}
+
+	t.Cleanup(func() {
+		databaseManager.Close()
+	})
+
+	return databaseManager
+}
+
+func testSchemaName(suffix string) string {
+	return "condext_test_" + strconv.FormatInt(time.Now().UnixNano(), 10) + "_" + suffix
+}
+
+func TestInstanceLockKey(t *testing.T) {
+
+	testCases := []struct {
+		name    string
+		schemaA string
+		schemaB string
+		same    bool
+	}{
+		{"same schema", "public", "public", true},
+		{"different schemas", "public", "paper", false},
+		{"case matters like it does for quoted schemas", "paper", "Paper", false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			same := instanceLockKey(testCase.schemaA) == instanceLockKey(testCase.schemaB)
+
+			if same != testCase.same {
+				t.Errorf("keys equal = %v, want %v", same, testCase.same)
+			}
+		})
+	}
+}
+
+func TestSqliteInstanceLock(t *testing.T) {
+
+	databaseDirectory, directoryError := ioutil.TempDir("", "condext-test")
+
+	if directoryError != nil {
+		t.Fatal(directoryError)
+	}
+
+	defer os.RemoveAll(databaseDirectory)
+
+	databaseManager, openError := OpenDatabaseManager(util.DatabaseDialectSqlite, filepath.Join(databaseDirectory, "condext.db"))
+
+	if openError != nil {
+		t.Fatal(openError)
+	}
+
+	defer databaseManager.Close()
+
+	lockPath := filepath.Join(databaseDirectory, "condext.db.lock")
+
+	firstLock, firstLockError := databaseManager.AcquireInstanceLock(lockPath)
+
+	if firstLockError != nil {
+		t.Fatal(firstLockError)
+	}
+
+	_, secondLockError := databaseManager.AcquireInstanceLock(lockPath)
+
+	if secondLockError == nil {
+		t.Fatal("a second instance took the lock")
+	}
+
+	releaseError := firstLock.Release()
+
+	if releaseError != nil {
+		t.Fatal(releaseError)
+	}
+
+	thirdLock, thirdLockError := databaseManager.AcquireInstanceLock(lockPath)
+
+	if thirdLockError != nil {
+		t.Fatal(thirdLockError)
+	}
+
+	thirdLock.Release()
+}
+
+func TestPostgresInstanceLock(t *testing.T) {
+
+	testCases := []struct {
+		name     string
+		shared   bool
+		excluded bool
+	}{
+		{"same schema", true, true},
+		{"separate schemas", false, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			firstSchema := testSchemaName("a")
+			secondSchema := testSchemaName("b")
+
+			if testCase.shared == true {
+				secondSchema = firstSchema
+			}
+
+			firstManager := openTestPostgresDatabaseManager(t, firstSchema)
+			secondManager := openTestPostgresDatabaseManager(t, secondSchema)
+
+			firstLock, firstLockError := firstManager.AcquireInstanceLock("")
+
+			if firstLockError != nil {
+				t.Fatal(firstLockError)
+			}
+
+			defer firstLock.Release()
+
+			secondLock, secondLockError := secondManager.AcquireInstanceLock("")
+
+			if (secondLockError != nil) != testCase.excluded {
+				t.Fatalf("second lock error = %v, want excluded %v", secondLockError, testCase.excluded)
+			}
+
+			if secondLock != nil {
+				secondLock.Release()
+			}
+		})
+	}
+}
+
+func TestPostgresStore(t *testing.T) {
+
+	databaseManager := openTestPostgresDatabaseManager(t, testSchemaName("store"))
+
+	_, migrateError := databaseManager.Migrate()
+
+	if migrateError != nil {
+		t.Fatal(migrateError)
+	}
+
+	checkError := databaseManager.CheckSchemaCurrent()
+
+	if checkError != nil {
+		t.Fatal(checkError)
+	}
+
+	configError := databaseManager.CreateCondextConfigAndFirstSymbolModel()
+
+	if configError != nil {
+		t.Fatal(configError)
+	}
+
+	testCases := []struct {
+		name      string
+		riskOrder RiskOrder
+	}{
+		{"buy", RiskOrder{Symbol: "VTI", Side: "buy", Amount: 10, Price: 200, Source: SourceRebalance}},
+		{"sell", RiskOrder{Symbol: "VXUS", Side: "sell", Amount: 3, Price: 55.5, Source: SourceHarvest}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			orderIntent, createError := createOrderIntent(databaseManager, testCase.riskOrder)
+
+			if createError != nil {
+				t.Fatal(createError)
+			}
+
+			savedIntent, savedIntentError := databaseManager.GetOrderIntentModel(orderIntent.ID)
+
+			if savedIntentError != nil {
+				t.Fatal(savedIntentError)
+			}
+
+			if orderIntentClientOrderId(savedIntent) != orderIntent.ClientOrderId {
+				t.Errorf("client order id %s does not survive the round trip", orderIntent.ClientOrderId)
+			}
+		})
+	}
+
+	problems, verifyError := CreateEventManager(databaseManager).VerifyChain()
+
+	if verifyError != nil {
+		t.Fatal(verifyError)
+	}
+
+	if len(problems) != 0 {
+		t.Errorf("VerifyChain = %q, want no problems", problems)
+	}
+}
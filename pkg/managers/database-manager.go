@@ -3,32 +3,136 @@ package managers
 import (
 	"errors"
 	"github.com/satori/go.uuid"
+	"sync"
+	"time"
 
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/util"
 )
 
 type DatabaseManager struct {
 	gormClient *gorm.DB
+	dialect    string
+
+	// Set on the copy handed to a RunInTransaction function
+	inTransaction bool
+	transaction   *transactionState
+}
+
+// sqliteEventLogMutex serializes appends to a sqlite event log, it is held from the first event of a transaction until
+// the transaction ends so a second writer always reads the sequence the first one committed
+var sqliteEventLogMutex sync.Mutex
+
+// transactionState is shared by every manager joined to one transaction
+type transactionState struct {
+	eventLogLocked bool
 }
 
-func CreateDatabaseManager(databaseName string) (*DatabaseManager, error) {
+func (state *transactionState) release() {
+
+	if state.eventLogLocked == true {
+		state.eventLogLocked = false
+		sqliteEventLogMutex.Unlock()
+	}
+}
 
-	databaseClient, databaseClientError := gorm.Open("sqlite3", databaseName)
+// lockEventLog keeps other writers off the event log until the transaction ends, postgres holds a transaction advisory
+// lock for the schema so other processes wait as well
+func (databaseManager *DatabaseManager) lockEventLog() error {
+
+	if databaseManager.inTransaction == false {
+		return errors.New("the event log can only be locked inside a transaction")
+	}
+
+	if databaseManager.transaction.eventLogLocked == true {
+		return nil
+	}
+
+	if databaseManager.dialect == util.DatabaseDialectPostgres {
+		return databaseManager.gormClient.Exec("SELECT pg_advisory_xact_lock(hashtext('condext_event_log:' || current_schema()))").Error
+	}
+
+	sqliteEventLogMutex.Lock()
+	databaseManager.transaction.eventLogLocked = true
+
+	return nil
+}
+
+// OpenDatabaseManager connects to a sqlite3 or postgres database without applying migrations, only the schema version table is created
+func OpenDatabaseManager(databaseDialect string, databaseSource string) (*DatabaseManager, error) {
+
+	databaseClient, databaseClientError := gorm.Open(databaseDialect, databaseSource)
 
 	if databaseClientError != nil {
 		return &DatabaseManager{}, databaseClientError
 	}
 
-	databaseClient.AutoMigrate(&dto.CondextConfigModel{})
-	databaseClient.AutoMigrate(&dto.IndexedSymbolModel{})
+	migrateError := databaseClient.AutoMigrate(&dto.SchemaMigrationModel{}).Error
+
+	if migrateError != nil {
+		databaseClient.Close()
+		return &DatabaseManager{}, migrateError
+	}
 
 	return &DatabaseManager{
 		gormClient: databaseClient,
+		dialect:    databaseDialect,
 	}, nil
 }
 
+func (databaseManager *DatabaseManager) Close() error {
+	return databaseManager.gormClient.Close()
+}
+
+// RunInTransaction hands the function a DatabaseManager bound to one transaction, it commits when the function
+// returns nil and rolls back on an error or panic, inside a transaction it joins the one already open
+func (databaseManager *DatabaseManager) RunInTransaction(transactionFunc func(transactionManager *DatabaseManager) error) (transactionError error) {
+
+	if databaseManager.inTransaction == true {
+		return transactionFunc(databaseManager)
+	}
+
+	transaction := databaseManager.gormClient.Begin()
+
+	if transaction.Error != nil {
+		return transaction.Error
+	}
+
+	state := &transactionState{}
+
+	// Runs after the commit or rollback below
+	defer state.release()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			transaction.Rollback()
+			panic(recovered)
+		}
+	}()
+
+	transactionError = transactionFunc(&DatabaseManager{
+		gormClient:    transaction,
+		dialect:       databaseManager.dialect,
+		inTransaction: true,
+		transaction:   state,
+	})
+
+	if transactionError != nil {
+		rollbackError := transaction.Rollback().Error
+
+		if rollbackError != nil {
+			return errors.New(transactionError.Error() + ", rollback failed " + rollbackError.Error())
+		}
+
+		return transactionError
+	}
+
+	return transaction.Commit().Error
+}
+
 func (databaseManager *DatabaseManager) CreateIndexSymbolModel(indexedSymbolModel dto.IndexedSymbolModel) (dto.IndexedSymbolModel, error) {
 
 	if databaseManager.CheckIfSymbolIsIndexed(indexedSymbolModel.Symbol) != false {
@@ -114,8 +218,13 @@ func (databaseManager *DatabaseManager) UpdateIndexedSymbolModel(updatedIndexedS
 	indexedSymbolModel.Locked = updatedIndexedSymbolModel.Locked
 	indexedSymbolModel.CurrentPrice = updatedIndexedSymbolModel.CurrentPrice
 	indexedSymbolModel.Amount = updatedIndexedSymbolModel.Amount
+	indexedSymbolModel.Sector = updatedIndexedSymbolModel.Sector
+
+	saveError := databaseManager.gormClient.Save(&indexedSymbolModel).Error
 
-	databaseManager.gormClient.Save(&indexedSymbolModel)
+	if saveError != nil {
+		return dto.IndexedSymbolModel{}, saveError
+	}
 
 	return indexedSymbolModel, nil
 }
@@ -132,6 +241,11 @@ func (databaseManager *DatabaseManager) CreateCondextConfigAndFirstSymbolModel()
 		condextConfigModel.OrderTimeout = 10
 		condextConfigModel.RebalanceFrequency = 60
 		condextConfigModel.StartingBalance = 50000
+		condextConfigModel.HarvestLossThreshold = 5
+		condextConfigModel.ShortTermTaxRate = 37
+		condextConfigModel.LongTermTaxRate = 20
+		condextConfigModel.SnapshotFrequency = 3600
+		condextConfigModel.MaxPriceDeviation = 10
 		createError := databaseManager.gormClient.Create(&condextConfigModel).Error
 
 		if createError != nil {
@@ -169,8 +283,629 @@ func (databaseManager *DatabaseManager) UpdateCondextConfig(updatedConfigModel d
 	configModel.OrderTimeout = updatedConfigModel.OrderTimeout
 	configModel.RebalanceFrequency = updatedConfigModel.RebalanceFrequency
 	configModel.StartingBalance = updatedConfigModel.StartingBalance
-
-	databaseManager.gormClient.Save(&configModel)
+	configModel.HarvestLossThreshold = updatedConfigModel.HarvestLossThreshold
+	configModel.ShortTermTaxRate = updatedConfigModel.ShortTermTaxRate
+	configModel.LongTermTaxRate = updatedConfigModel.LongTermTaxRate
+	configModel.TaxDriftTradeoff = updatedConfigModel.TaxDriftTradeoff
+	configModel.SnapshotFrequency = updatedConfigModel.SnapshotFrequency
+	configModel.RiskFreeRate = updatedConfigModel.RiskFreeRate
+	configModel.BenchmarkSymbol = updatedConfigModel.BenchmarkSymbol
+	configModel.TradeWindowStart = updatedConfigModel.TradeWindowStart
+	configModel.TradeWindowEnd = updatedConfigModel.TradeWindowEnd
+	configModel.MaxOrderNotional = updatedConfigModel.MaxOrderNotional
+	configModel.MaxDailyNotional = updatedConfigModel.MaxDailyNotional
+	configModel.MaxPositionWeight = updatedConfigModel.MaxPositionWeight
+	configModel.MaxPriceDeviation = updatedConfigModel.MaxPriceDeviation
+
+	saveError := databaseManager.gormClient.Save(&configModel).Error
+
+	if saveError != nil {
+		return dto.CondextConfigModel{}, saveError
+	}
 
 	return configModel, nil
 }
+
+func (databaseManager *DatabaseManager) CreateFillModel(fillModel dto.FillModel) (dto.FillModel, error) {
+
+	fillModel.UUID = uuid.NewV4().String()
+
+	createError := databaseManager.gormClient.Create(&fillModel).Error
+
+	if createError != nil {
+		return dto.FillModel{}, createError
+	}
+
+	return fillModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetFillsBySymbolSince(symbol string, side string, since time.Time) ([]dto.FillModel, error) {
+	var fillModels []dto.FillModel
+
+	findError := databaseManager.gormClient.Order("filled_at asc").Find(&fillModels, "symbol = ? AND side = ? AND filled_at >= ?", symbol, side, since).Error
+
+	if findError != nil {
+		return fillModels, findError
+	}
+
+	return fillModels, nil
+}
+
+func (databaseManager *DatabaseManager) GetFillsBetween(start time.Time, end time.Time) ([]dto.FillModel, error) {
+	var fillModels []dto.FillModel
+
+	findError := databaseManager.gormClient.Order("filled_at asc").Find(&fillModels, "filled_at >= ? AND filled_at < ?", start, end).Error
+
+	if findError != nil {
+		return fillModels, findError
+	}
+
+	return fillModels, nil
+}
+
+func (databaseManager *DatabaseManager) GetRecentFills(limit int) ([]dto.FillModel, error) {
+	var fillModels []dto.FillModel
+
+	findError := databaseManager.gormClient.Order("filled_at desc").Limit(limit).Find(&fillModels).Error
+
+	if findError != nil {
+		return fillModels, findError
+	}
+
+	return fillModels, nil
+}
+
+func (databaseManager *DatabaseManager) GetFillsSince(since time.Time) ([]dto.FillModel, error) {
+	var fillModels []dto.FillModel
+
+	findError := databaseManager.gormClient.Where("filled_at >= ?", since).Find(&fillModels).Error
+
+	if findError != nil {
+		return fillModels, findError
+	}
+
+	return fillModels, nil
+}
+
+func (databaseManager *DatabaseManager) CreateTaxLotModel(taxLotModel dto.TaxLotModel) (dto.TaxLotModel, error) {
+
+	taxLotModel.UUID = uuid.NewV4().String()
+
+	createError := databaseManager.gormClient.Create(&taxLotModel).Error
+
+	if createError != nil {
+		return dto.TaxLotModel{}, createError
+	}
+
+	return taxLotModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetOpenTaxLotsBySymbol(symbol string) ([]dto.TaxLotModel, error) {
+	var taxLotModels []dto.TaxLotModel
+
+	findError := databaseManager.gormClient.Order("acquired_at asc").Find(&taxLotModels, "symbol = ? AND remaining_amount > 0", symbol).Error
+
+	if findError != nil {
+		return taxLotModels, findError
+	}
+
+	return taxLotModels, nil
+}
+
+func (databaseManager *DatabaseManager) UpdateTaxLotModel(updatedTaxLotModel dto.TaxLotModel) (dto.TaxLotModel, error) {
+
+	taxLotModel := dto.TaxLotModel{}
+
+	findError := databaseManager.gormClient.Find(&taxLotModel, "uuid = ?", updatedTaxLotModel.UUID).Error
+
+	if findError != nil {
+		return taxLotModel, findError
+	}
+
+	taxLotModel.Amount = updatedTaxLotModel.Amount
+	taxLotModel.RemainingAmount = updatedTaxLotModel.RemainingAmount
+	taxLotModel.CostBasis = updatedTaxLotModel.CostBasis
+	taxLotModel.AcquiredAt = updatedTaxLotModel.AcquiredAt
+
+	saveError := databaseManager.gormClient.Save(&taxLotModel).Error
+
+	if saveError != nil {
+		return taxLotModel, saveError
+	}
+
+	return taxLotModel, nil
+}
+
+func (databaseManager *DatabaseManager) CreateClosedLotModel(closedLotModel dto.ClosedLotModel) (dto.ClosedLotModel, error) {
+
+	closedLotModel.UUID = uuid.NewV4().String()
+
+	createError := databaseManager.gormClient.Create(&closedLotModel).Error
+
+	if createError != nil {
+		return dto.ClosedLotModel{}, createError
+	}
+
+	return closedLotModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetClosedLotsBySymbolSince(symbol string, since time.Time) ([]dto.ClosedLotModel, error) {
+	var closedLotModels []dto.ClosedLotModel
+
+	findError := databaseManager.gormClient.Order("sold_at asc").Find(&closedLotModels, "symbol = ? AND sold_at >= ?", symbol, since).Error
+
+	if findError != nil {
+		return closedLotModels, findError
+	}
+
+	return closedLotModels, nil
+}
+
+func (databaseManager *DatabaseManager) GetClosedLotsSoldBetween(start time.Time, end time.Time) ([]dto.ClosedLotModel, error) {
+	var closedLotModels []dto.ClosedLotModel
+
+	findError := databaseManager.gormClient.Order("sold_at asc").Find(&closedLotModels, "sold_at >= ? AND sold_at < ?", start, end).Error
+
+	if findError != nil {
+		return closedLotModels, findError
+	}
+
+	return closedLotModels, nil
+}
+
+func (databaseManager *DatabaseManager) UpdateClosedLotModel(updatedClosedLotModel dto.ClosedLotModel) (dto.ClosedLotModel, error) {
+
+	closedLotModel := dto.ClosedLotModel{}
+
+	findError := databaseManager.gormClient.Find(&closedLotModel, "uuid = ?", updatedClosedLotModel.UUID).Error
+
+	if findError != nil {
+		return closedLotModel, findError
+	}
+
+	closedLotModel.WashSaleAdjustment = updatedClosedLotModel.WashSaleAdjustment
+	closedLotModel.WashSaleMatchedAmount = updatedClosedLotModel.WashSaleMatchedAmount
+
+	saveError := databaseManager.gormClient.Save(&closedLotModel).Error
+
+	if saveError != nil {
+		return closedLotModel, saveError
+	}
+
+	return closedLotModel, nil
+}
+
+func (databaseManager *DatabaseManager) CreateSubstituteSymbolModel(substituteSymbolModel dto.SubstituteSymbolModel) (dto.SubstituteSymbolModel, error) {
+
+	_, existingError := databaseManager.GetSubstituteSymbolBySymbol(substituteSymbolModel.Symbol)
+
+	if existingError == nil {
+		return dto.SubstituteSymbolModel{}, errors.New("symbol already has a substitute")
+	}
+
+	createError := databaseManager.gormClient.Create(&substituteSymbolModel).Error
+
+	if createError != nil {
+		return dto.SubstituteSymbolModel{}, createError
+	}
+
+	return substituteSymbolModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetSubstituteSymbolBySymbol(symbol string) (dto.SubstituteSymbolModel, error) {
+
+	substituteSymbolModel := dto.SubstituteSymbolModel{}
+
+	findError := databaseManager.gormClient.Find(&substituteSymbolModel, "symbol = ?", symbol).Error
+
+	if findError != nil {
+		return substituteSymbolModel, findError
+	}
+
+	return substituteSymbolModel, nil
+}
+
+func (databaseManager *DatabaseManager) CreateHarvestSwapModel(harvestSwapModel dto.HarvestSwapModel) (dto.HarvestSwapModel, error) {
+
+	harvestSwapModel.UUID = uuid.NewV4().String()
+
+	createError := databaseManager.gormClient.Create(&harvestSwapModel).Error
+
+	if createError != nil {
+		return dto.HarvestSwapModel{}, createError
+	}
+
+	return harvestSwapModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetActiveHarvestSwaps() ([]dto.HarvestSwapModel, error) {
+	var harvestSwapModels []dto.HarvestSwapModel
+
+	findError := databaseManager.gormClient.Find(&harvestSwapModels, "completed = ?", false).Error
+
+	if findError != nil {
+		return harvestSwapModels, findError
+	}
+
+	return harvestSwapModels, nil
+}
+
+func (databaseManager *DatabaseManager) GetActiveHarvestSwapBySymbol(symbol string) (dto.HarvestSwapModel, error) {
+
+	harvestSwapModel := dto.HarvestSwapModel{}
+
+	findError := databaseManager.gormClient.Find(&harvestSwapModel, "symbol = ? AND completed = ?", symbol, false).Error
+
+	if findError != nil {
+		return harvestSwapModel, findError
+	}
+
+	return harvestSwapModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetHarvestSwapModel(id uint) (dto.HarvestSwapModel, error) {
+
+	harvestSwapModel := dto.HarvestSwapModel{}
+
+	findError := databaseManager.gormClient.First(&harvestSwapModel, id).Error
+
+	if findError != nil {
+		return dto.HarvestSwapModel{}, findError
+	}
+
+	return harvestSwapModel, nil
+}
+
+func (databaseManager *DatabaseManager) UpdateHarvestSwapModel(updatedHarvestSwapModel dto.HarvestSwapModel) (dto.HarvestSwapModel, error) {
+
+	harvestSwapModel := dto.HarvestSwapModel{}
+
+	findError := databaseManager.gormClient.Find(&harvestSwapModel, "uuid = ?", updatedHarvestSwapModel.UUID).Error
+
+	if findError != nil {
+		return harvestSwapModel, findError
+	}
+
+	harvestSwapModel.SubstituteAmount = updatedHarvestSwapModel.SubstituteAmount
+	harvestSwapModel.BuyBackCash = updatedHarvestSwapModel.BuyBackCash
+	harvestSwapModel.Completed = updatedHarvestSwapModel.Completed
+
+	saveError := databaseManager.gormClient.Save(&harvestSwapModel).Error
+
+	if saveError != nil {
+		return harvestSwapModel, saveError
+	}
+
+	return harvestSwapModel, nil
+}
+
+func (databaseManager *DatabaseManager) CreatePortfolioSnapshotModel(portfolioSnapshotModel dto.PortfolioSnapshotModel) (dto.PortfolioSnapshotModel, error) {
+
+	createError := databaseManager.gormClient.Create(&portfolioSnapshotModel).Error
+
+	if createError != nil {
+		return dto.PortfolioSnapshotModel{}, createError
+	}
+
+	return portfolioSnapshotModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetLastPortfolioSnapshotModel() (dto.PortfolioSnapshotModel, error) {
+
+	portfolioSnapshotModel := dto.PortfolioSnapshotModel{}
+
+	findError := databaseManager.gormClient.Order("taken_at desc").First(&portfolioSnapshotModel).Error
+
+	if findError != nil {
+		return portfolioSnapshotModel, findError
+	}
+
+	return portfolioSnapshotModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetPortfolioSnapshotsSince(since time.Time) ([]dto.PortfolioSnapshotModel, error) {
+	var portfolioSnapshotModels []dto.PortfolioSnapshotModel
+
+	findError := databaseManager.gormClient.Order("taken_at asc").Find(&portfolioSnapshotModels, "taken_at >= ?", since).Error
+
+	if findError != nil {
+		return portfolioSnapshotModels, findError
+	}
+
+	return portfolioSnapshotModels, nil
+}
+
+func (databaseManager *DatabaseManager) CreateHoldingSnapshotModel(holdingSnapshotModel dto.HoldingSnapshotModel) (dto.HoldingSnapshotModel, error) {
+
+	createError := databaseManager.gormClient.Create(&holdingSnapshotModel).Error
+
+	if createError != nil {
+		return dto.HoldingSnapshotModel{}, createError
+	}
+
+	return holdingSnapshotModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetHoldingSnapshotsByPortfolioSnapshotID(portfolioSnapshotID uint) ([]dto.HoldingSnapshotModel, error) {
+	var holdingSnapshotModels []dto.HoldingSnapshotModel
+
+	findError := databaseManager.gormClient.Find(&holdingSnapshotModels, "portfolio_snapshot_id = ?", portfolioSnapshotID).Error
+
+	if findError != nil {
+		return holdingSnapshotModels, findError
+	}
+
+	return holdingSnapshotModels, nil
+}
+
+// GetRebalanceStateModel returns the single saved loop state, a fresh database reads as stopped
+func (databaseManager *DatabaseManager) GetRebalanceStateModel() (dto.RebalanceStateModel, error) {
+
+	rebalanceStateModel := dto.RebalanceStateModel{}
+
+	findError := databaseManager.gormClient.Last(&rebalanceStateModel).Error
+
+	if gorm.IsRecordNotFoundError(findError) {
+		return dto.RebalanceStateModel{Mode: "stopped"}, nil
+	}
+
+	if findError != nil {
+		return rebalanceStateModel, findError
+	}
+
+	return rebalanceStateModel, nil
+}
+
+func (databaseManager *DatabaseManager) SaveRebalanceStateModel(rebalanceStateModel dto.RebalanceStateModel) (dto.RebalanceStateModel, error) {
+
+	saveError := databaseManager.gormClient.Save(&rebalanceStateModel).Error
+
+	if saveError != nil {
+		return dto.RebalanceStateModel{}, saveError
+	}
+
+	return rebalanceStateModel, nil
+}
+
+// GetRiskStateModel returns the single saved kill switch state, a fresh database reads as not halted
+func (databaseManager *DatabaseManager) GetRiskStateModel() (dto.RiskStateModel, error) {
+
+	riskStateModel := dto.RiskStateModel{}
+
+	findError := databaseManager.gormClient.Last(&riskStateModel).Error
+
+	if gorm.IsRecordNotFoundError(findError) {
+		return dto.RiskStateModel{}, nil
+	}
+
+	if findError != nil {
+		return riskStateModel, findError
+	}
+
+	return riskStateModel, nil
+}
+
+func (databaseManager *DatabaseManager) SaveRiskStateModel(riskStateModel dto.RiskStateModel) (dto.RiskStateModel, error) {
+
+	saveError := databaseManager.gormClient.Save(&riskStateModel).Error
+
+	if saveError != nil {
+		return dto.RiskStateModel{}, saveError
+	}
+
+	return riskStateModel, nil
+}
+
+func (databaseManager *DatabaseManager) CreateRiskRejectionModel(riskRejectionModel dto.RiskRejectionModel) (dto.RiskRejectionModel, error) {
+
+	createError := databaseManager.gormClient.Create(&riskRejectionModel).Error
+
+	if createError != nil {
+		return dto.RiskRejectionModel{}, createError
+	}
+
+	return riskRejectionModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetRecentRiskRejections(limit int) ([]dto.RiskRejectionModel, error) {
+	var riskRejectionModels []dto.RiskRejectionModel
+
+	findError := databaseManager.gormClient.Order("rejected_at desc").Limit(limit).Find(&riskRejectionModels).Error
+
+	if findError != nil {
+		return riskRejectionModels, findError
+	}
+
+	return riskRejectionModels, nil
+}
+
+func (databaseManager *DatabaseManager) CreateConfigChangeModel(configChangeModel dto.ConfigChangeModel) (dto.ConfigChangeModel, error) {
+
+	createError := databaseManager.gormClient.Create(&configChangeModel).Error
+
+	if createError != nil {
+		return dto.ConfigChangeModel{}, createError
+	}
+
+	return configChangeModel, nil
+}
+
+func (databaseManager *DatabaseManager) GetRecentConfigChanges(limit int) ([]dto.ConfigChangeModel, error) {
+	var configChangeModels []dto.ConfigChangeModel
+
+	findError := databaseManager.gormClient.Order("changed_at desc").Limit(limit).Find(&configChangeModels).Error
+
+	if findError != nil {
+		return configChangeModels, findError
+	}
+
+	return configChangeModels, nil
+}
+
+// GetLastConfigChange returns the latest change of the key made by the source
+func (databaseManager *DatabaseManager) GetLastConfigChange(key string, source string) (dto.ConfigChangeModel, error) {
+
+	configChangeModel := dto.ConfigChangeModel{}
+
+	findError := databaseManager.gormClient.Where("key = ? AND source = ?", key, source).Order("id desc").First(&configChangeModel).Error
+
+	if findError != nil {
+		return configChangeModel, findError
+	}
+
+	return configChangeModel, nil
+}
+
+func (databaseManager *DatabaseManager) CreateOrderIntentModel(orderIntentModel dto.OrderIntentModel) (dto.OrderIntentModel, error) {
+
+	createError := databaseManager.gormClient.Create(&orderIntentModel).Error
+
+	if createError != nil {
+		return dto.OrderIntentModel{}, createError
+	}
+
+	return orderIntentModel, nil
+}
+
+func (databaseManager *DatabaseManager) UpdateOrderIntentModel(orderIntentModel dto.OrderIntentModel) (dto.OrderIntentModel, error) {
+
+	saveError := databaseManager.gormClient.Save(&orderIntentModel).Error
+
+	if saveError != nil {
+		return dto.OrderIntentModel{}, saveError
+	}
+
+	return orderIntentModel, nil
+}
+
+// SettleOrderIntentModel saves a completed or failed intent only while it is still open, so a job and the recovery
+// of the same order can never both save its fill
+func (databaseManager *DatabaseManager) SettleOrderIntentModel(orderIntentModel dto.OrderIntentModel) error {
+
+	updateResult := databaseManager.gormClient.Model(&dto.OrderIntentModel{}).
+		Where("id = ? AND status IN (?)", orderIntentModel.ID, []string{OrderIntentPending, OrderIntentFilled}).
+		Updates(map[string]interface{}{
+			"status":        orderIntentModel.Status,
+			"filled_amount": orderIntentModel.FilledAmount,
+			"fill_price":    orderIntentModel.FillPrice,
+			"reason":        orderIntentModel.Reason,
+			"resolved_at":   orderIntentModel.ResolvedAt,
+		})
+
+	if updateResult.Error != nil {
+		return updateResult.Error
+	}
+
+	if updateResult.RowsAffected == 0 {
+		return errors.New("order " + orderIntentModel.ClientOrderId + " was already settled")
+	}
+
+	return nil
+}
+
+func (databaseManager *DatabaseManager) GetOrderIntentModel(id uint) (dto.OrderIntentModel, error) {
+
+	orderIntentModel := dto.OrderIntentModel{}
+
+	findError := databaseManager.gormClient.First(&orderIntentModel, id).Error
+
+	if findError != nil {
+		return dto.OrderIntentModel{}, findError
+	}
+
+	return orderIntentModel, nil
+}
+
+// GetOpenOrderIntents returns the intents whose order has not been settled in the database yet, oldest first,
+// an empty symbol returns them for every symbol
+func (databaseManager *DatabaseManager) GetOpenOrderIntents(symbol string) ([]dto.OrderIntentModel, error) {
+	var orderIntentModels []dto.OrderIntentModel
+
+	query := databaseManager.gormClient.Where("status IN (?)", []string{OrderIntentPending, OrderIntentFilled}).Order("id asc")
+
+	if symbol != "" {
+		query = query.Where("symbol = ?", symbol)
+	}
+
+	findError := query.Find(&orderIntentModels).Error
+
+	if findError != nil {
+		return orderIntentModels, findError
+	}
+
+	return orderIntentModels, nil
+}
+
+func (databaseManager *DatabaseManager) CreateEventModel(eventModel dto.EventModel) (dto.EventModel, error) {
+
+	createError := databaseManager.gormClient.Create(&eventModel).Error
+
+	if createError != nil {
+		return dto.EventModel{}, createError
+	}
+
+	return eventModel, nil
+}
+
+// GetLastEventModel returns the newest event, soft deleted or not, a record not found error when the log is empty
+func (databaseManager *DatabaseManager) GetLastEventModel() (dto.EventModel, error) {
+
+	eventModel := dto.EventModel{}
+
+	findError := databaseManager.gormClient.Unscoped().Order("sequence desc").First(&eventModel).Error
+
+	if findError != nil {
+		return dto.EventModel{}, findError
+	}
+
+	return eventModel, nil
+}
+
+// GetEventModels returns the newest events matching the filter, empty filter fields match everything
+func (databaseManager *DatabaseManager) GetEventModels(eventFilter EventFilter) ([]dto.EventModel, error) {
+	var eventModels []dto.EventModel
+
+	query := databaseManager.gormClient.Order("sequence desc")
+
+	if eventFilter.Type != "" {
+		query = query.Where("type = ?", eventFilter.Type)
+	}
+
+	if eventFilter.Symbol != "" {
+		query = query.Where("symbol = ?", eventFilter.Symbol)
+	}
+
+	if eventFilter.Actor != "" {
+		query = query.Where("actor LIKE ?", eventFilter.Actor+"%")
+	}
+
+	if eventFilter.Since.IsZero() == false {
+		query = query.Where("occurred_at >= ?", eventFilter.Since)
+	}
+
+	if eventFilter.Limit > 0 {
+		query = query.Limit(eventFilter.Limit)
+	}
+
+	findError := query.Find(&eventModels).Error
+
+	if findError != nil {
+		return eventModels, findError
+	}
+
+	return eventModels, nil
+}
+
+// GetAllEventModels returns the whole log oldest first, the order it is replayed and verified in, soft deleted
+// events are included so removing one can not hide it
+func (databaseManager *DatabaseManager) GetAllEventModels() ([]dto.EventModel, error) {
+	var eventModels []dto.EventModel
+
+	findError := databaseManager.gormClient.Unscoped().Order("sequence asc").Find(&eventModels).Error
+
+	if findError != nil {
+		return eventModels, findError
+	}
+
+	return eventModels, nil
+}
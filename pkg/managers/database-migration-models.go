@@ -0,0 +1,288 @@
+package managers
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Frozen copies of the models as each migration left them, a migration must never read the live dto structs or a
+// later field would appear in an earlier version. Later versions only carry the columns they add, AutoMigrate adds
+// missing columns to a table that already exists
+
+type migrationV1CondextConfigModel struct {
+	gorm.Model
+
+	Active             bool
+	ReBalanceThreshold float64
+	OrderTimeout       int64
+	RebalanceFrequency int64
+	StartingBalance    float64
+	FloatingPercentage float64
+
+	HarvestLossThreshold float64
+	ShortTermTaxRate     float64
+	LongTermTaxRate      float64
+	TaxDriftTradeoff     float64
+
+	SnapshotFrequency int64
+	RiskFreeRate      float64
+	BenchmarkSymbol   string
+
+	TradeWindowStart string
+	TradeWindowEnd   string
+
+	MaxOrderNotional  float64
+	MaxDailyNotional  float64
+	MaxPositionWeight float64
+	MaxPriceDeviation float64
+}
+
+func (migrationV1CondextConfigModel) TableName() string {
+	return "condext_config_models"
+}
+
+type migrationV1IndexedSymbolModel struct {
+	gorm.Model
+
+	UUID              string
+	Symbol            string
+	Locked            bool
+	DesiredPercentage float64
+	CurrentPercentage float64
+	CurrentPrice      float64
+	Amount            int64
+	Sector            string
+}
+
+func (migrationV1IndexedSymbolModel) TableName() string {
+	return "indexed_symbol_models"
+}
+
+type migrationV1FillModel struct {
+	gorm.Model
+
+	UUID     string
+	Symbol   string
+	Side     string
+	Amount   int64
+	Price    float64
+	FilledAt time.Time
+}
+
+func (migrationV1FillModel) TableName() string {
+	return "fill_models"
+}
+
+type migrationV1TaxLotModel struct {
+	gorm.Model
+
+	UUID            string
+	Symbol          string
+	FillUUID        string
+	Amount          int64
+	RemainingAmount int64
+	CostBasis       float64
+	AcquiredAt      time.Time
+}
+
+func (migrationV1TaxLotModel) TableName() string {
+	return "tax_lot_models"
+}
+
+type migrationV1ClosedLotModel struct {
+	gorm.Model
+
+	UUID       string
+	LotUUID    string
+	FillUUID   string
+	Symbol     string
+	Amount     int64
+	AcquiredAt time.Time
+	SoldAt     time.Time
+	Proceeds   float64
+	CostBasis  float64
+
+	WashSaleAdjustment float64
+}
+
+func (migrationV1ClosedLotModel) TableName() string {
+	return "closed_lot_models"
+}
+
+type migrationV1SubstituteSymbolModel struct {
+	gorm.Model
+
+	Symbol           string
+	SubstituteSymbol string
+}
+
+func (migrationV1SubstituteSymbolModel) TableName() string {
+	return "substitute_symbol_models"
+}
+
+type migrationV1HarvestSwapModel struct {
+	gorm.Model
+
+	UUID             string
+	Symbol           string
+	SubstituteSymbol string
+	Amount           int64
+	SubstituteAmount int64
+	HarvestedLoss    float64
+	SwappedAt        time.Time
+	Completed        bool
+}
+
+func (migrationV1HarvestSwapModel) TableName() string {
+	return "harvest_swap_models"
+}
+
+type migrationV1PortfolioSnapshotModel struct {
+	gorm.Model
+
+	Value   float64
+	Cash    float64
+	NetFlow float64
+	TakenAt time.Time
+
+	BenchmarkSymbol string
+	BenchmarkPrice  float64
+}
+
+func (migrationV1PortfolioSnapshotModel) TableName() string {
+	return "portfolio_snapshot_models"
+}
+
+type migrationV1HoldingSnapshotModel struct {
+	gorm.Model
+
+	PortfolioSnapshotID uint
+	Symbol              string
+	Sector              string
+	Amount              int64
+	Price               float64
+	Value               float64
+	DesiredPercentage   float64
+	TakenAt             time.Time
+}
+
+func (migrationV1HoldingSnapshotModel) TableName() string {
+	return "holding_snapshot_models"
+}
+
+type migrationV1RebalanceStateModel struct {
+	gorm.Model
+
+	Mode       string
+	LastTickAt time.Time
+	LastError  string
+}
+
+func (migrationV1RebalanceStateModel) TableName() string {
+	return "rebalance_state_models"
+}
+
+type migrationV1RiskStateModel struct {
+	gorm.Model
+
+	Halted     bool
+	HaltReason string
+	HaltedAt   time.Time
+}
+
+func (migrationV1RiskStateModel) TableName() string {
+	return "risk_state_models"
+}
+
+type migrationV1RiskRejectionModel struct {
+	gorm.Model
+
+	Symbol     string
+	Side       string
+	Amount     int64
+	Price      float64
+	Source     string
+	Rule       string
+	Reason     string
+	RejectedAt time.Time
+}
+
+func (migrationV1RiskRejectionModel) TableName() string {
+	return "risk_rejection_models"
+}
+
+type migrationV1ConfigChangeModel struct {
+	gorm.Model
+
+	Key       string
+	OldValue  string
+	NewValue  string
+	Source    string
+	ChangedAt time.Time
+}
+
+func (migrationV1ConfigChangeModel) TableName() string {
+	return "config_change_models"
+}
+
+type migrationV2EventModel struct {
+	gorm.Model
+
+	Sequence     int64  `gorm:"unique_index"`
+	Type         string `gorm:"index"`
+	Actor        string
+	Symbol       string `gorm:"index"`
+	Payload      string
+	OccurredAt   time.Time
+	PreviousHash string
+	Hash         string
+}
+
+func (migrationV2EventModel) TableName() string {
+	return "event_models"
+}
+
+type migrationV3OrderIntentModel struct {
+	gorm.Model
+
+	ClientOrderId string `gorm:"index"`
+	Symbol        string `gorm:"index"`
+	Side          string
+	Amount        int64
+	Price         float64
+	Source        string
+	Status        string `gorm:"index"`
+	FilledAmount  int64
+	FillPrice     float64
+	Reason        string
+	ResolvedAt    *time.Time
+}
+
+func (migrationV3OrderIntentModel) TableName() string {
+	return "order_intent_models"
+}
+
+type migrationV4HarvestSwapModel struct {
+	BuyBackCash float64
+}
+
+func (migrationV4HarvestSwapModel) TableName() string {
+	return "harvest_swap_models"
+}
+
+type migrationV5OrderIntentModel struct {
+	LotUUIDs string
+	SwapID   uint
+}
+
+func (migrationV5OrderIntentModel) TableName() string {
+	return "order_intent_models"
+}
+
+type migrationV6ClosedLotModel struct {
+	WashSaleMatchedAmount int64
+}
+
+func (migrationV6ClosedLotModel) TableName() string {
+	return "closed_lot_models"
+}
@@ -0,0 +1,237 @@
+package managers
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"time"
+)
+
+// DatabaseMigration is one numbered schema change, versions only ever grow and a shipped migration is never edited
+type DatabaseMigration struct {
+	Version int64
+	Name    string
+	migrate func(transactionManager *DatabaseManager) error
+}
+
+// New models and column changes get a new entry at the end with a frozen model in database-migration-models.go, renames
+// and drops go through ModifyColumn or DropColumn here
+var databaseMigrations = []DatabaseMigration{
+	{
+		Version: 1,
+		Name:    "baseline schema",
+		migrate: func(transactionManager *DatabaseManager) error {
+
+			// Matches what AutoMigrate created before versioning so existing databases upgrade in place
+			return transactionManager.gormClient.AutoMigrate(
+				&migrationV1CondextConfigModel{},
+				&migrationV1IndexedSymbolModel{},
+				&migrationV1FillModel{},
+				&migrationV1TaxLotModel{},
+				&migrationV1ClosedLotModel{},
+				&migrationV1SubstituteSymbolModel{},
+				&migrationV1HarvestSwapModel{},
+				&migrationV1PortfolioSnapshotModel{},
+				&migrationV1HoldingSnapshotModel{},
+				&migrationV1RebalanceStateModel{},
+				&migrationV1RiskStateModel{},
+				&migrationV1RiskRejectionModel{},
+				&migrationV1ConfigChangeModel{},
+			).Error
+		},
+	},
+	{
+		Version: 2,
+		Name:    "event log",
+		migrate: func(transactionManager *DatabaseManager) error {
+
+			migrateError := transactionManager.gormClient.AutoMigrate(&migrationV2EventModel{}).Error
+
+			if migrateError != nil {
+				return migrateError
+			}
+
+			// Migrations run inside a transaction, the seeded events join it
+			return seedSymbolEvents(transactionManager)
+		},
+	},
+	{
+		Version: 3,
+		Name:    "order intents",
+		migrate: func(transactionManager *DatabaseManager) error {
+			return transactionManager.gormClient.AutoMigrate(&migrationV3OrderIntentModel{}).Error
+		},
+	},
+	{
+		Version: 4,
+		Name:    "harvest swap buy back cash",
+		migrate: func(transactionManager *DatabaseManager) error {
+			return transactionManager.gormClient.AutoMigrate(&migrationV4HarvestSwapModel{}).Error
+		},
+	},
+	{
+		Version: 5,
+		Name:    "order intent lots and swap",
+		migrate: func(transactionManager *DatabaseManager) error {
+			return transactionManager.gormClient.AutoMigrate(&migrationV5OrderIntentModel{}).Error
+		},
+	},
+	{
+		Version: 6,
+		Name:    "closed lot wash sale matched amount",
+		migrate: func(transactionManager *DatabaseManager) error {
+
+			migrateError := transactionManager.gormClient.AutoMigrate(&migrationV6ClosedLotModel{}).Error
+
+			if migrateError != nil {
+				return migrateError
+			}
+
+			// Lots adjusted before the count was kept get the share count their adjustment covers
+			return transactionManager.gormClient.Exec("UPDATE closed_lot_models SET wash_sale_matched_amount = " +
+				"CAST(ROUND(wash_sale_adjustment * amount / (cost_basis - proceeds)) AS INTEGER) " +
+				"WHERE wash_sale_adjustment != 0 AND cost_basis > proceeds").Error
+		},
+	},
+}
+
+// LatestSchemaVersion is the schema this build expects
+func LatestSchemaVersion() int64 {
+	return databaseMigrations[len(databaseMigrations)-1].Version
+}
+
+// GetSchemaVersion returns the highest applied migration, zero for a new or unversioned database
+func (databaseManager *DatabaseManager) GetSchemaVersion() (int64, error) {
+
+	schemaMigrationModel := dto.SchemaMigrationModel{}
+
+	findError := databaseManager.gormClient.Order("version desc").First(&schemaMigrationModel).Error
+
+	if gorm.IsRecordNotFoundError(findError) {
+		return 0, nil
+	}
+
+	if findError != nil {
+		return 0, findError
+	}
+
+	return schemaMigrationModel.Version, nil
+}
+
+// CheckSchemaVersion refuses a database written by a newer build, its columns may mean something this one does not know
+func (databaseManager *DatabaseManager) CheckSchemaVersion() error {
+
+	schemaVersion, schemaVersionError := databaseManager.GetSchemaVersion()
+
+	if schemaVersionError != nil {
+		return schemaVersionError
+	}
+
+	if schemaVersion > LatestSchemaVersion() {
+		return errors.New("database schema version " + strconv.FormatInt(schemaVersion, 10) + " is newer than the " +
+			strconv.FormatInt(LatestSchemaVersion(), 10) + " this build supports, upgrade condext before using it")
+	}
+
+	return nil
+}
+
+// CheckSchemaCurrent refuses any schema but the one this build expects, commands that do not hold the instance lock
+// may not migrate and an older schema is missing columns they read
+func (databaseManager *DatabaseManager) CheckSchemaCurrent() error {
+
+	checkError := databaseManager.CheckSchemaVersion()
+
+	if checkError != nil {
+		return checkError
+	}
+
+	schemaVersion, schemaVersionError := databaseManager.GetSchemaVersion()
+
+	if schemaVersionError != nil {
+		return schemaVersionError
+	}
+
+	if schemaVersion < LatestSchemaVersion() {
+		return errors.New("database schema version " + strconv.FormatInt(schemaVersion, 10) + " is older than the " +
+			strconv.FormatInt(LatestSchemaVersion(), 10) + " this build expects, run condext db migrate first")
+	}
+
+	return nil
+}
+
+// GetPendingMigrations lists the migrations a Migrate call would apply, in order
+func (databaseManager *DatabaseManager) GetPendingMigrations() ([]DatabaseMigration, error) {
+
+	checkError := databaseManager.CheckSchemaVersion()
+
+	if checkError != nil {
+		return nil, checkError
+	}
+
+	schemaVersion, schemaVersionError := databaseManager.GetSchemaVersion()
+
+	if schemaVersionError != nil {
+		return nil, schemaVersionError
+	}
+
+	pendingMigrations := []DatabaseMigration{}
+
+	for _, element := range databaseMigrations {
+		if element.Version > schemaVersion {
+			pendingMigrations = append(pendingMigrations, element)
+		}
+	}
+
+	return pendingMigrations, nil
+}
+
+// Migrate applies every pending migration in its own transaction and returns the ones applied
+func (databaseManager *DatabaseManager) Migrate() ([]DatabaseMigration, error) {
+	return databaseManager.migrateTo(LatestSchemaVersion())
+}
+
+// migrateTo applies the pending migrations up to and including the target version
+func (databaseManager *DatabaseManager) migrateTo(targetVersion int64) ([]DatabaseMigration, error) {
+
+	pendingMigrations, pendingMigrationsError := databaseManager.GetPendingMigrations()
+
+	if pendingMigrationsError != nil {
+		return nil, pendingMigrationsError
+	}
+
+	appliedMigrations := []DatabaseMigration{}
+
+	for _, element := range pendingMigrations {
+
+		if element.Version > targetVersion {
+			break
+		}
+
+		logrus.Info("Applying schema migration " + strconv.FormatInt(element.Version, 10) + " " + element.Name)
+
+		migrateError := databaseManager.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+			migrationError := element.migrate(transactionManager)
+
+			if migrationError != nil {
+				return migrationError
+			}
+
+			return transactionManager.gormClient.Create(&dto.SchemaMigrationModel{
+				Version:   element.Version,
+				Name:      element.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+
+		if migrateError != nil {
+			return appliedMigrations, errors.New("schema migration " + strconv.FormatInt(element.Version, 10) + " failed, " + migrateError.Error())
+		}
+
+		appliedMigrations = append(appliedMigrations, element)
+	}
+
+	return appliedMigrations, nil
+}
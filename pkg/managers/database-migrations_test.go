@@ -0,0 +1,253 @@
+package managers
+
+import (
+	"github.com/r4stl1n/condext/pkg/dto"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// sqliteSchema describes every table as its sorted columns with their types and its index names
+func sqliteSchema(t *testing.T, databaseManager *DatabaseManager) map[string][]string {
+
+	t.Helper()
+
+	schema := map[string][]string{}
+
+	tableRows, tableRowsError := databaseManager.gormClient.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").Rows()
+
+	if tableRowsError != nil {
+		t.Fatal(tableRowsError)
+	}
+
+	tableNames := []string{}
+
+	for tableRows.Next() {
+
+		var tableName string
+
+		scanError := tableRows.Scan(&tableName)
+
+		if scanError != nil {
+			tableRows.Close()
+			t.Fatal(scanError)
+		}
+
+		tableNames = append(tableNames, tableName)
+	}
+
+	tableRows.Close()
+
+	for _, tableName := range tableNames {
+
+		columnRows, columnRowsError := databaseManager.gormClient.Raw("SELECT name, type FROM pragma_table_info(?)", tableName).Rows()
+
+		if columnRowsError != nil {
+			t.Fatal(columnRowsError)
+		}
+
+		for columnRows.Next() {
+
+			var columnName, columnType string
+
+			scanError := columnRows.Scan(&columnName, &columnType)
+
+			if scanError != nil {
+				columnRows.Close()
+				t.Fatal(scanError)
+			}
+
+			schema[tableName] = append(schema[tableName], "column "+columnName+" "+columnType)
+		}
+
+		columnRows.Close()
+
+		indexRows, indexRowsError := databaseManager.gormClient.Raw("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ?", tableName).Rows()
+
+		if indexRowsError != nil {
+			t.Fatal(indexRowsError)
+		}
+
+		for indexRows.Next() {
+
+			var indexName string
+
+			scanError := indexRows.Scan(&indexName)
+
+			if scanError != nil {
+				indexRows.Close()
+				t.Fatal(scanError)
+			}
+
+			schema[tableName] = append(schema[tableName], "index "+indexName)
+		}
+
+		indexRows.Close()
+
+		sort.Strings(schema[tableName])
+	}
+
+	return schema
+}
+
+func TestMigrateSchema(t *testing.T) {
+
+	// The schema the current models describe, every migration path has to end here
+	modelDatabaseManager := openEmptyTestDatabaseManager(t)
+
+	modelError := modelDatabaseManager.gormClient.AutoMigrate(
+		&dto.CondextConfigModel{},
+		&dto.IndexedSymbolModel{},
+		&dto.FillModel{},
+		&dto.TaxLotModel{},
+		&dto.ClosedLotModel{},
+		&dto.SubstituteSymbolModel{},
+		&dto.HarvestSwapModel{},
+		&dto.PortfolioSnapshotModel{},
+		&dto.HoldingSnapshotModel{},
+		&dto.RebalanceStateModel{},
+		&dto.RiskStateModel{},
+		&dto.RiskRejectionModel{},
+		&dto.ConfigChangeModel{},
+		&dto.EventModel{},
+		&dto.OrderIntentModel{},
+	).Error
+
+	if modelError != nil {
+		t.Fatal(modelError)
+	}
+
+	modelSchema := sqliteSchema(t, modelDatabaseManager)
+
+	delete(modelSchema, "schema_migration_models")
+
+	testCases := []struct {
+		name         string
+		startVersion int64
+	}{
+		{"from an empty database", 0},
+		{"from the baseline", 1},
+		{"from the event log", 2},
+		{"from order intents", 3},
+		{"from buy back cash", 4},
+		{"from order intent lots", 5},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openEmptyTestDatabaseManager(t)
+
+			_, startError := databaseManager.migrateTo(testCase.startVersion)
+
+			if startError != nil {
+				t.Fatal(startError)
+			}
+
+			schemaVersion, schemaVersionError := databaseManager.GetSchemaVersion()
+
+			if schemaVersionError != nil {
+				t.Fatal(schemaVersionError)
+			}
+
+			if schemaVersion != testCase.startVersion {
+				t.Fatalf("started at version %d, want %d", schemaVersion, testCase.startVersion)
+			}
+
+			_, migrateError := databaseManager.Migrate()
+
+			if migrateError != nil {
+				t.Fatal(migrateError)
+			}
+
+			schema := sqliteSchema(t, databaseManager)
+
+			delete(schema, "schema_migration_models")
+
+			for tableName, modelTable := range modelSchema {
+				if reflect.DeepEqual(schema[tableName], modelTable) == false {
+					t.Errorf("%s differs from its model\n got %v\nwant %v", tableName, schema[tableName], modelTable)
+				}
+			}
+
+			for tableName := range schema {
+				if _, exists := modelSchema[tableName]; exists == false {
+					t.Errorf("migrations created %s, no model has it", tableName)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateBaselineIsFrozen(t *testing.T) {
+
+	databaseManager := openEmptyTestDatabaseManager(t)
+
+	_, migrateError := databaseManager.migrateTo(1)
+
+	if migrateError != nil {
+		t.Fatal(migrateError)
+	}
+
+	schema := sqliteSchema(t, databaseManager)
+
+	for _, tableName := range []string{"event_models", "order_intent_models"} {
+		if _, exists := schema[tableName]; exists == true {
+			t.Errorf("baseline created %s, a later migration adds it", tableName)
+		}
+	}
+
+	for _, column := range schema["harvest_swap_models"] {
+		if column == "column buy_back_cash real" {
+			t.Errorf("baseline created buy_back_cash, migration 4 adds it")
+		}
+	}
+}
+
+func TestMigrateWashSaleMatchedAmount(t *testing.T) {
+
+	databaseManager := openEmptyTestDatabaseManager(t)
+
+	_, startError := databaseManager.migrateTo(5)
+
+	if startError != nil {
+		t.Fatal(startError)
+	}
+
+	// 100 shares sold at a 2000 loss, 600 of it was disallowed before the matched count was kept
+	insertError := databaseManager.gormClient.Exec("INSERT INTO closed_lot_models (uuid, symbol, amount, proceeds, cost_basis, " +
+		"wash_sale_adjustment) VALUES ('adjusted', 'VTI', 100, 8000, 10000, 600), ('untouched', 'VTI', 100, 8000, 10000, 0)").Error
+
+	if insertError != nil {
+		t.Fatal(insertError)
+	}
+
+	_, migrateError := databaseManager.Migrate()
+
+	if migrateError != nil {
+		t.Fatal(migrateError)
+	}
+
+	testCases := []struct {
+		uuid          string
+		matchedAmount int64
+	}{
+		{"adjusted", 30},
+		{"untouched", 0},
+	}
+
+	for _, testCase := range testCases {
+
+		closedLot := dto.ClosedLotModel{}
+
+		findError := databaseManager.gormClient.Find(&closedLot, "uuid = ?", testCase.uuid).Error
+
+		if findError != nil {
+			t.Fatal(findError)
+		}
+
+		if closedLot.WashSaleMatchedAmount != testCase.matchedAmount {
+			t.Errorf("%s matched amount = %d, want %d", testCase.uuid, closedLot.WashSaleMatchedAmount, testCase.matchedAmount)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package managers
+
+import (
+	"errors"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/renderers"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/abiosoft/ishell.v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EventCommandManager struct {
+	eventMgr     *EventManager
+	rebalanceMgr *RebalanceManager
+}
+
+func CreateEventCommandManager(eventManager *EventManager, rebalanceManager *RebalanceManager) *EventCommandManager {
+
+	return &EventCommandManager{
+		eventMgr:     eventManager,
+		rebalanceMgr: rebalanceManager,
+	}
+}
+
+// ParseEventFilter reads the limit and the --type, --symbol, --actor and --since options of show_events
+func ParseEventFilter(args []string) (EventFilter, error) {
+
+	eventFilter := EventFilter{Limit: 50}
+
+	for index := 0; index < len(args); index++ {
+
+		if strings.HasPrefix(args[index], "--") == false {
+
+			parsedLimit, parseError := strconv.Atoi(args[index])
+
+			if parseError != nil || parsedLimit <= 0 {
+				return eventFilter, errors.New("limit must be a positive number")
+			}
+
+			eventFilter.Limit = parsedLimit
+			continue
+		}
+
+		if index+1 >= len(args) {
+			return eventFilter, errors.New(args[index] + " needs a value")
+		}
+
+		filterValue := args[index+1]
+		index = index + 1
+
+		switch args[index-1] {
+		case "--type":
+			eventFilter.Type = strings.ToLower(filterValue)
+		case "--symbol":
+			eventFilter.Symbol = strings.ToUpper(filterValue)
+		case "--actor":
+			eventFilter.Actor = filterValue
+		case "--since":
+
+			since, sinceError := time.ParseInLocation("2006-01-02", filterValue, time.Local)
+
+			if sinceError != nil {
+				return eventFilter, errors.New("--since must be a date like 2006-01-02")
+			}
+
+			eventFilter.Since = since
+		default:
+			return eventFilter, errors.New("unknown option " + args[index-1] + ", use --type, --symbol, --actor or --since")
+		}
+	}
+
+	return eventFilter, nil
+}
+
+func (eventCommandManager *EventCommandManager) GetEvents(eventFilter EventFilter) ([]dto.EventModel, error) {
+	return eventCommandManager.eventMgr.GetEvents(eventFilter)
+}
+
+func EventsView(eventModels []dto.EventModel) renderers.View {
+
+	view := renderers.View{
+		Name: "Events",
+		Columns: []renderers.ViewColumn{
+			{Key: "sequence", Title: "Sequence"},
+			{Key: "occurred_at", Title: "Occurred At"},
+			{Key: "type", Title: "Type"},
+			{Key: "actor", Title: "Actor"},
+			{Key: "symbol", Title: "Symbol"},
+			{Key: "payload", Title: "Payload"},
+		},
+	}
+
+	for _, element := range eventModels {
+		view.Rows = append(view.Rows, []string{strconv.FormatInt(element.Sequence, 10), element.OccurredAt.Local().Format("2006-01-02 15:04:05"),
+			element.Type, element.Actor, element.Symbol, element.Payload})
+	}
+
+	return view
+}
+
+func (eventCommandManager *EventCommandManager) ShowEventsCommand(c *ishell.Context) {
+
+	positionalArgs, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	eventFilter, eventFilterError := ParseEventFilter(positionalArgs)
+
+	if eventFilterError != nil {
+		logrus.Error(eventFilterError.Error())
+		return
+	}
+
+	eventModels, eventModelsError := eventCommandManager.GetEvents(eventFilter)
+
+	if eventModelsError != nil {
+		logrus.Error(eventModelsError.Error())
+		return
+	}
+
+	renderError := RenderView(EventsView(eventModels), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
+
+// Replay compares the index rebuilt from the events with the saved one, apply writes the rebuilt index back
+func (eventCommandManager *EventCommandManager) Replay(apply bool, source string) ([]ReplayDifference, error) {
+
+	if apply == false {
+		_, replayDifferences, compareError := eventCommandManager.eventMgr.CompareReplay()
+		return replayDifferences, compareError
+	}
+
+	if eventCommandManager.rebalanceMgr.IsRebalanceProcessRunning() == true {
+		return nil, errors.New("stop the rebalance process with index_stop before applying a replay")
+	}
+
+	return eventCommandManager.eventMgr.ApplyReplay(source)
+}
+
+func ReplayView(replayDifferences []ReplayDifference) renderers.View {
+
+	view := renderers.View{
+		Name: "Replay differences",
+		Columns: []renderers.ViewColumn{
+			{Key: "symbol", Title: "Symbol"},
+			{Key: "field", Title: "Field"},
+			{Key: "saved", Title: "Saved"},
+			{Key: "replayed", Title: "Replayed"},
+		},
+	}
+
+	for _, element := range replayDifferences {
+		view.Rows = append(view.Rows, []string{element.Symbol, element.Field, element.Saved, element.Replayed})
+	}
+
+	return view
+}
+
+func (eventCommandManager *EventCommandManager) ReplayCommand(c *ishell.Context) {
+
+	positionalArgs, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	if len(positionalArgs) > 1 || (len(positionalArgs) == 1 && positionalArgs[0] != "--apply") {
+		logrus.Warn("Only --apply is accepted")
+		return
+	}
+
+	apply := len(positionalArgs) == 1
+
+	replayDifferences, replayError := eventCommandManager.Replay(apply, SourceShell)
+
+	if replayError != nil {
+		logrus.Error(replayError.Error())
+		return
+	}
+
+	if len(replayDifferences) == 0 {
+		logrus.Info("The index rebuilt from the event log matches the saved index")
+		return
+	}
+
+	renderError := RenderView(ReplayView(replayDifferences), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+		return
+	}
+
+	if apply == true {
+		logrus.Info("Saved index replaced with the one rebuilt from the event log")
+	}
+}
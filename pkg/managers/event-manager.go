@@ -0,0 +1,562 @@
+package managers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/shopspring/decimal"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources name whatever made a change, the event actor is the source and the user running condext
+const (
+	SourceShell      = "shell"
+	SourceCli        = "cli"
+	SourceApi        = "api"
+	SourceConfigFile = "config_file"
+	SourceRebalance  = "rebalance"
+	SourceGenerate   = "generate"
+	SourceHarvest    = "harvest"
+	SourceSwapBack   = "swap_back"
+	SourceBrokerSync = "broker_sync"
+	SourceMigration  = "migration"
+	SourceRecovery   = "recovery"
+)
+
+const (
+	EventSymbolAdded        = "symbol_added"
+	EventSymbolRemoved      = "symbol_removed"
+	EventWeightChanged      = "weight_changed"
+	EventSectorChanged      = "sector_changed"
+	EventHoldingChanged     = "holding_changed"
+	EventConfigChanged      = "config_changed"
+	EventTradingHalted      = "trading_halted"
+	EventTradingResumed     = "trading_resumed"
+	EventOrderPlaced        = "order_placed"
+	EventOrderFilled        = "order_filled"
+	EventOrderFailed        = "order_failed"
+	EventOrderRejected      = "order_rejected"
+	EventRebalanceStarted   = "rebalance_started"
+	EventRebalanceCompleted = "rebalance_completed"
+	EventIndexReplayed      = "index_replayed"
+)
+
+// Payloads are stored as json, the symbol events carry everything a replay needs to rebuild the index
+type symbolAddedPayload struct {
+	DesiredPercentage float64 `json:"desired_percentage"`
+	Locked            bool    `json:"locked"`
+	Sector            string  `json:"sector,omitempty"`
+	Amount            int64   `json:"amount"`
+	Price             float64 `json:"price"`
+}
+
+type weightChangedPayload struct {
+	OldPercentage float64 `json:"old_percentage"`
+	NewPercentage float64 `json:"new_percentage"`
+}
+
+type sectorChangedPayload struct {
+	OldSector string `json:"old_sector"`
+	NewSector string `json:"new_sector"`
+}
+
+type holdingChangedPayload struct {
+	OldAmount int64   `json:"old_amount"`
+	NewAmount int64   `json:"new_amount"`
+	Price     float64 `json:"price"`
+}
+
+type configChangedPayload struct {
+	Key      string `json:"key"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+type tradingHaltPayload struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type orderPayload struct {
+	Side          string  `json:"side"`
+	Amount        int64   `json:"amount"`
+	Price         float64 `json:"price"`
+	ClientOrderId string  `json:"client_order_id,omitempty"`
+	Rule          string  `json:"rule,omitempty"`
+	Reason        string  `json:"reason,omitempty"`
+}
+
+type rebalancePayload struct {
+	PlannedTrades  int  `json:"planned_trades"`
+	DeferredTrades int  `json:"deferred_trades"`
+	FilledTrades   int  `json:"filled_trades,omitempty"`
+	FailedTrades   int  `json:"failed_trades,omitempty"`
+	Stopped        bool `json:"stopped,omitempty"`
+}
+
+type indexReplayedPayload struct {
+	Differences int `json:"differences"`
+}
+
+// EventFilter narrows show_events, empty fields match every event and the actor matches on its prefix
+type EventFilter struct {
+	Type   string
+	Symbol string
+	Actor  string
+	Since  time.Time
+	Limit  int
+}
+
+// ReplayDifference is a field where the saved index does not match the index rebuilt from the events
+type ReplayDifference struct {
+	Symbol   string `json:"symbol"`
+	Field    string `json:"field"`
+	Saved    string `json:"saved"`
+	Replayed string `json:"replayed"`
+}
+
+var eventUser = lookupEventUser()
+
+func lookupEventUser() string {
+
+	currentUser, currentUserError := user.Current()
+
+	if currentUserError == nil && currentUser.Username != "" {
+		return currentUser.Username
+	}
+
+	if os.Getenv("USER") != "" {
+		return os.Getenv("USER")
+	}
+
+	return "unknown"
+}
+
+func eventActor(source string) string {
+	return source + ":" + eventUser
+}
+
+// eventHash covers every field of the event and the hash before it, so changing or removing an event breaks the chain
+func eventHash(eventModel dto.EventModel) string {
+
+	hashInput := strings.Join([]string{
+		strconv.FormatInt(eventModel.Sequence, 10),
+		eventModel.Type,
+		eventModel.Actor,
+		eventModel.Symbol,
+		eventModel.Payload,
+		eventModel.OccurredAt.UTC().Format(time.RFC3339Nano),
+		eventModel.PreviousHash,
+	}, "\n")
+
+	hashSum := sha256.Sum256([]byte(hashInput))
+
+	return hex.EncodeToString(hashSum[:])
+}
+
+// eventWriteAttempts bounds how often an event in a transaction of its own is retried after another process took its
+// sequence
+const eventWriteAttempts = 3
+
+// isEventSequenceConflict is true for the errors a second writer gets from the unique sequence or a locked sqlite file
+func isEventSequenceConflict(writeError error) bool {
+
+	errorText := strings.ToLower(writeError.Error())
+
+	return strings.Contains(errorText, "unique") || strings.Contains(errorText, "database is locked")
+}
+
+// recordEvent appends an event to the log, inside a transaction it is only kept when the change it describes is.
+// Writers are serialized until their transaction ends and the unique sequence makes any writer that slips past fail
+// instead of forking the chain, an event with a transaction of its own is then written again
+func recordEvent(databaseManager *DatabaseManager, eventType string, source string, symbol string, payload interface{}) error {
+
+	payloadJson, payloadJsonError := json.Marshal(payload)
+
+	if payloadJsonError != nil {
+		return payloadJsonError
+	}
+
+	appendEvent := func(transactionManager *DatabaseManager) error {
+
+		lockError := transactionManager.lockEventLog()
+
+		if lockError != nil {
+			return lockError
+		}
+
+		eventModel := dto.EventModel{
+			Sequence: 1,
+			Type:     eventType,
+			Actor:    eventActor(source),
+			Symbol:   symbol,
+			Payload:  string(payloadJson),
+
+			// Postgres keeps microseconds, the hash has to match what is read back
+			OccurredAt: time.Now().UTC().Truncate(time.Microsecond),
+		}
+
+		lastEvent, lastEventError := transactionManager.GetLastEventModel()
+
+		if lastEventError == nil {
+			eventModel.Sequence = lastEvent.Sequence + 1
+			eventModel.PreviousHash = lastEvent.Hash
+		} else if gorm.IsRecordNotFoundError(lastEventError) == false {
+			return lastEventError
+		}
+
+		eventModel.Hash = eventHash(eventModel)
+
+		_, createError := transactionManager.CreateEventModel(eventModel)
+
+		return createError
+	}
+
+	// A failed insert aborts a postgres transaction, only a transaction this call owns can be run again
+	if databaseManager.inTransaction == true {
+		return databaseManager.RunInTransaction(appendEvent)
+	}
+
+	var recordError error
+
+	for attempt := 1; attempt <= eventWriteAttempts; attempt++ {
+
+		recordError = databaseManager.RunInTransaction(appendEvent)
+
+		if recordError == nil || isEventSequenceConflict(recordError) == false {
+			return recordError
+		}
+
+		time.Sleep(time.Duration(attempt) * 50 * time.Millisecond)
+	}
+
+	return recordError
+}
+
+func recordSymbolAdded(databaseManager *DatabaseManager, source string, indexedSymbol dto.IndexedSymbolModel) error {
+
+	return recordEvent(databaseManager, EventSymbolAdded, source, indexedSymbol.Symbol, symbolAddedPayload{
+		DesiredPercentage: indexedSymbol.DesiredPercentage,
+		Locked:            indexedSymbol.Locked,
+		Sector:            indexedSymbol.Sector,
+		Amount:            indexedSymbol.Amount,
+		Price:             indexedSymbol.CurrentPrice,
+	})
+}
+
+func recordHoldingChange(databaseManager *DatabaseManager, source string, symbol string, oldAmount int64, newAmount int64, price float64) error {
+
+	return recordEvent(databaseManager, EventHoldingChanged, source, symbol, holdingChangedPayload{
+		OldAmount: oldAmount,
+		NewAmount: newAmount,
+		Price:     price,
+	})
+}
+
+func recordConfigChange(databaseManager *DatabaseManager, source string, key string, oldValue string, newValue string) error {
+
+	return recordEvent(databaseManager, EventConfigChanged, source, "", configChangedPayload{
+		Key:      key,
+		OldValue: oldValue,
+		NewValue: newValue,
+	})
+}
+
+// seedSymbolEvents gives a database from before the event log a symbol_added event per holding so replays start from it
+func seedSymbolEvents(databaseManager *DatabaseManager) error {
+
+	indexedSymbols, indexedSymbolsError := databaseManager.GetAllIndexedSymbols()
+
+	if indexedSymbolsError != nil {
+		return indexedSymbolsError
+	}
+
+	for _, element := range indexedSymbols {
+
+		recordError := recordSymbolAdded(databaseManager, SourceMigration, element)
+
+		if recordError != nil {
+			return recordError
+		}
+	}
+
+	return nil
+}
+
+type EventManager struct {
+	databaseMgr *DatabaseManager
+}
+
+func CreateEventManager(databaseManager *DatabaseManager) *EventManager {
+
+	return &EventManager{
+		databaseMgr: databaseManager,
+	}
+}
+
+func (eventManager *EventManager) GetEvents(eventFilter EventFilter) ([]dto.EventModel, error) {
+	return eventManager.databaseMgr.GetEventModels(eventFilter)
+}
+
+// VerifyChain walks the log from the first event and reports every event that was changed, removed or inserted
+func (eventManager *EventManager) VerifyChain() ([]string, error) {
+
+	eventModels, eventModelsError := eventManager.databaseMgr.GetAllEventModels()
+
+	if eventModelsError != nil {
+		return nil, eventModelsError
+	}
+
+	problems := []string{}
+	previousHash := ""
+
+	for index, element := range eventModels {
+
+		sequenceText := strconv.FormatInt(element.Sequence, 10)
+
+		if element.Sequence != int64(index+1) {
+			problems = append(problems, "event log skips from "+strconv.Itoa(index)+" to "+sequenceText+", events were removed")
+		}
+
+		if element.DeletedAt != nil {
+			problems = append(problems, "event "+sequenceText+" was deleted")
+		}
+
+		if element.PreviousHash != previousHash {
+			problems = append(problems, "event "+sequenceText+" does not follow the event before it")
+		}
+
+		if eventHash(element) != element.Hash {
+			problems = append(problems, "event "+sequenceText+" was changed after it was written")
+		}
+
+		previousHash = element.Hash
+	}
+
+	return problems, nil
+}
+
+// replayIndexedSymbols rebuilds the symbol, weight, lock, sector and amount of every holding from the events,
+// current percentages come from market prices and are left for the next rebalance tick
+func replayIndexedSymbols(eventModels []dto.EventModel) ([]dto.IndexedSymbolModel, error) {
+
+	replayedSymbols := []dto.IndexedSymbolModel{}
+	symbolIndexes := map[string]int{}
+
+	for _, element := range eventModels {
+
+		sequenceText := strconv.FormatInt(element.Sequence, 10)
+		symbolIndex, symbolKnown := symbolIndexes[element.Symbol]
+
+		switch element.Type {
+		case EventSymbolAdded:
+
+			payload := symbolAddedPayload{}
+
+			unmarshalError := json.Unmarshal([]byte(element.Payload), &payload)
+
+			if unmarshalError != nil {
+				return nil, errors.New("event " + sequenceText + " has an unreadable payload, " + unmarshalError.Error())
+			}
+
+			replayedSymbol := dto.IndexedSymbolModel{
+				Symbol:            element.Symbol,
+				Locked:            payload.Locked,
+				DesiredPercentage: payload.DesiredPercentage,
+				CurrentPrice:      payload.Price,
+				Amount:            payload.Amount,
+				Sector:            payload.Sector,
+			}
+
+			if symbolKnown == true {
+				replayedSymbols[symbolIndex] = replayedSymbol
+				continue
+			}
+
+			symbolIndexes[element.Symbol] = len(replayedSymbols)
+			replayedSymbols = append(replayedSymbols, replayedSymbol)
+		case EventSymbolRemoved:
+
+			if symbolKnown == false {
+				continue
+			}
+
+			replayedSymbols = append(replayedSymbols[:symbolIndex], replayedSymbols[symbolIndex+1:]...)
+
+			delete(symbolIndexes, element.Symbol)
+
+			for symbol, index := range symbolIndexes {
+				if index > symbolIndex {
+					symbolIndexes[symbol] = index - 1
+				}
+			}
+		case EventWeightChanged, EventSectorChanged, EventHoldingChanged:
+
+			if symbolKnown == false {
+				return nil, errors.New("event " + sequenceText + " changes " + element.Symbol + " before it was added")
+			}
+
+			var unmarshalError error
+
+			switch element.Type {
+			case EventWeightChanged:
+
+				payload := weightChangedPayload{}
+				unmarshalError = json.Unmarshal([]byte(element.Payload), &payload)
+				replayedSymbols[symbolIndex].DesiredPercentage = payload.NewPercentage
+			case EventSectorChanged:
+
+				payload := sectorChangedPayload{}
+				unmarshalError = json.Unmarshal([]byte(element.Payload), &payload)
+				replayedSymbols[symbolIndex].Sector = payload.NewSector
+			case EventHoldingChanged:
+
+				payload := holdingChangedPayload{}
+				unmarshalError = json.Unmarshal([]byte(element.Payload), &payload)
+				replayedSymbols[symbolIndex].Amount = payload.NewAmount
+
+				if payload.Price > 0 {
+					replayedSymbols[symbolIndex].CurrentPrice = payload.Price
+				}
+			}
+
+			if unmarshalError != nil {
+				return nil, errors.New("event " + sequenceText + " has an unreadable payload, " + unmarshalError.Error())
+			}
+		}
+	}
+
+	return replayedSymbols, nil
+}
+
+// CompareReplay rebuilds the index from the events and lists where it differs from the saved index
+func (eventManager *EventManager) CompareReplay() ([]dto.IndexedSymbolModel, []ReplayDifference, error) {
+
+	eventModels, eventModelsError := eventManager.databaseMgr.GetAllEventModels()
+
+	if eventModelsError != nil {
+		return nil, nil, eventModelsError
+	}
+
+	replayedSymbols, replayError := replayIndexedSymbols(eventModels)
+
+	if replayError != nil {
+		return nil, nil, replayError
+	}
+
+	indexedSymbols, indexedSymbolsError := eventManager.databaseMgr.GetAllIndexedSymbols()
+
+	if indexedSymbolsError != nil {
+		return nil, nil, indexedSymbolsError
+	}
+
+	savedSymbols := map[string]dto.IndexedSymbolModel{}
+
+	for _, element := range indexedSymbols {
+		savedSymbols[element.Symbol] = element
+	}
+
+	replayDifferences := []ReplayDifference{}
+
+	for _, replayed := range replayedSymbols {
+
+		saved, savedFound := savedSymbols[replayed.Symbol]
+
+		if savedFound == false {
+			replayDifferences = append(replayDifferences, ReplayDifference{Symbol: replayed.Symbol, Field: "symbol", Saved: "missing", Replayed: "indexed"})
+			continue
+		}
+
+		delete(savedSymbols, replayed.Symbol)
+
+		if saved.DesiredPercentage != replayed.DesiredPercentage {
+			replayDifferences = append(replayDifferences, ReplayDifference{Symbol: replayed.Symbol, Field: "desired_percentage",
+				Saved: decimal.NewFromFloat(saved.DesiredPercentage).String(), Replayed: decimal.NewFromFloat(replayed.DesiredPercentage).String()})
+		}
+
+		if saved.Amount != replayed.Amount {
+			replayDifferences = append(replayDifferences, ReplayDifference{Symbol: replayed.Symbol, Field: "amount",
+				Saved: strconv.FormatInt(saved.Amount, 10), Replayed: strconv.FormatInt(replayed.Amount, 10)})
+		}
+
+		if saved.Locked != replayed.Locked {
+			replayDifferences = append(replayDifferences, ReplayDifference{Symbol: replayed.Symbol, Field: "locked",
+				Saved: strconv.FormatBool(saved.Locked), Replayed: strconv.FormatBool(replayed.Locked)})
+		}
+
+		if saved.Sector != replayed.Sector {
+			replayDifferences = append(replayDifferences, ReplayDifference{Symbol: replayed.Symbol, Field: "sector",
+				Saved: saved.Sector, Replayed: replayed.Sector})
+		}
+	}
+
+	for _, element := range indexedSymbols {
+		if _, untracked := savedSymbols[element.Symbol]; untracked == true {
+			replayDifferences = append(replayDifferences, ReplayDifference{Symbol: element.Symbol, Field: "symbol", Saved: "indexed", Replayed: "missing"})
+		}
+	}
+
+	return replayedSymbols, replayDifferences, nil
+}
+
+// ApplyReplay writes the replayed index over the saved one, a symbol with no events is reported but left alone
+func (eventManager *EventManager) ApplyReplay(source string) ([]ReplayDifference, error) {
+
+	replayedSymbols, replayDifferences, compareError := eventManager.CompareReplay()
+
+	if compareError != nil {
+		return nil, compareError
+	}
+
+	if len(replayDifferences) == 0 {
+		return replayDifferences, nil
+	}
+
+	applyError := eventManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		for _, replayed := range replayedSymbols {
+
+			saved, savedError := transactionManager.GetIndexedSymbolBySymbol(replayed.Symbol)
+
+			if gorm.IsRecordNotFoundError(savedError) {
+
+				_, createError := transactionManager.CreateIndexSymbolModel(replayed)
+
+				if createError != nil {
+					return createError
+				}
+
+				continue
+			}
+
+			if savedError != nil {
+				return savedError
+			}
+
+			saved.DesiredPercentage = replayed.DesiredPercentage
+			saved.Amount = replayed.Amount
+			saved.Locked = replayed.Locked
+			saved.Sector = replayed.Sector
+
+			_, updateError := transactionManager.UpdateIndexedSymbolModel(saved)
+
+			if updateError != nil {
+				return updateError
+			}
+		}
+
+		return recordEvent(transactionManager, EventIndexReplayed, source, "", indexReplayedPayload{Differences: len(replayDifferences)})
+	})
+
+	if applyError != nil {
+		return nil, applyError
+	}
+
+	return replayDifferences, nil
+}
@@ -0,0 +1,227 @@
+package managers
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventHash(t *testing.T) {
+
+	baseEvent := dto.EventModel{
+		Sequence:     2,
+		Type:         EventConfigChanged,
+		Actor:        "shell:tester",
+		Symbol:       "",
+		Payload:      `{"key":"order_timeout"}`,
+		OccurredAt:   time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC),
+		PreviousHash: "abc",
+		Hash:         "ignored",
+	}
+
+	testCases := []struct {
+		name    string
+		change  func(eventModel *dto.EventModel)
+		changed bool
+	}{
+		{"same event", func(eventModel *dto.EventModel) {}, false},
+		{"stored hash is not hashed", func(eventModel *dto.EventModel) { eventModel.Hash = "other" }, false},
+		{"same instant in another zone", func(eventModel *dto.EventModel) {
+			eventModel.OccurredAt = eventModel.OccurredAt.In(time.FixedZone("EST", -5*60*60))
+		}, false},
+		{"sequence", func(eventModel *dto.EventModel) { eventModel.Sequence = 3 }, true},
+		{"type", func(eventModel *dto.EventModel) { eventModel.Type = EventWeightChanged }, true},
+		{"actor", func(eventModel *dto.EventModel) { eventModel.Actor = "api:tester" }, true},
+		{"symbol", func(eventModel *dto.EventModel) { eventModel.Symbol = "VTI" }, true},
+		{"payload", func(eventModel *dto.EventModel) { eventModel.Payload = `{"key":"rebalance_frequency"}` }, true},
+		{"occurred at", func(eventModel *dto.EventModel) { eventModel.OccurredAt = eventModel.OccurredAt.Add(time.Microsecond) }, true},
+		{"previous hash", func(eventModel *dto.EventModel) { eventModel.PreviousHash = "abd" }, true},
+	}
+
+	baseHash := eventHash(baseEvent)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			changedEvent := baseEvent
+			testCase.change(&changedEvent)
+
+			if (eventHash(changedEvent) != baseHash) != testCase.changed {
+				t.Errorf("hash changed = %v, want %v", eventHash(changedEvent) != baseHash, testCase.changed)
+			}
+		})
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+
+	testCases := []struct {
+		name     string
+		tamper   func(gormClient *gorm.DB) error
+		problems []string
+	}{
+		{
+			"untouched log",
+			func(gormClient *gorm.DB) error { return nil },
+			[]string{},
+		},
+		{
+			"payload changed",
+			func(gormClient *gorm.DB) error {
+				return gormClient.Model(&dto.EventModel{}).Where("sequence = ?", 2).Update("payload", "{}").Error
+			},
+			[]string{"event 2 was changed after it was written"},
+		},
+		{
+			"event soft deleted",
+			func(gormClient *gorm.DB) error {
+				return gormClient.Where("sequence = ?", 2).Delete(&dto.EventModel{}).Error
+			},
+			[]string{"event 2 was deleted"},
+		},
+		{
+			"event removed",
+			func(gormClient *gorm.DB) error {
+				return gormClient.Unscoped().Where("sequence = ?", 2).Delete(&dto.EventModel{}).Error
+			},
+			[]string{"event log skips from 1 to 3, events were removed", "event 3 does not follow the event before it"},
+		},
+		{
+			"event changed and rehashed",
+			func(gormClient *gorm.DB) error {
+
+				eventModel := dto.EventModel{}
+
+				findError := gormClient.Where("sequence = ?", 2).First(&eventModel).Error
+
+				if findError != nil {
+					return findError
+				}
+
+				eventModel.Payload = "{}"
+				eventModel.Hash = eventHash(eventModel)
+
+				return gormClient.Save(&eventModel).Error
+			},
+			[]string{"event 3 does not follow the event before it"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			for _, element := range []string{"10", "20", "30"} {
+
+				recordError := recordConfigChange(databaseManager, SourceShell, "order_timeout", "", element)
+
+				if recordError != nil {
+					t.Fatal(recordError)
+				}
+			}
+
+			tamperError := testCase.tamper(databaseManager.gormClient)
+
+			if tamperError != nil {
+				t.Fatal(tamperError)
+			}
+
+			problems, verifyError := CreateEventManager(databaseManager).VerifyChain()
+
+			if verifyError != nil {
+				t.Fatal(verifyError)
+			}
+
+			if reflect.DeepEqual(problems, testCase.problems) == false {
+				t.Errorf("VerifyChain = %q, want %q", problems, testCase.problems)
+			}
+		})
+	}
+}
+
+func TestRecordEventConcurrently(t *testing.T) {
+
+	testCases := []struct {
+		name            string
+		writers         int
+		eventsPerWriter int
+		joined          bool
+	}{
+		{"events in transactions of their own", 8, 5, false},
+		{"events joining a longer transaction", 4, 3, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			writerGroup := sync.WaitGroup{}
+			writerErrors := make(chan error, testCase.writers)
+
+			for writer := 0; writer < testCase.writers; writer++ {
+
+				writerGroup.Add(1)
+
+				go func(writer int) {
+
+					defer writerGroup.Done()
+
+					writeEvents := func(writeManager *DatabaseManager) error {
+
+						for event := 0; event < testCase.eventsPerWriter; event++ {
+
+							recordError := recordConfigChange(writeManager, SourceShell, "writer_"+strconv.Itoa(writer), "", strconv.Itoa(event))
+
+							if recordError != nil {
+								return recordError
+							}
+						}
+
+						return nil
+					}
+
+					if testCase.joined == true {
+						writerErrors <- databaseManager.RunInTransaction(writeEvents)
+					} else {
+						writerErrors <- writeEvents(databaseManager)
+					}
+				}(writer)
+			}
+
+			writerGroup.Wait()
+			close(writerErrors)
+
+			for writerError := range writerErrors {
+				if writerError != nil {
+					t.Fatal(writerError)
+				}
+			}
+
+			eventModels, eventModelsError := databaseManager.GetAllEventModels()
+
+			if eventModelsError != nil {
+				t.Fatal(eventModelsError)
+			}
+
+			if len(eventModels) != testCase.writers*testCase.eventsPerWriter {
+				t.Errorf("got %d events, want %d", len(eventModels), testCase.writers*testCase.eventsPerWriter)
+			}
+
+			problems, verifyError := CreateEventManager(databaseManager).VerifyChain()
+
+			if verifyError != nil {
+				t.Fatal(verifyError)
+			}
+
+			if len(problems) != 0 {
+				t.Errorf("VerifyChain = %q, want no problems", problems)
+			}
+		})
+	}
+}
@@ -1,57 +1,47 @@
 package managers
 
 import (
+	"context"
+	"errors"
 	"github.com/r4stl1n/condext/pkg/broker-integrations"
 	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/renderers"
 	"github.com/r4stl1n/condext/pkg/util"
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/abiosoft/ishell.v2"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type IndexCommandManager struct {
 	databaseMgr  *DatabaseManager
 	rebalanceMgr *RebalanceManager
+	taxMgr       *TaxManager
 
+	marketCalendarMgr *MarketCalendarManager
+	riskMgr           *RiskManager
 	brokerIntegration *broker_integrations.BrokerIntegrationInterface
 }
 
-func CreateIndexCommandManager(databaseManager *DatabaseManager, rebalanceManager *RebalanceManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *IndexCommandManager {
+func CreateIndexCommandManager(databaseManager *DatabaseManager, rebalanceManager *RebalanceManager, taxManager *TaxManager, marketCalendarManager *MarketCalendarManager, riskManager *RiskManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *IndexCommandManager {
 
 	return &IndexCommandManager{
 		databaseMgr:       databaseManager,
 		rebalanceMgr:      rebalanceManager,
+		taxMgr:            taxManager,
+		marketCalendarMgr: marketCalendarManager,
+		riskMgr:           riskManager,
 		brokerIntegration: &selectedBrokerIntegration,
 	}
 }
 
-func (indexCommandManager *IndexCommandManager) AddSymbolToIndexCommand(c *ishell.Context) {
-
-	// Grab the arguments from the command and validate them
-
-	// Check that we have enough arguments
-	if len(c.Args) != 3 {
-		logrus.Warn("Not enough parameters submitted")
-		return
-	}
+func (indexCommandManager *IndexCommandManager) AddSymbolToIndex(symbolToAdd string, symbolPercentage decimal.Decimal, symbolLocked bool, source string) (dto.IndexedSymbolModel, error) {
 
-	symbolToAdd := strings.ToUpper(c.Args[0])
-	symbolPercentage, symbolPercentageError := decimal.NewFromString(c.Args[1])
-	symbolLocked, symbolLockedError := strconv.ParseBool(c.Args[2])
+	symbolToAdd = strings.ToUpper(symbolToAdd)
 	symbolPercentageConverted, _ := symbolPercentage.Round(2).Float64()
 
-	if symbolPercentageError != nil {
-		logrus.Error(symbolPercentageError.Error())
-		return
-	}
-
-	if symbolLockedError != nil {
-		logrus.Error(symbolLockedError.Error())
-		return
-	}
-
 	// Round the percentage to 2 points
 	symbolPercentage = symbolPercentage.Round(3)
 
@@ -59,37 +49,32 @@ func (indexCommandManager *IndexCommandManager) AddSymbolToIndexCommand(c *ishel
 	indexSymbolExist := indexCommandManager.databaseMgr.CheckIfSymbolIsIndexed(symbolToAdd)
 
 	if indexSymbolExist == true {
-		logrus.Error("Requested symbol is already indexed")
-		return
+		return dto.IndexedSymbolModel{}, errors.New("requested symbol is already indexed")
 	}
 
 	// Now validate if the symbol exist
 	symbolExist, symbolExistError := (*indexCommandManager.brokerIntegration).CheckIfSymbolIsValid(symbolToAdd)
 
 	if symbolExistError != nil {
-		logrus.Error(symbolExistError.Error())
-		return
+		return dto.IndexedSymbolModel{}, symbolExistError
 	}
 
 	if symbolExist != true {
-		logrus.Error("Symbol does not exist or is not tradeable on broker")
-		return
+		return dto.IndexedSymbolModel{}, errors.New("symbol does not exist or is not tradeable on broker")
 	}
 
 	// Now we need to get the quote price
 	symbolQuotePrice, symbolQuotePriceError := (*indexCommandManager.brokerIntegration).GetSymbolQuotePrice(symbolToAdd)
 
 	if symbolQuotePriceError != nil {
-		logrus.Error(symbolQuotePriceError.Error())
-		return
+		return dto.IndexedSymbolModel{}, symbolQuotePriceError
 	}
 
 	// First we need to grab all the current indexed symbols
 	indexedSymbols, indexedSymbolsError := indexCommandManager.databaseMgr.GetAllIndexedSymbols()
 
 	if indexedSymbolsError != nil {
-		logrus.Error(indexedSymbolsError)
-		return
+		return dto.IndexedSymbolModel{}, indexedSymbolsError
 	}
 
 	// Next we need to calculate the total locked and unlocked percentages available
@@ -110,103 +95,465 @@ func (indexCommandManager *IndexCommandManager) AddSymbolToIndexCommand(c *ishel
 
 	// Check if we have enough free percentage
 	if totalFreePercentage.GreaterThanOrEqual(symbolPercentage) {
+
+		addedSymbol := dto.IndexedSymbolModel{}
+
+		transactionError := indexCommandManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+			var createError error
+
+			// We have enough total free we can go ahead and move forward
+			addedSymbol, createError = transactionManager.CreateIndexSymbolModel(dto.IndexedSymbolModel{
+				Symbol:            symbolToAdd,
+				Locked:            symbolLocked,
+				DesiredPercentage: symbolPercentageConverted,
+			})
+
+			if createError != nil {
+				return createError
+			}
+
+			return recordSymbolAdded(transactionManager, source, addedSymbol)
+		})
+
+		if transactionError != nil {
+			return dto.IndexedSymbolModel{}, transactionError
+		}
+
+		return addedSymbol, nil
+	}
+
+	// Now validate we have enough unlocked percentage to add
+	if totalPercentageUnlocked.LessThan(symbolPercentage) {
+		return dto.IndexedSymbolModel{}, errors.New("requested percentage is more than available unlocked percentage")
+	}
+
+	// Remove the percentage from the other coins
+
+	percentageToRemove := symbolPercentage.Div(totalUnlockedSymbolsCount).Round(2)
+
+	addedSymbol := dto.IndexedSymbolModel{}
+
+	// The weights only ever change together so they keep summing to 100
+	transactionError := indexCommandManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		for _, indexedSymbol := range indexedSymbols {
+
+			if indexedSymbol.Locked == false {
+
+				oldPercentage := indexedSymbol.DesiredPercentage
+
+				indexedSymbol.DesiredPercentage, _ = decimal.NewFromFloat(indexedSymbol.DesiredPercentage).Sub(percentageToRemove).Round(2).Float64()
+
+				_, updateError := transactionManager.UpdateIndexedSymbolModel(indexedSymbol)
+
+				if updateError != nil {
+					return updateError
+				}
+
+				eventError := recordEvent(transactionManager, EventWeightChanged, source, indexedSymbol.Symbol, weightChangedPayload{
+					OldPercentage: oldPercentage,
+					NewPercentage: indexedSymbol.DesiredPercentage,
+				})
+
+				if eventError != nil {
+					return eventError
+				}
+			}
+		}
+
+		var createError error
+
 		// We have enough total free we can go ahead and move forward
-		_, createIndexSymbolError := indexCommandManager.databaseMgr.CreateIndexSymbolModel(dto.IndexedSymbolModel{
+		addedSymbol, createError = transactionManager.CreateIndexSymbolModel(dto.IndexedSymbolModel{
 			Symbol:            symbolToAdd,
 			Locked:            symbolLocked,
+			CurrentPrice:      symbolQuotePrice,
 			DesiredPercentage: symbolPercentageConverted,
 		})
 
-		if createIndexSymbolError != nil {
-			logrus.Error(createIndexSymbolError.Error())
-			return
+		if createError != nil {
+			return createError
 		}
 
-		logrus.Info("Symbol " + symbolToAdd + " added to index")
+		return recordSymbolAdded(transactionManager, source, addedSymbol)
+	})
+
+	if transactionError != nil {
+		return dto.IndexedSymbolModel{}, transactionError
+	}
+
+	return addedSymbol, nil
+}
+
+func (indexCommandManager *IndexCommandManager) AddSymbolToIndexCommand(c *ishell.Context) {
+
+	// Grab the arguments from the command and validate them
+
+	// Check that we have enough arguments
+	if len(c.Args) != 3 {
+		logrus.Warn("Not enough parameters submitted")
 		return
 	}
 
-	// Now validate we have enough unlocked percentage to add
-	if totalPercentageUnlocked.LessThan(symbolPercentage) {
-		logrus.Error("Requested percentage is more than available unlocked percentage")
+	symbolPercentage, symbolPercentageError := decimal.NewFromString(c.Args[1])
+	symbolLocked, symbolLockedError := strconv.ParseBool(c.Args[2])
+
+	if symbolPercentageError != nil {
+		logrus.Error(symbolPercentageError.Error())
 		return
 	}
 
-	// Remove the percentage from the other coins
+	if symbolLockedError != nil {
+		logrus.Error(symbolLockedError.Error())
+		return
+	}
 
-	percentageToRemove := symbolPercentage.Div(totalUnlockedSymbolsCount).Round(2)
-	_ = symbolLocked
+	indexedSymbol, addSymbolError := indexCommandManager.AddSymbolToIndex(c.Args[0], symbolPercentage, symbolLocked, SourceShell)
 
-	for _, indexedSymbol := range indexedSymbols {
+	if addSymbolError != nil {
+		logrus.Error(addSymbolError.Error())
+		return
+	}
 
-		if indexedSymbol.Locked == false {
+	logrus.Info("Symbol " + indexedSymbol.Symbol + " added to index")
+}
 
-			indexedSymbol.DesiredPercentage, _ = decimal.NewFromFloat(indexedSymbol.DesiredPercentage).Sub(percentageToRemove).Round(2).Float64()
+func (indexCommandManager *IndexCommandManager) SetBenchmark(benchmarkSymbol string, source string) error {
 
-			_, updateError := indexCommandManager.databaseMgr.UpdateIndexedSymbolModel(indexedSymbol)
+	benchmarkSymbol = strings.ToUpper(benchmarkSymbol)
 
-			if updateError != nil {
-				logrus.Error(updateError.Error())
-			}
+	symbolExist, symbolExistError := (*indexCommandManager.brokerIntegration).CheckIfSymbolIsValid(benchmarkSymbol)
+
+	if symbolExistError != nil {
+		return symbolExistError
+	}
+
+	if symbolExist != true {
+		return errors.New("symbol does not exist or is not tradeable on broker")
+	}
+
+	condextConfigModel, condextConfigModelError := indexCommandManager.databaseMgr.GetCondextConfigModel()
+
+	if condextConfigModelError != nil {
+		return condextConfigModelError
+	}
+
+	oldBenchmarkSymbol := condextConfigModel.BenchmarkSymbol
+	condextConfigModel.BenchmarkSymbol = benchmarkSymbol
+
+	return indexCommandManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		_, updateError := transactionManager.UpdateCondextConfig(condextConfigModel)
+
+		if updateError != nil {
+			return updateError
+		}
+
+		return recordConfigChange(transactionManager, source, "benchmark_symbol", oldBenchmarkSymbol, benchmarkSymbol)
+	})
+}
+
+func (indexCommandManager *IndexCommandManager) SetBenchmarkCommand(c *ishell.Context) {
+
+	if len(c.Args) != 1 {
+		logrus.Warn("Not enough parameters submitted")
+		return
+	}
+
+	benchmarkError := indexCommandManager.SetBenchmark(c.Args[0], SourceShell)
+
+	if benchmarkError != nil {
+		logrus.Error(benchmarkError.Error())
+		return
+	}
+
+	logrus.Info("Index benchmark set to " + strings.ToUpper(c.Args[0]))
+}
+
+// SetTradeWindow limits trading to a part of the session, off clears the window
+func (indexCommandManager *IndexCommandManager) SetTradeWindow(windowStart string, windowEnd string, source string) error {
+
+	if strings.ToLower(windowStart) == "off" {
+		windowStart = ""
+		windowEnd = ""
+	}
+
+	windowError := util.ValidateTradeWindow(windowStart, windowEnd)
+
+	if windowError != nil {
+		return windowError
+	}
+
+	condextConfigModel, condextConfigModelError := indexCommandManager.databaseMgr.GetCondextConfigModel()
+
+	if condextConfigModelError != nil {
+		return condextConfigModelError
+	}
+
+	oldTradeWindow := condextConfigModel.TradeWindowStart + "-" + condextConfigModel.TradeWindowEnd
+
+	condextConfigModel.TradeWindowStart = windowStart
+	condextConfigModel.TradeWindowEnd = windowEnd
+
+	return indexCommandManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		_, updateError := transactionManager.UpdateCondextConfig(condextConfigModel)
+
+		if updateError != nil {
+			return updateError
 		}
+
+		return recordConfigChange(transactionManager, source, "trade_window", strings.Trim(oldTradeWindow, "-"), strings.Trim(windowStart+"-"+windowEnd, "-"))
+	})
+}
+
+func tradeWindowMessage(windowStart string, windowEnd string) string {
+
+	if strings.ToLower(windowStart) == "off" {
+		return "Trade window cleared, trading the whole session"
 	}
 
-	// We have enough total free we can go ahead and move forward
-	_, createIndexSymbolError := indexCommandManager.databaseMgr.CreateIndexSymbolModel(dto.IndexedSymbolModel{
-		Symbol:            symbolToAdd,
-		Locked:            symbolLocked,
-		CurrentPrice:      symbolQuotePrice,
-		DesiredPercentage: symbolPercentageConverted,
+	return "Trade window set to " + windowStart + "-" + windowEnd + " ET"
+}
+
+func (indexCommandManager *IndexCommandManager) SetTradeWindowCommand(c *ishell.Context) {
+
+	if len(c.Args) == 1 && strings.ToLower(c.Args[0]) == "off" {
+		c.Args = append(c.Args, "")
+	}
+
+	if len(c.Args) != 2 {
+		logrus.Warn("Not enough parameters submitted")
+		return
+	}
+
+	windowError := indexCommandManager.SetTradeWindow(c.Args[0], c.Args[1], SourceShell)
+
+	if windowError != nil {
+		logrus.Error(windowError.Error())
+		return
+	}
+
+	logrus.Info(tradeWindowMessage(c.Args[0], c.Args[1]))
+}
+
+func (indexCommandManager *IndexCommandManager) SetSector(symbol string, sector string, source string) (dto.IndexedSymbolModel, error) {
+
+	indexedSymbol, indexedSymbolError := indexCommandManager.databaseMgr.GetIndexedSymbolBySymbol(strings.ToUpper(symbol))
+
+	if indexedSymbolError != nil {
+		return indexedSymbol, errors.New("requested symbol is not indexed")
+	}
+
+	oldSector := indexedSymbol.Sector
+	indexedSymbol.Sector = sector
+
+	updatedSymbol := dto.IndexedSymbolModel{}
+
+	transactionError := indexCommandManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		var updateError error
+
+		updatedSymbol, updateError = transactionManager.UpdateIndexedSymbolModel(indexedSymbol)
+
+		if updateError != nil {
+			return updateError
+		}
+
+		return recordEvent(transactionManager, EventSectorChanged, source, indexedSymbol.Symbol, sectorChangedPayload{
+			OldSector: oldSector,
+			NewSector: sector,
+		})
 	})
 
-	if createIndexSymbolError != nil {
-		logrus.Error(createIndexSymbolError.Error())
+	if transactionError != nil {
+		return dto.IndexedSymbolModel{}, transactionError
+	}
+
+	return updatedSymbol, nil
+}
+
+func (indexCommandManager *IndexCommandManager) SetSectorCommand(c *ishell.Context) {
+
+	if len(c.Args) < 2 {
+		logrus.Warn("Not enough parameters submitted")
+		return
+	}
+
+	indexedSymbol, sectorError := indexCommandManager.SetSector(c.Args[0], strings.Join(c.Args[1:], " "), SourceShell)
+
+	if sectorError != nil {
+		logrus.Error(sectorError.Error())
 		return
 	}
 
-	logrus.Info("Symbol " + symbolToAdd + " added to index")
+	logrus.Info("Symbol " + indexedSymbol.Symbol + " sector set to " + indexedSymbol.Sector)
+}
 
+func (indexCommandManager *IndexCommandManager) StartIndex() error {
+	return indexCommandManager.rebalanceMgr.StartRebalanceProcess()
 }
 
 func (indexCommandManager *IndexCommandManager) StartIndexCommand(c *ishell.Context) {
 
-
-	rebalanceStartError := indexCommandManager.rebalanceMgr.StartRebalanceProcess()
+	rebalanceStartError := indexCommandManager.StartIndex()
 
 	if rebalanceStartError != nil {
 		logrus.Error(rebalanceStartError.Error())
+		return
 	}
 
 	logrus.Info("Rebalance process initiated")
 }
 
-func (indexCommandManager *IndexCommandManager) GenerateIndexCommand(c *ishell.Context) {
+func (indexCommandManager *IndexCommandManager) StopIndex() error {
+	return indexCommandManager.rebalanceMgr.StopRebalanceProcess()
+}
+
+func (indexCommandManager *IndexCommandManager) StopIndexCommand(c *ishell.Context) {
+
+	rebalanceStopError := indexCommandManager.StopIndex()
+
+	if rebalanceStopError != nil {
+		logrus.Error(rebalanceStopError.Error())
+		return
+	}
+
+	logrus.Info("Rebalance process will stop after the current tick")
+}
+
+func (indexCommandManager *IndexCommandManager) PauseIndex() error {
+	return indexCommandManager.rebalanceMgr.PauseRebalanceProcess()
+}
+
+func (indexCommandManager *IndexCommandManager) PauseIndexCommand(c *ishell.Context) {
+
+	rebalancePauseError := indexCommandManager.PauseIndex()
+
+	if rebalancePauseError != nil {
+		logrus.Error(rebalancePauseError.Error())
+		return
+	}
+
+	logrus.Info("Rebalance process paused, ticks are skipped until index_resume")
+}
+
+func (indexCommandManager *IndexCommandManager) ResumeIndex() error {
+	return indexCommandManager.rebalanceMgr.ResumeRebalanceProcess()
+}
+
+func (indexCommandManager *IndexCommandManager) ResumeIndexCommand(c *ishell.Context) {
+
+	rebalanceResumeError := indexCommandManager.ResumeIndex()
+
+	if rebalanceResumeError != nil {
+		logrus.Error(rebalanceResumeError.Error())
+		return
+	}
+
+	logrus.Info("Rebalance process resumed")
+}
+
+func (indexCommandManager *IndexCommandManager) GetIndexStatus() (RebalanceStatus, error) {
+	return indexCommandManager.rebalanceMgr.GetRebalanceStatus()
+}
+
+func formatStatusTime(statusTime time.Time) string {
+
+	if statusTime.IsZero() {
+		return "-"
+	}
+
+	return statusTime.Format("2006-01-02 15:04:05")
+}
+
+func IndexStatusView(rebalanceStatus RebalanceStatus) renderers.View {
+
+	lastError := rebalanceStatus.LastError
+
+	if lastError == "" {
+		lastError = "-"
+	}
+
+	return renderers.View{
+		Name: "Index status",
+		Columns: []renderers.ViewColumn{
+			{Key: "mode", Title: "Mode"},
+			{Key: "saved_mode", Title: "Mode On Restart"},
+			{Key: "last_tick_at", Title: "Last Tick"},
+			{Key: "next_tick_at", Title: "Next Tick"},
+			{Key: "last_error", Title: "Last Error"},
+		},
+		Rows: [][]string{
+			{
+				rebalanceStatus.Mode,
+				rebalanceStatus.SavedMode,
+				formatStatusTime(rebalanceStatus.LastTickAt),
+				formatStatusTime(rebalanceStatus.NextTickAt),
+				lastError,
+			},
+		},
+		Vertical: true,
+	}
+}
+
+func (indexCommandManager *IndexCommandManager) IndexStatusCommand(c *ishell.Context) {
+
+	_, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	rebalanceStatus, rebalanceStatusError := indexCommandManager.GetIndexStatus()
+
+	if rebalanceStatusError != nil {
+		logrus.Error(rebalanceStatusError.Error())
+		return
+	}
+
+	renderError := RenderView(IndexStatusView(rebalanceStatus), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
+
+func (indexCommandManager *IndexCommandManager) GenerateIndex() error {
+
+	tradingAllowed, closedReason, tradingAllowedError := indexCommandManager.marketCalendarMgr.CheckTradingAllowed()
+
+	if tradingAllowedError != nil {
+		return tradingAllowedError
+	}
+
+	if tradingAllowed == false {
+		return errors.New("can not generate the index, " + closedReason)
+	}
 
 	accountBalance, accountBalanceError := (*indexCommandManager.brokerIntegration).GetAccountValue()
 
 	if accountBalanceError != nil {
-		logrus.Error(accountBalanceError.Error())
-		return
+		return accountBalanceError
 	}
 
 	condextConfigModel, condextConfigModelError := indexCommandManager.databaseMgr.GetCondextConfigModel()
 
 	if condextConfigModelError != nil {
-		logrus.Error(condextConfigModelError.Error())
-		return
+		return condextConfigModelError
 	}
 
 	if accountBalance < condextConfigModel.StartingBalance {
-		logrus.Error("The balance in the account is lower than the starting balance")
-		return
+		return errors.New("the balance in the account is lower than the starting balance")
 	}
 
 	// Get all the indexed symbols
 	indexedSymbols, indexedSymbolsError := indexCommandManager.databaseMgr.GetAllIndexedSymbols()
 
 	if indexedSymbolsError != nil {
-		logrus.Error(indexedSymbolsError.Error())
-		return
+		return indexedSymbolsError
 	}
 
 	for _, element := range indexedSymbols {
@@ -223,21 +570,45 @@ func (indexCommandManager *IndexCommandManager) GenerateIndexCommand(c *ishell.C
 			usdPercentageValue := util.GetPercentage(condextConfigModel.StartingBalance, element.DesiredPercentage)
 			amountToBuy := decimal.NewFromFloat(usdPercentageValue).Div(decimal.NewFromFloat(symbolQuote)).IntPart()
 
-			buyError := (*indexCommandManager.brokerIntegration).FulFillMarketOrderBuy(element.Symbol, amountToBuy)
+			buyIntent, buyError := indexCommandManager.riskMgr.PlaceOrder(context.Background(), RiskOrder{Symbol: element.Symbol, Side: "buy", Amount: amountToBuy, Price: symbolQuote, Source: SourceGenerate})
 
 			if buyError != nil {
 				logrus.Error(buyError.Error())
 				continue
 			}
 
+			oldAmount := element.Amount
+
 			element.CurrentPrice = symbolQuote
 			element.Amount = amountToBuy
 			element.CurrentPercentage = element.DesiredPercentage
 
-			_, updateSymbolError := indexCommandManager.databaseMgr.UpdateIndexedSymbolModel(element)
+			// The lot and the holding it belongs to are saved together
+			saveError := indexCommandManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+				recordBuyError := indexCommandManager.taxMgr.withDatabase(transactionManager).RecordBuyFill(element.Symbol, amountToBuy, buyIntent.FillPrice)
+
+				if recordBuyError != nil {
+					return recordBuyError
+				}
+
+				_, updateSymbolError := transactionManager.UpdateIndexedSymbolModel(element)
+
+				if updateSymbolError != nil {
+					return updateSymbolError
+				}
 
-			if updateSymbolError != nil {
-				logrus.Error(updateSymbolError.Error())
+				holdingError := recordHoldingChange(transactionManager, SourceGenerate, element.Symbol, oldAmount, element.Amount, buyIntent.FillPrice)
+
+				if holdingError != nil {
+					return holdingError
+				}
+
+				return completeOrderIntent(transactionManager, buyIntent)
+			})
+
+			if saveError != nil {
+				logrus.Error("Bought " + element.Symbol + " but could not save it, it is settled by the order recovery, " + saveError.Error())
 			}
 		}
 	}
@@ -246,7 +617,14 @@ func (indexCommandManager *IndexCommandManager) GenerateIndexCommand(c *ishell.C
 
 	_, updateError := indexCommandManager.databaseMgr.UpdateCondextConfig(condextConfigModel)
 
-	if updateError != nil {
-		logrus.Error(updateError.Error())
+	return updateError
+}
+
+func (indexCommandManager *IndexCommandManager) GenerateIndexCommand(c *ishell.Context) {
+
+	generateError := indexCommandManager.GenerateIndex()
+
+	if generateError != nil {
+		logrus.Error(generateError.Error())
 	}
 }
@@ -0,0 +1,73 @@
+package managers
+
+import (
+	"fmt"
+	"github.com/r4stl1n/condext/pkg/broker-integrations"
+	"github.com/r4stl1n/condext/pkg/util"
+	"time"
+)
+
+// Trade windows are set in exchange time so they do not move with the host timezone
+const marketTimezone = "America/New_York"
+
+type MarketCalendarManager struct {
+	databaseMgr *DatabaseManager
+
+	brokerIntegration *broker_integrations.BrokerIntegrationInterface
+}
+
+func CreateMarketCalendarManager(databaseManager *DatabaseManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *MarketCalendarManager {
+
+	return &MarketCalendarManager{
+		databaseMgr:       databaseManager,
+		brokerIntegration: &selectedBrokerIntegration,
+	}
+}
+
+// CheckTradingAllowed reports whether orders can be placed now, the reason is set when they can not
+func (marketCalendarManager *MarketCalendarManager) CheckTradingAllowed() (bool, string, error) {
+
+	marketClock, marketClockError := (*marketCalendarManager.brokerIntegration).GetMarketClock()
+
+	if marketClockError != nil {
+		return false, "", marketClockError
+	}
+
+	marketLocation, marketLocationError := time.LoadLocation(marketTimezone)
+
+	if marketLocationError != nil {
+		return false, "", marketLocationError
+	}
+
+	if marketClock.IsOpen == false {
+		return false, "market is closed until " + marketClock.NextOpen.In(marketLocation).Format("2006-01-02 15:04 MST"), nil
+	}
+
+	configModel, configModelError := marketCalendarManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return false, "", configModelError
+	}
+
+	if configModel.TradeWindowStart == "" && configModel.TradeWindowEnd == "" {
+		return true, "", nil
+	}
+
+	windowError := util.ValidateTradeWindow(configModel.TradeWindowStart, configModel.TradeWindowEnd)
+
+	if windowError != nil {
+		return false, "", windowError
+	}
+
+	startMinutes, _ := util.ParseWindowTime(configModel.TradeWindowStart)
+	endMinutes, _ := util.ParseWindowTime(configModel.TradeWindowEnd)
+
+	marketNow := marketClock.Timestamp.In(marketLocation)
+	nowMinutes := marketNow.Hour()*60 + marketNow.Minute()
+
+	if nowMinutes < startMinutes || nowMinutes >= endMinutes {
+		return false, fmt.Sprintf("outside the trade window %s-%s ET", configModel.TradeWindowStart, configModel.TradeWindowEnd), nil
+	}
+
+	return true, "", nil
+}
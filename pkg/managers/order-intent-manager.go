@@ -0,0 +1,383 @@
+package managers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/jinzhu/gorm"
+	"github.com/r4stl1n/condext/pkg/broker-integrations"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/util"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OrderIntentPending   = "pending"   // saved before sending, the broker may or may not have the order
+	OrderIntentFilled    = "filled"    // the broker filled it, the holding is not saved yet
+	OrderIntentCompleted = "completed" // the fill is saved with the holding it changed
+	OrderIntentFailed    = "failed"    // the broker refused the order or never received it
+)
+
+// An intent this process created is only recovered once it is older than this, the job that placed it has long
+// finished saving the fill or given up by then. An intent with a reason was given up on already and is not delayed
+const orderIntentRecoveryDelay = 10 * time.Minute
+
+// Orders in one of these states will not fill any further
+var brokerOrderFinalStatuses = map[string]bool{
+	"filled":   true,
+	"canceled": true,
+	"expired":  true,
+	"rejected": true,
+	"replaced": true,
+}
+
+// orderIntentClientOrderId derives the client order id from the saved intent, the broker allows 48 characters
+func orderIntentClientOrderId(orderIntent dto.OrderIntentModel) string {
+
+	hashInput := strings.Join([]string{
+		strconv.FormatUint(uint64(orderIntent.ID), 10),
+		orderIntent.Symbol,
+		orderIntent.Side,
+		strconv.FormatInt(orderIntent.Amount, 10),
+		orderIntent.Source,
+		orderIntent.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}, "\n")
+
+	hashSum := sha256.Sum256([]byte(hashInput))
+
+	return "condext-" + hex.EncodeToString(hashSum[:])[:32]
+}
+
+// createOrderIntent saves the intent and its order_placed event before anything is sent
+func createOrderIntent(databaseManager *DatabaseManager, riskOrder RiskOrder) (dto.OrderIntentModel, error) {
+
+	lotUUIDs := []string{}
+
+	for _, element := range riskOrder.Lots {
+		lotUUIDs = append(lotUUIDs, element.UUID)
+	}
+
+	orderIntent := dto.OrderIntentModel{
+		Symbol:   riskOrder.Symbol,
+		Side:     riskOrder.Side,
+		Amount:   riskOrder.Amount,
+		Price:    riskOrder.Price,
+		Source:   riskOrder.Source,
+		Status:   OrderIntentPending,
+		LotUUIDs: strings.Join(lotUUIDs, ","),
+		SwapID:   riskOrder.SwapID,
+	}
+
+	// Postgres keeps microseconds, the id has to be the same when worked out from what is read back
+	orderIntent.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	intentError := databaseManager.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		createdIntent, createError := transactionManager.CreateOrderIntentModel(orderIntent)
+
+		if createError != nil {
+			return createError
+		}
+
+		createdIntent.ClientOrderId = orderIntentClientOrderId(createdIntent)
+
+		updatedIntent, updateError := transactionManager.UpdateOrderIntentModel(createdIntent)
+
+		if updateError != nil {
+			return updateError
+		}
+
+		orderIntent = updatedIntent
+
+		return recordEvent(transactionManager, EventOrderPlaced, riskOrder.Source, riskOrder.Symbol, orderPayload{
+			Side:          riskOrder.Side,
+			Amount:        riskOrder.Amount,
+			Price:         riskOrder.Price,
+			ClientOrderId: orderIntent.ClientOrderId,
+		})
+	})
+
+	return orderIntent, intentError
+}
+
+// completeOrderIntent is called in the transaction that saves the fill so the intent closes with the holding
+func completeOrderIntent(databaseManager *DatabaseManager, orderIntent dto.OrderIntentModel) error {
+
+	resolvedAt := time.Now()
+
+	orderIntent.Status = OrderIntentCompleted
+	orderIntent.ResolvedAt = &resolvedAt
+
+	return databaseManager.SettleOrderIntentModel(orderIntent)
+}
+
+// failOrderIntent closes an intent whose order never filled
+func failOrderIntent(databaseManager *DatabaseManager, orderIntent dto.OrderIntentModel, source string, reason string) error {
+
+	resolvedAt := time.Now()
+
+	orderIntent.Status = OrderIntentFailed
+	orderIntent.Reason = reason
+	orderIntent.ResolvedAt = &resolvedAt
+
+	return databaseManager.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		settleError := transactionManager.SettleOrderIntentModel(orderIntent)
+
+		if settleError != nil {
+			return settleError
+		}
+
+		return recordEvent(transactionManager, EventOrderFailed, source, orderIntent.Symbol, orderPayload{
+			Side:          orderIntent.Side,
+			Amount:        orderIntent.Amount,
+			Price:         orderIntent.Price,
+			ClientOrderId: orderIntent.ClientOrderId,
+			Reason:        reason,
+		})
+	})
+}
+
+type OrderIntentManager struct {
+	databaseMgr *DatabaseManager
+	taxMgr      *TaxManager
+
+	// Intents created after this were made by this process, they wait orderIntentRecoveryDelay in case the job that
+	// placed them is still saving the fill
+	startedAt time.Time
+
+	brokerIntegration *broker_integrations.BrokerIntegrationInterface
+}
+
+func CreateOrderIntentManager(databaseManager *DatabaseManager, taxManager *TaxManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *OrderIntentManager {
+
+	return &OrderIntentManager{
+		databaseMgr:       databaseManager,
+		taxMgr:            taxManager,
+		startedAt:         time.Now(),
+		brokerIntegration: &selectedBrokerIntegration,
+	}
+}
+
+// RecoverOrderIntents settles the orders an earlier run sent but did not save, and the ones this run could not save,
+// each one is looked up at the broker by its client order id and never sent again
+func (orderIntentManager *OrderIntentManager) RecoverOrderIntents() error {
+
+	openIntents, openIntentsError := orderIntentManager.databaseMgr.GetOpenOrderIntents("")
+
+	if openIntentsError != nil {
+		return openIntentsError
+	}
+
+	for _, orderIntent := range openIntents {
+
+		if orderIntent.Reason == "" && orderIntent.CreatedAt.Before(orderIntentManager.startedAt) == false &&
+			time.Since(orderIntent.CreatedAt) < orderIntentRecoveryDelay {
+			continue
+		}
+
+		recoverError := orderIntentManager.recoverOrderIntent(orderIntent)
+
+		if recoverError != nil {
+			logrus.Error("Could not settle order " + orderIntent.ClientOrderId + " for " + orderIntent.Symbol + ", " + recoverError.Error())
+		}
+	}
+
+	return nil
+}
+
+func (orderIntentManager *OrderIntentManager) recoverOrderIntent(orderIntent dto.OrderIntentModel) error {
+
+	// A filled intent already has what the broker reported, only the save is missing
+	if orderIntent.Status == OrderIntentFilled {
+		return orderIntentManager.saveRecoveredFill(orderIntent, false)
+	}
+
+	brokerOrder, brokerOrderFound, brokerOrderError := (*orderIntentManager.brokerIntegration).GetOrderByClientOrderId(orderIntent.ClientOrderId)
+
+	if brokerOrderError != nil {
+		return brokerOrderError
+	}
+
+	if brokerOrderFound == false {
+		logrus.Warn("Order " + orderIntent.ClientOrderId + " for " + orderIntent.Symbol + " never reached the broker")
+		return failOrderIntent(orderIntentManager.databaseMgr, orderIntent, SourceRecovery, "the broker never received the order")
+	}
+
+	if brokerOrderFinalStatuses[brokerOrder.Status] == false {
+		logrus.Info("Order " + orderIntent.ClientOrderId + " for " + orderIntent.Symbol + " is still " + brokerOrder.Status + " at the broker")
+		return nil
+	}
+
+	if brokerOrder.FilledAmount == 0 {
+		return failOrderIntent(orderIntentManager.databaseMgr, orderIntent, SourceRecovery, "the order was "+brokerOrder.Status+" at the broker")
+	}
+
+	orderIntent.FilledAmount = brokerOrder.FilledAmount
+	orderIntent.FillPrice = brokerOrder.FillPrice
+
+	if orderIntent.FillPrice == 0 {
+		orderIntent.FillPrice = orderIntent.Price
+	}
+
+	return orderIntentManager.saveRecoveredFill(orderIntent, true)
+}
+
+// saveRecoveredFill saves the fill, the tax lots, the holding amount and the swap back the interrupted job would have
+// saved, the rest of what that job does, like the floating percentage or a new harvest swap, is left for the next
+// rebalance or the operator
+func (orderIntentManager *OrderIntentManager) saveRecoveredFill(orderIntent dto.OrderIntentModel, recordFill bool) error {
+
+	saveError := orderIntentManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		taxManager := orderIntentManager.taxMgr.withDatabase(transactionManager)
+
+		var recordError error
+
+		if orderIntent.Side == "sell" {
+
+			saleLots, saleLotsError := recoveredSaleLots(transactionManager, orderIntent)
+
+			if saleLotsError != nil {
+				return saleLotsError
+			}
+
+			recordError = taxManager.RecordSellFill(orderIntent.Symbol, orderIntent.FilledAmount, orderIntent.FillPrice, saleLots)
+		} else {
+			recordError = taxManager.RecordBuyFill(orderIntent.Symbol, orderIntent.FilledAmount, orderIntent.FillPrice)
+		}
+
+		if recordError != nil {
+			return recordError
+		}
+
+		indexedSymbol, indexedSymbolError := transactionManager.GetIndexedSymbolBySymbol(orderIntent.Symbol)
+
+		// Substitutes bought by a harvest are not indexed, they only have lots
+		if indexedSymbolError == nil {
+
+			oldAmount := indexedSymbol.Amount
+
+			if orderIntent.Side == "sell" {
+				indexedSymbol.Amount = indexedSymbol.Amount - orderIntent.FilledAmount
+			} else {
+				indexedSymbol.Amount = indexedSymbol.Amount + orderIntent.FilledAmount
+			}
+
+			_, updateError := transactionManager.UpdateIndexedSymbolModel(indexedSymbol)
+
+			if updateError != nil {
+				return updateError
+			}
+
+			eventError := recordHoldingChange(transactionManager, SourceRecovery, indexedSymbol.Symbol, oldAmount, indexedSymbol.Amount, orderIntent.FillPrice)
+
+			if eventError != nil {
+				return eventError
+			}
+		} else if gorm.IsRecordNotFoundError(indexedSymbolError) == false {
+			return indexedSymbolError
+		}
+
+		if orderIntent.SwapID != 0 {
+
+			swapError := recoverSwapOrder(transactionManager, orderIntent)
+
+			if swapError != nil {
+				return swapError
+			}
+		}
+
+		if recordFill == true {
+
+			eventError := recordEvent(transactionManager, EventOrderFilled, SourceRecovery, orderIntent.Symbol, orderPayload{
+				Side:          orderIntent.Side,
+				Amount:        orderIntent.FilledAmount,
+				Price:         orderIntent.FillPrice,
+				ClientOrderId: orderIntent.ClientOrderId,
+			})
+
+			if eventError != nil {
+				return eventError
+			}
+		}
+
+		return completeOrderIntent(transactionManager, orderIntent)
+	})
+
+	if saveError != nil {
+		return saveError
+	}
+
+	logrus.Warn("Settled " + orderIntent.Side + " of " + strconv.FormatInt(orderIntent.FilledAmount, 10) + " " + orderIntent.Symbol +
+		" placed by " + orderIntent.Source + ", check what else that job saves")
+
+	return nil
+}
+
+// recoveredSaleLots puts the lots the sell was planned against first, the other open lots follow in case some of the
+// planned ones were sold since, nil sells the oldest lots first
+func recoveredSaleLots(databaseManager *DatabaseManager, orderIntent dto.OrderIntentModel) ([]dto.TaxLotModel, error) {
+
+	if orderIntent.LotUUIDs == "" {
+		return nil, nil
+	}
+
+	openLots, openLotsError := databaseManager.GetOpenTaxLotsBySymbol(orderIntent.Symbol)
+
+	if openLotsError != nil {
+		return nil, openLotsError
+	}
+
+	saleLots := []dto.TaxLotModel{}
+	plannedLots := map[string]bool{}
+
+	for _, lotUUID := range strings.Split(orderIntent.LotUUIDs, ",") {
+		for _, lot := range openLots {
+			if lot.UUID == lotUUID && plannedLots[lot.UUID] == false {
+				saleLots = append(saleLots, lot)
+				plannedLots[lot.UUID] = true
+			}
+		}
+	}
+
+	for _, lot := range openLots {
+		if plannedLots[lot.UUID] == false {
+			saleLots = append(saleLots, lot)
+		}
+	}
+
+	return saleLots, nil
+}
+
+// recoverSwapOrder saves what ProcessHarvestSwapBacks saves after a swap back order, the substitute sell adds its
+// proceeds to the cash to buy back and the buy back finishes the swap
+func recoverSwapOrder(databaseManager *DatabaseManager, orderIntent dto.OrderIntentModel) error {
+
+	swap, swapError := databaseManager.GetHarvestSwapModel(orderIntent.SwapID)
+
+	if swapError != nil {
+		return swapError
+	}
+
+	if orderIntent.Side == "sell" {
+
+		swap.BuyBackCash = util.DecimalToFloat(decimal.NewFromFloat(swap.BuyBackCash).Add(
+			decimal.NewFromFloat(orderIntent.FillPrice).Mul(decimal.NewFromInt(orderIntent.FilledAmount))).Round(2))
+		swap.SubstituteAmount = swap.SubstituteAmount - orderIntent.FilledAmount
+
+		if swap.SubstituteAmount < 0 {
+			swap.SubstituteAmount = 0
+		}
+	} else {
+		swap.BuyBackCash = 0
+		swap.Completed = true
+	}
+
+	_, updateError := databaseManager.UpdateHarvestSwapModel(swap)
+
+	return updateError
+}
@@ -0,0 +1,106 @@
+package managers
+
+import (
+	"github.com/r4stl1n/condext/pkg/dto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrderIntentClientOrderId(t *testing.T) {
+
+	baseIntent := dto.OrderIntentModel{
+		Symbol: "VTI",
+		Side:   "buy",
+		Amount: 10,
+		Price:  200,
+		Source: SourceRebalance,
+		Status: OrderIntentPending,
+	}
+
+	baseIntent.ID = 7
+	baseIntent.CreatedAt = time.Date(2021, time.March, 1, 15, 30, 0, 123456000, time.UTC)
+
+	testCases := []struct {
+		name    string
+		change  func(orderIntent *dto.OrderIntentModel)
+		changed bool
+	}{
+		{"same intent", func(orderIntent *dto.OrderIntentModel) {}, false},
+		{"status is not part of the id", func(orderIntent *dto.OrderIntentModel) { orderIntent.Status = OrderIntentFilled }, false},
+		{"price is not part of the id", func(orderIntent *dto.OrderIntentModel) { orderIntent.Price = 201 }, false},
+		{"same instant in another zone", func(orderIntent *dto.OrderIntentModel) {
+			orderIntent.CreatedAt = orderIntent.CreatedAt.In(time.FixedZone("EST", -5*60*60))
+		}, false},
+		{"id", func(orderIntent *dto.OrderIntentModel) { orderIntent.ID = 8 }, true},
+		{"symbol", func(orderIntent *dto.OrderIntentModel) { orderIntent.Symbol = "VXUS" }, true},
+		{"side", func(orderIntent *dto.OrderIntentModel) { orderIntent.Side = "sell" }, true},
+		{"amount", func(orderIntent *dto.OrderIntentModel) { orderIntent.Amount = 11 }, true},
+		{"source", func(orderIntent *dto.OrderIntentModel) { orderIntent.Source = SourceHarvest }, true},
+		{"created at", func(orderIntent *dto.OrderIntentModel) {
+			orderIntent.CreatedAt = orderIntent.CreatedAt.Add(time.Microsecond)
+		}, true},
+	}
+
+	baseClientOrderId := orderIntentClientOrderId(baseIntent)
+
+	if strings.HasPrefix(baseClientOrderId, "condext-") == false || len(baseClientOrderId) > 48 {
+		t.Fatalf("client order id %s is not a condext id the broker accepts", baseClientOrderId)
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			changedIntent := baseIntent
+			testCase.change(&changedIntent)
+
+			clientOrderId := orderIntentClientOrderId(changedIntent)
+
+			if (clientOrderId != baseClientOrderId) != testCase.changed {
+				t.Errorf("client order id changed = %v, want %v", clientOrderId != baseClientOrderId, testCase.changed)
+			}
+		})
+	}
+}
+
+func TestOrderIntentClientOrderIdReadBack(t *testing.T) {
+
+	testCases := []struct {
+		name      string
+		riskOrder RiskOrder
+	}{
+		{"buy", RiskOrder{Symbol: "VTI", Side: "buy", Amount: 10, Price: 200, Source: SourceRebalance}},
+		{"sell with lots", RiskOrder{Symbol: "VXUS", Side: "sell", Amount: 3, Price: 55.5, Source: SourceHarvest,
+			Lots: []dto.TaxLotModel{{UUID: "lot-a"}, {UUID: "lot-b"}}}},
+	}
+
+	databaseManager := openTestDatabaseManager(t)
+	clientOrderIds := map[string]bool{}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			orderIntent, createError := createOrderIntent(databaseManager, testCase.riskOrder)
+
+			if createError != nil {
+				t.Fatal(createError)
+			}
+
+			savedIntent, savedIntentError := databaseManager.GetOrderIntentModel(orderIntent.ID)
+
+			if savedIntentError != nil {
+				t.Fatal(savedIntentError)
+			}
+
+			if savedIntent.ClientOrderId != orderIntent.ClientOrderId || orderIntentClientOrderId(savedIntent) != orderIntent.ClientOrderId {
+				t.Errorf("client order id %s does not match the one worked out from the saved intent", orderIntent.ClientOrderId)
+			}
+
+			if clientOrderIds[orderIntent.ClientOrderId] == true {
+				t.Errorf("client order id %s was handed out twice", orderIntent.ClientOrderId)
+			}
+
+			clientOrderIds[orderIntent.ClientOrderId] = true
+		})
+	}
+}
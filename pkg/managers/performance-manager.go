@@ -0,0 +1,349 @@
+package managers
+
+import (
+	"errors"
+	"github.com/r4stl1n/condext/pkg/broker-integrations"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/util"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+type PerformanceReport struct {
+	Period              string
+	Start               time.Time
+	End                 time.Time
+	StartValue          float64
+	EndValue            float64
+	NetFlows            float64
+	TimeWeightedReturn  float64
+	MoneyWeightedReturn float64
+	Volatility          float64
+	SharpeRatio         float64
+	SortinoRatio        float64
+	MaxDrawdown         float64
+}
+
+type BenchmarkReport struct {
+	Period           string
+	BenchmarkSymbol  string
+	Start            time.Time
+	End              time.Time
+	PortfolioReturn  float64
+	BenchmarkReturn  float64
+	ActiveReturn     float64
+	TrackingError    float64
+	InformationRatio float64
+	Beta             float64
+}
+
+type PerformanceManager struct {
+	databaseMgr       *DatabaseManager
+	brokerIntegration *broker_integrations.BrokerIntegrationInterface
+}
+
+func CreatePerformanceManager(databaseManager *DatabaseManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *PerformanceManager {
+
+	return &PerformanceManager{
+		databaseMgr:       databaseManager,
+		brokerIntegration: &selectedBrokerIntegration,
+	}
+}
+
+func (performanceManager *PerformanceManager) TakeSnapshot() error {
+
+	accountValue, accountValueError := (*performanceManager.brokerIntegration).GetAccountValue()
+
+	if accountValueError != nil {
+		return accountValueError
+	}
+
+	accountCash, accountCashError := (*performanceManager.brokerIntegration).GetAccountCash()
+
+	if accountCashError != nil {
+		return accountCashError
+	}
+
+	netFlow := 0.0
+
+	lastSnapshot, lastSnapshotError := performanceManager.databaseMgr.GetLastPortfolioSnapshotModel()
+
+	if lastSnapshotError == nil {
+
+		var netFlowError error
+
+		netFlow, netFlowError = (*performanceManager.brokerIntegration).GetNetExternalFlows(lastSnapshot.TakenAt)
+
+		if netFlowError != nil {
+			return netFlowError
+		}
+	}
+
+	configModel, configModelError := performanceManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return configModelError
+	}
+
+	benchmarkPrice := 0.0
+
+	if configModel.BenchmarkSymbol != "" {
+
+		var benchmarkPriceError error
+
+		benchmarkPrice, benchmarkPriceError = (*performanceManager.brokerIntegration).GetSymbolQuotePrice(configModel.BenchmarkSymbol)
+
+		if benchmarkPriceError != nil {
+			return benchmarkPriceError
+		}
+	}
+
+	portfolioSnapshot, snapshotError := performanceManager.databaseMgr.CreatePortfolioSnapshotModel(dto.PortfolioSnapshotModel{
+		Value:           accountValue,
+		Cash:            accountCash,
+		NetFlow:         netFlow,
+		TakenAt:         time.Now(),
+		BenchmarkSymbol: configModel.BenchmarkSymbol,
+		BenchmarkPrice:  benchmarkPrice,
+	})
+
+	if snapshotError != nil {
+		return snapshotError
+	}
+
+	indexedSymbols, indexedSymbolsError := performanceManager.databaseMgr.GetAllIndexedSymbols()
+
+	if indexedSymbolsError != nil {
+		return indexedSymbolsError
+	}
+
+	for _, element := range indexedSymbols {
+
+		symbolQuote, symbolQuoteError := (*performanceManager.brokerIntegration).GetSymbolQuotePrice(element.Symbol)
+
+		if symbolQuoteError != nil {
+			logrus.Error(symbolQuoteError.Error())
+			symbolQuote = element.CurrentPrice
+		}
+
+		_, holdingSnapshotError := performanceManager.databaseMgr.CreateHoldingSnapshotModel(dto.HoldingSnapshotModel{
+			PortfolioSnapshotID: portfolioSnapshot.ID,
+			Symbol:              element.Symbol,
+			Sector:              element.Sector,
+			Amount:              element.Amount,
+			Price:               symbolQuote,
+			Value:               util.DecimalToFloat(decimal.NewFromFloat(symbolQuote).Mul(decimal.NewFromInt(element.Amount)).Round(2)),
+			DesiredPercentage:   element.DesiredPercentage,
+			TakenAt:             portfolioSnapshot.TakenAt,
+		})
+
+		if holdingSnapshotError != nil {
+			return holdingSnapshotError
+		}
+	}
+
+	return nil
+}
+
+func (performanceManager *PerformanceManager) TakeSnapshotIfDue() error {
+
+	configModel, configModelError := performanceManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return configModelError
+	}
+
+	if configModel.SnapshotFrequency <= 0 {
+		return nil
+	}
+
+	lastSnapshot, lastSnapshotError := performanceManager.databaseMgr.GetLastPortfolioSnapshotModel()
+
+	if lastSnapshotError == nil && time.Since(lastSnapshot.TakenAt) < time.Duration(configModel.SnapshotFrequency)*time.Second {
+		return nil
+	}
+
+	logrus.Info("Taking portfolio snapshot")
+
+	return performanceManager.TakeSnapshot()
+}
+
+func GetPeriodStart(period string, now time.Time) (time.Time, error) {
+
+	switch strings.ToUpper(period) {
+	case "1M":
+		return now.AddDate(0, -1, 0), nil
+	case "3M":
+		return now.AddDate(0, -3, 0), nil
+	case "YTD":
+		return time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location()), nil
+	case "1Y":
+		return now.AddDate(-1, 0, 0), nil
+	case "INCEPTION":
+		return time.Time{}, nil
+	}
+
+	return time.Time{}, errors.New("unknown period, use one of 1M, 3M, YTD, 1Y, INCEPTION")
+}
+
+// GetDailySnapshots keeps the last snapshot of each day and folds the flows of the dropped ones into it
+func (performanceManager *PerformanceManager) GetDailySnapshots(since time.Time) ([]dto.PortfolioSnapshotModel, error) {
+
+	dailySnapshots := []dto.PortfolioSnapshotModel{}
+
+	snapshots, snapshotsError := performanceManager.databaseMgr.GetPortfolioSnapshotsSince(since)
+
+	if snapshotsError != nil {
+		return dailySnapshots, snapshotsError
+	}
+
+	for index, snapshot := range snapshots {
+
+		lastIndex := len(dailySnapshots) - 1
+
+		if index > 0 && lastIndex >= 0 && dailySnapshots[lastIndex].TakenAt.Format("2006-01-02") == snapshot.TakenAt.Format("2006-01-02") {
+			snapshot.NetFlow = snapshot.NetFlow + dailySnapshots[lastIndex].NetFlow
+			dailySnapshots[lastIndex] = snapshot
+			continue
+		}
+
+		dailySnapshots = append(dailySnapshots, snapshot)
+	}
+
+	// Flows before the first snapshot in the period are already in its value
+	if len(dailySnapshots) > 0 {
+		dailySnapshots[0].NetFlow = 0
+	}
+
+	return dailySnapshots, nil
+}
+
+func (performanceManager *PerformanceManager) GeneratePerformanceReport(period string) (PerformanceReport, error) {
+
+	performanceReport := PerformanceReport{Period: strings.ToUpper(period)}
+
+	configModel, configModelError := performanceManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return performanceReport, configModelError
+	}
+
+	periodStart, periodStartError := GetPeriodStart(period, time.Now())
+
+	if periodStartError != nil {
+		return performanceReport, periodStartError
+	}
+
+	dailySnapshots, dailySnapshotsError := performanceManager.GetDailySnapshots(periodStart)
+
+	if dailySnapshotsError != nil {
+		return performanceReport, dailySnapshotsError
+	}
+
+	if len(dailySnapshots) < 2 {
+		return performanceReport, errors.New("not enough portfolio snapshots in the period")
+	}
+
+	values := []float64{}
+	flows := []float64{}
+	times := []time.Time{}
+
+	for _, snapshot := range dailySnapshots {
+		values = append(values, snapshot.Value)
+		flows = append(flows, snapshot.NetFlow)
+		times = append(times, snapshot.TakenAt)
+
+		performanceReport.NetFlows = performanceReport.NetFlows + snapshot.NetFlow
+	}
+
+	periodReturns := util.GetPeriodReturns(values, flows)
+	periodsPerYear := util.GetPeriodsPerYear(times)
+	riskFreeRate := configModel.RiskFreeRate / 100
+
+	performanceReport.Start = times[0]
+	performanceReport.End = times[len(times)-1]
+	performanceReport.StartValue = values[0]
+	performanceReport.EndValue = values[len(values)-1]
+	performanceReport.TimeWeightedReturn = util.GetTimeWeightedReturn(periodReturns) * 100
+	performanceReport.MoneyWeightedReturn = util.GetMoneyWeightedReturn(values, flows, times) * 100
+	performanceReport.Volatility = util.GetAnnualizedVolatility(periodReturns, periodsPerYear) * 100
+	performanceReport.SharpeRatio = util.GetSharpeRatio(periodReturns, riskFreeRate, periodsPerYear)
+	performanceReport.SortinoRatio = util.GetSortinoRatio(periodReturns, riskFreeRate, periodsPerYear)
+	performanceReport.MaxDrawdown = util.GetMaxDrawdown(periodReturns) * 100
+
+	return performanceReport, nil
+}
+
+func (performanceManager *PerformanceManager) GenerateBenchmarkReport(period string) (BenchmarkReport, error) {
+
+	benchmarkReport := BenchmarkReport{Period: strings.ToUpper(period)}
+
+	configModel, configModelError := performanceManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return benchmarkReport, configModelError
+	}
+
+	if configModel.BenchmarkSymbol == "" {
+		return benchmarkReport, errors.New("no benchmark symbol is set")
+	}
+
+	benchmarkReport.BenchmarkSymbol = configModel.BenchmarkSymbol
+
+	periodStart, periodStartError := GetPeriodStart(period, time.Now())
+
+	if periodStartError != nil {
+		return benchmarkReport, periodStartError
+	}
+
+	dailySnapshots, dailySnapshotsError := performanceManager.GetDailySnapshots(periodStart)
+
+	if dailySnapshotsError != nil {
+		return benchmarkReport, dailySnapshotsError
+	}
+
+	values := []float64{}
+	flows := []float64{}
+	times := []time.Time{}
+	benchmarkPrices := []float64{}
+
+	// Only compare the days the current benchmark was recorded alongside the portfolio
+	for _, snapshot := range dailySnapshots {
+
+		if snapshot.BenchmarkSymbol != configModel.BenchmarkSymbol || snapshot.BenchmarkPrice == 0 {
+			continue
+		}
+
+		if len(values) == 0 {
+			benchmarkReport.Start = snapshot.TakenAt
+			snapshot.NetFlow = 0
+		}
+
+		values = append(values, snapshot.Value)
+		flows = append(flows, snapshot.NetFlow)
+		times = append(times, snapshot.TakenAt)
+		benchmarkPrices = append(benchmarkPrices, snapshot.BenchmarkPrice)
+
+		benchmarkReport.End = snapshot.TakenAt
+	}
+
+	if len(values) < 2 {
+		return benchmarkReport, errors.New("not enough benchmark snapshots in the period")
+	}
+
+	// A period one series had to leave out is left out of both so each return is compared with the same day's
+	periodReturns, benchmarkReturns := util.JoinDatedReturns(util.GetDatedPeriodReturns(values, flows, times),
+		util.GetDatedPeriodReturns(benchmarkPrices, make([]float64, len(benchmarkPrices)), times))
+	periodsPerYear := util.GetPeriodsPerYear(times)
+
+	benchmarkReport.PortfolioReturn = util.GetTimeWeightedReturn(periodReturns) * 100
+	benchmarkReport.BenchmarkReturn = util.GetTimeWeightedReturn(benchmarkReturns) * 100
+	benchmarkReport.ActiveReturn = benchmarkReport.PortfolioReturn - benchmarkReport.BenchmarkReturn
+	benchmarkReport.TrackingError = util.GetTrackingError(periodReturns, benchmarkReturns, periodsPerYear) * 100
+	benchmarkReport.InformationRatio = util.GetInformationRatio(periodReturns, benchmarkReturns, periodsPerYear)
+	benchmarkReport.Beta = util.GetBeta(periodReturns, benchmarkReturns)
+
+	return benchmarkReport, nil
+}
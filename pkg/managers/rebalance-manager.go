@@ -1,28 +1,74 @@
 package managers
 
 import (
+	"context"
 	"errors"
 	broker_integrations "github.com/r4stl1n/condext/pkg/broker-integrations"
+	"github.com/r4stl1n/condext/pkg/dto"
 	"github.com/r4stl1n/condext/pkg/util"
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
+	"strconv"
+	"sync"
 	"time"
 )
 
+type PlannedTrade struct {
+	Symbol               string
+	Side                 string
+	Amount               int64
+	Price                float64
+	PercentageDifference float64
+	Lots                 []dto.TaxLotModel
+	TaxImpact            TaxImpact
+	Deferred             bool
+	DeferReason          string
+}
+
+type RebalanceStatus struct {
+	Mode       string
+	SavedMode  string
+	LastTickAt time.Time
+	NextTickAt time.Time
+	LastError  string
+}
+
 type RebalanceManager struct {
 	databaseMgr             *DatabaseManager
+	taxMgr                  *TaxManager
+	performanceMgr          *PerformanceManager
+	marketCalendarMgr       *MarketCalendarManager
+	riskMgr                 *RiskManager
+	backupMgr               *BackupManager
+	orderIntentMgr          *OrderIntentManager
 	brokerIntegration       *broker_integrations.BrokerIntegrationInterface
+	rebalanceMutex          sync.Mutex
+	rebalanceCancel         context.CancelFunc
+	orderCancel             context.CancelFunc
+	rebalanceDone           chan struct{}
+	rebalancePaused         bool
+	nextTickAt              time.Time
 	rebalanceProcessRunning bool
 	rebalanceFrequency      int64
 	startingBalance         float64
+
+	// Signalled when the frequency changes so the loop reschedules instead of finishing the old wait
+	rebalanceWake chan struct{}
 }
 
-func CreateRebalanceManager(databaseManager *DatabaseManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *RebalanceManager {
+func CreateRebalanceManager(databaseManager *DatabaseManager, taxManager *TaxManager, performanceManager *PerformanceManager, marketCalendarManager *MarketCalendarManager, riskManager *RiskManager, backupManager *BackupManager, orderIntentManager *OrderIntentManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *RebalanceManager {
 
 	return &RebalanceManager{
 		databaseMgr:             databaseManager,
+		taxMgr:                  taxManager,
+		performanceMgr:          performanceManager,
+		marketCalendarMgr:       marketCalendarManager,
+		riskMgr:                 riskManager,
+		backupMgr:               backupManager,
+		orderIntentMgr:          orderIntentManager,
 		brokerIntegration:       &selectedBrokerIntegration,
 		rebalanceProcessRunning: false,
+		rebalanceWake:           make(chan struct{}, 1),
 	}
 }
 
@@ -30,12 +76,20 @@ func (rebalanceManager *RebalanceManager) calculateCurrentPercentages() error {
 
 	logrus.Info("Processing percentage changes")
 
+	// ReloadConfig may change it while the loop runs
+	rebalanceManager.rebalanceMutex.Lock()
+	startingBalance := rebalanceManager.startingBalance
+	rebalanceManager.rebalanceMutex.Unlock()
+
 	allIndexedSymbols, allIndexedSymbolsError := rebalanceManager.databaseMgr.GetAllIndexedSymbols()
 
 	if allIndexedSymbolsError != nil {
 		return allIndexedSymbolsError
 	}
 
+	// Quotes are fetched first so the percentages are saved together and never mix two ticks
+	updatedSymbols := []dto.IndexedSymbolModel{}
+
 	for _, element := range allIndexedSymbols {
 
 		// Grab the quote for the symbol
@@ -49,8 +103,24 @@ func (rebalanceManager *RebalanceManager) calculateCurrentPercentages() error {
 		// Now we calculate the current value of the holdings
 		currentHoldingUSDValue, _ := decimal.NewFromFloat(currentQuote).Mul(decimal.NewFromInt(element.Amount)).Round(2).Float64()
 
+		// While harvested the substitute holds the exposure for the symbol
+		activeSwap, activeSwapError := rebalanceManager.databaseMgr.GetActiveHarvestSwapBySymbol(element.Symbol)
+
+		if activeSwapError == nil {
+
+			substituteQuote, substituteQuoteError := (*rebalanceManager.brokerIntegration).GetSymbolQuotePrice(activeSwap.SubstituteSymbol)
+
+			if substituteQuoteError != nil {
+				logrus.Error(substituteQuoteError.Error())
+				continue
+			}
+
+			currentHoldingUSDValue, _ = decimal.NewFromFloat(currentHoldingUSDValue).Add(decimal.NewFromFloat(substituteQuote).Mul(decimal.NewFromInt(activeSwap.SubstituteAmount))).
+				Add(decimal.NewFromFloat(activeSwap.BuyBackCash)).Round(2).Float64()
+		}
+
 		// Calculate the current percentage amount we have above / below the desired for the index
-		desiredUSDValue := util.GetPercentage(rebalanceManager.startingBalance, element.DesiredPercentage)
+		desiredUSDValue := util.GetPercentage(startingBalance, element.DesiredPercentage)
 
 		percentageDifference := util.GetPercentageDifference(desiredUSDValue, currentHoldingUSDValue)
 
@@ -59,29 +129,40 @@ func (rebalanceManager *RebalanceManager) calculateCurrentPercentages() error {
 
 		logrus.Info("Symbol " + element.Symbol + " new current percentage is - " + decimal.NewFromFloat(percentageDifference).String())
 
-		_, updateSymbolError := rebalanceManager.databaseMgr.UpdateIndexedSymbolModel(element)
+		updatedSymbols = append(updatedSymbols, element)
+	}
+
+	return rebalanceManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		for _, element := range updatedSymbols {
 
-		if updateSymbolError != nil {
-			logrus.Error(updateSymbolError.Error())
+			_, updateSymbolError := transactionManager.UpdateIndexedSymbolModel(element)
+
+			if updateSymbolError != nil {
+				return updateSymbolError
+			}
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
 
-func (rebalanceManager *RebalanceManager) handleTrades() error {
+// GenerateRebalancePlan works out the trades the next rebalance would place from the last calculated percentages
+func (rebalanceManager *RebalanceManager) GenerateRebalancePlan() ([]PlannedTrade, error) {
+
+	plannedTrades := []PlannedTrade{}
 
 	configModel, configModelError := rebalanceManager.databaseMgr.GetCondextConfigModel()
 
 	if configModelError != nil {
-		return configModelError
+		return plannedTrades, configModelError
 	}
 
 	// Now we need to go through all the ones who are over their percentage and rebalance threshold
 	allIndexedSymbols, allIndexedSymbolsError := rebalanceManager.databaseMgr.GetAllIndexedSymbols()
 
 	if allIndexedSymbolsError != nil {
-		return allIndexedSymbolsError
+		return plannedTrades, allIndexedSymbolsError
 	}
 
 	// We are going to do this sloppy first we are going to iterate on all the ones we need to sell
@@ -107,22 +188,30 @@ func (rebalanceManager *RebalanceManager) handleTrades() error {
 					continue
 				}
 
-				sellError := (*rebalanceManager.brokerIntegration).FulFillMarketOrderSell(element.Symbol, amountToSell)
+				selectedLots, taxImpact, selectLotsError := rebalanceManager.taxMgr.SelectLotsForSale(element.Symbol, amountToSell, element.CurrentPrice)
 
-				if sellError != nil {
-					logrus.Error(sellError.Error())
+				if selectLotsError != nil {
+					logrus.Error(selectLotsError.Error())
 					continue
 				}
 
-				element.Amount = element.Amount - amountToSell
-
-				_, symbolUpdateError := rebalanceManager.databaseMgr.UpdateIndexedSymbolModel(element)
+				plannedTrade := PlannedTrade{
+					Symbol:               element.Symbol,
+					Side:                 "sell",
+					Amount:               amountToSell,
+					Price:                element.CurrentPrice,
+					PercentageDifference: percentageDifferenceConv,
+					Lots:                 selectedLots,
+					TaxImpact:            taxImpact,
+				}
 
-				if symbolUpdateError != nil {
-					logrus.Error(symbolUpdateError)
+				// Leave the drift in place when correcting it would cost more tax than it is worth
+				if configModel.TaxDriftTradeoff > 0 && taxImpact.EstimatedTax > configModel.TaxDriftTradeoff*percentageDifferenceConv {
+					plannedTrade.Deferred = true
+					plannedTrade.DeferReason = "estimated tax " + decimal.NewFromFloat(taxImpact.EstimatedTax).String() + " exceeds drift tradeoff"
 				}
 
-				configModel.FloatingPercentage = configModel.FloatingPercentage + percentageDifferenceConv
+				plannedTrades = append(plannedTrades, plannedTrade)
 			}
 		}
 
@@ -138,80 +227,407 @@ func (rebalanceManager *RebalanceManager) handleTrades() error {
 
 			if percentageDifference.Abs().GreaterThan(decimal.NewFromFloat(configModel.ReBalanceThreshold)) == true {
 
-				if configModel.FloatingPercentage > percentageDifferenceConv {
-					// If we are above the threshold we now are going to try and buy the above threshold amount
-					currentHoldingUSDValue, _ := decimal.NewFromFloat(element.CurrentPrice).Mul(decimal.NewFromInt(element.Amount)).Round(2).Float64()
+				// If we are above the threshold we now are going to try and buy the above threshold amount
+				currentHoldingUSDValue, _ := decimal.NewFromFloat(element.CurrentPrice).Mul(decimal.NewFromInt(element.Amount)).Round(2).Float64()
+
+				// Get the percentage difference in usd
+				percentageDifferenceInUsd := util.GetPercentage(currentHoldingUSDValue, percentageDifferenceConv)
+
+				// Now we need to calculate how many we can buy
+				amountToBuy := decimal.NewFromFloat(percentageDifferenceInUsd).Div(decimal.NewFromFloat(element.CurrentPrice)).Abs().IntPart()
+
+				if amountToBuy == 0 {
+					logrus.Warn("Unable to partial buy " + element.Symbol + " current percentage is to low to fullfill amount")
+					continue
+				}
+
+				plannedTrade := PlannedTrade{
+					Symbol:               element.Symbol,
+					Side:                 "buy",
+					Amount:               amountToBuy,
+					Price:                element.CurrentPrice,
+					PercentageDifference: percentageDifferenceConv,
+				}
+
+				// Buying back inside the window would disallow the loss we just realized
+				washSaleRestricted, washSaleRestrictedError := rebalanceManager.taxMgr.IsWashSaleRestricted(element.Symbol)
+
+				if washSaleRestrictedError != nil {
+					logrus.Error(washSaleRestrictedError.Error())
+					continue
+				}
 
-					// Get the percentage difference in usd
-					percentageDifferenceInUsd := util.GetPercentage(currentHoldingUSDValue, percentageDifferenceConv)
+				if washSaleRestricted == true {
+					plannedTrade.Deferred = true
+					plannedTrade.DeferReason = "inside a wash sale window"
+				}
 
-					// Now we need to calculate how many we can buy
-					amountToBuy := decimal.NewFromFloat(percentageDifferenceInUsd).Div(decimal.NewFromFloat(element.CurrentPrice)).Abs().IntPart()
+				plannedTrades = append(plannedTrades, plannedTrade)
+			}
+		}
 
-					if amountToBuy == 0 {
-						logrus.Warn("Unable to partial buy " + element.Symbol + " current percentage is to low to fullfill amount")
-						continue
-					}
+	}
 
-					buyError := (*rebalanceManager.brokerIntegration).FulFillMarketOrderBuy(element.Symbol, amountToBuy)
+	return plannedTrades, nil
+}
 
-					if buyError != nil {
-						logrus.Error(buyError.Error())
-						continue
-					}
+func (rebalanceManager *RebalanceManager) placePlannedTrade(orderContext context.Context, plannedTrade PlannedTrade) (dto.OrderIntentModel, error) {
 
-					element.Amount = element.Amount + amountToBuy
+	return rebalanceManager.riskMgr.PlaceOrder(orderContext, RiskOrder{
+		Symbol: plannedTrade.Symbol,
+		Side:   plannedTrade.Side,
+		Amount: plannedTrade.Amount,
+		Price:  plannedTrade.Price,
+		Source: SourceRebalance,
+		Lots:   plannedTrade.Lots,
+	})
+}
 
-					_, symbolUpdateError := rebalanceManager.databaseMgr.UpdateIndexedSymbolModel(element)
+// saveFilledTrade records the fill with its tax lots, the new symbol amount, the floating percentage and the completed
+// order intent in one transaction
+func (rebalanceManager *RebalanceManager) saveFilledTrade(plannedTrade PlannedTrade, orderIntent dto.OrderIntentModel) error {
 
-					if symbolUpdateError != nil {
-						logrus.Error(symbolUpdateError)
-					}
+	fillPrice := orderIntent.FillPrice
 
-					configModel.FloatingPercentage = configModel.FloatingPercentage - percentageDifferenceConv
-				} else {
+	return rebalanceManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
 
-					logrus.Warn("Current floating percentage is not large enough to fulfill buy need of " + element.Symbol)
+		taxManager := rebalanceManager.taxMgr.withDatabase(transactionManager)
 
-				}
-			}
+		element, elementError := transactionManager.GetIndexedSymbolBySymbol(plannedTrade.Symbol)
+
+		if elementError != nil {
+			return elementError
+		}
+
+		// Read again so settings changed during the tick are not written back
+		configModel, configModelError := transactionManager.GetCondextConfigModel()
+
+		if configModelError != nil {
+			return configModelError
 		}
 
+		var recordError error
+
+		oldAmount := element.Amount
+
+		if plannedTrade.Side == "sell" {
+			recordError = taxManager.RecordSellFill(plannedTrade.Symbol, plannedTrade.Amount, fillPrice, plannedTrade.Lots)
+			element.Amount = element.Amount - plannedTrade.Amount
+			configModel.FloatingPercentage = configModel.FloatingPercentage + plannedTrade.PercentageDifference
+		} else {
+			recordError = taxManager.RecordBuyFill(plannedTrade.Symbol, plannedTrade.Amount, fillPrice)
+			element.Amount = element.Amount + plannedTrade.Amount
+			configModel.FloatingPercentage = configModel.FloatingPercentage - plannedTrade.PercentageDifference
+		}
+
+		if recordError != nil {
+			return recordError
+		}
+
+		_, symbolUpdateError := transactionManager.UpdateIndexedSymbolModel(element)
+
+		if symbolUpdateError != nil {
+			return symbolUpdateError
+		}
+
+		eventError := recordHoldingChange(transactionManager, SourceRebalance, element.Symbol, oldAmount, element.Amount, fillPrice)
+
+		if eventError != nil {
+			return eventError
+		}
+
+		_, configUpdateError := transactionManager.UpdateCondextConfig(configModel)
+
+		if configUpdateError != nil {
+			return configUpdateError
+		}
+
+		return completeOrderIntent(transactionManager, orderIntent)
+	})
+}
+
+// handleTrades stops placing orders once the rebalance context ends, the order context cancels the one in flight
+func (rebalanceManager *RebalanceManager) handleTrades(rebalanceContext context.Context, orderContext context.Context) error {
+
+	configModel, configModelError := rebalanceManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return configModelError
 	}
 
-	_, configUpdateError := rebalanceManager.databaseMgr.UpdateCondextConfig(configModel)
+	plannedTrades, plannedTradesError := rebalanceManager.GenerateRebalancePlan()
 
-	if configUpdateError != nil {
-		logrus.Error(configUpdateError.Error())
+	if plannedTradesError != nil {
+		return plannedTradesError
 	}
 
-	return nil
-}
+	deferredTrades := 0
+
+	for _, plannedTrade := range plannedTrades {
+		if plannedTrade.Deferred == true {
+			deferredTrades = deferredTrades + 1
+		}
+	}
+
+	// Ticks with nothing to trade are not rebalances, they are left out of the snapshots and the event log
+	if deferredTrades == len(plannedTrades) {
+
+		for _, plannedTrade := range plannedTrades {
+			logrus.Warn("Skipping " + plannedTrade.Side + " of " + plannedTrade.Symbol + " " + plannedTrade.DeferReason)
+		}
+
+		return nil
+	}
+
+	// Taken once per rebalance that will trade, so there is always a copy from before the last orders
+	snapshotError := rebalanceManager.backupMgr.SnapshotBeforeRebalance()
+
+	if snapshotError != nil {
+		return errors.New("pre-rebalance snapshot failed, no orders were placed, " + snapshotError.Error())
+	}
+
+	startedError := recordEvent(rebalanceManager.databaseMgr, EventRebalanceStarted, SourceRebalance, "", rebalancePayload{
+		PlannedTrades:  len(plannedTrades),
+		DeferredTrades: deferredTrades,
+	})
+
+	if startedError != nil {
+		return errors.New("rebalance could not be recorded, no orders were placed, " + startedError.Error())
+	}
+
+	filledTrades := 0
+	failedTrades := 0
+	stopped := false
+
+	// The plan lists every sell ahead of the buys so the floating percentage is freed up first
+	for _, plannedTrade := range plannedTrades {
+
+		// Once stopped no new orders are placed, every filled one was already saved with its floating percentage
+		if rebalanceContext.Err() != nil {
+			logrus.Warn("Rebalance stopped before placing remaining trades")
+			stopped = true
+			break
+		}
+
+		if plannedTrade.Deferred == true {
+			logrus.Warn("Skipping " + plannedTrade.Side + " of " + plannedTrade.Symbol + " " + plannedTrade.DeferReason)
+			continue
+		}
+
+		_, elementError := rebalanceManager.databaseMgr.GetIndexedSymbolBySymbol(plannedTrade.Symbol)
+
+		if elementError != nil {
+			logrus.Error(elementError.Error())
+			continue
+		}
+
+		if plannedTrade.Side == "sell" {
+
+			sellIntent, sellError := rebalanceManager.placePlannedTrade(orderContext, plannedTrade)
 
-func (rebalanceManager *RebalanceManager) rebalanceRoutine() {
+			if sellError != nil {
+				logrus.Error(sellError.Error())
+				failedTrades = failedTrades + 1
+				continue
+			}
+
+			filledTrades = filledTrades + 1
 
-	for rebalanceManager.rebalanceProcessRunning == true {
+			saveError := rebalanceManager.saveFilledTrade(plannedTrade, sellIntent)
+
+			if saveError != nil {
+				logrus.Error("Sold " + plannedTrade.Symbol + " but could not save it, it is settled by the order recovery, " + saveError.Error())
+			}
 
-		calculateError := rebalanceManager.calculateCurrentPercentages()
+			// The cash was freed whether or not it was saved
+			configModel.FloatingPercentage = configModel.FloatingPercentage + plannedTrade.PercentageDifference
 
-		if calculateError != nil {
-			logrus.Error(calculateError.Error())
 			continue
 		}
 
-		handleTradesError := rebalanceManager.handleTrades()
+		if configModel.FloatingPercentage > plannedTrade.PercentageDifference {
+
+			buyIntent, buyError := rebalanceManager.placePlannedTrade(orderContext, plannedTrade)
+
+			if buyError != nil {
+				logrus.Error(buyError.Error())
+				failedTrades = failedTrades + 1
+				continue
+			}
+
+			filledTrades = filledTrades + 1
+
+			saveError := rebalanceManager.saveFilledTrade(plannedTrade, buyIntent)
+
+			if saveError != nil {
+				logrus.Error("Bought " + plannedTrade.Symbol + " but could not save it, it is settled by the order recovery, " + saveError.Error())
+			}
+
+			configModel.FloatingPercentage = configModel.FloatingPercentage - plannedTrade.PercentageDifference
+		} else {
+
+			logrus.Warn("Current floating percentage is not large enough to fulfill buy need of " + plannedTrade.Symbol)
+
+		}
+	}
+
+	return recordEvent(rebalanceManager.databaseMgr, EventRebalanceCompleted, SourceRebalance, "", rebalancePayload{
+		PlannedTrades:  len(plannedTrades),
+		DeferredTrades: deferredTrades,
+		FilledTrades:   filledTrades,
+		FailedTrades:   failedTrades,
+		Stopped:        stopped,
+	})
+}
+
+func (rebalanceManager *RebalanceManager) runRebalanceTick(rebalanceContext context.Context, orderContext context.Context) error {
+
+	// Orders still working at the broker on the last start are settled once they finish
+	recoverError := rebalanceManager.orderIntentMgr.RecoverOrderIntents()
+
+	if recoverError != nil {
+		logrus.Error(recoverError.Error())
+	}
+
+	snapshotError := rebalanceManager.performanceMgr.TakeSnapshotIfDue()
+
+	if snapshotError != nil {
+		logrus.Error(snapshotError.Error())
+	}
+
+	tradingAllowed, closedReason, tradingAllowedError := rebalanceManager.marketCalendarMgr.CheckTradingAllowed()
 
-		if handleTradesError != nil {
-			logrus.Error(handleTradesError)
+	if tradingAllowedError != nil {
+		return tradingAllowedError
+	}
+
+	tradingBlock, tradingBlockError := rebalanceManager.riskMgr.GetTradingBlock()
+
+	if tradingBlockError != nil {
+		return tradingBlockError
+	}
+
+	if tradingBlock != "" {
+		tradingAllowed = false
+		closedReason = tradingBlock
+	}
+
+	if tradingAllowed == true {
+
+		swapBackError := rebalanceManager.taxMgr.ProcessHarvestSwapBacks(orderContext)
+
+		if swapBackError != nil {
+			logrus.Error(swapBackError.Error())
 		}
+	}
 
-		time.Sleep(time.Duration(rebalanceManager.rebalanceFrequency) * time.Second)
+	calculateError := rebalanceManager.calculateCurrentPercentages()
 
+	if calculateError != nil {
+		return calculateError
+	}
 
+	// Orders placed while closed would sit until the open and fill at the auction price
+	if tradingAllowed == false {
+		logrus.Info("Skipping trades, " + closedReason)
+		return nil
 	}
+
+	return rebalanceManager.handleTrades(rebalanceContext, orderContext)
 }
 
-func (rebalanceManager *RebalanceManager) StartRebalanceProcess() error {
+// saveRebalanceMode persists the loop mode so a restart comes back the same way
+func (rebalanceManager *RebalanceManager) saveRebalanceMode(mode string) error {
+
+	rebalanceState, rebalanceStateError := rebalanceManager.databaseMgr.GetRebalanceStateModel()
+
+	if rebalanceStateError != nil {
+		return rebalanceStateError
+	}
+
+	rebalanceState.Mode = mode
+
+	_, saveError := rebalanceManager.databaseMgr.SaveRebalanceStateModel(rebalanceState)
+
+	return saveError
+}
+
+func (rebalanceManager *RebalanceManager) saveTickResult(tickAt time.Time, tickError error) {
+
+	// Held so a pause or stop saving the mode at the same time is not overwritten
+	rebalanceManager.rebalanceMutex.Lock()
+	defer rebalanceManager.rebalanceMutex.Unlock()
+
+	rebalanceState, rebalanceStateError := rebalanceManager.databaseMgr.GetRebalanceStateModel()
+
+	if rebalanceStateError != nil {
+		logrus.Error(rebalanceStateError.Error())
+		return
+	}
+
+	rebalanceState.LastTickAt = tickAt
+	rebalanceState.LastError = ""
+
+	if tickError != nil {
+		rebalanceState.LastError = tickError.Error()
+	}
+
+	_, saveError := rebalanceManager.databaseMgr.SaveRebalanceStateModel(rebalanceState)
+
+	if saveError != nil {
+		logrus.Error(saveError.Error())
+	}
+}
+
+func (rebalanceManager *RebalanceManager) rebalanceTick(rebalanceContext context.Context, orderContext context.Context) {
+
+	tickAt := time.Now()
+	tickError := rebalanceManager.runRebalanceTick(rebalanceContext, orderContext)
+
+	if tickError != nil {
+		logrus.Error(tickError.Error())
+	}
+
+	rebalanceManager.saveTickResult(tickAt, tickError)
+}
+
+func (rebalanceManager *RebalanceManager) rebalanceRoutine(rebalanceContext context.Context, orderContext context.Context, rebalanceDone chan struct{}) {
+
+	defer close(rebalanceDone)
+
+	for {
+
+		rebalanceManager.rebalanceMutex.Lock()
+		rebalancePaused := rebalanceManager.rebalancePaused
+		rebalanceManager.rebalanceMutex.Unlock()
+
+		// A paused loop keeps its schedule but skips the work
+		if rebalancePaused == false {
+			rebalanceManager.rebalanceTick(rebalanceContext, orderContext)
+		}
+
+		lastTickAt := time.Now()
+
+		for waiting := true; waiting == true; {
+
+			rebalanceManager.rebalanceMutex.Lock()
+			nextTickAt := lastTickAt.Add(time.Duration(rebalanceManager.rebalanceFrequency) * time.Second)
+			rebalanceManager.nextTickAt = nextTickAt
+			rebalanceManager.rebalanceMutex.Unlock()
+
+			select {
+			case <-rebalanceContext.Done():
+				logrus.Info("Rebalance process stopped")
+				return
+			case <-time.After(time.Until(nextTickAt)):
+				waiting = false
+			case <-rebalanceManager.rebalanceWake:
+			}
+		}
+	}
+}
+
+func (rebalanceManager *RebalanceManager) startRebalanceProcess(paused bool) error {
 
 	configModel, configModelError := rebalanceManager.databaseMgr.GetCondextConfigModel()
 
@@ -223,18 +639,469 @@ func (rebalanceManager *RebalanceManager) StartRebalanceProcess() error {
 		return errors.New("you need to generate the index before calling start")
 	}
 
+	rebalanceManager.rebalanceMutex.Lock()
+	defer rebalanceManager.rebalanceMutex.Unlock()
+
 	if rebalanceManager.rebalanceProcessRunning == true {
 		return errors.New("rebalance process already started")
 	}
 
+	if rebalanceManager.rebalanceDone != nil {
+		select {
+		case <-rebalanceManager.rebalanceDone:
+		default:
+			return errors.New("the stopped rebalance process is still finishing its tick")
+		}
+	}
+
+	rebalanceMode := "running"
+
+	if paused == true {
+		rebalanceMode = "paused"
+	}
+
+	saveModeError := rebalanceManager.saveRebalanceMode(rebalanceMode)
+
+	if saveModeError != nil {
+		return saveModeError
+	}
+
 	rebalanceManager.rebalanceFrequency = configModel.RebalanceFrequency
 	rebalanceManager.startingBalance = configModel.StartingBalance
 
+	// Stopping ends the loop after the current order, a shutdown also cancels the order in flight
+	orderContext, orderCancel := context.WithCancel(context.Background())
+	rebalanceContext, rebalanceCancel := context.WithCancel(orderContext)
+	rebalanceDone := make(chan struct{})
+
 	go func() {
-		rebalanceManager.rebalanceRoutine()
+		defer orderCancel()
+		rebalanceManager.rebalanceRoutine(rebalanceContext, orderContext, rebalanceDone)
 	}()
 
+	rebalanceManager.rebalanceCancel = rebalanceCancel
+	rebalanceManager.orderCancel = orderCancel
+	rebalanceManager.rebalanceDone = rebalanceDone
 	rebalanceManager.rebalanceProcessRunning = true
+	rebalanceManager.rebalancePaused = paused
 
 	return nil
 }
+
+// ReloadConfig picks up a changed frequency and starting balance without restarting the process
+func (rebalanceManager *RebalanceManager) ReloadConfig() error {
+
+	configModel, configModelError := rebalanceManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return configModelError
+	}
+
+	rebalanceManager.rebalanceMutex.Lock()
+	rebalanceManager.rebalanceFrequency = configModel.RebalanceFrequency
+	rebalanceManager.startingBalance = configModel.StartingBalance
+	rebalanceManager.rebalanceMutex.Unlock()
+
+	select {
+	case rebalanceManager.rebalanceWake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (rebalanceManager *RebalanceManager) StartRebalanceProcess() error {
+	return rebalanceManager.startRebalanceProcess(false)
+}
+
+// RestoreRebalanceProcess starts the loop again when it was running or paused as the last process exited
+func (rebalanceManager *RebalanceManager) RestoreRebalanceProcess() error {
+
+	rebalanceState, rebalanceStateError := rebalanceManager.databaseMgr.GetRebalanceStateModel()
+
+	if rebalanceStateError != nil {
+		return rebalanceStateError
+	}
+
+	switch rebalanceState.Mode {
+	case "running":
+		logrus.Info("Resuming rebalance process")
+		return rebalanceManager.startRebalanceProcess(false)
+	case "paused":
+		logrus.Info("Restoring paused rebalance process")
+		return rebalanceManager.startRebalanceProcess(true)
+	}
+
+	return nil
+}
+
+// SyncWithBroker re-reads positions so a restart does not trade on amounts saved before a crash. Orders sent before
+// the restart are settled first, a symbol whose order is still open keeps its amount, the broker position already
+// holds what that order filled and the order recovery adds it once the order is settled
+func (rebalanceManager *RebalanceManager) SyncWithBroker() error {
+
+	configModel, configModelError := rebalanceManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return configModelError
+	}
+
+	recoverError := rebalanceManager.orderIntentMgr.RecoverOrderIntents()
+
+	if recoverError != nil {
+		return recoverError
+	}
+
+	openIntents, openIntentsError := rebalanceManager.databaseMgr.GetOpenOrderIntents("")
+
+	if openIntentsError != nil {
+		return openIntentsError
+	}
+
+	unsettledSymbols := map[string]bool{}
+
+	for _, element := range openIntents {
+		unsettledSymbols[element.Symbol] = true
+	}
+
+	brokerPositions, brokerPositionsError := (*rebalanceManager.brokerIntegration).GetPositions()
+
+	if brokerPositionsError != nil {
+		return brokerPositionsError
+	}
+
+	allIndexedSymbols, allIndexedSymbolsError := rebalanceManager.databaseMgr.GetAllIndexedSymbols()
+
+	if allIndexedSymbolsError != nil {
+		return allIndexedSymbolsError
+	}
+
+	syncedSymbols := []dto.IndexedSymbolModel{}
+
+	for _, element := range allIndexedSymbols {
+
+		if unsettledSymbols[element.Symbol] == true {
+			logrus.Warn("Symbol " + element.Symbol + " has an order that is not settled yet, its amount is left to the order recovery")
+			continue
+		}
+
+		syncedSymbols = append(syncedSymbols, element)
+	}
+
+	syncError := rebalanceManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		for _, element := range syncedSymbols {
+
+			brokerAmount := brokerPositions[element.Symbol]
+
+			if brokerAmount == element.Amount {
+				continue
+			}
+
+			logrus.Warn("Symbol " + element.Symbol + " amount was " + strconv.FormatInt(element.Amount, 10) +
+				" but the broker holds " + strconv.FormatInt(brokerAmount, 10) + ", using the broker amount")
+
+			oldAmount := element.Amount
+			element.Amount = brokerAmount
+
+			_, updateSymbolError := transactionManager.UpdateIndexedSymbolModel(element)
+
+			if updateSymbolError != nil {
+				return updateSymbolError
+			}
+
+			eventError := recordHoldingChange(transactionManager, SourceBrokerSync, element.Symbol, oldAmount, brokerAmount, 0)
+
+			if eventError != nil {
+				return eventError
+			}
+		}
+
+		return nil
+	})
+
+	if syncError != nil {
+		return syncError
+	}
+
+	lotMismatches, lotMismatchesError := taxLotMismatches(rebalanceManager.databaseMgr, syncedSymbols, brokerPositions)
+
+	if lotMismatchesError != nil {
+		return lotMismatchesError
+	}
+
+	for _, element := range lotMismatches {
+		logrus.Warn("The " + element + ", the lots were not changed, correct them before harvesting or exporting the tax report")
+	}
+
+	rebalanceManager.rebalanceMutex.Lock()
+	rebalanceManager.startingBalance = configModel.StartingBalance
+	rebalanceManager.rebalanceMutex.Unlock()
+
+	return rebalanceManager.calculateCurrentPercentages()
+}
+
+// taxLotMismatches lists the symbols whose open tax lots do not add up to the broker position. The lots are left as
+// they are, the price and date of shares bought or sold outside condext are not known so an adjustment lot would put
+// made up numbers into the tax report
+func taxLotMismatches(databaseManager *DatabaseManager, indexedSymbols []dto.IndexedSymbolModel, brokerPositions map[string]int64) ([]string, error) {
+
+	mismatches := []string{}
+
+	for _, element := range indexedSymbols {
+
+		openLots, openLotsError := databaseManager.GetOpenTaxLotsBySymbol(element.Symbol)
+
+		if openLotsError != nil {
+			return nil, openLotsError
+		}
+
+		openLotAmount := int64(0)
+
+		for _, lot := range openLots {
+			openLotAmount = openLotAmount + lot.RemainingAmount
+		}
+
+		// Holdings bought before lots were tracked have no lots
+		if openLotAmount == 0 || openLotAmount == brokerPositions[element.Symbol] {
+			continue
+		}
+
+		mismatches = append(mismatches, "tax lots of "+element.Symbol+" hold "+strconv.FormatInt(openLotAmount, 10)+
+			" shares but the broker holds "+strconv.FormatInt(brokerPositions[element.Symbol], 10))
+	}
+
+	return mismatches, nil
+}
+
+// AutoResumeRebalanceProcess syncs with the broker and restores the loop when it was running or paused before shutdown
+func (rebalanceManager *RebalanceManager) AutoResumeRebalanceProcess() error {
+
+	configModel, configModelError := rebalanceManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return configModelError
+	}
+
+	rebalanceState, rebalanceStateError := rebalanceManager.databaseMgr.GetRebalanceStateModel()
+
+	if rebalanceStateError != nil {
+		return rebalanceStateError
+	}
+
+	if configModel.Active != true || rebalanceState.Mode == "stopped" {
+		return nil
+	}
+
+	logrus.Info("Rebalance process was " + rebalanceState.Mode + " before shutdown, syncing with the broker")
+
+	syncError := rebalanceManager.SyncWithBroker()
+
+	if syncError != nil {
+		return syncError
+	}
+
+	return rebalanceManager.RestoreRebalanceProcess()
+}
+
+func (rebalanceManager *RebalanceManager) stopRebalanceProcess(saveMode bool, cancelOrder bool) error {
+
+	rebalanceManager.rebalanceMutex.Lock()
+	defer rebalanceManager.rebalanceMutex.Unlock()
+
+	if rebalanceManager.rebalanceProcessRunning != true {
+		return errors.New("rebalance process is not running")
+	}
+
+	if saveMode == true {
+
+		saveModeError := rebalanceManager.saveRebalanceMode("stopped")
+
+		if saveModeError != nil {
+			return saveModeError
+		}
+	}
+
+	rebalanceManager.rebalanceCancel()
+
+	if cancelOrder == true {
+		rebalanceManager.orderCancel()
+	}
+
+	rebalanceManager.rebalanceProcessRunning = false
+	rebalanceManager.rebalancePaused = false
+	rebalanceManager.nextTickAt = time.Time{}
+
+	return nil
+}
+
+// StopRebalanceProcess lets the current order finish and stops the loop before the next one
+func (rebalanceManager *RebalanceManager) StopRebalanceProcess() error {
+	return rebalanceManager.stopRebalanceProcess(true, false)
+}
+
+// ShutdownRebalanceProcess stops the loop for process exit, cancels the order in flight at the broker and keeps the
+// saved mode for the next start
+func (rebalanceManager *RebalanceManager) ShutdownRebalanceProcess() error {
+	return rebalanceManager.stopRebalanceProcess(false, true)
+}
+
+func (rebalanceManager *RebalanceManager) setRebalancePaused(paused bool) error {
+
+	rebalanceManager.rebalanceMutex.Lock()
+	defer rebalanceManager.rebalanceMutex.Unlock()
+
+	if rebalanceManager.rebalanceProcessRunning != true {
+		return errors.New("rebalance process is not running")
+	}
+
+	if rebalanceManager.rebalancePaused == paused {
+
+		if paused == true {
+			return errors.New("rebalance process is already paused")
+		}
+
+		return errors.New("rebalance process is not paused")
+	}
+
+	rebalanceMode := "running"
+
+	if paused == true {
+		rebalanceMode = "paused"
+	}
+
+	saveModeError := rebalanceManager.saveRebalanceMode(rebalanceMode)
+
+	if saveModeError != nil {
+		return saveModeError
+	}
+
+	rebalanceManager.rebalancePaused = paused
+
+	return nil
+}
+
+// PauseRebalanceProcess keeps the loop alive but skips ticks from the next one on
+func (rebalanceManager *RebalanceManager) PauseRebalanceProcess() error {
+	return rebalanceManager.setRebalancePaused(true)
+}
+
+func (rebalanceManager *RebalanceManager) ResumeRebalanceProcess() error {
+	return rebalanceManager.setRebalancePaused(false)
+}
+
+// RunRebalanceOnce runs a single rebalance tick in the foreground for scheduled runs, it counts as a running process
+// while it trades so nothing else starts one and a stop or shutdown reaches it
+func (rebalanceManager *RebalanceManager) RunRebalanceOnce() error {
+
+	configModel, configModelError := rebalanceManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return configModelError
+	}
+
+	if configModel.Active != true {
+		return errors.New("you need to generate the index before running a rebalance")
+	}
+
+	rebalanceManager.rebalanceMutex.Lock()
+
+	if rebalanceManager.rebalanceProcessRunning == true {
+		rebalanceManager.rebalanceMutex.Unlock()
+		return errors.New("rebalance process already started")
+	}
+
+	if rebalanceManager.rebalanceDone != nil {
+		select {
+		case <-rebalanceManager.rebalanceDone:
+		default:
+			rebalanceManager.rebalanceMutex.Unlock()
+			return errors.New("the stopped rebalance process is still finishing its tick")
+		}
+	}
+
+	orderContext, orderCancel := context.WithCancel(context.Background())
+	rebalanceContext, rebalanceCancel := context.WithCancel(orderContext)
+	rebalanceDone := make(chan struct{})
+
+	rebalanceManager.rebalanceCancel = rebalanceCancel
+	rebalanceManager.orderCancel = orderCancel
+	rebalanceManager.rebalanceDone = rebalanceDone
+	rebalanceManager.rebalanceProcessRunning = true
+	rebalanceManager.startingBalance = configModel.StartingBalance
+	rebalanceManager.rebalanceMutex.Unlock()
+
+	defer func() {
+		rebalanceManager.rebalanceMutex.Lock()
+		rebalanceManager.rebalanceProcessRunning = false
+		rebalanceManager.rebalanceMutex.Unlock()
+
+		close(rebalanceDone)
+		orderCancel()
+	}()
+
+	tickAt := time.Now()
+	tickError := rebalanceManager.runRebalanceTick(rebalanceContext, orderContext)
+
+	rebalanceManager.saveTickResult(tickAt, tickError)
+
+	return tickError
+}
+
+// WaitForRebalanceProcess blocks until a stopped loop has finished its in-flight tick or the timeout passes
+func (rebalanceManager *RebalanceManager) WaitForRebalanceProcess(timeout time.Duration) bool {
+
+	rebalanceManager.rebalanceMutex.Lock()
+	rebalanceDone := rebalanceManager.rebalanceDone
+	rebalanceManager.rebalanceMutex.Unlock()
+
+	if rebalanceDone == nil {
+		return true
+	}
+
+	select {
+	case <-rebalanceDone:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (rebalanceManager *RebalanceManager) IsRebalanceProcessRunning() bool {
+
+	rebalanceManager.rebalanceMutex.Lock()
+	defer rebalanceManager.rebalanceMutex.Unlock()
+
+	return rebalanceManager.rebalanceProcessRunning
+}
+
+func (rebalanceManager *RebalanceManager) GetRebalanceStatus() (RebalanceStatus, error) {
+
+	rebalanceState, rebalanceStateError := rebalanceManager.databaseMgr.GetRebalanceStateModel()
+
+	if rebalanceStateError != nil {
+		return RebalanceStatus{}, rebalanceStateError
+	}
+
+	rebalanceManager.rebalanceMutex.Lock()
+	defer rebalanceManager.rebalanceMutex.Unlock()
+
+	rebalanceStatus := RebalanceStatus{
+		Mode:       "stopped",
+		SavedMode:  rebalanceState.Mode,
+		LastTickAt: rebalanceState.LastTickAt,
+		LastError:  rebalanceState.LastError,
+	}
+
+	if rebalanceManager.rebalanceProcessRunning == true {
+
+		rebalanceStatus.Mode = "running"
+		rebalanceStatus.NextTickAt = rebalanceManager.nextTickAt
+
+		if rebalanceManager.rebalancePaused == true {
+			rebalanceStatus.Mode = "paused"
+		}
+	}
+
+	return rebalanceStatus, nil
+}
@@ -0,0 +1,202 @@
+package managers
+
+import (
+	"github.com/r4stl1n/condext/pkg/broker-integrations"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTaxLotMismatches(t *testing.T) {
+
+	testCases := []struct {
+		name            string
+		lotAmounts      []int64
+		brokerPositions map[string]int64
+		mismatches      []string
+	}{
+		{"lots match the broker", []int64{6, 4}, map[string]int64{"VTI": 10}, []string{}},
+		{"no lots tracked", []int64{}, map[string]int64{"VTI": 10}, []string{}},
+		{"broker holds more", []int64{6}, map[string]int64{"VTI": 10}, []string{"tax lots of VTI hold 6 shares but the broker holds 10"}},
+		{"broker holds fewer", []int64{6, 4}, map[string]int64{"VTI": 7}, []string{"tax lots of VTI hold 10 shares but the broker holds 7"}},
+		{"position closed at the broker", []int64{3}, map[string]int64{}, []string{"tax lots of VTI hold 3 shares but the broker holds 0"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			for _, lotAmount := range testCase.lotAmounts {
+
+				_, createError := databaseManager.CreateTaxLotModel(dto.TaxLotModel{
+					Symbol:          "VTI",
+					Amount:          lotAmount,
+					RemainingAmount: lotAmount,
+					CostBasis:       100,
+					AcquiredAt:      time.Now(),
+				})
+
+				if createError != nil {
+					t.Fatal(createError)
+				}
+			}
+
+			indexedSymbols := []dto.IndexedSymbolModel{{Symbol: "VTI", Amount: 10}}
+
+			mismatches, mismatchesError := taxLotMismatches(databaseManager, indexedSymbols, testCase.brokerPositions)
+
+			if mismatchesError != nil {
+				t.Fatal(mismatchesError)
+			}
+
+			if reflect.DeepEqual(mismatches, testCase.mismatches) == false {
+				t.Errorf("taxLotMismatches = %q, want %q", mismatches, testCase.mismatches)
+			}
+
+			openLots, openLotsError := databaseManager.GetOpenTaxLotsBySymbol("VTI")
+
+			if openLotsError != nil {
+				t.Fatal(openLotsError)
+			}
+
+			if len(openLots) != len(testCase.lotAmounts) {
+				t.Errorf("got %d open lots after the check, want the %d it started with", len(openLots), len(testCase.lotAmounts))
+			}
+		})
+	}
+}
+
+func TestSyncWithBroker(t *testing.T) {
+
+	testCases := []struct {
+		name           string
+		savedAmount    int64
+		brokerPosition int64
+		intentStatus   string
+		brokerStatus   string
+		filledAmount   int64
+		syncedAmount   int64
+		settledAmount  int64
+	}{
+		{"no open order", 10, 25, "", "", 0, 25, 25},
+		{"order filled before the restart", 0, 40, OrderIntentFilled, "filled", 40, 40, 40},
+		{"order canceled in part before the restart", 0, 40, OrderIntentPending, "canceled", 40, 40, 40},
+		{"order still working at the broker", 0, 40, OrderIntentPending, "partially_filled", 40, 0, 100},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			_, symbolError := databaseManager.CreateIndexSymbolModel(dto.IndexedSymbolModel{Symbol: "VTI", DesiredPercentage: 100, Amount: testCase.savedAmount})
+
+			if symbolError != nil {
+				t.Fatal(symbolError)
+			}
+
+			fakeBroker := createFakeBrokerIntegration()
+			fakeBroker.positions["VTI"] = testCase.brokerPosition
+
+			var orderIntent dto.OrderIntentModel
+
+			if testCase.intentStatus != "" {
+
+				var intentError error
+
+				orderIntent, intentError = createOrderIntent(databaseManager, RiskOrder{Symbol: "VTI", Side: "buy", Amount: 100, Price: 100, Source: SourceRebalance})
+
+				if intentError != nil {
+					t.Fatal(intentError)
+				}
+
+				orderIntent.Status = testCase.intentStatus
+
+				if testCase.intentStatus == OrderIntentFilled {
+					orderIntent.FilledAmount = testCase.filledAmount
+					orderIntent.FillPrice = 100
+				}
+
+				_, updateError := databaseManager.UpdateOrderIntentModel(orderIntent)
+
+				if updateError != nil {
+					t.Fatal(updateError)
+				}
+
+				fakeBroker.orders[orderIntent.ClientOrderId] = broker_integrations.BrokerOrder{
+					ClientOrderId: orderIntent.ClientOrderId,
+					Symbol:        "VTI",
+					Side:          "buy",
+					Status:        testCase.brokerStatus,
+					FilledAmount:  testCase.filledAmount,
+					FillPrice:     100,
+				}
+			}
+
+			// Made after the intent so the intent counts as sent before the restart
+			riskManager := CreateRiskManager(databaseManager, fakeBroker)
+			taxManager := CreateTaxManager(databaseManager, riskManager, fakeBroker)
+			orderIntentManager := CreateOrderIntentManager(databaseManager, taxManager, fakeBroker)
+
+			rebalanceManager := CreateRebalanceManager(databaseManager, taxManager, nil, nil, riskManager, nil, orderIntentManager, fakeBroker)
+
+			syncError := rebalanceManager.SyncWithBroker()
+
+			if syncError != nil {
+				t.Fatal(syncError)
+			}
+
+			indexedSymbol, indexedSymbolError := databaseManager.GetIndexedSymbolBySymbol("VTI")
+
+			if indexedSymbolError != nil {
+				t.Fatal(indexedSymbolError)
+			}
+
+			if indexedSymbol.Amount != testCase.syncedAmount {
+				t.Errorf("amount after the sync is %d, want %d", indexedSymbol.Amount, testCase.syncedAmount)
+			}
+
+			// The working order finishes and the next recovery pass settles it
+			if testCase.intentStatus != "" {
+
+				fakeBroker.positions["VTI"] = testCase.settledAmount
+
+				brokerOrder := fakeBroker.orders[orderIntent.ClientOrderId]
+
+				if brokerOrderFinalStatuses[brokerOrder.Status] == false {
+					brokerOrder.Status = "filled"
+					brokerOrder.FilledAmount = testCase.settledAmount
+					fakeBroker.orders[orderIntent.ClientOrderId] = brokerOrder
+				}
+			}
+
+			recoverError := orderIntentManager.RecoverOrderIntents()
+
+			if recoverError != nil {
+				t.Fatal(recoverError)
+			}
+
+			indexedSymbol, indexedSymbolError = databaseManager.GetIndexedSymbolBySymbol("VTI")
+
+			if indexedSymbolError != nil {
+				t.Fatal(indexedSymbolError)
+			}
+
+			if indexedSymbol.Amount != testCase.settledAmount {
+				t.Errorf("amount once the order is settled is %d, want %d", indexedSymbol.Amount, testCase.settledAmount)
+			}
+
+			openIntents, openIntentsError := databaseManager.GetOpenOrderIntents("VTI")
+
+			if openIntentsError != nil {
+				t.Fatal(openIntentsError)
+			}
+
+			if len(openIntents) != 0 {
+				t.Errorf("order intent is still %s", openIntents[0].Status)
+			}
+		})
+	}
+}
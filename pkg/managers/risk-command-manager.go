@@ -0,0 +1,266 @@
+package managers
+
+import (
+	"errors"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/renderers"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/abiosoft/ishell.v2"
+	"strconv"
+	"strings"
+)
+
+// Names accepted by risk_limit
+var riskLimitNames = []string{"order_notional", "daily_notional", "position_weight", "price_deviation"}
+
+type RiskCommandManager struct {
+	databaseMgr *DatabaseManager
+	riskMgr     *RiskManager
+}
+
+func CreateRiskCommandManager(databaseManager *DatabaseManager, riskManager *RiskManager) *RiskCommandManager {
+
+	return &RiskCommandManager{
+		databaseMgr: databaseManager,
+		riskMgr:     riskManager,
+	}
+}
+
+func (riskCommandManager *RiskCommandManager) Halt(haltReason string, source string) error {
+	return riskCommandManager.riskMgr.Halt(haltReason, source)
+}
+
+func (riskCommandManager *RiskCommandManager) HaltCommand(c *ishell.Context) {
+
+	haltError := riskCommandManager.Halt(strings.Join(c.Args, " "), SourceShell)
+
+	if haltError != nil {
+		logrus.Error(haltError.Error())
+		return
+	}
+
+	logrus.Warn("Trading halted, every order is rejected until risk_resume")
+}
+
+func (riskCommandManager *RiskCommandManager) Resume(source string) error {
+	return riskCommandManager.riskMgr.Resume(source)
+}
+
+func (riskCommandManager *RiskCommandManager) ResumeCommand(c *ishell.Context) {
+
+	resumeError := riskCommandManager.Resume(SourceShell)
+
+	if resumeError != nil {
+		logrus.Error(resumeError.Error())
+		return
+	}
+
+	logrus.Info("Trading resumed")
+}
+
+func (riskCommandManager *RiskCommandManager) SetLimit(limitName string, limitValue string, source string) error {
+
+	parsedValue, parseError := strconv.ParseFloat(limitValue, 64)
+
+	if parseError != nil || parsedValue < 0 {
+		return errors.New("limit value must be a number of zero or more, zero turns the check off")
+	}
+
+	configModel, configModelError := riskCommandManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return configModelError
+	}
+
+	var limitTarget *float64
+
+	switch strings.ToLower(limitName) {
+	case "order_notional":
+		limitTarget = &configModel.MaxOrderNotional
+	case "daily_notional":
+		limitTarget = &configModel.MaxDailyNotional
+	case "position_weight":
+		limitTarget = &configModel.MaxPositionWeight
+	case "price_deviation":
+		limitTarget = &configModel.MaxPriceDeviation
+	default:
+		return errors.New("unknown limit, use one of " + strings.Join(riskLimitNames, ", "))
+	}
+
+	oldValue := *limitTarget
+	*limitTarget = parsedValue
+
+	return riskCommandManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		_, updateError := transactionManager.UpdateCondextConfig(configModel)
+
+		if updateError != nil {
+			return updateError
+		}
+
+		return recordConfigChange(transactionManager, source, "risk_limit."+strings.ToLower(limitName),
+			decimal.NewFromFloat(oldValue).String(), decimal.NewFromFloat(parsedValue).String())
+	})
+}
+
+func (riskCommandManager *RiskCommandManager) SetLimitCommand(c *ishell.Context) {
+
+	if len(c.Args) != 2 {
+		logrus.Warn("Not enough parameters submitted")
+		return
+	}
+
+	limitError := riskCommandManager.SetLimit(c.Args[0], c.Args[1], SourceShell)
+
+	if limitError != nil {
+		logrus.Error(limitError.Error())
+		return
+	}
+
+	logrus.Info("Risk limit " + strings.ToLower(c.Args[0]) + " set to " + c.Args[1])
+}
+
+func (riskCommandManager *RiskCommandManager) GetRiskState() (dto.RiskStateModel, dto.CondextConfigModel, error) {
+
+	riskState, riskStateError := riskCommandManager.riskMgr.GetRiskState()
+
+	if riskStateError != nil {
+		return riskState, dto.CondextConfigModel{}, riskStateError
+	}
+
+	configModel, configModelError := riskCommandManager.databaseMgr.GetCondextConfigModel()
+
+	return riskState, configModel, configModelError
+}
+
+func riskLimitText(limitValue float64) string {
+
+	if limitValue <= 0 {
+		return "off"
+	}
+
+	return decimal.NewFromFloat(limitValue).String()
+}
+
+func RiskView(riskState dto.RiskStateModel, configModel dto.CondextConfigModel) renderers.View {
+
+	haltedAt := "-"
+
+	if riskState.Halted == true {
+		haltedAt = riskState.HaltedAt.Format("2006-01-02 15:04:05")
+	}
+
+	return renderers.View{
+		Name: "Risk",
+		Columns: []renderers.ViewColumn{
+			{Key: "halted", Title: "Halted"},
+			{Key: "halt_reason", Title: "Halt Reason"},
+			{Key: "halted_at", Title: "Halted At"},
+			{Key: "max_order_notional", Title: "Max Order Notional"},
+			{Key: "max_daily_notional", Title: "Max Daily Notional"},
+			{Key: "max_position_weight", Title: "Max Position Weight %"},
+			{Key: "max_price_deviation", Title: "Max Price Deviation %"},
+		},
+		Rows: [][]string{
+			{
+				strconv.FormatBool(riskState.Halted),
+				riskState.HaltReason,
+				haltedAt,
+				riskLimitText(configModel.MaxOrderNotional),
+				riskLimitText(configModel.MaxDailyNotional),
+				riskLimitText(configModel.MaxPositionWeight),
+				riskLimitText(configModel.MaxPriceDeviation),
+			},
+		},
+		Vertical: true,
+	}
+}
+
+func (riskCommandManager *RiskCommandManager) ShowRiskCommand(c *ishell.Context) {
+
+	_, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	riskState, configModel, riskStateError := riskCommandManager.GetRiskState()
+
+	if riskStateError != nil {
+		logrus.Error(riskStateError.Error())
+		return
+	}
+
+	renderError := RenderView(RiskView(riskState, configModel), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
+
+func (riskCommandManager *RiskCommandManager) GetRejections(limit int) ([]dto.RiskRejectionModel, error) {
+	return riskCommandManager.riskMgr.GetRecentRejections(limit)
+}
+
+func RiskRejectionsView(riskRejections []dto.RiskRejectionModel) renderers.View {
+
+	view := renderers.View{
+		Name: "Risk rejections",
+		Columns: []renderers.ViewColumn{
+			{Key: "rejected_at", Title: "Rejected At"},
+			{Key: "source", Title: "Source"},
+			{Key: "symbol", Title: "Symbol"},
+			{Key: "side", Title: "Side"},
+			{Key: "amount", Title: "Amount"},
+			{Key: "price", Title: "Price"},
+			{Key: "rule", Title: "Rule"},
+			{Key: "reason", Title: "Reason"},
+		},
+	}
+
+	for _, element := range riskRejections {
+		view.Rows = append(view.Rows, []string{element.RejectedAt.Format("2006-01-02 15:04:05"), element.Source, element.Symbol,
+			element.Side, decimal.NewFromInt(element.Amount).String(), decimal.NewFromFloat(element.Price).String(), element.Rule, element.Reason})
+	}
+
+	return view
+}
+
+func (riskCommandManager *RiskCommandManager) ShowRejectionsCommand(c *ishell.Context) {
+
+	positionalArgs, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	limit := 25
+
+	if len(positionalArgs) > 0 {
+
+		parsedLimit, parseError := strconv.Atoi(positionalArgs[0])
+
+		if parseError != nil || parsedLimit <= 0 {
+			logrus.Error("limit must be a positive number")
+			return
+		}
+
+		limit = parsedLimit
+	}
+
+	riskRejections, riskRejectionsError := riskCommandManager.GetRejections(limit)
+
+	if riskRejectionsError != nil {
+		logrus.Error(riskRejectionsError.Error())
+		return
+	}
+
+	renderError := RenderView(RiskRejectionsView(riskRejections), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
@@ -0,0 +1,481 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"github.com/r4stl1n/condext/pkg/broker-integrations"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"time"
+)
+
+const (
+	RiskRuleHalt              = "halt"
+	RiskRuleMaxOrderNotional  = "max_order_notional"
+	RiskRuleMaxDailyNotional  = "max_daily_notional"
+	RiskRuleMaxPositionWeight = "max_position_weight"
+	RiskRulePriceSanity       = "price_sanity"
+	RiskRuleBuyingPower       = "buying_power"
+	RiskRuleLiveGuard         = "live_guard"
+	RiskRuleOpenOrder         = "open_order"
+)
+
+// RiskOrder is an order about to be sent to the broker, Source names the job placing it
+type RiskOrder struct {
+	Symbol string
+	Side   string
+	Amount int64
+	Price  float64
+	Source string
+
+	// Saved on the intent so an order settled by the recovery closes the lots and updates the swap its job would have
+	Lots   []dto.TaxLotModel
+	SwapID uint
+}
+
+type RiskManager struct {
+	databaseMgr *DatabaseManager
+
+	// Set for a live environment until the operator confirms live trading
+	liveUnconfirmed bool
+
+	brokerIntegration *broker_integrations.BrokerIntegrationInterface
+}
+
+func CreateRiskManager(databaseManager *DatabaseManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *RiskManager {
+
+	return &RiskManager{
+		databaseMgr:       databaseManager,
+		brokerIntegration: &selectedBrokerIntegration,
+	}
+}
+
+// RequireLiveConfirmation blocks every order until ConfirmLiveTrading is called
+func (riskManager *RiskManager) RequireLiveConfirmation() {
+	riskManager.liveUnconfirmed = true
+}
+
+func (riskManager *RiskManager) ConfirmLiveTrading() {
+	riskManager.liveUnconfirmed = false
+}
+
+func (riskManager *RiskManager) reject(riskOrder RiskOrder, rule string, reason string) error {
+
+	logrus.Warn("Risk check " + rule + " rejected " + riskOrder.Side + " of " + strconv.FormatInt(riskOrder.Amount, 10) + " " + riskOrder.Symbol + ", " + reason)
+
+	_, createError := riskManager.databaseMgr.CreateRiskRejectionModel(dto.RiskRejectionModel{
+		Symbol:     riskOrder.Symbol,
+		Side:       riskOrder.Side,
+		Amount:     riskOrder.Amount,
+		Price:      riskOrder.Price,
+		Source:     riskOrder.Source,
+		Rule:       rule,
+		Reason:     reason,
+		RejectedAt: time.Now(),
+	})
+
+	if createError != nil {
+		logrus.Error(createError.Error())
+	}
+
+	eventError := recordEvent(riskManager.databaseMgr, EventOrderRejected, riskOrder.Source, riskOrder.Symbol, orderPayload{
+		Side:   riskOrder.Side,
+		Amount: riskOrder.Amount,
+		Price:  riskOrder.Price,
+		Rule:   rule,
+		Reason: reason,
+	})
+
+	if eventError != nil {
+		logrus.Error(eventError.Error())
+	}
+
+	return errors.New("order rejected by " + rule + ", " + reason)
+}
+
+func (riskManager *RiskManager) getDailyNotional() (decimal.Decimal, error) {
+
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	fills, fillsError := riskManager.databaseMgr.GetFillsSince(startOfDay)
+
+	if fillsError != nil {
+		return decimal.Zero, fillsError
+	}
+
+	dailyNotional := decimal.Zero
+
+	for _, fill := range fills {
+		dailyNotional = dailyNotional.Add(decimal.NewFromInt(fill.Amount).Mul(decimal.NewFromFloat(fill.Price)))
+	}
+
+	return dailyNotional, nil
+}
+
+// CheckOrder runs every pre-trade rule against the order, a rejection is saved with the rule that fired
+func (riskManager *RiskManager) CheckOrder(riskOrder RiskOrder) error {
+
+	if riskManager.liveUnconfirmed == true {
+		return riskManager.reject(riskOrder, RiskRuleLiveGuard, "live trading was not confirmed at startup")
+	}
+
+	riskState, riskStateError := riskManager.databaseMgr.GetRiskStateModel()
+
+	if riskStateError != nil {
+		return riskStateError
+	}
+
+	if riskState.Halted == true {
+		return riskManager.reject(riskOrder, RiskRuleHalt, "trading is halted, "+riskState.HaltReason)
+	}
+
+	// Until an earlier order is settled the saved amount may be behind the broker and a new order could repeat it
+	openIntents, openIntentsError := riskManager.databaseMgr.GetOpenOrderIntents(riskOrder.Symbol)
+
+	if openIntentsError != nil {
+		return openIntentsError
+	}
+
+	if len(openIntents) > 0 {
+		return riskManager.reject(riskOrder, RiskRuleOpenOrder, "order "+openIntents[0].ClientOrderId+" is not settled yet, it is settled by the order recovery")
+	}
+
+	configModel, configModelError := riskManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return configModelError
+	}
+
+	orderNotional := decimal.NewFromInt(riskOrder.Amount).Mul(decimal.NewFromFloat(riskOrder.Price))
+
+	if configModel.MaxOrderNotional > 0 && orderNotional.GreaterThan(decimal.NewFromFloat(configModel.MaxOrderNotional)) {
+		return riskManager.reject(riskOrder, RiskRuleMaxOrderNotional,
+			"notional "+orderNotional.StringFixed(2)+" is above "+decimal.NewFromFloat(configModel.MaxOrderNotional).StringFixed(2))
+	}
+
+	if configModel.MaxDailyNotional > 0 {
+
+		dailyNotional, dailyNotionalError := riskManager.getDailyNotional()
+
+		if dailyNotionalError != nil {
+			return dailyNotionalError
+		}
+
+		if dailyNotional.Add(orderNotional).GreaterThan(decimal.NewFromFloat(configModel.MaxDailyNotional)) {
+			return riskManager.reject(riskOrder, RiskRuleMaxDailyNotional,
+				"traded "+dailyNotional.StringFixed(2)+" today and this order adds "+orderNotional.StringFixed(2)+
+					", the limit is "+decimal.NewFromFloat(configModel.MaxDailyNotional).StringFixed(2))
+		}
+	}
+
+	if configModel.MaxPriceDeviation > 0 {
+
+		previousClose, previousCloseError := (*riskManager.brokerIntegration).GetPreviousClose(riskOrder.Symbol)
+
+		// Without a reference price the quote can not be trusted
+		if previousCloseError != nil {
+			return riskManager.reject(riskOrder, RiskRulePriceSanity, "no previous close, "+previousCloseError.Error())
+		}
+
+		if previousClose <= 0 {
+			return riskManager.reject(riskOrder, RiskRulePriceSanity, "the previous close is not a usable price")
+		}
+
+		priceDeviation := decimal.NewFromFloat(riskOrder.Price).Sub(decimal.NewFromFloat(previousClose)).Abs().
+			Div(decimal.NewFromFloat(previousClose)).Mul(decimal.NewFromInt(100))
+
+		if priceDeviation.GreaterThan(decimal.NewFromFloat(configModel.MaxPriceDeviation)) {
+			return riskManager.reject(riskOrder, RiskRulePriceSanity,
+				"price "+decimal.NewFromFloat(riskOrder.Price).StringFixed(2)+" is "+priceDeviation.StringFixed(2)+
+					"% away from the previous close "+decimal.NewFromFloat(previousClose).StringFixed(2))
+		}
+	}
+
+	// Sells only reduce exposure and free up cash
+	if riskOrder.Side != "buy" {
+		return nil
+	}
+
+	accountCash, accountCashError := (*riskManager.brokerIntegration).GetAccountCash()
+
+	if accountCashError != nil {
+		return accountCashError
+	}
+
+	if orderNotional.GreaterThan(decimal.NewFromFloat(accountCash)) {
+		return riskManager.reject(riskOrder, RiskRuleBuyingPower,
+			"notional "+orderNotional.StringFixed(2)+" is above the available cash "+decimal.NewFromFloat(accountCash).StringFixed(2))
+	}
+
+	if configModel.MaxPositionWeight > 0 {
+
+		accountValue, accountValueError := (*riskManager.brokerIntegration).GetAccountValue()
+
+		if accountValueError != nil {
+			return accountValueError
+		}
+
+		if accountValue <= 0 {
+			return riskManager.reject(riskOrder, RiskRuleMaxPositionWeight, "the account has no value to weigh the position against")
+		}
+
+		heldAmount := int64(0)
+
+		indexedSymbol, indexedSymbolError := riskManager.databaseMgr.GetIndexedSymbolBySymbol(riskOrder.Symbol)
+
+		if indexedSymbolError == nil {
+			heldAmount = indexedSymbol.Amount
+		}
+
+		positionWeight := decimal.NewFromInt(heldAmount + riskOrder.Amount).Mul(decimal.NewFromFloat(riskOrder.Price)).
+			Div(decimal.NewFromFloat(accountValue)).Mul(decimal.NewFromInt(100))
+
+		if positionWeight.GreaterThan(decimal.NewFromFloat(configModel.MaxPositionWeight)) {
+			return riskManager.reject(riskOrder, RiskRuleMaxPositionWeight,
+				"position would be "+positionWeight.StringFixed(2)+"% of the account, the limit is "+
+					decimal.NewFromFloat(configModel.MaxPositionWeight).String()+"%")
+		}
+	}
+
+	return nil
+}
+
+// PlaceOrder checks the order, saves an intent for it and sends it as a market order under the intent's client order id.
+// The returned intent carries the fill price, or the order price when the broker does not report one, and has to be
+// completed in the transaction that saves the fill. The order is canceled at the broker if the context ends or the order
+// timeout passes before it fills
+func (riskManager *RiskManager) PlaceOrder(orderContext context.Context, riskOrder RiskOrder) (dto.OrderIntentModel, error) {
+
+	if orderContext.Err() != nil {
+		return dto.OrderIntentModel{}, errors.New("order not sent, " + orderContext.Err().Error())
+	}
+
+	checkError := riskManager.CheckOrder(riskOrder)
+
+	if checkError != nil {
+		return dto.OrderIntentModel{}, checkError
+	}
+
+	// An order that can not be recorded is not sent, the log has to show every order the broker saw
+	orderIntent, intentError := createOrderIntent(riskManager.databaseMgr, riskOrder)
+
+	if intentError != nil {
+		return dto.OrderIntentModel{}, errors.New("order not sent, it could not be recorded, " + intentError.Error())
+	}
+
+	configModel, configModelError := riskManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		riskManager.settleFailedOrder(orderIntent, configModelError)
+		return dto.OrderIntentModel{}, configModelError
+	}
+
+	// A resting order, a halted symbol or one done for the day would otherwise hold the job and the instance lock
+	if configModel.OrderTimeout > 0 {
+
+		var cancelOrder context.CancelFunc
+
+		orderContext, cancelOrder = context.WithTimeout(orderContext, time.Duration(configModel.OrderTimeout)*time.Second)
+
+		defer cancelOrder()
+	}
+
+	var fillPrice float64
+	var orderError error
+
+	if riskOrder.Side == "sell" {
+		fillPrice, orderError = (*riskManager.brokerIntegration).FulFillMarketOrderSell(orderContext, riskOrder.Symbol, riskOrder.Amount, orderIntent.ClientOrderId)
+	} else {
+		fillPrice, orderError = (*riskManager.brokerIntegration).FulFillMarketOrderBuy(orderContext, riskOrder.Symbol, riskOrder.Amount, orderIntent.ClientOrderId)
+	}
+
+	if orderError != nil {
+		riskManager.settleFailedOrder(orderIntent, orderError)
+		return dto.OrderIntentModel{}, orderError
+	}
+
+	if fillPrice == 0 {
+		fillPrice = riskOrder.Price
+	}
+
+	orderIntent.Status = OrderIntentFilled
+	orderIntent.FilledAmount = riskOrder.Amount
+	orderIntent.FillPrice = fillPrice
+
+	filledError := riskManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		_, updateError := transactionManager.UpdateOrderIntentModel(orderIntent)
+
+		if updateError != nil {
+			return updateError
+		}
+
+		return recordEvent(transactionManager, EventOrderFilled, riskOrder.Source, riskOrder.Symbol, orderPayload{
+			Side:          riskOrder.Side,
+			Amount:        riskOrder.Amount,
+			Price:         fillPrice,
+			ClientOrderId: orderIntent.ClientOrderId,
+		})
+	})
+
+	if filledError != nil {
+		// The intent stays pending, the broker still has the order under its client order id
+		logrus.Error("Order for " + riskOrder.Symbol + " filled but the fill could not be recorded, " + filledError.Error())
+	}
+
+	return orderIntent, nil
+}
+
+// settleFailedOrder closes the intent of an order the broker did not fill. An order that ended with part of it filled
+// has the partial fill saved on the intent, when the broker may still have the order the intent is left open, either
+// way the order recovery settles it on its next pass instead of a retry sending it twice, with the error as its reason
+func (riskManager *RiskManager) settleFailedOrder(orderIntent dto.OrderIntentModel, orderError error) {
+
+	orderIntent.Reason = orderError.Error()
+
+	brokerOrder, brokerOrderFound, brokerOrderError := (*riskManager.brokerIntegration).GetOrderByClientOrderId(orderIntent.ClientOrderId)
+
+	if brokerOrderError == nil && brokerOrderFound == true && brokerOrderFinalStatuses[brokerOrder.Status] == true && brokerOrder.FilledAmount > 0 {
+
+		logrus.Warn("Order " + orderIntent.ClientOrderId + " for " + orderIntent.Symbol + " was " + brokerOrder.Status + " with " +
+			strconv.FormatInt(brokerOrder.FilledAmount, 10) + " of " + strconv.FormatInt(orderIntent.Amount, 10) + " filled, it is settled by the order recovery")
+
+		orderIntent.Status = OrderIntentFilled
+		orderIntent.FilledAmount = brokerOrder.FilledAmount
+		orderIntent.FillPrice = brokerOrder.FillPrice
+
+		if orderIntent.FillPrice == 0 {
+			orderIntent.FillPrice = orderIntent.Price
+		}
+
+		filledError := riskManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+			_, updateError := transactionManager.UpdateOrderIntentModel(orderIntent)
+
+			if updateError != nil {
+				return updateError
+			}
+
+			return recordEvent(transactionManager, EventOrderFilled, orderIntent.Source, orderIntent.Symbol, orderPayload{
+				Side:          orderIntent.Side,
+				Amount:        orderIntent.FilledAmount,
+				Price:         orderIntent.FillPrice,
+				ClientOrderId: orderIntent.ClientOrderId,
+			})
+		})
+
+		if filledError != nil {
+			logrus.Error(filledError.Error())
+		}
+
+		return
+	}
+
+	if brokerOrderError != nil || (brokerOrderFound == true && (brokerOrderFinalStatuses[brokerOrder.Status] == false || brokerOrder.FilledAmount > 0)) {
+		logrus.Warn("Order " + orderIntent.ClientOrderId + " for " + orderIntent.Symbol + " is left open, it is settled by the order recovery")
+
+		_, updateError := riskManager.databaseMgr.UpdateOrderIntentModel(orderIntent)
+
+		if updateError != nil {
+			logrus.Error(updateError.Error())
+		}
+
+		return
+	}
+
+	failError := failOrderIntent(riskManager.databaseMgr, orderIntent, orderIntent.Source, orderError.Error())
+
+	if failError != nil {
+		logrus.Error(failError.Error())
+	}
+}
+
+func (riskManager *RiskManager) Halt(haltReason string, source string) error {
+
+	riskState, riskStateError := riskManager.databaseMgr.GetRiskStateModel()
+
+	if riskStateError != nil {
+		return riskStateError
+	}
+
+	if riskState.Halted == true {
+		return errors.New("trading is already halted")
+	}
+
+	if haltReason == "" {
+		haltReason = "halted by operator"
+	}
+
+	riskState.Halted = true
+	riskState.HaltReason = haltReason
+	riskState.HaltedAt = time.Now()
+
+	return riskManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		_, saveError := transactionManager.SaveRiskStateModel(riskState)
+
+		if saveError != nil {
+			return saveError
+		}
+
+		return recordEvent(transactionManager, EventTradingHalted, source, "", tradingHaltPayload{Reason: haltReason})
+	})
+}
+
+func (riskManager *RiskManager) Resume(source string) error {
+
+	riskState, riskStateError := riskManager.databaseMgr.GetRiskStateModel()
+
+	if riskStateError != nil {
+		return riskStateError
+	}
+
+	if riskState.Halted == false {
+		return errors.New("trading is not halted")
+	}
+
+	riskState.Halted = false
+	riskState.HaltReason = ""
+
+	return riskManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		_, saveError := transactionManager.SaveRiskStateModel(riskState)
+
+		if saveError != nil {
+			return saveError
+		}
+
+		return recordEvent(transactionManager, EventTradingResumed, source, "", tradingHaltPayload{})
+	})
+}
+
+// GetTradingBlock lets scheduled jobs skip a whole run instead of saving a rejection for every order, empty when trading is allowed
+func (riskManager *RiskManager) GetTradingBlock() (string, error) {
+
+	if riskManager.liveUnconfirmed == true {
+		return "live trading was not confirmed at startup", nil
+	}
+
+	riskState, riskStateError := riskManager.databaseMgr.GetRiskStateModel()
+
+	if riskStateError != nil {
+		return "", riskStateError
+	}
+
+	if riskState.Halted == true {
+		return "trading is halted", nil
+	}
+
+	return "", nil
+}
+
+func (riskManager *RiskManager) GetRiskState() (dto.RiskStateModel, error) {
+	return riskManager.databaseMgr.GetRiskStateModel()
+}
+
+func (riskManager *RiskManager) GetRecentRejections(limit int) ([]dto.RiskRejectionModel, error) {
+	return riskManager.databaseMgr.GetRecentRiskRejections(limit)
+}
@@ -0,0 +1,230 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"github.com/r4stl1n/condext/pkg/broker-integrations"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"testing"
+	"time"
+)
+
+// fakeBrokerIntegration fills every order at the quote price unless it is told to leave orders resting
+type fakeBrokerIntegration struct {
+	quotePrice   float64
+	accountCash  float64
+	accountValue float64
+	positions    map[string]int64
+
+	// A resting order waits for the context to end, then is canceled with partialAmount filled
+	restingOrders bool
+	partialAmount int64
+
+	orders map[string]broker_integrations.BrokerOrder
+}
+
+func createFakeBrokerIntegration() *fakeBrokerIntegration {
+
+	return &fakeBrokerIntegration{
+		quotePrice:   100,
+		accountCash:  100000,
+		accountValue: 100000,
+		positions:    map[string]int64{},
+		orders:       map[string]broker_integrations.BrokerOrder{},
+	}
+}
+
+func (fakeBroker *fakeBrokerIntegration) Connect(connectionUrl string) error {
+	return nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) SetCredentials(credentials []string) error {
+	return nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) ValidateCredentials() (bool, error) {
+	return true, nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) GetAccountValue() (float64, error) {
+	return fakeBroker.accountValue, nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) GetAccountCash() (float64, error) {
+	return fakeBroker.accountCash, nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) GetNetExternalFlows(since time.Time) (float64, error) {
+	return 0, nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) GetSymbolQuotePrice(symbol string) (float64, error) {
+	return fakeBroker.quotePrice, nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) GetPreviousClose(symbol string) (float64, error) {
+	return fakeBroker.quotePrice, nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) CheckIfSymbolIsValid(symbol string) (bool, error) {
+	return true, nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) GetPositions() (map[string]int64, error) {
+
+	positions := map[string]int64{}
+
+	for symbol, amount := range fakeBroker.positions {
+		positions[symbol] = amount
+	}
+
+	return positions, nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) GetMarketClock() (broker_integrations.MarketClock, error) {
+	return broker_integrations.MarketClock{Timestamp: time.Now(), IsOpen: true}, nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) fillOrder(orderContext context.Context, symbol string, side string, amount int64, clientOrderId string) (float64, error) {
+
+	filledAmount := amount
+	status := "filled"
+
+	if fakeBroker.restingOrders == true {
+		<-orderContext.Done()
+
+		filledAmount = fakeBroker.partialAmount
+		status = "canceled"
+	}
+
+	if side == "sell" {
+		fakeBroker.positions[symbol] = fakeBroker.positions[symbol] - filledAmount
+	} else {
+		fakeBroker.positions[symbol] = fakeBroker.positions[symbol] + filledAmount
+	}
+
+	fakeBroker.orders[clientOrderId] = broker_integrations.BrokerOrder{
+		ClientOrderId: clientOrderId,
+		Symbol:        symbol,
+		Side:          side,
+		Status:        status,
+		FilledAmount:  filledAmount,
+		FillPrice:     fakeBroker.quotePrice,
+	}
+
+	if status != "filled" {
+		return 0, errors.New("canceled before it filled, " + orderContext.Err().Error())
+	}
+
+	return fakeBroker.quotePrice, nil
+}
+
+func (fakeBroker *fakeBrokerIntegration) FulFillMarketOrderBuy(orderContext context.Context, symbol string, amount int64, clientOrderId string) (float64, error) {
+	return fakeBroker.fillOrder(orderContext, symbol, "buy", amount, clientOrderId)
+}
+
+func (fakeBroker *fakeBrokerIntegration) FulFillMarketOrderSell(orderContext context.Context, symbol string, amount int64, clientOrderId string) (float64, error) {
+	return fakeBroker.fillOrder(orderContext, symbol, "sell", amount, clientOrderId)
+}
+
+func (fakeBroker *fakeBrokerIntegration) GetOrderByClientOrderId(clientOrderId string) (broker_integrations.BrokerOrder, bool, error) {
+
+	brokerOrder, brokerOrderFound := fakeBroker.orders[clientOrderId]
+
+	return brokerOrder, brokerOrderFound, nil
+}
+
+func TestPlaceOrderTimeout(t *testing.T) {
+
+	testCases := []struct {
+		name          string
+		partialAmount int64
+		status        string
+		heldAmount    int64
+	}{
+		{"order that never fills", 0, OrderIntentFailed, 0},
+		{"order that fills in part", 40, OrderIntentCompleted, 40},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			configModel, configModelError := databaseManager.GetCondextConfigModel()
+
+			if configModelError != nil {
+				t.Fatal(configModelError)
+			}
+
+			configModel.OrderTimeout = 1
+
+			_, configError := databaseManager.UpdateCondextConfig(configModel)
+
+			if configError != nil {
+				t.Fatal(configError)
+			}
+
+			_, symbolError := databaseManager.CreateIndexSymbolModel(dto.IndexedSymbolModel{Symbol: "VTI", DesiredPercentage: 100})
+
+			if symbolError != nil {
+				t.Fatal(symbolError)
+			}
+
+			fakeBroker := createFakeBrokerIntegration()
+			fakeBroker.restingOrders = true
+			fakeBroker.partialAmount = testCase.partialAmount
+
+			riskManager := CreateRiskManager(databaseManager, fakeBroker)
+
+			startedAt := time.Now()
+
+			_, orderError := riskManager.PlaceOrder(context.Background(), RiskOrder{Symbol: "VTI", Side: "buy", Amount: 100, Price: 100, Source: SourceRebalance})
+
+			if orderError == nil {
+				t.Fatal("an order that never filled was reported filled")
+			}
+
+			if time.Since(startedAt) > 3*time.Second {
+				t.Errorf("order returned after %v, the timeout is one second", time.Since(startedAt))
+			}
+
+			// The placing job gave up on the order, the recovery settles it without waiting
+			recoverError := CreateOrderIntentManager(databaseManager, CreateTaxManager(databaseManager, riskManager, fakeBroker), fakeBroker).RecoverOrderIntents()
+
+			if recoverError != nil {
+				t.Fatal(recoverError)
+			}
+
+			openIntents, openIntentsError := databaseManager.GetOpenOrderIntents("VTI")
+
+			if openIntentsError != nil {
+				t.Fatal(openIntentsError)
+			}
+
+			if len(openIntents) != 0 {
+				t.Fatalf("order intent is still %s", openIntents[0].Status)
+			}
+
+			orderIntent, orderIntentError := databaseManager.GetOrderIntentModel(1)
+
+			if orderIntentError != nil {
+				t.Fatal(orderIntentError)
+			}
+
+			if orderIntent.Status != testCase.status || orderIntent.FilledAmount != testCase.heldAmount {
+				t.Errorf("order intent is %s with %d filled, want %s with %d", orderIntent.Status, orderIntent.FilledAmount, testCase.status, testCase.heldAmount)
+			}
+
+			indexedSymbol, indexedSymbolError := databaseManager.GetIndexedSymbolBySymbol("VTI")
+
+			if indexedSymbolError != nil {
+				t.Fatal(indexedSymbolError)
+			}
+
+			if indexedSymbol.Amount != testCase.heldAmount {
+				t.Errorf("holding is %d, want %d", indexedSymbol.Amount, testCase.heldAmount)
+			}
+		})
+	}
+}
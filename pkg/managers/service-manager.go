@@ -1,34 +1,218 @@
 package managers
 
 import (
+	"context"
+	"errors"
 	"github.com/r4stl1n/condext/pkg/util"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/abiosoft/ishell.v2"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// How long a shutdown waits for the in-flight rebalance tick before giving up on it
+const rebalanceShutdownTimeout = 2 * time.Minute
+
+// How long a shutdown waits for open api requests
+const apiShutdownTimeout = 30 * time.Second
+
 type ServiceManager struct {
 	config              *util.ConfigStruct
 	databaseMgr         *DatabaseManager
 	showCommandMgr      *ShowCommandManager
 	indexCommandManager *IndexCommandManager
+	taxCommandManager   *TaxCommandManager
+	riskCommandManager  *RiskCommandManager
+	configCommandMgr    *ConfigCommandManager
+	backupCommandMgr    *BackupCommandManager
+	eventCommandMgr     *EventCommandManager
+	rebalanceMgr        *RebalanceManager
+	apiMgr              *ApiManager
+	dashboardMgr        *DashboardManager
 }
 
-func CreateServiceManager(config *util.ConfigStruct, databaseClient *DatabaseManager, showCommandManager *ShowCommandManager, indexCommandManager *IndexCommandManager) *ServiceManager {
+func CreateServiceManager(config *util.ConfigStruct, databaseClient *DatabaseManager, showCommandManager *ShowCommandManager, indexCommandManager *IndexCommandManager, taxCommandManager *TaxCommandManager, riskCommandManager *RiskCommandManager, configCommandManager *ConfigCommandManager, backupCommandManager *BackupCommandManager, eventCommandManager *EventCommandManager, rebalanceManager *RebalanceManager, apiManager *ApiManager, dashboardManager *DashboardManager) *ServiceManager {
 
 	return &ServiceManager{
 		config:              config,
 		databaseMgr:         databaseClient,
 		showCommandMgr:      showCommandManager,
 		indexCommandManager: indexCommandManager,
+		taxCommandManager:   taxCommandManager,
+		riskCommandManager:  riskCommandManager,
+		configCommandMgr:    configCommandManager,
+		backupCommandMgr:    backupCommandManager,
+		eventCommandMgr:     eventCommandManager,
+		rebalanceMgr:        rebalanceManager,
+		apiMgr:              apiManager,
+		dashboardMgr:        dashboardManager,
 	}
 
 }
 
 func (serviceManager *ServiceManager) Initialize() error {
+
+	if serviceManager.config.ApiListen != "" && serviceManager.config.ApiToken == "" {
+		return errors.New("ApiToken must be set when ApiListen is configured")
+	}
+
+	if serviceManager.config.ApiOnly == true && serviceManager.config.ApiListen == "" {
+		return errors.New("ApiListen must be set when ApiOnly is enabled")
+	}
+
 	return nil
 }
 
+func (serviceManager *ServiceManager) startServers(includeApi bool) {
+
+	if serviceManager.config.DashboardListen != "" {
+		go func() {
+			logrus.Error(serviceManager.dashboardMgr.ListenAndServe())
+		}()
+	}
+
+	if includeApi == true && serviceManager.config.ApiListen != "" {
+		go func() {
+			logrus.Error(serviceManager.apiMgr.ListenAndServe())
+		}()
+	}
+}
+
+// stopRebalance cancels the order in flight at the broker and waits for the tick to save its state before returning,
+// an order that filled in part is settled by the order recovery on the next start
+func (serviceManager *ServiceManager) stopRebalance(interruptChannel chan os.Signal) {
+
+	if serviceManager.rebalanceMgr.IsRebalanceProcessRunning() == false {
+		return
+	}
+
+	logrus.Info("Stopping rebalance process, canceling the order in flight")
+
+	// Shutdown keeps the saved mode so the next start resumes the loop
+	stopError := serviceManager.rebalanceMgr.ShutdownRebalanceProcess()
+
+	if stopError != nil {
+		logrus.Error(stopError.Error())
+		return
+	}
+
+	rebalanceStopped := make(chan bool, 1)
+
+	go func() {
+		rebalanceStopped <- serviceManager.rebalanceMgr.WaitForRebalanceProcess(rebalanceShutdownTimeout)
+	}()
+
+	select {
+	case stopped := <-rebalanceStopped:
+		if stopped == false {
+			logrus.Warn("Rebalance tick did not finish in time, check the broker for open orders")
+		}
+	case <-interruptChannel:
+		logrus.Warn("Forced shutdown, check the broker for open orders")
+	}
+}
+
+// RunDaemon runs the rebalance loop without a shell until SIGINT or SIGTERM
+func (serviceManager *ServiceManager) RunDaemon() error {
+
+	// The daemon brings the loop back in the mode it was saved in like auto resume does, a loop that was stopped stays
+	// stopped
+	rebalanceStatus, rebalanceStatusError := serviceManager.rebalanceMgr.GetRebalanceStatus()
+
+	if rebalanceStatusError != nil {
+		return rebalanceStatusError
+	}
+
+	// The loop is already up when auto resume brought it back on startup
+	if rebalanceStatus.Mode == "stopped" {
+
+		resumeError := serviceManager.rebalanceMgr.AutoResumeRebalanceProcess()
+
+		if resumeError != nil {
+			return resumeError
+		}
+
+		if serviceManager.rebalanceMgr.IsRebalanceProcessRunning() == false {
+			logrus.Warn("Rebalance process was stopped and stays stopped, start it over the api or with index_start in the shell")
+		}
+	}
+
+	serviceManager.startServers(true)
+
+	logrus.Info("Condext daemon running")
+
+	interruptChannel := make(chan os.Signal, 1)
+	signal.Notify(interruptChannel, syscall.SIGINT, syscall.SIGTERM)
+
+	receivedSignal := <-interruptChannel
+
+	logrus.Info("Received " + receivedSignal.String() + ", shutting down")
+
+	serviceManager.stopRebalance(interruptChannel)
+
+	return serviceManager.databaseMgr.Close()
+}
+
+// serveApiOnly serves the api until SIGINT or SIGTERM, then lets the open requests finish and stops the rebalance loop
+// the same way the daemon does
+func (serviceManager *ServiceManager) serveApiOnly() error {
+
+	apiServer, apiServerError := serviceManager.apiMgr.Server()
+
+	if apiServerError != nil {
+		return apiServerError
+	}
+
+	interruptChannel := make(chan os.Signal, 1)
+	signal.Notify(interruptChannel, syscall.SIGINT, syscall.SIGTERM)
+
+	serveErrors := make(chan error, 1)
+
+	go func() {
+		logrus.Info("Api listening on " + serviceManager.config.ApiListen)
+		serveErrors <- apiServer.ListenAndServe()
+	}()
+
+	logrus.Println("Condext Ready")
+
+	select {
+	case serveError := <-serveErrors:
+		return serveError
+	case receivedSignal := <-interruptChannel:
+		logrus.Info("Received " + receivedSignal.String() + ", shutting down")
+	}
+
+	shutdownContext, shutdownCancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+	defer shutdownCancel()
+
+	shutdownError := apiServer.Shutdown(shutdownContext)
+
+	if shutdownError != nil {
+		logrus.Error("Api did not shut down cleanly, " + shutdownError.Error())
+	}
+
+	serviceManager.stopRebalance(interruptChannel)
+
+	return serviceManager.databaseMgr.Close()
+}
+
 func (serviceManager *ServiceManager) Run() {
+
+	serviceManager.startServers(serviceManager.config.ApiOnly == false)
+
+	if serviceManager.config.ApiOnly == true {
+
+		serveError := serviceManager.serveApiOnly()
+
+		if serveError != nil {
+			logrus.Fatal(serveError.Error())
+		}
+
+		return
+	}
+
 	shell := ishell.New()
 
 	// display welcome info.
@@ -53,24 +237,210 @@ func (serviceManager *ServiceManager) Run() {
 		Func: serviceManager.indexCommandManager.StartIndexCommand,
 	})
 
+	shell.AddCmd(&ishell.Cmd{
+		Name: "index_stop",
+		Help: "Stops the rebalance background process after the current tick",
+		Func: serviceManager.indexCommandManager.StopIndexCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "index_pause",
+		Help: "Pauses the rebalance background process, ticks are skipped until index_resume",
+		Func: serviceManager.indexCommandManager.PauseIndexCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "index_resume",
+		Help: "Resumes a paused rebalance background process",
+		Func: serviceManager.indexCommandManager.ResumeIndexCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "index_status",
+		Help: "Shows the rebalance process mode, last and next tick and the last error, options --format table|json|csv|markdown --output <file>",
+		Func: serviceManager.indexCommandManager.IndexStatusCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "index_benchmark",
+		Help: "Sets the symbol the index is measured against, def: index_benchmark <symbol>, ex. index_benchmark SPY",
+		Func: serviceManager.indexCommandManager.SetBenchmarkCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "index_trade_window",
+		Help: "Only trade between two exchange times, def: index_trade_window <start> <end>, ex. index_trade_window 10:00 15:30, index_trade_window off to clear",
+		Func: serviceManager.indexCommandManager.SetTradeWindowCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "index_sector",
+		Help: "Sets the sector used to group a symbol in attribution, def: index_sector <symbol> <sector>, ex. index_sector AAPL Information Technology",
+		Func: serviceManager.indexCommandManager.SetSectorCommand,
+	})
+
 	shell.AddCmd(&ishell.Cmd{
 		Name: "show_stats",
-		Help: "Shows index stats",
+		Help: "Shows index stats, options --format table|json|csv|markdown --output <file>",
 		Func: serviceManager.showCommandMgr.ShowStats,
 	})
 
 	shell.AddCmd(&ishell.Cmd{
 		Name: "show_config",
-		Help: "Shows index configuration",
+		Help: "Shows index configuration, options --format table|json|csv|markdown --output <file>",
 		Func: serviceManager.showCommandMgr.ShowConfig,
 	})
 
+	shell.AddCmd(&ishell.Cmd{
+		Name: "config_set",
+		Help: "Changes a setting, a running rebalance process picks it up, def: config_set <rebalance_threshold|order_timeout|rebalance_frequency|starting_balance> <value>, ex. config_set rebalance_frequency 300",
+		Func: serviceManager.configCommandMgr.SetValueCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "config_history",
+		Help: "Shows the most recent config changes, def: config_history <limit>, options --format table|json|csv|markdown --output <file>",
+		Func: serviceManager.configCommandMgr.HistoryCommand,
+	})
+
 	shell.AddCmd(&ishell.Cmd{
 		Name: "show_index",
-		Help: "Shows the current index data",
+		Help: "Shows the current index data, options --format table|json|csv|markdown --output <file>",
 		Func: serviceManager.showCommandMgr.ShowIndex,
 	})
 
+	shell.AddCmd(&ishell.Cmd{
+		Name: "show_trades",
+		Help: "Shows the most recent fills, def: show_trades <limit>, ex. show_trades 25, options --format table|json|csv|markdown --output <file>",
+		Func: serviceManager.showCommandMgr.ShowTrades,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "show_performance",
+		Help: "Shows return and risk statistics, def: show_performance <period>, periods 1M 3M YTD 1Y INCEPTION, ex. show_performance YTD, options --format table|json|csv|markdown --output <file>",
+		Func: serviceManager.showCommandMgr.ShowPerformance,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "show_benchmark",
+		Help: "Shows active return and tracking error against the benchmark, def: show_benchmark <period>, ex. show_benchmark 1Y, options --format table|json|csv|markdown --output <file>",
+		Func: serviceManager.showCommandMgr.ShowBenchmark,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "show_attribution",
+		Help: "Shows per symbol and sector return attribution against targets, def: show_attribution <period> <csv file>, ex. show_attribution 3M attribution.csv, options --format table|json|csv|markdown --output <file>",
+		Func: serviceManager.showCommandMgr.ShowAttribution,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "tax_substitute_add",
+		Help: "Set the substitute bought while a symbol is harvested, def: tax_substitute_add <symbol> <substitute>, ex. tax_substitute_add VOO IVV",
+		Func: serviceManager.taxCommandManager.AddSubstituteCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "tax_harvest_scan",
+		Help: "Shows lots with unrealized losses beyond the harvest threshold",
+		Func: serviceManager.taxCommandManager.HarvestScanCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "tax_harvest_run",
+		Help: "Sells the proposed loss lots and buys their substitutes",
+		Func: serviceManager.taxCommandManager.HarvestRunCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "show_tax_impact",
+		Help: "Shows the estimated realized gains of the next rebalance, options --format table|json|csv|markdown --output <file>",
+		Func: serviceManager.taxCommandManager.ShowTaxImpactCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "tax_report",
+		Help: "Exports the closed lots of a year as form 8949 csv, def: tax_report <year> <file>, ex. tax_report 2020 gains-2020.csv",
+		Func: serviceManager.taxCommandManager.TaxReportCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "risk_halt",
+		Help: "Blocks all trading until risk_resume, def: risk_halt <reason>, ex. risk_halt broker outage",
+		Func: serviceManager.riskCommandManager.HaltCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "risk_resume",
+		Help: "Allows trading again after risk_halt",
+		Func: serviceManager.riskCommandManager.ResumeCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "risk_limit",
+		Help: "Sets a pre-trade limit, 0 turns it off, def: risk_limit <order_notional|daily_notional|position_weight|price_deviation> <value>, ex. risk_limit order_notional 5000",
+		Func: serviceManager.riskCommandManager.SetLimitCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "show_risk",
+		Help: "Shows the kill switch state and the pre-trade limits, options --format table|json|csv|markdown --output <file>",
+		Func: serviceManager.riskCommandManager.ShowRiskCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "show_risk_rejections",
+		Help: "Shows the most recent orders rejected by a risk check, def: show_risk_rejections <limit>, options --format table|json|csv|markdown --output <file>",
+		Func: serviceManager.riskCommandManager.ShowRejectionsCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "db_backup",
+		Help: "Copies the database into the backup directory, def: db_backup <label>, ex. db_backup before_upgrade",
+		Func: serviceManager.backupCommandMgr.BackupCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "db_restore",
+		Help: "Replaces the database with a backup after saving a pre_restore copy, the rebalance process must be stopped, def: db_restore <file>",
+		Func: serviceManager.backupCommandMgr.RestoreCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "db_verify",
+		Help: "Checks the database integrity and that the index weights, amounts and tax lots add up",
+		Func: serviceManager.backupCommandMgr.VerifyCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "show_backups",
+		Help: "Shows the backups of this database, newest first, options --format table|json|csv|markdown --output <file>",
+		Func: serviceManager.backupCommandMgr.ShowBackupsCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "show_events",
+		Help: "Shows the event log, newest first, show_events [limit] [--type t] [--symbol s] [--actor a] [--since YYYY-MM-DD]",
+		Func: serviceManager.eventCommandMgr.ShowEventsCommand,
+	})
+
+	shell.AddCmd(&ishell.Cmd{
+		Name: "events_replay",
+		Help: "Rebuilds the index from the event log and shows where it differs, --apply saves the rebuilt index",
+		Func: serviceManager.eventCommandMgr.ReplayCommand,
+	})
+
 	// run shell
 	shell.Run()
+
+	// Leaving the shell stops the background loop the same way the daemon does
+	interruptChannel := make(chan os.Signal, 1)
+	signal.Notify(interruptChannel, syscall.SIGINT, syscall.SIGTERM)
+
+	serviceManager.stopRebalance(interruptChannel)
+
+	closeError := serviceManager.databaseMgr.Close()
+
+	if closeError != nil {
+		logrus.Error(closeError.Error())
+	}
 }
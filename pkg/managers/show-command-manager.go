@@ -1,9 +1,10 @@
 package managers
 
 import (
-	"fmt"
-	"github.com/olekukonko/tablewriter"
+	"errors"
 	"github.com/r4stl1n/condext/pkg/broker-integrations"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/renderers"
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/abiosoft/ishell.v2"
@@ -11,101 +12,522 @@ import (
 	"strconv"
 )
 
+type IndexStats struct {
+	AccountValue   float64
+	IndexedSymbols int
+}
+
 type ShowCommandManager struct {
 	databaseMgr       *DatabaseManager
+	performanceMgr    *PerformanceManager
+	attributionMgr    *AttributionManager
 	brokerIntegration *broker_integrations.BrokerIntegrationInterface
 }
 
-func CreateShowCommandManager(databaseManager *DatabaseManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *ShowCommandManager {
+func CreateShowCommandManager(databaseManager *DatabaseManager, performanceManager *PerformanceManager, attributionManager *AttributionManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *ShowCommandManager {
 
 	return &ShowCommandManager{
 		databaseMgr:       databaseManager,
+		performanceMgr:    performanceManager,
+		attributionMgr:    attributionManager,
 		brokerIntegration: &selectedBrokerIntegration,
 	}
 }
 
-func (showCommandManager *ShowCommandManager) ShowIndex(c *ishell.Context) {
+func (showCommandManager *ShowCommandManager) GetIndex() ([]dto.IndexedSymbolModel, error) {
+	return showCommandManager.databaseMgr.GetAllIndexedSymbols()
+}
 
-	data := [][]string{}
+// parseRenderArgs splits the --format and --output options from the positional arguments of a show command
+func parseRenderArgs(args []string) ([]string, string, string, error) {
 
-	allIndexedSymbols, allIndexedSymbolsError := showCommandManager.databaseMgr.GetAllIndexedSymbols()
+	positionalArgs := []string{}
+	format := "table"
+	outputFile := ""
 
-	if allIndexedSymbolsError != nil {
-		logrus.Error(allIndexedSymbolsError.Error())
-		return
+	for index := 0; index < len(args); index++ {
+
+		switch args[index] {
+		case "--format", "--output":
+
+			if index+1 >= len(args) {
+				return positionalArgs, format, outputFile, errors.New(args[index] + " needs a value")
+			}
+
+			if args[index] == "--format" {
+				format = args[index+1]
+			} else {
+				outputFile = args[index+1]
+			}
+
+			index = index + 1
+		default:
+			positionalArgs = append(positionalArgs, args[index])
+		}
+	}
+
+	return positionalArgs, format, outputFile, nil
+}
+
+// RenderView writes the view in the requested format to stdout or to the output file when one is given
+func RenderView(view renderers.View, format string, outputFile string) error {
+
+	renderer, rendererError := renderers.GetRenderer(format)
+
+	if rendererError != nil {
+		return rendererError
+	}
+
+	if outputFile == "" {
+		return renderer.Render(os.Stdout, view)
+	}
+
+	output, outputError := os.Create(outputFile)
+
+	if outputError != nil {
+		return outputError
 	}
 
-	for _, element := range allIndexedSymbols {
+	renderError := renderer.Render(output, view)
+
+	// A failed close can mean the file was never fully written
+	closeError := output.Close()
+
+	if renderError != nil {
+		return renderError
+	}
+
+	if closeError != nil {
+		return closeError
+	}
+
+	logrus.Info(view.Name + " written to " + outputFile)
+
+	return nil
+}
+
+func IndexView(indexedSymbols []dto.IndexedSymbolModel) renderers.View {
+
+	view := renderers.View{
+		Name: "Index",
+		Columns: []renderers.ViewColumn{
+			{Key: "symbol", Title: "Symbol"},
+			{Key: "amount", Title: "Amount"},
+			{Key: "current_value", Title: "Current USD Value"},
+			{Key: "current_price", Title: "Current Price"},
+			{Key: "locked", Title: "Locked"},
+			{Key: "desired_percentage", Title: "Desired %"},
+			{Key: "current_percentage", Title: "Current %"},
+		},
+	}
+
+	for _, element := range indexedSymbols {
 		currentValue := decimal.NewFromInt(element.Amount).Mul(decimal.NewFromFloat(element.CurrentPrice))
-		data = append(data, []string{element.Symbol, decimal.NewFromInt(element.Amount).String(),
+		view.Rows = append(view.Rows, []string{element.Symbol, decimal.NewFromInt(element.Amount).String(),
 			currentValue.String(), decimal.NewFromFloat(element.CurrentPrice).String(), strconv.FormatBool(element.Locked),
 			decimal.NewFromFloat(element.DesiredPercentage).String(), decimal.NewFromFloat(element.CurrentPercentage).String()})
 	}
 
-	fmt.Println()
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Symbol", "Amount", "Current USD Value", "Current Price", "Locked", "Desired %", "Current %"})
-	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
-	table.SetCenterSeparator("|")
-	table.AppendBulk(data) // Add Bulk Data
-	table.Render()
-	fmt.Println()
+	return view
 }
 
-func (showCommandManager *ShowCommandManager) ShowStats(c *ishell.Context) {
+func (showCommandManager *ShowCommandManager) ShowIndex(c *ishell.Context) {
 
-	allIndexedSymbols, allIndexedSymbolsError := showCommandManager.databaseMgr.GetAllIndexedSymbols()
+	_, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	allIndexedSymbols, allIndexedSymbolsError := showCommandManager.GetIndex()
 
 	if allIndexedSymbolsError != nil {
 		logrus.Error(allIndexedSymbolsError.Error())
 		return
 	}
 
+	renderError := RenderView(IndexView(allIndexedSymbols), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
+
+func (showCommandManager *ShowCommandManager) GetStats() (IndexStats, error) {
+
+	allIndexedSymbols, allIndexedSymbolsError := showCommandManager.databaseMgr.GetAllIndexedSymbols()
+
+	if allIndexedSymbolsError != nil {
+		return IndexStats{}, allIndexedSymbolsError
+	}
+
 	accountBalance, accountBalanceError := (*showCommandManager.brokerIntegration).GetAccountValue()
 
 	if accountBalanceError != nil {
-		logrus.Error(accountBalanceError.Error())
+		return IndexStats{}, accountBalanceError
+	}
+
+	return IndexStats{
+		AccountValue:   accountBalance,
+		IndexedSymbols: len(allIndexedSymbols),
+	}, nil
+}
+
+func StatsView(indexStats IndexStats) renderers.View {
+
+	return renderers.View{
+		Name: "Stats",
+		Columns: []renderers.ViewColumn{
+			{Key: "account_value", Title: "Account Value"},
+			{Key: "indexed_symbols", Title: "# Indexed"},
+		},
+		Rows: [][]string{
+			{decimal.NewFromFloat(indexStats.AccountValue).String(), decimal.NewFromInt(int64(indexStats.IndexedSymbols)).String()},
+		},
+	}
+}
+
+func (showCommandManager *ShowCommandManager) ShowStats(c *ishell.Context) {
+
+	_, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	indexStats, indexStatsError := showCommandManager.GetStats()
+
+	if indexStatsError != nil {
+		logrus.Error(indexStatsError.Error())
 		return
 	}
 
-	data := [][]string{
-		{decimal.NewFromFloat(accountBalance).String(), decimal.NewFromInt(int64(len(allIndexedSymbols))).String()},
+	renderError := RenderView(StatsView(indexStats), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
+
+func (showCommandManager *ShowCommandManager) GetConfig() (dto.CondextConfigModel, error) {
+	return showCommandManager.databaseMgr.GetCondextConfigModel()
+}
+
+func tradeWindowText(configModel dto.CondextConfigModel) string {
+
+	if configModel.TradeWindowStart == "" {
+		return "session"
 	}
 
-	fmt.Println()
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Account Value", "# Indexed"})
-	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
-	table.SetCenterSeparator("|")
-	table.AppendBulk(data) // Add Bulk Data
-	table.Render()
-	fmt.Println()
+	return configModel.TradeWindowStart + "-" + configModel.TradeWindowEnd
+}
+
+func ConfigView(configModel dto.CondextConfigModel) renderers.View {
+
+	return renderers.View{
+		Name: "Config",
+		Columns: []renderers.ViewColumn{
+			{Key: "active", Title: "Active"},
+			{Key: "rebalance_threshold", Title: "Balance Threshold %"},
+			{Key: "order_timeout", Title: "Order Timeout"},
+			{Key: "rebalance_frequency", Title: "ReBalance Tick Setting"},
+			{Key: "starting_balance", Title: "Starting Balance"},
+			{Key: "harvest_loss_threshold", Title: "Harvest Loss %"},
+			{Key: "tax_drift_tradeoff", Title: "Tax Drift Tradeoff"},
+			{Key: "benchmark_symbol", Title: "Benchmark"},
+			{Key: "trade_window", Title: "Trade Window ET"},
+		},
+		Rows: [][]string{
+			{
+				strconv.FormatBool(configModel.Active),
+				decimal.NewFromFloat(configModel.ReBalanceThreshold).String(),
+				decimal.NewFromInt(configModel.OrderTimeout).String(),
+				decimal.NewFromInt(configModel.RebalanceFrequency).String(),
+				decimal.NewFromFloat(configModel.StartingBalance).String(),
+				decimal.NewFromFloat(configModel.HarvestLossThreshold).String(),
+				decimal.NewFromFloat(configModel.TaxDriftTradeoff).String(),
+				configModel.BenchmarkSymbol,
+				tradeWindowText(configModel),
+			},
+		},
+	}
 }
 
 func (showCommandManager *ShowCommandManager) ShowConfig(c *ishell.Context) {
 
-	configModel, configModelError := showCommandManager.databaseMgr.GetCondextConfigModel()
+	_, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	configModel, configModelError := showCommandManager.GetConfig()
 
 	if configModelError != nil {
 		logrus.Error(configModelError.Error())
 		return
 	}
 
-	data := [][]string{
-		{
-			strconv.FormatBool(configModel.Active),
-			decimal.NewFromFloat(configModel.ReBalanceThreshold).String(),
-			decimal.NewFromInt(configModel.OrderTimeout).String(),
-			decimal.NewFromInt(configModel.RebalanceFrequency).String(),
+	renderError := RenderView(ConfigView(configModel), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
+
+func (showCommandManager *ShowCommandManager) GetTrades(limit int) ([]dto.FillModel, error) {
+	return showCommandManager.databaseMgr.GetRecentFills(limit)
+}
+
+func TradesView(fills []dto.FillModel) renderers.View {
+
+	view := renderers.View{
+		Name: "Trades",
+		Columns: []renderers.ViewColumn{
+			{Key: "filled_at", Title: "Filled At"},
+			{Key: "symbol", Title: "Symbol"},
+			{Key: "side", Title: "Side"},
+			{Key: "amount", Title: "Amount"},
+			{Key: "price", Title: "Price"},
+		},
+	}
+
+	for _, element := range fills {
+		view.Rows = append(view.Rows, []string{element.FilledAt.Format("2006-01-02 15:04:05"), element.Symbol, element.Side,
+			decimal.NewFromInt(element.Amount).String(), decimal.NewFromFloat(element.Price).String()})
+	}
+
+	return view
+}
+
+func (showCommandManager *ShowCommandManager) ShowTrades(c *ishell.Context) {
+
+	args, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	limit := 25
+
+	if len(args) > 0 {
+
+		parsedLimit, parsedLimitError := strconv.Atoi(args[0])
+
+		if parsedLimitError != nil {
+			logrus.Error(parsedLimitError.Error())
+			return
+		}
+
+		limit = parsedLimit
+	}
+
+	fills, fillsError := showCommandManager.GetTrades(limit)
+
+	if fillsError != nil {
+		logrus.Error(fillsError.Error())
+		return
+	}
+
+	renderError := RenderView(TradesView(fills), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
+
+func PerformanceView(performanceReport PerformanceReport) renderers.View {
+
+	return renderers.View{
+		Name:     "Performance",
+		Vertical: true,
+		Columns: []renderers.ViewColumn{
+			{Key: "period", Title: "Period"},
+			{Key: "from", Title: "From"},
+			{Key: "to", Title: "To"},
+			{Key: "start_value", Title: "Start Value"},
+			{Key: "end_value", Title: "End Value"},
+			{Key: "net_flows", Title: "Net External Flows"},
+			{Key: "time_weighted_return", Title: "Time Weighted Return %"},
+			{Key: "money_weighted_return", Title: "Money Weighted Return % (annualized)"},
+			{Key: "volatility", Title: "Volatility % (annualized)"},
+			{Key: "sharpe_ratio", Title: "Sharpe Ratio"},
+			{Key: "sortino_ratio", Title: "Sortino Ratio"},
+			{Key: "max_drawdown", Title: "Max Drawdown %"},
 		},
+		Rows: [][]string{
+			{
+				performanceReport.Period,
+				performanceReport.Start.Format("2006-01-02"),
+				performanceReport.End.Format("2006-01-02"),
+				decimal.NewFromFloat(performanceReport.StartValue).StringFixed(2),
+				decimal.NewFromFloat(performanceReport.EndValue).StringFixed(2),
+				decimal.NewFromFloat(performanceReport.NetFlows).StringFixed(2),
+				decimal.NewFromFloat(performanceReport.TimeWeightedReturn).StringFixed(2),
+				decimal.NewFromFloat(performanceReport.MoneyWeightedReturn).StringFixed(2),
+				decimal.NewFromFloat(performanceReport.Volatility).StringFixed(2),
+				decimal.NewFromFloat(performanceReport.SharpeRatio).StringFixed(2),
+				decimal.NewFromFloat(performanceReport.SortinoRatio).StringFixed(2),
+				decimal.NewFromFloat(performanceReport.MaxDrawdown).StringFixed(2),
+			},
+		},
+	}
+}
+
+func getPeriodArg(args []string) string {
+
+	if len(args) > 0 {
+		return args[0]
 	}
 
-	fmt.Println()
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Active", "Balance Threshold %", "Order Timeout", "ReBalance Tick Setting"})
-	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
-	table.SetCenterSeparator("|")
-	table.AppendBulk(data) // Add Bulk Data
-	table.Render()
-	fmt.Println()
+	return "INCEPTION"
+}
+
+func (showCommandManager *ShowCommandManager) ShowPerformance(c *ishell.Context) {
+
+	args, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	performanceReport, performanceReportError := showCommandManager.performanceMgr.GeneratePerformanceReport(getPeriodArg(args))
+
+	if performanceReportError != nil {
+		logrus.Error(performanceReportError.Error())
+		return
+	}
+
+	renderError := RenderView(PerformanceView(performanceReport), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
+
+func BenchmarkView(benchmarkReport BenchmarkReport) renderers.View {
+
+	return renderers.View{
+		Name:     "Benchmark",
+		Vertical: true,
+		Columns: []renderers.ViewColumn{
+			{Key: "period", Title: "Period"},
+			{Key: "benchmark_symbol", Title: "Benchmark"},
+			{Key: "from", Title: "From"},
+			{Key: "to", Title: "To"},
+			{Key: "portfolio_return", Title: "Portfolio Return %"},
+			{Key: "benchmark_return", Title: "Benchmark Return %"},
+			{Key: "active_return", Title: "Active Return %"},
+			{Key: "tracking_error", Title: "Tracking Error % (annualized)"},
+			{Key: "information_ratio", Title: "Information Ratio"},
+			{Key: "beta", Title: "Beta"},
+		},
+		Rows: [][]string{
+			{
+				benchmarkReport.Period,
+				benchmarkReport.BenchmarkSymbol,
+				benchmarkReport.Start.Format("2006-01-02"),
+				benchmarkReport.End.Format("2006-01-02"),
+				decimal.NewFromFloat(benchmarkReport.PortfolioReturn).StringFixed(2),
+				decimal.NewFromFloat(benchmarkReport.BenchmarkReturn).StringFixed(2),
+				decimal.NewFromFloat(benchmarkReport.ActiveReturn).StringFixed(2),
+				decimal.NewFromFloat(benchmarkReport.TrackingError).StringFixed(2),
+				decimal.NewFromFloat(benchmarkReport.InformationRatio).StringFixed(2),
+				decimal.NewFromFloat(benchmarkReport.Beta).StringFixed(2),
+			},
+		},
+	}
+}
+
+func (showCommandManager *ShowCommandManager) ShowBenchmark(c *ishell.Context) {
+
+	args, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	benchmarkReport, benchmarkReportError := showCommandManager.performanceMgr.GenerateBenchmarkReport(getPeriodArg(args))
+
+	if benchmarkReportError != nil {
+		logrus.Error(benchmarkReportError.Error())
+		return
+	}
+
+	renderError := RenderView(BenchmarkView(benchmarkReport), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
+
+// AttributionView lists the symbol rows followed by the sector rows, told apart by the level column
+func AttributionView(attributionReport AttributionReport) renderers.View {
+
+	view := renderers.View{
+		Name: "Attribution",
+		Columns: []renderers.ViewColumn{
+			{Key: "level", Title: "Level"},
+			{Key: "name", Title: "Name"},
+			{Key: "portfolio_weight", Title: "Portfolio Weight %"},
+			{Key: "target_weight", Title: "Target Weight %"},
+			{Key: "contribution", Title: "Contribution %"},
+			{Key: "allocation", Title: "Allocation %"},
+			{Key: "selection", Title: "Selection %"},
+			{Key: "interaction", Title: "Interaction %"},
+		},
+	}
+
+	appendRows := func(level string, rows []AttributionRow) {
+		for _, element := range rows {
+			view.Rows = append(view.Rows, []string{level, element.Name, decimal.NewFromFloat(element.PortfolioWeight).StringFixed(2),
+				decimal.NewFromFloat(element.BenchmarkWeight).StringFixed(2), decimal.NewFromFloat(element.Contribution).StringFixed(2),
+				decimal.NewFromFloat(element.Allocation).StringFixed(2), decimal.NewFromFloat(element.Selection).StringFixed(2),
+				decimal.NewFromFloat(element.Interaction).StringFixed(2)})
+		}
+	}
+
+	appendRows("Symbol", attributionReport.Symbols)
+	appendRows("Sector", attributionReport.Sectors)
+
+	return view
+}
+
+func (showCommandManager *ShowCommandManager) ShowAttribution(c *ishell.Context) {
+
+	args, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	attributionReport, attributionReportError := showCommandManager.attributionMgr.GenerateAttributionReport(getPeriodArg(args))
+
+	if attributionReportError != nil {
+		logrus.Error(attributionReportError.Error())
+		return
+	}
+
+	logrus.Info("Attribution from " + attributionReport.Start.Format("2006-01-02") + " to " + attributionReport.End.Format("2006-01-02") +
+		" portfolio return " + decimal.NewFromFloat(attributionReport.PortfolioReturn).StringFixed(2) +
+		"% target return " + decimal.NewFromFloat(attributionReport.BenchmarkReturn).StringFixed(2) + "%")
+
+	// The csv file argument predates --format and is kept for existing scripts
+	if len(args) > 1 {
+		format = "csv"
+		outputFile = args[1]
+	}
+
+	renderError := RenderView(AttributionView(attributionReport), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
 }
@@ -0,0 +1,331 @@
+package managers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"github.com/r4stl1n/condext/pkg/broker-integrations"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/renderers"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/abiosoft/ishell.v2"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type TaxCommandManager struct {
+	databaseMgr  *DatabaseManager
+	taxMgr       *TaxManager
+	rebalanceMgr *RebalanceManager
+
+	marketCalendarMgr *MarketCalendarManager
+	brokerIntegration *broker_integrations.BrokerIntegrationInterface
+}
+
+func CreateTaxCommandManager(databaseManager *DatabaseManager, taxManager *TaxManager, rebalanceManager *RebalanceManager, marketCalendarManager *MarketCalendarManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *TaxCommandManager {
+
+	return &TaxCommandManager{
+		databaseMgr:       databaseManager,
+		taxMgr:            taxManager,
+		rebalanceMgr:      rebalanceManager,
+		marketCalendarMgr: marketCalendarManager,
+		brokerIntegration: &selectedBrokerIntegration,
+	}
+}
+
+func (taxCommandManager *TaxCommandManager) AddSubstitute(symbol string, substituteSymbol string) error {
+
+	symbol = strings.ToUpper(symbol)
+	substituteSymbol = strings.ToUpper(substituteSymbol)
+
+	if symbol == substituteSymbol {
+		return errors.New("a symbol can not be its own substitute")
+	}
+
+	if taxCommandManager.databaseMgr.CheckIfSymbolIsIndexed(symbol) != true {
+		return errors.New("requested symbol is not indexed")
+	}
+
+	substituteExist, substituteExistError := (*taxCommandManager.brokerIntegration).CheckIfSymbolIsValid(substituteSymbol)
+
+	if substituteExistError != nil {
+		return substituteExistError
+	}
+
+	if substituteExist != true {
+		return errors.New("substitute does not exist or is not tradeable on broker")
+	}
+
+	_, createError := taxCommandManager.databaseMgr.CreateSubstituteSymbolModel(dto.SubstituteSymbolModel{
+		Symbol:           symbol,
+		SubstituteSymbol: substituteSymbol,
+	})
+
+	return createError
+}
+
+func (taxCommandManager *TaxCommandManager) AddSubstituteCommand(c *ishell.Context) {
+
+	if len(c.Args) != 2 {
+		logrus.Warn("Not enough parameters submitted")
+		return
+	}
+
+	substituteError := taxCommandManager.AddSubstitute(c.Args[0], c.Args[1])
+
+	if substituteError != nil {
+		logrus.Error(substituteError.Error())
+		return
+	}
+
+	logrus.Info("Substitute " + strings.ToUpper(c.Args[1]) + " set for " + strings.ToUpper(c.Args[0]))
+}
+
+func PrintHarvestProposals(harvestProposals []HarvestProposal) {
+
+	data := [][]string{}
+
+	for _, element := range harvestProposals {
+		data = append(data, []string{element.Symbol, decimal.NewFromInt(int64(len(element.Lots))).String(),
+			decimal.NewFromInt(element.Amount).String(), decimal.NewFromFloat(element.CurrentPrice).String(),
+			decimal.NewFromFloat(element.UnrealizedLoss).String(), element.SubstituteSymbol})
+	}
+
+	fmt.Println()
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Symbol", "# Lots", "Amount", "Current Price", "Unrealized Loss", "Substitute"})
+	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	table.SetCenterSeparator("|")
+	table.AppendBulk(data) // Add Bulk Data
+	table.Render()
+	fmt.Println()
+}
+
+func (taxCommandManager *TaxCommandManager) HarvestScanCommand(c *ishell.Context) {
+
+	harvestProposals, harvestProposalsError := taxCommandManager.taxMgr.ScanHarvestOpportunities()
+
+	if harvestProposalsError != nil {
+		logrus.Error(harvestProposalsError.Error())
+		return
+	}
+
+	PrintHarvestProposals(harvestProposals)
+}
+
+// RunHarvest executes every current proposal and reports the proposals that failed as one error
+func (taxCommandManager *TaxCommandManager) RunHarvest() ([]HarvestProposal, error) {
+
+	tradingAllowed, closedReason, tradingAllowedError := taxCommandManager.marketCalendarMgr.CheckTradingAllowed()
+
+	if tradingAllowedError != nil {
+		return nil, tradingAllowedError
+	}
+
+	if tradingAllowed == false {
+		return nil, errors.New("can not harvest, " + closedReason)
+	}
+
+	harvestProposals, harvestProposalsError := taxCommandManager.taxMgr.ScanHarvestOpportunities()
+
+	if harvestProposalsError != nil {
+		return harvestProposals, harvestProposalsError
+	}
+
+	failedSymbols := []string{}
+
+	for _, element := range harvestProposals {
+
+		harvestError := taxCommandManager.taxMgr.ExecuteHarvest(element)
+
+		if harvestError != nil {
+			logrus.Error(harvestError.Error())
+			failedSymbols = append(failedSymbols, element.Symbol)
+		}
+	}
+
+	if len(failedSymbols) > 0 {
+		return harvestProposals, errors.New("harvest failed for " + strings.Join(failedSymbols, ", "))
+	}
+
+	return harvestProposals, nil
+}
+
+func (taxCommandManager *TaxCommandManager) HarvestRunCommand(c *ishell.Context) {
+
+	harvestProposals, harvestError := taxCommandManager.RunHarvest()
+
+	if harvestError != nil {
+		logrus.Error(harvestError.Error())
+		return
+	}
+
+	if len(harvestProposals) == 0 {
+		logrus.Info("No harvest opportunities found")
+	}
+}
+
+func TaxImpactView(plannedTrades []PlannedTrade) renderers.View {
+
+	view := renderers.View{
+		Name: "Tax impact",
+		Columns: []renderers.ViewColumn{
+			{Key: "symbol", Title: "Symbol"},
+			{Key: "amount", Title: "Amount"},
+			{Key: "price", Title: "Price"},
+			{Key: "short_term_gain", Title: "Short Term Gain"},
+			{Key: "long_term_gain", Title: "Long Term Gain"},
+			{Key: "estimated_tax", Title: "Est. Tax"},
+			{Key: "deferred", Title: "Deferred"},
+		},
+	}
+
+	totalShortTermGain := decimal.NewFromFloat(0.0)
+	totalLongTermGain := decimal.NewFromFloat(0.0)
+	totalEstimatedTax := decimal.NewFromFloat(0.0)
+
+	for _, element := range plannedTrades {
+
+		if element.Side != "sell" {
+			continue
+		}
+
+		view.Rows = append(view.Rows, []string{element.Symbol, decimal.NewFromInt(element.Amount).String(),
+			decimal.NewFromFloat(element.Price).String(), decimal.NewFromFloat(element.TaxImpact.ShortTermGain).String(),
+			decimal.NewFromFloat(element.TaxImpact.LongTermGain).String(), decimal.NewFromFloat(element.TaxImpact.EstimatedTax).String(),
+			strconv.FormatBool(element.Deferred)})
+
+		if element.Deferred == false {
+			totalShortTermGain = totalShortTermGain.Add(decimal.NewFromFloat(element.TaxImpact.ShortTermGain))
+			totalLongTermGain = totalLongTermGain.Add(decimal.NewFromFloat(element.TaxImpact.LongTermGain))
+			totalEstimatedTax = totalEstimatedTax.Add(decimal.NewFromFloat(element.TaxImpact.EstimatedTax))
+		}
+	}
+
+	view.Footer = []string{"Total", "", "", totalShortTermGain.String(), totalLongTermGain.String(), totalEstimatedTax.String(), ""}
+
+	return view
+}
+
+func (taxCommandManager *TaxCommandManager) ShowTaxImpactCommand(c *ishell.Context) {
+
+	_, format, outputFile, renderArgsError := parseRenderArgs(c.Args)
+
+	if renderArgsError != nil {
+		logrus.Error(renderArgsError.Error())
+		return
+	}
+
+	plannedTrades, plannedTradesError := taxCommandManager.rebalanceMgr.GenerateRebalancePlan()
+
+	if plannedTradesError != nil {
+		logrus.Error(plannedTradesError.Error())
+		return
+	}
+
+	renderError := RenderView(TaxImpactView(plannedTrades), format, outputFile)
+
+	if renderError != nil {
+		logrus.Error(renderError.Error())
+	}
+}
+
+// WriteTaxReport exports the closed lots sold in the year as form 8949 csv
+func (taxCommandManager *TaxCommandManager) WriteTaxReport(reportYear int, fileName string) ([]RealizedGain, error) {
+
+	realizedGains, realizedGainsError := taxCommandManager.taxMgr.GetRealizedGains(reportYear)
+
+	if realizedGainsError != nil {
+		return realizedGains, realizedGainsError
+	}
+
+	reportFile, reportFileError := os.Create(fileName)
+
+	if reportFileError != nil {
+		return realizedGains, reportFileError
+	}
+
+	defer reportFile.Close()
+
+	// Columns follow form 8949 (a) through (h) with the holding term for part I / part II
+	data := [][]string{
+		{"Description of Property", "Date Acquired", "Date Sold", "Proceeds", "Cost Basis", "Code", "Adjustment", "Gain or Loss", "Term"},
+	}
+
+	for _, element := range realizedGains {
+
+		adjustmentCode := ""
+		term := "Short"
+
+		if element.WashSaleAdjustment != 0 {
+			adjustmentCode = "W"
+		}
+
+		if element.LongTerm == true {
+			term = "Long"
+		}
+
+		data = append(data, []string{element.Description, element.AcquiredAt.Format("01/02/2006"), element.SoldAt.Format("01/02/2006"),
+			decimal.NewFromFloat(element.Proceeds).StringFixed(2), decimal.NewFromFloat(element.CostBasis).StringFixed(2), adjustmentCode,
+			decimal.NewFromFloat(element.WashSaleAdjustment).StringFixed(2), decimal.NewFromFloat(element.Gain).StringFixed(2), term})
+	}
+
+	return realizedGains, csv.NewWriter(reportFile).WriteAll(data)
+}
+
+func PrintTaxReportSummary(reportYear int, realizedGains []RealizedGain) {
+
+	totalShortTermGain := decimal.NewFromFloat(0.0)
+	totalLongTermGain := decimal.NewFromFloat(0.0)
+	totalWashSaleAdjustment := decimal.NewFromFloat(0.0)
+
+	for _, element := range realizedGains {
+
+		if element.LongTerm == true {
+			totalLongTermGain = totalLongTermGain.Add(decimal.NewFromFloat(element.Gain))
+		} else {
+			totalShortTermGain = totalShortTermGain.Add(decimal.NewFromFloat(element.Gain))
+		}
+
+		totalWashSaleAdjustment = totalWashSaleAdjustment.Add(decimal.NewFromFloat(element.WashSaleAdjustment))
+	}
+
+	fmt.Println()
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Year", "# Closed Lots", "Short Term Gain", "Long Term Gain", "Wash Sale Adjustment"})
+	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	table.SetCenterSeparator("|")
+	table.Append([]string{strconv.Itoa(reportYear), strconv.Itoa(len(realizedGains)), totalShortTermGain.String(),
+		totalLongTermGain.String(), totalWashSaleAdjustment.String()})
+	table.Render()
+	fmt.Println()
+}
+
+func (taxCommandManager *TaxCommandManager) TaxReportCommand(c *ishell.Context) {
+
+	if len(c.Args) != 2 {
+		logrus.Warn("Not enough parameters submitted")
+		return
+	}
+
+	reportYear, reportYearError := strconv.Atoi(c.Args[0])
+
+	if reportYearError != nil {
+		logrus.Error(reportYearError.Error())
+		return
+	}
+
+	realizedGains, reportError := taxCommandManager.WriteTaxReport(reportYear, c.Args[1])
+
+	if reportError != nil {
+		logrus.Error(reportError.Error())
+		return
+	}
+
+	logrus.Info("Wrote " + strconv.Itoa(len(realizedGains)) + " closed lots to " + c.Args[1])
+
+	PrintTaxReportSummary(reportYear, realizedGains)
+}
@@ -0,0 +1,863 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"github.com/r4stl1n/condext/pkg/broker-integrations"
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/util"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+// The irs wash sale rule covers 30 days either side of a sale at a loss
+const washSaleWindowDays = 30
+
+type TaxImpact struct {
+	ShortTermGain float64
+	LongTermGain  float64
+	EstimatedTax  float64
+}
+
+type RealizedGain struct {
+	Description        string
+	AcquiredAt         time.Time
+	SoldAt             time.Time
+	Proceeds           float64
+	CostBasis          float64
+	WashSaleAdjustment float64
+	Gain               float64
+	LongTerm           bool
+}
+
+type HarvestProposal struct {
+	Symbol           string
+	SubstituteSymbol string
+	Lots             []dto.TaxLotModel
+	Amount           int64
+	CurrentPrice     float64
+	UnrealizedLoss   float64
+}
+
+type TaxManager struct {
+	databaseMgr       *DatabaseManager
+	riskMgr           *RiskManager
+	brokerIntegration *broker_integrations.BrokerIntegrationInterface
+}
+
+func CreateTaxManager(databaseManager *DatabaseManager, riskManager *RiskManager, selectedBrokerIntegration broker_integrations.BrokerIntegrationInterface) *TaxManager {
+
+	return &TaxManager{
+		databaseMgr:       databaseManager,
+		riskMgr:           riskManager,
+		brokerIntegration: &selectedBrokerIntegration,
+	}
+}
+
+// withDatabase returns a copy that reads and writes through the given manager, used to join a transaction
+func (taxManager *TaxManager) withDatabase(databaseManager *DatabaseManager) *TaxManager {
+
+	boundTaxManager := *taxManager
+	boundTaxManager.databaseMgr = databaseManager
+
+	return &boundTaxManager
+}
+
+// RecordBuyFill saves the fill, its tax lot and any wash sale adjustment in one transaction
+func (taxManager *TaxManager) RecordBuyFill(symbol string, amount int64, price float64) error {
+
+	return taxManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+		return taxManager.withDatabase(transactionManager).recordBuyFill(symbol, amount, price)
+	})
+}
+
+func (taxManager *TaxManager) recordBuyFill(symbol string, amount int64, price float64) error {
+
+	fillModel, fillModelError := taxManager.databaseMgr.CreateFillModel(dto.FillModel{
+		Symbol:   symbol,
+		Side:     "buy",
+		Amount:   amount,
+		Price:    price,
+		FilledAt: time.Now(),
+	})
+
+	if fillModelError != nil {
+		return fillModelError
+	}
+
+	taxLot, taxLotError := taxManager.databaseMgr.CreateTaxLotModel(dto.TaxLotModel{
+		Symbol:          symbol,
+		FillUUID:        fillModel.UUID,
+		Amount:          amount,
+		RemainingAmount: amount,
+		CostBasis:       price,
+		AcquiredAt:      fillModel.FilledAt,
+	})
+
+	if taxLotError != nil {
+		return taxLotError
+	}
+
+	// Any loss realized in the window before this buy is disallowed and carried into the new lot
+	closedLots, closedLotsError := taxManager.databaseMgr.GetClosedLotsBySymbolSince(symbol, fillModel.FilledAt.AddDate(0, 0, -washSaleWindowDays))
+
+	if closedLotsError != nil {
+		return closedLotsError
+	}
+
+	unmatchedAmount := amount
+
+	for _, closedLot := range closedLots {
+
+		if unmatchedAmount == 0 {
+			break
+		}
+
+		if closedLot.Proceeds >= closedLot.CostBasis || closedLot.WashSaleMatchedAmount >= closedLot.Amount {
+			continue
+		}
+
+		matchedAmount := closedLot.Amount - closedLot.WashSaleMatchedAmount
+
+		if matchedAmount > unmatchedAmount {
+			matchedAmount = unmatchedAmount
+		}
+
+		_, taxLot, taxLotError = taxManager.applyWashSale(closedLot, taxLot, matchedAmount)
+
+		if taxLotError != nil {
+			return taxLotError
+		}
+
+		unmatchedAmount = unmatchedAmount - matchedAmount
+	}
+
+	return nil
+}
+
+// applyWashSale disallows the matched part of a closed lots loss. The matched shares of the replacement lot are split
+// off into a lot of their own that carries the disallowed loss in its basis and the holding period of the sold shares,
+// the returned lot is what is left of the replacement lot for further matches
+func (taxManager *TaxManager) applyWashSale(closedLot dto.ClosedLotModel, replacementLot dto.TaxLotModel, matchedAmount int64) (dto.ClosedLotModel, dto.TaxLotModel, error) {
+
+	disallowedLoss := decimal.NewFromFloat(closedLot.CostBasis).Sub(decimal.NewFromFloat(closedLot.Proceeds)).Div(
+		decimal.NewFromInt(closedLot.Amount)).Mul(decimal.NewFromInt(matchedAmount)).Round(2)
+
+	closedLot.WashSaleAdjustment = util.DecimalToFloat(decimal.NewFromFloat(closedLot.WashSaleAdjustment).Add(disallowedLoss))
+	closedLot.WashSaleMatchedAmount = closedLot.WashSaleMatchedAmount + matchedAmount
+
+	updatedClosedLot, closedLotError := taxManager.databaseMgr.UpdateClosedLotModel(closedLot)
+
+	if closedLotError != nil {
+		return closedLot, replacementLot, closedLotError
+	}
+
+	adjustedCostBasis := util.DecimalToFloat(decimal.NewFromFloat(replacementLot.CostBasis).Add(
+		disallowedLoss.Div(decimal.NewFromInt(matchedAmount))).Round(4))
+
+	// The replacement shares count as held since the sold shares were bought, less the days nothing was held
+	adjustedAcquiredAt := replacementLot.AcquiredAt.Add(-closedLot.SoldAt.Sub(closedLot.AcquiredAt))
+
+	logrus.Warn("Wash sale on " + closedLot.Symbol + " disallowed loss of " + disallowedLoss.String())
+
+	if matchedAmount >= replacementLot.RemainingAmount {
+
+		replacementLot.CostBasis = adjustedCostBasis
+		replacementLot.AcquiredAt = adjustedAcquiredAt
+
+		updatedLot, updatedLotError := taxManager.databaseMgr.UpdateTaxLotModel(replacementLot)
+
+		if updatedLotError != nil {
+			return updatedClosedLot, replacementLot, updatedLotError
+		}
+
+		return updatedClosedLot, updatedLot, nil
+	}
+
+	_, splitLotError := taxManager.databaseMgr.CreateTaxLotModel(dto.TaxLotModel{
+		Symbol:          replacementLot.Symbol,
+		FillUUID:        replacementLot.FillUUID,
+		Amount:          matchedAmount,
+		RemainingAmount: matchedAmount,
+		CostBasis:       adjustedCostBasis,
+		AcquiredAt:      adjustedAcquiredAt,
+	})
+
+	if splitLotError != nil {
+		return updatedClosedLot, replacementLot, splitLotError
+	}
+
+	replacementLot.Amount = replacementLot.Amount - matchedAmount
+	replacementLot.RemainingAmount = replacementLot.RemainingAmount - matchedAmount
+
+	updatedLot, updatedLotError := taxManager.databaseMgr.UpdateTaxLotModel(replacementLot)
+
+	if updatedLotError != nil {
+		return updatedClosedLot, replacementLot, updatedLotError
+	}
+
+	return updatedClosedLot, updatedLot, nil
+}
+
+// RecordSellFill closes the supplied lots in order, when none are supplied the oldest lots are closed first
+func (taxManager *TaxManager) RecordSellFill(symbol string, amount int64, price float64, selectedLots []dto.TaxLotModel) error {
+
+	return taxManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+		return taxManager.withDatabase(transactionManager).recordSellFill(symbol, amount, price, selectedLots)
+	})
+}
+
+func (taxManager *TaxManager) recordSellFill(symbol string, amount int64, price float64, selectedLots []dto.TaxLotModel) error {
+
+	fillModel, fillModelError := taxManager.databaseMgr.CreateFillModel(dto.FillModel{
+		Symbol:   symbol,
+		Side:     "sell",
+		Amount:   amount,
+		Price:    price,
+		FilledAt: time.Now(),
+	})
+
+	if fillModelError != nil {
+		return fillModelError
+	}
+
+	if selectedLots == nil {
+
+		openLots, openLotsError := taxManager.databaseMgr.GetOpenTaxLotsBySymbol(symbol)
+
+		if openLotsError != nil {
+			return openLotsError
+		}
+
+		selectedLots = openLots
+	}
+
+	amountToClose := amount
+	lossClosedLots := []dto.ClosedLotModel{}
+
+	for _, lot := range selectedLots {
+
+		if amountToClose == 0 {
+			break
+		}
+
+		closeAmount := lot.RemainingAmount
+
+		if closeAmount > amountToClose {
+			closeAmount = amountToClose
+		}
+
+		closedLot, closedLotError := taxManager.databaseMgr.CreateClosedLotModel(dto.ClosedLotModel{
+			LotUUID:    lot.UUID,
+			FillUUID:   fillModel.UUID,
+			Symbol:     symbol,
+			Amount:     closeAmount,
+			AcquiredAt: lot.AcquiredAt,
+			SoldAt:     fillModel.FilledAt,
+			Proceeds:   util.DecimalToFloat(decimal.NewFromFloat(price).Mul(decimal.NewFromInt(closeAmount)).Round(2)),
+			CostBasis:  util.DecimalToFloat(decimal.NewFromFloat(lot.CostBasis).Mul(decimal.NewFromInt(closeAmount)).Round(2)),
+		})
+
+		if closedLotError != nil {
+			return closedLotError
+		}
+
+		if closedLot.Proceeds < closedLot.CostBasis {
+			lossClosedLots = append(lossClosedLots, closedLot)
+		}
+
+		lot.RemainingAmount = lot.RemainingAmount - closeAmount
+
+		_, lotUpdateError := taxManager.databaseMgr.UpdateTaxLotModel(lot)
+
+		if lotUpdateError != nil {
+			return lotUpdateError
+		}
+
+		amountToClose = amountToClose - closeAmount
+	}
+
+	if amountToClose > 0 {
+		logrus.Warn("Sold " + decimal.NewFromInt(amountToClose).String() + " " + symbol + " with no tracked tax lot")
+	}
+
+	if len(lossClosedLots) == 0 {
+		return nil
+	}
+
+	// Shares still held that were bought in the window before a loss sale replace the sold shares
+	openLots, openLotsError := taxManager.databaseMgr.GetOpenTaxLotsBySymbol(symbol)
+
+	if openLotsError != nil {
+		return openLotsError
+	}
+
+	windowStart := fillModel.FilledAt.AddDate(0, 0, -washSaleWindowDays)
+
+	// Track how many shares of each lot are left to act as a replacement during this sale
+	replaceableAmounts := map[string]int64{}
+
+	for _, openLot := range openLots {
+		if openLot.AcquiredAt.Before(windowStart) == false {
+			replaceableAmounts[openLot.UUID] = openLot.RemainingAmount
+		}
+	}
+
+	for _, closedLot := range lossClosedLots {
+
+		unmatchedAmount := closedLot.Amount - closedLot.WashSaleMatchedAmount
+
+		for index, openLot := range openLots {
+
+			if unmatchedAmount == 0 {
+				break
+			}
+
+			if openLot.UUID == closedLot.LotUUID || replaceableAmounts[openLot.UUID] == 0 {
+				continue
+			}
+
+			matchedAmount := replaceableAmounts[openLot.UUID]
+
+			if matchedAmount > unmatchedAmount {
+				matchedAmount = unmatchedAmount
+			}
+
+			var washSaleError error
+
+			closedLot, openLots[index], washSaleError = taxManager.applyWashSale(closedLot, openLot, matchedAmount)
+
+			if washSaleError != nil {
+				return washSaleError
+			}
+
+			replaceableAmounts[openLot.UUID] = replaceableAmounts[openLot.UUID] - matchedAmount
+			unmatchedAmount = unmatchedAmount - matchedAmount
+		}
+	}
+
+	return nil
+}
+
+func isLongTermLot(lot dto.TaxLotModel, soldAt time.Time) bool {
+	return lot.AcquiredAt.AddDate(1, 0, 0).Before(soldAt)
+}
+
+// lotSaleRank orders losses first, then long term gains and short term gains last
+func lotSaleRank(lot dto.TaxLotModel, price float64, soldAt time.Time) int {
+
+	if price < lot.CostBasis {
+		return 0
+	}
+
+	if isLongTermLot(lot, soldAt) {
+		return 1
+	}
+
+	return 2
+}
+
+// SelectLotsForSale picks the open lots to close for a sale so the realized gain is taxed as lightly as possible
+func (taxManager *TaxManager) SelectLotsForSale(symbol string, amount int64, price float64) ([]dto.TaxLotModel, TaxImpact, error) {
+
+	taxImpact := TaxImpact{}
+
+	configModel, configModelError := taxManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return nil, taxImpact, configModelError
+	}
+
+	openLots, openLotsError := taxManager.databaseMgr.GetOpenTaxLotsBySymbol(symbol)
+
+	if openLotsError != nil {
+		return nil, taxImpact, openLotsError
+	}
+
+	soldAt := time.Now()
+
+	sort.SliceStable(openLots, func(i, j int) bool {
+
+		rankI := lotSaleRank(openLots[i], price, soldAt)
+		rankJ := lotSaleRank(openLots[j], price, soldAt)
+
+		if rankI != rankJ {
+			return rankI < rankJ
+		}
+
+		// Within a rank the highest cost basis realizes the least gain
+		return openLots[i].CostBasis > openLots[j].CostBasis
+	})
+
+	shortTermGain := decimal.NewFromFloat(0.0)
+	longTermGain := decimal.NewFromFloat(0.0)
+	amountToClose := amount
+
+	for _, lot := range openLots {
+
+		if amountToClose == 0 {
+			break
+		}
+
+		closeAmount := lot.RemainingAmount
+
+		if closeAmount > amountToClose {
+			closeAmount = amountToClose
+		}
+
+		lotGain := decimal.NewFromFloat(price).Sub(decimal.NewFromFloat(lot.CostBasis)).Mul(decimal.NewFromInt(closeAmount))
+
+		if isLongTermLot(lot, soldAt) {
+			longTermGain = longTermGain.Add(lotGain)
+		} else {
+			shortTermGain = shortTermGain.Add(lotGain)
+		}
+
+		amountToClose = amountToClose - closeAmount
+	}
+
+	estimatedTax := util.GetDecimalPercentage(shortTermGain, decimal.NewFromFloat(configModel.ShortTermTaxRate)).Add(
+		util.GetDecimalPercentage(longTermGain, decimal.NewFromFloat(configModel.LongTermTaxRate)))
+
+	taxImpact.ShortTermGain = util.DecimalToFloat(shortTermGain.Round(2))
+	taxImpact.LongTermGain = util.DecimalToFloat(longTermGain.Round(2))
+	taxImpact.EstimatedTax = util.DecimalToFloat(estimatedTax.Round(2))
+
+	return openLots, taxImpact, nil
+}
+
+// GetRealizedGains lists every lot closed during the year with short term lots ahead of long term ones
+func (taxManager *TaxManager) GetRealizedGains(year int) ([]RealizedGain, error) {
+
+	realizedGains := []RealizedGain{}
+
+	yearStart := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+
+	closedLots, closedLotsError := taxManager.databaseMgr.GetClosedLotsSoldBetween(yearStart, yearStart.AddDate(1, 0, 0))
+
+	if closedLotsError != nil {
+		return realizedGains, closedLotsError
+	}
+
+	for _, closedLot := range closedLots {
+
+		gain := decimal.NewFromFloat(closedLot.Proceeds).Sub(decimal.NewFromFloat(closedLot.CostBasis)).Add(decimal.NewFromFloat(closedLot.WashSaleAdjustment))
+
+		realizedGains = append(realizedGains, RealizedGain{
+			Description:        decimal.NewFromInt(closedLot.Amount).String() + " sh. " + closedLot.Symbol,
+			AcquiredAt:         closedLot.AcquiredAt,
+			SoldAt:             closedLot.SoldAt,
+			Proceeds:           closedLot.Proceeds,
+			CostBasis:          closedLot.CostBasis,
+			WashSaleAdjustment: closedLot.WashSaleAdjustment,
+			Gain:               util.DecimalToFloat(gain.Round(2)),
+			LongTerm:           closedLot.AcquiredAt.AddDate(1, 0, 0).Before(closedLot.SoldAt),
+		})
+	}
+
+	sort.SliceStable(realizedGains, func(i, j int) bool {
+		return realizedGains[i].LongTerm == false && realizedGains[j].LongTerm == true
+	})
+
+	return realizedGains, nil
+}
+
+// IsWashSaleRestricted reports if the symbol was sold at a loss within the wash sale window
+func (taxManager *TaxManager) IsWashSaleRestricted(symbol string) (bool, error) {
+
+	windowStart := time.Now().AddDate(0, 0, -washSaleWindowDays)
+
+	closedLots, closedLotsError := taxManager.databaseMgr.GetClosedLotsBySymbolSince(symbol, windowStart)
+
+	if closedLotsError != nil {
+		return false, closedLotsError
+	}
+
+	for _, closedLot := range closedLots {
+		if closedLot.Proceeds < closedLot.CostBasis {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (taxManager *TaxManager) hasRecentBuy(symbol string) (bool, error) {
+
+	windowStart := time.Now().AddDate(0, 0, -washSaleWindowDays)
+
+	buyFills, buyFillsError := taxManager.databaseMgr.GetFillsBySymbolSince(symbol, "buy", windowStart)
+
+	if buyFillsError != nil {
+		return false, buyFillsError
+	}
+
+	return len(buyFills) > 0, nil
+}
+
+func (taxManager *TaxManager) ScanHarvestOpportunities() ([]HarvestProposal, error) {
+
+	harvestProposals := []HarvestProposal{}
+
+	configModel, configModelError := taxManager.databaseMgr.GetCondextConfigModel()
+
+	if configModelError != nil {
+		return harvestProposals, configModelError
+	}
+
+	if configModel.HarvestLossThreshold <= 0 {
+		return harvestProposals, errors.New("harvest loss threshold is not set")
+	}
+
+	indexedSymbols, indexedSymbolsError := taxManager.databaseMgr.GetAllIndexedSymbols()
+
+	if indexedSymbolsError != nil {
+		return harvestProposals, indexedSymbolsError
+	}
+
+	for _, element := range indexedSymbols {
+
+		substituteSymbol, substituteSymbolError := taxManager.databaseMgr.GetSubstituteSymbolBySymbol(element.Symbol)
+
+		if substituteSymbolError != nil {
+			continue
+		}
+
+		_, activeSwapError := taxManager.databaseMgr.GetActiveHarvestSwapBySymbol(element.Symbol)
+
+		if activeSwapError == nil {
+			continue
+		}
+
+		// Buying within the window on either side of the loss would disallow it
+		recentBuy, recentBuyError := taxManager.hasRecentBuy(element.Symbol)
+
+		if recentBuyError != nil {
+			return harvestProposals, recentBuyError
+		}
+
+		substituteRestricted, substituteRestrictedError := taxManager.IsWashSaleRestricted(substituteSymbol.SubstituteSymbol)
+
+		if substituteRestrictedError != nil {
+			return harvestProposals, substituteRestrictedError
+		}
+
+		if recentBuy == true || substituteRestricted == true {
+			logrus.Warn("Skipping harvest of " + element.Symbol + " it would trigger a wash sale")
+			continue
+		}
+
+		currentQuote, currentQuoteError := (*taxManager.brokerIntegration).GetSymbolQuotePrice(element.Symbol)
+
+		if currentQuoteError != nil {
+			logrus.Error(currentQuoteError.Error())
+			continue
+		}
+
+		openLots, openLotsError := taxManager.databaseMgr.GetOpenTaxLotsBySymbol(element.Symbol)
+
+		if openLotsError != nil {
+			return harvestProposals, openLotsError
+		}
+
+		harvestProposal := HarvestProposal{
+			Symbol:           element.Symbol,
+			SubstituteSymbol: substituteSymbol.SubstituteSymbol,
+			CurrentPrice:     currentQuote,
+		}
+
+		unrealizedLoss := decimal.NewFromFloat(0.0)
+
+		for _, lot := range openLots {
+
+			lotChange := util.GetPercentageDifference(lot.CostBasis, currentQuote)
+
+			if lotChange <= -configModel.HarvestLossThreshold {
+				harvestProposal.Lots = append(harvestProposal.Lots, lot)
+				harvestProposal.Amount = harvestProposal.Amount + lot.RemainingAmount
+
+				unrealizedLoss = unrealizedLoss.Add(decimal.NewFromFloat(currentQuote).Sub(decimal.NewFromFloat(lot.CostBasis)).Mul(decimal.NewFromInt(lot.RemainingAmount)))
+			}
+		}
+
+		if harvestProposal.Amount == 0 {
+			continue
+		}
+
+		harvestProposal.UnrealizedLoss = util.DecimalToFloat(unrealizedLoss.Round(2))
+
+		harvestProposals = append(harvestProposals, harvestProposal)
+	}
+
+	return harvestProposals, nil
+}
+
+func (taxManager *TaxManager) ExecuteHarvest(harvestProposal HarvestProposal) error {
+
+	indexedSymbol, indexedSymbolError := taxManager.databaseMgr.GetIndexedSymbolBySymbol(harvestProposal.Symbol)
+
+	if indexedSymbolError != nil {
+		return indexedSymbolError
+	}
+
+	substituteQuote, substituteQuoteError := (*taxManager.brokerIntegration).GetSymbolQuotePrice(harvestProposal.SubstituteSymbol)
+
+	if substituteQuoteError != nil {
+		return substituteQuoteError
+	}
+
+	sellIntent, sellError := taxManager.riskMgr.PlaceOrder(context.Background(), RiskOrder{Symbol: harvestProposal.Symbol, Side: "sell", Amount: harvestProposal.Amount, Price: harvestProposal.CurrentPrice, Source: SourceHarvest,
+		Lots: harvestProposal.Lots})
+
+	if sellError != nil {
+		return sellError
+	}
+
+	sellPrice := sellIntent.FillPrice
+
+	oldAmount := indexedSymbol.Amount
+	indexedSymbol.Amount = indexedSymbol.Amount - harvestProposal.Amount
+
+	sellSaveError := taxManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		recordSellError := taxManager.withDatabase(transactionManager).RecordSellFill(harvestProposal.Symbol, harvestProposal.Amount, sellPrice, harvestProposal.Lots)
+
+		if recordSellError != nil {
+			return recordSellError
+		}
+
+		_, symbolUpdateError := transactionManager.UpdateIndexedSymbolModel(indexedSymbol)
+
+		if symbolUpdateError != nil {
+			return symbolUpdateError
+		}
+
+		holdingError := recordHoldingChange(transactionManager, SourceHarvest, indexedSymbol.Symbol, oldAmount, indexedSymbol.Amount, sellPrice)
+
+		if holdingError != nil {
+			return holdingError
+		}
+
+		return completeOrderIntent(transactionManager, sellIntent)
+	})
+
+	if sellSaveError != nil {
+		logrus.Error("Sold " + harvestProposal.Symbol + " but could not save it, it is settled by the order recovery, " + sellSaveError.Error())
+	}
+
+	// Keep the exposure by buying as much of the substitute as the sale raised
+	saleProceeds := decimal.NewFromFloat(sellPrice).Mul(decimal.NewFromInt(harvestProposal.Amount))
+	substituteAmount := saleProceeds.Div(decimal.NewFromFloat(substituteQuote)).IntPart()
+
+	substituteIntent := dto.OrderIntentModel{}
+
+	var substituteError error
+
+	if substituteAmount > 0 {
+		substituteIntent, substituteError = taxManager.riskMgr.PlaceOrder(context.Background(), RiskOrder{Symbol: harvestProposal.SubstituteSymbol, Side: "buy", Amount: substituteAmount, Price: substituteQuote, Source: SourceHarvest})
+	}
+
+	harvestSwap := dto.HarvestSwapModel{
+		Symbol:           harvestProposal.Symbol,
+		SubstituteSymbol: harvestProposal.SubstituteSymbol,
+		Amount:           harvestProposal.Amount,
+		SubstituteAmount: substituteAmount,
+		SwappedAt:        time.Now(),
+	}
+
+	// Without the substitute the proceeds are held as cash and bought back into the symbol once the window has passed
+	if substituteError != nil || substituteAmount == 0 {
+		harvestSwap.SubstituteAmount = 0
+		harvestSwap.BuyBackCash = util.DecimalToFloat(saleProceeds.Round(2))
+	}
+
+	harvestedLoss := decimal.NewFromFloat(0.0)
+
+	for _, lot := range harvestProposal.Lots {
+		harvestedLoss = harvestedLoss.Add(decimal.NewFromFloat(sellPrice).Sub(decimal.NewFromFloat(lot.CostBasis)).Mul(decimal.NewFromInt(lot.RemainingAmount)))
+	}
+
+	harvestSwap.HarvestedLoss = util.DecimalToFloat(harvestedLoss.Round(2))
+
+	// The substitute lot and the swap that points at it are saved together
+	swapError := taxManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+		if harvestSwap.SubstituteAmount > 0 {
+
+			recordBuyError := taxManager.withDatabase(transactionManager).RecordBuyFill(harvestProposal.SubstituteSymbol, substituteAmount, substituteIntent.FillPrice)
+
+			if recordBuyError != nil {
+				return recordBuyError
+			}
+
+			completeError := completeOrderIntent(transactionManager, substituteIntent)
+
+			if completeError != nil {
+				return completeError
+			}
+		}
+
+		_, createSwapError := transactionManager.CreateHarvestSwapModel(harvestSwap)
+
+		return createSwapError
+	})
+
+	if swapError != nil {
+		return swapError
+	}
+
+	if substituteError != nil {
+		return errors.New("harvested " + harvestProposal.Symbol + " but could not buy " + harvestProposal.SubstituteSymbol +
+			", the proceeds are bought back into " + harvestProposal.Symbol + " after the wash sale window, " + substituteError.Error())
+	}
+
+	logrus.Info("Harvested " + harvestedLoss.Round(2).String() + " from " + harvestProposal.Symbol + " swapped into " + harvestProposal.SubstituteSymbol)
+
+	return nil
+}
+
+// ProcessHarvestSwapBacks moves substitutes back into the original symbol once the wash sale window has passed
+func (taxManager *TaxManager) ProcessHarvestSwapBacks(orderContext context.Context) error {
+
+	activeSwaps, activeSwapsError := taxManager.databaseMgr.GetActiveHarvestSwaps()
+
+	if activeSwapsError != nil {
+		return activeSwapsError
+	}
+
+	for _, swap := range activeSwaps {
+
+		if time.Now().Before(swap.SwappedAt.AddDate(0, 0, washSaleWindowDays+1)) {
+			continue
+		}
+
+		indexedSymbol, indexedSymbolError := taxManager.databaseMgr.GetIndexedSymbolBySymbol(swap.Symbol)
+
+		if indexedSymbolError != nil {
+			logrus.Error(indexedSymbolError.Error())
+			continue
+		}
+
+		symbolQuote, symbolQuoteError := (*taxManager.brokerIntegration).GetSymbolQuotePrice(swap.Symbol)
+
+		if symbolQuoteError != nil {
+			logrus.Error(symbolQuoteError.Error())
+			continue
+		}
+
+		// The substitute is sold first and the swap saved with the cash it raised, a buy that fails is retried on
+		// the next tick without selling the substitute again
+		if swap.SubstituteAmount > 0 {
+
+			substituteQuote, substituteQuoteError := (*taxManager.brokerIntegration).GetSymbolQuotePrice(swap.SubstituteSymbol)
+
+			if substituteQuoteError != nil {
+				logrus.Error(substituteQuoteError.Error())
+				continue
+			}
+
+			sellIntent, sellError := taxManager.riskMgr.PlaceOrder(orderContext, RiskOrder{Symbol: swap.SubstituteSymbol, Side: "sell", Amount: swap.SubstituteAmount, Price: substituteQuote, Source: SourceSwapBack,
+				SwapID: swap.ID})
+
+			if sellError != nil {
+				logrus.Error(sellError.Error())
+				continue
+			}
+
+			swap.BuyBackCash = util.DecimalToFloat(decimal.NewFromFloat(swap.BuyBackCash).Add(
+				decimal.NewFromFloat(sellIntent.FillPrice).Mul(decimal.NewFromInt(swap.SubstituteAmount))).Round(2))
+			soldAmount := swap.SubstituteAmount
+			swap.SubstituteAmount = 0
+
+			recordSellError := taxManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+				sellFillError := taxManager.withDatabase(transactionManager).RecordSellFill(swap.SubstituteSymbol, soldAmount, sellIntent.FillPrice, nil)
+
+				if sellFillError != nil {
+					return sellFillError
+				}
+
+				_, swapUpdateError := transactionManager.UpdateHarvestSwapModel(swap)
+
+				if swapUpdateError != nil {
+					return swapUpdateError
+				}
+
+				return completeOrderIntent(transactionManager, sellIntent)
+			})
+
+			if recordSellError != nil {
+				logrus.Error("Sold " + swap.SubstituteSymbol + " but could not save it, it is settled by the order recovery, " + recordSellError.Error())
+				continue
+			}
+		}
+
+		amountToBuy := decimal.NewFromFloat(swap.BuyBackCash).Div(decimal.NewFromFloat(symbolQuote)).IntPart()
+		buyIntent := dto.OrderIntentModel{}
+
+		if amountToBuy > 0 {
+
+			placedIntent, buyError := taxManager.riskMgr.PlaceOrder(orderContext, RiskOrder{Symbol: swap.Symbol, Side: "buy", Amount: amountToBuy, Price: symbolQuote, Source: SourceSwapBack,
+				SwapID: swap.ID})
+
+			if buyError != nil {
+				logrus.Error("Could not buy back " + swap.Symbol + ", it is retried on the next tick, " + buyError.Error())
+				continue
+			}
+
+			buyIntent = placedIntent
+		}
+
+		swap.BuyBackCash = 0
+		swap.Completed = true
+
+		// The bought lot, the symbol amount and the finished swap are saved together
+		swapBackError := taxManager.databaseMgr.RunInTransaction(func(transactionManager *DatabaseManager) error {
+
+			if amountToBuy > 0 {
+
+				recordBuyError := taxManager.withDatabase(transactionManager).RecordBuyFill(swap.Symbol, amountToBuy, buyIntent.FillPrice)
+
+				if recordBuyError != nil {
+					return recordBuyError
+				}
+
+				oldAmount := indexedSymbol.Amount
+				indexedSymbol.Amount = indexedSymbol.Amount + amountToBuy
+
+				_, symbolUpdateError := transactionManager.UpdateIndexedSymbolModel(indexedSymbol)
+
+				if symbolUpdateError != nil {
+					return symbolUpdateError
+				}
+
+				eventError := recordHoldingChange(transactionManager, SourceSwapBack, indexedSymbol.Symbol, oldAmount, indexedSymbol.Amount, buyIntent.FillPrice)
+
+				if eventError != nil {
+					return eventError
+				}
+
+				completeError := completeOrderIntent(transactionManager, buyIntent)
+
+				if completeError != nil {
+					return completeError
+				}
+			}
+
+			_, swapUpdateError := transactionManager.UpdateHarvestSwapModel(swap)
+
+			return swapUpdateError
+		})
+
+		if swapBackError != nil {
+			logrus.Error("Swap back of " + swap.Symbol + " could not be saved, " + swapBackError.Error())
+			continue
+		}
+
+		logrus.Info("Swapped " + swap.SubstituteSymbol + " back into " + swap.Symbol)
+	}
+
+	return nil
+}
@@ -0,0 +1,381 @@
+package managers
+
+import (
+	"github.com/r4stl1n/condext/pkg/dto"
+	"github.com/r4stl1n/condext/pkg/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openEmptyTestDatabaseManager opens an unmigrated sqlite database in a temporary directory
+func openEmptyTestDatabaseManager(t *testing.T) *DatabaseManager {
+
+	t.Helper()
+
+	databaseDirectory, directoryError := ioutil.TempDir("", "condext-test")
+
+	if directoryError != nil {
+		t.Fatal(directoryError)
+	}
+
+	databaseManager, openError := OpenDatabaseManager(util.DatabaseDialectSqlite, filepath.Join(databaseDirectory, "condext.db"))
+
+	if openError != nil {
+		os.RemoveAll(databaseDirectory)
+		t.Fatal(openError)
+	}
+
+	t.Cleanup(func() {
+		databaseManager.Close()
+		os.RemoveAll(databaseDirectory)
+	})
+
+	return databaseManager
+}
+
+// openTestDatabaseManager opens a migrated sqlite database with the default config in a temporary directory
+func openTestDatabaseManager(t *testing.T) *DatabaseManager {
+
+	t.Helper()
+
+	databaseManager := openEmptyTestDatabaseManager(t)
+
+	_, migrateError := databaseManager.Migrate()
+
+	if migrateError != nil {
+		t.Fatal(migrateError)
+	}
+
+	configError := databaseManager.CreateCondextConfigAndFirstSymbolModel()
+
+	if configError != nil {
+		t.Fatal(configError)
+	}
+
+	return databaseManager
+}
+
+func TestLotSaleRank(t *testing.T) {
+
+	soldAt := time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		costBasis  float64
+		acquiredAt time.Time
+		price      float64
+		rank       int
+	}{
+		{"short term loss", 120, soldAt.AddDate(0, -1, 0), 100, 0},
+		{"long term loss", 120, soldAt.AddDate(-2, 0, 0), 100, 0},
+		{"long term gain", 80, soldAt.AddDate(-2, 0, 0), 100, 1},
+		{"short term gain", 80, soldAt.AddDate(0, -1, 0), 100, 2},
+		{"break even counts as a gain", 100, soldAt.AddDate(0, -1, 0), 100, 2},
+		{"exactly one year is still short term", 80, soldAt.AddDate(-1, 0, 0), 100, 2},
+		{"one year and a day is long term", 80, soldAt.AddDate(-1, 0, -1), 100, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			lot := dto.TaxLotModel{CostBasis: testCase.costBasis, AcquiredAt: testCase.acquiredAt}
+
+			rank := lotSaleRank(lot, testCase.price, soldAt)
+
+			if rank != testCase.rank {
+				t.Errorf("lotSaleRank = %d, want %d", rank, testCase.rank)
+			}
+		})
+	}
+}
+
+func TestSelectLotsForSale(t *testing.T) {
+
+	now := time.Now()
+
+	testCases := []struct {
+		name          string
+		lots          []dto.TaxLotModel
+		amount        int64
+		price         float64
+		order         []float64
+		shortTermGain float64
+		longTermGain  float64
+		estimatedTax  float64
+	}{
+		{
+			name: "losses before long term before short term gains",
+			lots: []dto.TaxLotModel{
+				{Amount: 10, RemainingAmount: 10, CostBasis: 50, AcquiredAt: now.AddDate(0, -2, 0)},
+				{Amount: 10, RemainingAmount: 10, CostBasis: 60, AcquiredAt: now.AddDate(-2, 0, 0)},
+				{Amount: 10, RemainingAmount: 10, CostBasis: 150, AcquiredAt: now.AddDate(0, -1, 0)},
+			},
+			amount:        20,
+			price:         100,
+			order:         []float64{150, 60, 50},
+			shortTermGain: -500,
+			longTermGain:  400,
+			estimatedTax:  -105,
+		},
+		{
+			name: "highest basis first within a rank",
+			lots: []dto.TaxLotModel{
+				{Amount: 5, RemainingAmount: 5, CostBasis: 70, AcquiredAt: now.AddDate(0, -3, 0)},
+				{Amount: 5, RemainingAmount: 5, CostBasis: 90, AcquiredAt: now.AddDate(0, -2, 0)},
+				{Amount: 5, RemainingAmount: 5, CostBasis: 80, AcquiredAt: now.AddDate(0, -1, 0)},
+			},
+			amount:        7,
+			price:         100,
+			order:         []float64{90, 80, 70},
+			shortTermGain: 90,
+			longTermGain:  0,
+			estimatedTax:  33.3,
+		},
+		{
+			name: "partial lot is priced on the closed shares only",
+			lots: []dto.TaxLotModel{
+				{Amount: 10, RemainingAmount: 4, CostBasis: 40, AcquiredAt: now.AddDate(-3, 0, 0)},
+			},
+			amount:        3,
+			price:         50,
+			order:         []float64{40},
+			shortTermGain: 0,
+			longTermGain:  30,
+			estimatedTax:  6,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			for _, lot := range testCase.lots {
+
+				lot.Symbol = "VTI"
+
+				_, createError := databaseManager.CreateTaxLotModel(lot)
+
+				if createError != nil {
+					t.Fatal(createError)
+				}
+			}
+
+			taxManager := CreateTaxManager(databaseManager, nil, nil)
+
+			selectedLots, taxImpact, selectError := taxManager.SelectLotsForSale("VTI", testCase.amount, testCase.price)
+
+			if selectError != nil {
+				t.Fatal(selectError)
+			}
+
+			if len(selectedLots) != len(testCase.order) {
+				t.Fatalf("got %d lots, want %d", len(selectedLots), len(testCase.order))
+			}
+
+			for index, costBasis := range testCase.order {
+				if selectedLots[index].CostBasis != costBasis {
+					t.Errorf("lot %d has cost basis %v, want %v", index, selectedLots[index].CostBasis, costBasis)
+				}
+			}
+
+			if taxImpact.ShortTermGain != testCase.shortTermGain {
+				t.Errorf("short term gain = %v, want %v", taxImpact.ShortTermGain, testCase.shortTermGain)
+			}
+
+			if taxImpact.LongTermGain != testCase.longTermGain {
+				t.Errorf("long term gain = %v, want %v", taxImpact.LongTermGain, testCase.longTermGain)
+			}
+
+			if taxImpact.EstimatedTax != testCase.estimatedTax {
+				t.Errorf("estimated tax = %v, want %v", taxImpact.EstimatedTax, testCase.estimatedTax)
+			}
+		})
+	}
+}
+
+func TestApplyWashSale(t *testing.T) {
+
+	soldAt := time.Date(2021, time.March, 31, 15, 0, 0, 0, time.UTC)
+	acquiredAt := soldAt.AddDate(0, 0, -30)
+	boughtAt := soldAt.AddDate(0, 0, 5)
+
+	testCases := []struct {
+		name              string
+		replacementAmount int64
+		matchedAmount     int64
+		adjustment        float64
+		remainingAmount   int64
+		openLots          int
+	}{
+		{"whole replacement lot matched", 10, 10, 200, 10, 1},
+		{"replacement lot larger than the match", 25, 10, 200, 15, 2},
+		{"part of the loss matched", 4, 4, 80, 4, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			closedLot, closedLotError := databaseManager.CreateClosedLotModel(dto.ClosedLotModel{
+				Symbol:     "VTI",
+				Amount:     10,
+				AcquiredAt: acquiredAt,
+				SoldAt:     soldAt,
+				Proceeds:   800,
+				CostBasis:  1000,
+			})
+
+			if closedLotError != nil {
+				t.Fatal(closedLotError)
+			}
+
+			replacementLot, replacementLotError := databaseManager.CreateTaxLotModel(dto.TaxLotModel{
+				Symbol:          "VTI",
+				FillUUID:        "fill",
+				Amount:          testCase.replacementAmount,
+				RemainingAmount: testCase.replacementAmount,
+				CostBasis:       90,
+				AcquiredAt:      boughtAt,
+			})
+
+			if replacementLotError != nil {
+				t.Fatal(replacementLotError)
+			}
+
+			taxManager := CreateTaxManager(databaseManager, nil, nil)
+
+			updatedClosedLot, remainingLot, washSaleError := taxManager.applyWashSale(closedLot, replacementLot, testCase.matchedAmount)
+
+			if washSaleError != nil {
+				t.Fatal(washSaleError)
+			}
+
+			if updatedClosedLot.WashSaleAdjustment != testCase.adjustment {
+				t.Errorf("wash sale adjustment = %v, want %v", updatedClosedLot.WashSaleAdjustment, testCase.adjustment)
+			}
+
+			if remainingLot.RemainingAmount != testCase.remainingAmount || remainingLot.Amount != testCase.remainingAmount {
+				t.Errorf("remaining lot holds %d of %d, want %d", remainingLot.RemainingAmount, remainingLot.Amount, testCase.remainingAmount)
+			}
+
+			openLots, openLotsError := databaseManager.GetOpenTaxLotsBySymbol("VTI")
+
+			if openLotsError != nil {
+				t.Fatal(openLotsError)
+			}
+
+			if len(openLots) != testCase.openLots {
+				t.Fatalf("got %d open lots, want %d", len(openLots), testCase.openLots)
+			}
+
+			var totalAmount int64
+
+			for _, lot := range openLots {
+
+				totalAmount = totalAmount + lot.RemainingAmount
+
+				if lot.FillUUID != "fill" {
+					t.Errorf("lot %s lost its fill, got %q", lot.UUID, lot.FillUUID)
+				}
+
+				adjusted := lot.UUID != remainingLot.UUID || testCase.openLots == 1
+
+				if adjusted == true {
+
+					if lot.RemainingAmount != testCase.matchedAmount {
+						t.Errorf("adjusted lot holds %d, want %d", lot.RemainingAmount, testCase.matchedAmount)
+					}
+
+					if lot.CostBasis != 110 {
+						t.Errorf("adjusted lot cost basis = %v, want 110", lot.CostBasis)
+					}
+
+					if lot.AcquiredAt.Equal(boughtAt.AddDate(0, 0, -30)) == false {
+						t.Errorf("adjusted lot acquired at %v, want %v", lot.AcquiredAt, boughtAt.AddDate(0, 0, -30))
+					}
+
+				} else {
+
+					if lot.CostBasis != 90 || lot.AcquiredAt.Equal(boughtAt) == false {
+						t.Errorf("unmatched lot changed to %v acquired at %v", lot.CostBasis, lot.AcquiredAt)
+					}
+				}
+			}
+
+			if totalAmount != testCase.replacementAmount {
+				t.Errorf("open lots hold %d shares, want %d", totalAmount, testCase.replacementAmount)
+			}
+		})
+	}
+}
+
+func TestRecordBuyFillWashSale(t *testing.T) {
+
+	testCases := []struct {
+		name          string
+		buyAmounts    []int64
+		matchedAmount int64
+		adjustment    float64
+	}{
+		{"one replacement buy", []int64{100}, 100, 2000},
+		{"two partial replacement buys", []int64{30, 70}, 100, 2000},
+		{"replacement buys past the sold shares", []int64{30, 90}, 100, 2000},
+		{"replacement buys short of the sold shares", []int64{30, 20}, 50, 1000},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			databaseManager := openTestDatabaseManager(t)
+
+			soldAt := time.Now().AddDate(0, 0, -2)
+
+			closedLot, closedLotError := databaseManager.CreateClosedLotModel(dto.ClosedLotModel{
+				Symbol:     "VTI",
+				Amount:     100,
+				AcquiredAt: soldAt.AddDate(0, -2, 0),
+				SoldAt:     soldAt,
+				Proceeds:   8000,
+				CostBasis:  10000,
+			})
+
+			if closedLotError != nil {
+				t.Fatal(closedLotError)
+			}
+
+			taxManager := CreateTaxManager(databaseManager, nil, nil)
+
+			for _, buyAmount := range testCase.buyAmounts {
+
+				buyError := taxManager.RecordBuyFill("VTI", buyAmount, 90)
+
+				if buyError != nil {
+					t.Fatal(buyError)
+				}
+			}
+
+			closedLots, closedLotsError := databaseManager.GetClosedLotsBySymbolSince("VTI", soldAt.AddDate(0, 0, -1))
+
+			if closedLotsError != nil {
+				t.Fatal(closedLotsError)
+			}
+
+			if len(closedLots) != 1 || closedLots[0].UUID != closedLot.UUID {
+				t.Fatalf("got %d closed lots, want the one sold", len(closedLots))
+			}
+
+			if closedLots[0].WashSaleMatchedAmount != testCase.matchedAmount {
+				t.Errorf("wash sale matched amount = %d, want %d", closedLots[0].WashSaleMatchedAmount, testCase.matchedAmount)
+			}
+
+			if closedLots[0].WashSaleAdjustment != testCase.adjustment {
+				t.Errorf("wash sale adjustment = %v, want %v", closedLots[0].WashSaleAdjustment, testCase.adjustment)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package renderers
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+type CsvRenderer struct {
+}
+
+func CreateCsvRenderer() *CsvRenderer {
+	return &CsvRenderer{}
+}
+
+// Render writes a header of the column keys and the rows, the footer follows as the last row like it does in a table
+func (csvRenderer *CsvRenderer) Render(writer io.Writer, view View) error {
+
+	records := append([][]string{view.Keys()}, view.Rows...)
+
+	if len(view.Footer) > 0 && view.Vertical == false {
+		records = append(records, view.Footer)
+	}
+
+	return csv.NewWriter(writer).WriteAll(records)
+}
@@ -0,0 +1,56 @@
+package renderers
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type JsonRenderer struct {
+}
+
+func CreateJsonRenderer() *JsonRenderer {
+	return &JsonRenderer{}
+}
+
+func viewRecord(view View, row []string) map[string]string {
+
+	record := map[string]string{}
+
+	for index, key := range view.Keys() {
+		record[key] = row[index]
+	}
+
+	return record
+}
+
+// Render writes the rows as a list of records, a view with a footer is written as an object holding the rows and
+// the footer record so the totals are never mistaken for a row
+func (jsonRenderer *JsonRenderer) Render(writer io.Writer, view View) error {
+
+	records := []map[string]string{}
+
+	for _, row := range view.Rows {
+		records = append(records, viewRecord(view, row))
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	if view.Vertical == true {
+
+		if len(records) == 0 {
+			return encoder.Encode(map[string]string{})
+		}
+
+		return encoder.Encode(records[0])
+	}
+
+	if len(view.Footer) > 0 {
+		return encoder.Encode(map[string]interface{}{
+			"rows":   records,
+			"footer": viewRecord(view, view.Footer),
+		})
+	}
+
+	return encoder.Encode(records)
+}
@@ -0,0 +1,61 @@
+package renderers
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type MarkdownRenderer struct {
+}
+
+func CreateMarkdownRenderer() *MarkdownRenderer {
+	return &MarkdownRenderer{}
+}
+
+func escapeMarkdownCell(cell string) string {
+	return strings.Replace(cell, "|", "\\|", -1)
+}
+
+func writeMarkdownRow(writer io.Writer, cells []string) error {
+
+	escapedCells := []string{}
+
+	for _, cell := range cells {
+		escapedCells = append(escapedCells, escapeMarkdownCell(cell))
+	}
+
+	_, writeError := fmt.Fprintln(writer, "| "+strings.Join(escapedCells, " | ")+" |")
+
+	return writeError
+}
+
+func (markdownRenderer *MarkdownRenderer) Render(writer io.Writer, view View) error {
+
+	header := view.Titles()
+	data := view.Rows
+
+	if view.Vertical == true {
+		header = []string{"Metric", "Value"}
+		data = view.VerticalRows()
+	} else if len(view.Footer) > 0 {
+		data = append(data, view.Footer)
+	}
+
+	separator := []string{}
+
+	for range header {
+		separator = append(separator, "---")
+	}
+
+	for _, row := range append([][]string{header, separator}, data...) {
+
+		writeError := writeMarkdownRow(writer, row)
+
+		if writeError != nil {
+			return writeError
+		}
+	}
+
+	return nil
+}
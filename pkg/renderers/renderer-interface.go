@@ -0,0 +1,27 @@
+package renderers
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+type RendererInterface interface {
+	Render(writer io.Writer, view View) error
+}
+
+func GetRenderer(format string) (RendererInterface, error) {
+
+	switch strings.ToLower(format) {
+	case "", "table":
+		return CreateTableRenderer(), nil
+	case "json":
+		return CreateJsonRenderer(), nil
+	case "csv":
+		return CreateCsvRenderer(), nil
+	case "markdown", "md":
+		return CreateMarkdownRenderer(), nil
+	}
+
+	return nil, errors.New("unknown format, use one of table, json, csv, markdown")
+}
@@ -0,0 +1,63 @@
+package renderers
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRenderFooter(t *testing.T) {
+
+	footerView := View{
+		Name:    "Tax Impact",
+		Columns: []ViewColumn{{Key: "symbol", Title: "Symbol"}, {Key: "gain", Title: "Gain"}},
+		Rows:    [][]string{{"VTI", "10.5"}, {"VXUS", "-2"}},
+		Footer:  []string{"Total", "8.5"},
+	}
+
+	plainView := footerView
+	plainView.Footer = nil
+
+	testCases := []struct {
+		name   string
+		format string
+		view   View
+		output string
+	}{
+		{"csv with footer", "csv", footerView, "symbol,gain\nVTI,10.5\nVXUS,-2\nTotal,8.5\n"},
+		{"csv without footer", "csv", plainView, "symbol,gain\nVTI,10.5\nVXUS,-2\n"},
+		{
+			"json with footer", "json", footerView,
+			"{\n  \"footer\": {\n    \"gain\": \"8.5\",\n    \"symbol\": \"Total\"\n  },\n  \"rows\": [\n" +
+				"    {\n      \"gain\": \"10.5\",\n      \"symbol\": \"VTI\"\n    },\n" +
+				"    {\n      \"gain\": \"-2\",\n      \"symbol\": \"VXUS\"\n    }\n  ]\n}\n",
+		},
+		{
+			"json without footer", "json", plainView,
+			"[\n  {\n    \"gain\": \"10.5\",\n    \"symbol\": \"VTI\"\n  },\n  {\n    \"gain\": \"-2\",\n    \"symbol\": \"VXUS\"\n  }\n]\n",
+		},
+		{"markdown with footer", "markdown", footerView, "| Symbol | Gain |\n| --- | --- |\n| VTI | 10.5 |\n| VXUS | -2 |\n| Total | 8.5 |\n"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			renderer, rendererError := GetRenderer(testCase.format)
+
+			if rendererError != nil {
+				t.Fatal(rendererError)
+			}
+
+			output := bytes.Buffer{}
+
+			renderError := renderer.Render(&output, testCase.view)
+
+			if renderError != nil {
+				t.Fatal(renderError)
+			}
+
+			if output.String() != testCase.output {
+				t.Errorf("Render wrote\n%s\nwant\n%s", output.String(), testCase.output)
+			}
+		})
+	}
+}
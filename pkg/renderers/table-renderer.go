@@ -0,0 +1,41 @@
+package renderers
+
+import (
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"io"
+)
+
+type TableRenderer struct {
+}
+
+func CreateTableRenderer() *TableRenderer {
+	return &TableRenderer{}
+}
+
+func (tableRenderer *TableRenderer) Render(writer io.Writer, view View) error {
+
+	header := view.Titles()
+	data := view.Rows
+
+	if view.Vertical == true {
+		header = []string{"Metric", "Value"}
+		data = view.VerticalRows()
+	}
+
+	fmt.Fprintln(writer)
+	table := tablewriter.NewWriter(writer)
+	table.SetHeader(header)
+
+	if len(view.Footer) > 0 && view.Vertical == false {
+		table.SetFooter(view.Footer)
+	}
+
+	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	table.SetCenterSeparator("|")
+	table.AppendBulk(data) // Add Bulk Data
+	table.Render()
+	fmt.Fprintln(writer)
+
+	return nil
+}
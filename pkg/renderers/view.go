@@ -0,0 +1,56 @@
+package renderers
+
+type ViewColumn struct {
+	// Key is the stable field name used by the machine readable formats
+	Key   string
+	Title string
+}
+
+// View is a renderer agnostic table, numbers are kept as decimal strings so no format loses precision
+type View struct {
+	Name    string
+	Columns []ViewColumn
+	Rows    [][]string
+	Footer  []string
+
+	// Vertical views hold a single record that reads better as metric and value pairs
+	Vertical bool
+}
+
+func (view View) Titles() []string {
+
+	titles := []string{}
+
+	for _, column := range view.Columns {
+		titles = append(titles, column.Title)
+	}
+
+	return titles
+}
+
+func (view View) Keys() []string {
+
+	keys := []string{}
+
+	for _, column := range view.Columns {
+		keys = append(keys, column.Key)
+	}
+
+	return keys
+}
+
+// VerticalRows turns the first row into title and value pairs
+func (view View) VerticalRows() [][]string {
+
+	rows := [][]string{}
+
+	if len(view.Rows) == 0 {
+		return rows
+	}
+
+	for index, column := range view.Columns {
+		rows = append(rows, []string{column.Title, view.Rows[0][index]})
+	}
+
+	return rows
+}
@@ -0,0 +1,112 @@
+package util
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnvironmentVariables(t *testing.T) {
+
+	fileThreshold := 1.0
+	fileFrequency := int64(60)
+
+	testCases := []struct {
+		name      string
+		variables map[string]string
+		threshold float64
+		frequency int64
+		notional  *float64
+		window    string
+		error     string
+	}{
+		{"file values without variables", map[string]string{}, 1, 60, nil, "", ""},
+		{"variables override the file", map[string]string{"CONDEXT_REBALANCE_THRESHOLD": "2.5", "CONDEXT_REBALANCE_FREQUENCY": "300"}, 2.5, 300, nil, "", ""},
+		{"variables set what the file leaves out", map[string]string{"CONDEXT_RISK_MAX_ORDER_NOTIONAL": "5000", "CONDEXT_REBALANCE_TRADE_WINDOW_START": "10:00"}, 1, 60, floatPointer(5000), "10:00", ""},
+		{"zero turns a limit off", map[string]string{"CONDEXT_RISK_MAX_ORDER_NOTIONAL": "0"}, 1, 60, floatPointer(0), "", ""},
+		{"limit not a number", map[string]string{"CONDEXT_RISK_MAX_ORDER_NOTIONAL": "lots"}, 1, 60, nil, "", "CONDEXT_RISK_MAX_ORDER_NOTIONAL must be a number"},
+		{"frequency not a whole number", map[string]string{"CONDEXT_REBALANCE_FREQUENCY": "1.5"}, 1, 60, nil, "", "CONDEXT_REBALANCE_FREQUENCY must be a whole number"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			for variableName, variableValue := range testCase.variables {
+				os.Setenv(variableName, variableValue)
+				defer os.Unsetenv(variableName)
+			}
+
+			threshold := fileThreshold
+			frequency := fileFrequency
+
+			configStruct := ConfigStruct{Rebalance: RebalanceConfig{Threshold: &threshold, Frequency: &frequency}}
+
+			applyError := configStruct.applyEnvironmentVariables()
+
+			if testCase.error != "" {
+
+				if applyError == nil || applyError.Error() != testCase.error {
+					t.Fatalf("error = %v, want %s", applyError, testCase.error)
+				}
+
+				return
+			}
+
+			if applyError != nil {
+				t.Fatal(applyError)
+			}
+
+			if *configStruct.Rebalance.Threshold != testCase.threshold || *configStruct.Rebalance.Frequency != testCase.frequency {
+				t.Errorf("threshold %v and frequency %d, want %v and %d", *configStruct.Rebalance.Threshold, *configStruct.Rebalance.Frequency,
+					testCase.threshold, testCase.frequency)
+			}
+
+			if (configStruct.Risk.MaxOrderNotional == nil) != (testCase.notional == nil) ||
+				(testCase.notional != nil && *configStruct.Risk.MaxOrderNotional != *testCase.notional) {
+				t.Errorf("max order notional = %v, want %v", configStruct.Risk.MaxOrderNotional, testCase.notional)
+			}
+
+			windowStart := ""
+
+			if configStruct.Rebalance.TradeWindowStart != nil {
+				windowStart = *configStruct.Rebalance.TradeWindowStart
+			}
+
+			if windowStart != testCase.window {
+				t.Errorf("trade window start = %q, want %q", windowStart, testCase.window)
+			}
+		})
+	}
+}
+
+func TestValidateListenTokens(t *testing.T) {
+
+	testCases := []struct {
+		name    string
+		config  ConfigStruct
+		problem string
+		flagged bool
+	}{
+		{"dashboard with a token", ConfigStruct{DashboardListen: ":8081", DashboardToken: "secret"}, "DashboardToken is required", false},
+		{"dashboard without a token", ConfigStruct{DashboardListen: ":8081"}, "DashboardToken is required", true},
+		{"no dashboard", ConfigStruct{}, "DashboardToken is required", false},
+		{"api without a token", ConfigStruct{ApiListen: ":8080"}, "ApiToken is required", true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			validateError := testCase.config.Validate()
+
+			flagged := validateError != nil && strings.Contains(validateError.Error(), testCase.problem)
+
+			if flagged != testCase.flagged {
+				t.Errorf("Validate = %v, want %q flagged %v", validateError, testCase.problem, testCase.flagged)
+			}
+		})
+	}
+}
+
+func floatPointer(value float64) *float64 {
+	return &value
+}
@@ -1,6 +1,85 @@
 package util
 
+type EnvironmentConfig struct {
+	AlpacaApi    string
+	AlpacaSecret string
+
+	// BrokerUrl overrides the default endpoint, paper has to stay on the paper host. For sim it is the simulated account
+	// file
+	BrokerUrl string
+
+	// Database is a sqlite file or a postgres:// url, one instance trades against it at a time. Instances sharing a
+	// PostgreSQL database keep apart by setting search_path to a schema of their own in the url
+	Database string
+
+	// ConfirmLive allows live orders without the typed confirmation at startup
+	ConfirmLive bool
+}
+
+type LoggingConfig struct {
+	Level  string
+	Format string
+	File   string
+}
+
+// RiskConfig overrides the saved pre-trade limits when set, zero turns a check off
+type RiskConfig struct {
+	MaxOrderNotional  *float64
+	MaxDailyNotional  *float64
+	MaxPositionWeight *float64
+	MaxPriceDeviation *float64
+}
+
+// RebalanceConfig overrides the saved rebalance policy when set
+type RebalanceConfig struct {
+	Threshold        *float64
+	Frequency        *int64
+	OrderTimeout     *int64
+	TradeWindowStart *string
+	TradeWindowEnd   *string
+}
+
+// BackupConfig controls where database backups go and how many of each kind are kept
+type BackupConfig struct {
+	Directory string
+
+	// Retention is the number of backups kept per label, zero keeps all of them
+	Retention *int
+
+	// BeforeRebalance snapshots the database before a rebalance places its first order
+	BeforeRebalance *bool
+}
+
 type ConfigStruct struct {
 	AlpacaApi    string
 	AlpacaSecret string
+
+	// Environment picks one of Environments, paper when empty
+	Environment  string
+	Environments map[string]EnvironmentConfig
+
+	// AutoResume restarts the rebalance process on startup when it was running before shutdown
+	AutoResume bool
+
+	ApiListen string
+	ApiToken  string
+	ApiOnly   bool
+
+	DashboardListen string
+	DashboardToken  string
+
+	// SecretsFile is the encrypted store broker credentials are read from when the config leaves them empty, a relative
+	// path is resolved against the directory of the config file
+	SecretsFile string
+
+	Logging   LoggingConfig
+	Risk      RiskConfig
+	Rebalance RebalanceConfig
+	Backup    BackupConfig
+
+	// Set from environment variables and flags, never read from the file
+	overrides environmentOverrides
+
+	// The directory of the loaded config file, a SecretsFile read from it is relative to the file
+	configDirectory string
 }
@@ -0,0 +1,204 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	EnvironmentPaper = "paper"
+	EnvironmentLive  = "live"
+
+	// EnvironmentSim trades against the built in simulator, its BrokerUrl is the file keeping the simulated account
+	EnvironmentSim = "sim"
+)
+
+// Gorm dialect names for the supported databases
+const (
+	DatabaseDialectSqlite   = "sqlite3"
+	DatabaseDialectPostgres = "postgres"
+)
+
+var defaultBrokerUrls = map[string]string{
+	EnvironmentPaper: "https://paper-api.alpaca.markets",
+	EnvironmentLive:  "https://api.alpaca.markets",
+	EnvironmentSim:   "data-sim-account.json",
+}
+
+// Hosts of the alpaca endpoints, an order sent to the live host spends real money whatever the environment is called
+const (
+	paperBrokerHost = "paper-api.alpaca.markets"
+	liveBrokerHost  = "api.alpaca.markets"
+)
+
+// ResolveEnvironment returns the name and settings of the selected environment with defaults filled in
+func (config *ConfigStruct) ResolveEnvironment() (string, EnvironmentConfig, error) {
+
+	environmentName := strings.ToLower(config.Environment)
+
+	if environmentName == "" {
+		environmentName = EnvironmentPaper
+	}
+
+	if environmentName != EnvironmentPaper && environmentName != EnvironmentLive && environmentName != EnvironmentSim {
+		return "", EnvironmentConfig{}, errors.New("unknown environment " + config.Environment + ", use one of paper, live, sim")
+	}
+
+	environment, environmentFound := config.Environments[environmentName]
+
+	if environmentFound == false {
+
+		// Configs from before environments keep trading paper against data.db, the simulator needs no setup
+		if environmentName == EnvironmentLive && config.overrides.AlpacaApi == "" {
+			return "", EnvironmentConfig{}, errors.New("environment " + environmentName + " is not set up in Environments")
+		}
+
+		environment = EnvironmentConfig{}
+
+		if environmentName == EnvironmentPaper {
+			environment = EnvironmentConfig{
+				AlpacaApi:    config.AlpacaApi,
+				AlpacaSecret: config.AlpacaSecret,
+				Database:     "data.db",
+			}
+		}
+	}
+
+	if config.overrides.AlpacaApi != "" {
+		environment.AlpacaApi = config.overrides.AlpacaApi
+	}
+
+	if config.overrides.AlpacaSecret != "" {
+		environment.AlpacaSecret = config.overrides.AlpacaSecret
+	}
+
+	if config.overrides.BrokerUrl != "" {
+		environment.BrokerUrl = config.overrides.BrokerUrl
+	}
+
+	if config.overrides.Database != "" {
+		environment.Database = config.overrides.Database
+	}
+
+	if environment.BrokerUrl == "" {
+		environment.BrokerUrl = defaultBrokerUrls[environmentName]
+	}
+
+	if environmentName == EnvironmentSim {
+
+		if strings.Contains(environment.BrokerUrl, "://") == true && strings.HasPrefix(environment.BrokerUrl, "file://") == false {
+			return "", EnvironmentConfig{}, errors.New("environment sim keeps its account in a file, BrokerUrl " + environment.BrokerUrl + " is not a file path")
+		}
+	} else {
+
+		brokerHost, brokerHostError := BrokerHost(environment.BrokerUrl)
+
+		if brokerHostError != nil {
+			return "", EnvironmentConfig{}, errors.New("environment " + environmentName + " BrokerUrl " + environment.BrokerUrl + " is not a valid url")
+		}
+
+		if environmentName == EnvironmentPaper && brokerHost != paperBrokerHost {
+			return "", EnvironmentConfig{}, errors.New("environment paper must use the paper endpoint " + defaultBrokerUrls[EnvironmentPaper] +
+				", BrokerUrl is " + environment.BrokerUrl)
+		}
+	}
+
+	if environment.Database == "" {
+		if environmentName == EnvironmentPaper {
+			environment.Database = "data.db"
+		} else {
+			environment.Database = "data-" + environmentName + ".db"
+		}
+	}
+
+	return environmentName, environment, nil
+}
+
+// BrokerHost is the lowercased host of a broker url without its port, a url without a scheme is read as https
+func BrokerHost(brokerUrl string) (string, error) {
+
+	if strings.Contains(brokerUrl, "://") == false {
+		brokerUrl = "https://" + brokerUrl
+	}
+
+	parsedUrl, parseError := url.Parse(strings.TrimSpace(brokerUrl))
+
+	if parseError != nil {
+		return "", parseError
+	}
+
+	if parsedUrl.Hostname() == "" {
+		return "", errors.New("no host in " + brokerUrl)
+	}
+
+	return strings.TrimSuffix(strings.ToLower(parsedUrl.Hostname()), "."), nil
+}
+
+// IsLiveTrading reports whether orders spend real money, the live environment always does and so does any other
+// whose broker is the alpaca live host
+func IsLiveTrading(environmentName string, environment EnvironmentConfig) bool {
+
+	if environmentName == EnvironmentLive {
+		return true
+	}
+
+	if environmentName == EnvironmentSim {
+		return false
+	}
+
+	brokerHost, brokerHostError := BrokerHost(environment.BrokerUrl)
+
+	// A url that can not be read can not be shown to be safe
+	return brokerHostError != nil || brokerHost == liveBrokerHost
+}
+
+// DatabaseSource returns the gorm dialect and connection string for the environment database
+func (environment EnvironmentConfig) DatabaseSource() (string, string) {
+
+	if strings.HasPrefix(environment.Database, "postgres://") || strings.HasPrefix(environment.Database, "postgresql://") {
+		return DatabaseDialectPostgres, environment.Database
+	}
+
+	return DatabaseDialectSqlite, environment.Database
+}
+
+// DatabaseLabel is the database as shown in logs, a postgres password is masked
+func (environment EnvironmentConfig) DatabaseLabel() string {
+
+	databaseDialect, _ := environment.DatabaseSource()
+
+	if databaseDialect != DatabaseDialectPostgres {
+		return environment.Database
+	}
+
+	databaseUrl, parseError := url.Parse(environment.Database)
+
+	if parseError != nil {
+		return "postgres"
+	}
+
+	if _, passwordSet := databaseUrl.User.Password(); passwordSet == true {
+		databaseUrl.User = url.UserPassword(databaseUrl.User.Username(), "xxxxx")
+	}
+
+	// The query can carry a password as well
+	databaseUrl.RawQuery = ""
+
+	return databaseUrl.String()
+}
+
+func PrintEnvironment(environmentName string, environment EnvironmentConfig) {
+
+	if IsLiveTrading(environmentName, environment) == true {
+		fmt.Println("=========================================")
+		fmt.Println("  LIVE ENVIRONMENT - REAL MONEY ORDERS")
+		fmt.Println("=========================================")
+	}
+
+	fmt.Println("Environment: " + environmentName)
+	fmt.Println("Broker:      " + environment.BrokerUrl)
+	fmt.Println("Database:    " + environment.DatabaseLabel())
+	fmt.Println()
+}
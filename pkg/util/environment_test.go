@@ -0,0 +1,131 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestResolveEnvironment(t *testing.T) {
+
+	testCases := []struct {
+		name         string
+		config       ConfigStruct
+		environment  string
+		brokerUrl    string
+		database     string
+		errorMessage string
+	}{
+		{
+			name:        "paper by default",
+			config:      ConfigStruct{AlpacaApi: "key", AlpacaSecret: "secret"},
+			environment: EnvironmentPaper,
+			brokerUrl:   "https://paper-api.alpaca.markets",
+			database:    "data.db",
+		},
+		{
+			name: "live uses the live endpoint",
+			config: ConfigStruct{Environment: "live", Environments: map[string]EnvironmentConfig{
+				EnvironmentLive: {AlpacaApi: "key", AlpacaSecret: "secret"},
+			}},
+			environment: EnvironmentLive,
+			brokerUrl:   "https://api.alpaca.markets",
+			database:    "data-live.db",
+		},
+		{
+			name: "paper can not point at the live host",
+			config: ConfigStruct{Environments: map[string]EnvironmentConfig{
+				EnvironmentPaper: {BrokerUrl: "https://API.alpaca.markets:443/v2"},
+			}},
+			errorMessage: "environment paper must use the paper endpoint https://paper-api.alpaca.markets, BrokerUrl is https://API.alpaca.markets:443/v2",
+		},
+		{
+			name:         "paper can not be sent live by the environment variable",
+			config:       ConfigStruct{AlpacaApi: "key", AlpacaSecret: "secret", overrides: environmentOverrides{BrokerUrl: "api.alpaca.markets"}},
+			errorMessage: "environment paper must use the paper endpoint https://paper-api.alpaca.markets, BrokerUrl is api.alpaca.markets",
+		},
+		{
+			name: "paper accepts a variant of the paper url",
+			config: ConfigStruct{Environments: map[string]EnvironmentConfig{
+				EnvironmentPaper: {BrokerUrl: "https://Paper-Api.alpaca.markets/v2"},
+			}},
+			environment: EnvironmentPaper,
+			brokerUrl:   "https://Paper-Api.alpaca.markets/v2",
+			database:    "data.db",
+		},
+		{
+			name:        "sim needs no setup",
+			config:      ConfigStruct{Environment: "sim"},
+			environment: EnvironmentSim,
+			brokerUrl:   "data-sim-account.json",
+			database:    "data-sim.db",
+		},
+		{
+			name: "sim keeps its account in a file",
+			config: ConfigStruct{Environment: "sim", Environments: map[string]EnvironmentConfig{
+				EnvironmentSim: {BrokerUrl: "https://api.alpaca.markets"},
+			}},
+			errorMessage: "environment sim keeps its account in a file, BrokerUrl https://api.alpaca.markets is not a file path",
+		},
+		{
+			name:         "custom is not an environment",
+			config:       ConfigStruct{Environment: "custom"},
+			errorMessage: "unknown environment custom, use one of paper, live, sim",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			environmentName, environment, environmentError := testCase.config.ResolveEnvironment()
+
+			if testCase.errorMessage != "" {
+
+				if environmentError == nil || environmentError.Error() != testCase.errorMessage {
+					t.Errorf("ResolveEnvironment error = %v, want %s", environmentError, testCase.errorMessage)
+				}
+
+				return
+			}
+
+			if environmentError != nil {
+				t.Fatal(environmentError)
+			}
+
+			if environmentName != testCase.environment || environment.BrokerUrl != testCase.brokerUrl || environment.Database != testCase.database {
+				t.Errorf("ResolveEnvironment = %s %s %s, want %s %s %s", environmentName, environment.BrokerUrl, environment.Database,
+					testCase.environment, testCase.brokerUrl, testCase.database)
+			}
+		})
+	}
+}
+
+func TestIsLiveTrading(t *testing.T) {
+
+	testCases := []struct {
+		name            string
+		environmentName string
+		brokerUrl       string
+		liveTrading     bool
+	}{
+		{"live environment", EnvironmentLive, "https://api.alpaca.markets", true},
+		{"live environment on another host", EnvironmentLive, "http://localhost:8080", true},
+		{"paper host", EnvironmentPaper, "https://paper-api.alpaca.markets", false},
+		{"upper case live host", EnvironmentPaper, "https://API.alpaca.markets/", true},
+		{"live host with a port", EnvironmentPaper, "https://api.alpaca.markets:443", true},
+		{"live host with a path", EnvironmentPaper, "https://api.alpaca.markets/v2", true},
+		{"live host without a scheme", EnvironmentPaper, "api.alpaca.markets", true},
+		{"live host with a trailing dot", EnvironmentPaper, "https://api.alpaca.markets./", true},
+		{"url that can not be read", EnvironmentPaper, "https://%zz", true},
+		{"simulator", EnvironmentSim, "data-sim-account.json", false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			liveTrading := IsLiveTrading(testCase.environmentName, EnvironmentConfig{BrokerUrl: testCase.brokerUrl})
+
+			if liveTrading != testCase.liveTrading {
+				t.Errorf("IsLiveTrading(%s, %s) = %v, want %v", testCase.environmentName, testCase.brokerUrl, liveTrading, testCase.liveTrading)
+			}
+		})
+	}
+}
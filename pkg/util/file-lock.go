@@ -0,0 +1,25 @@
+package util
+
+import (
+	"os"
+	"strconv"
+)
+
+// FileLock holds an exclusive lock on a file next to the database for the life of the process
+type FileLock struct {
+	path string
+	file *os.File
+}
+
+func (fileLock *FileLock) writePid() error {
+
+	truncateError := fileLock.file.Truncate(0)
+
+	if truncateError != nil {
+		return truncateError
+	}
+
+	_, writeError := fileLock.file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+
+	return writeError
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// AcquireFileLock takes a non blocking flock so a crashed process never leaves a stale lock behind
+func AcquireFileLock(path string) (*FileLock, error) {
+
+	lockFile, lockFileError := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+
+	if lockFileError != nil {
+		return nil, lockFileError
+	}
+
+	flockError := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+
+	if flockError != nil {
+		lockFile.Close()
+
+		if flockError == syscall.EWOULDBLOCK {
+			return nil, errors.New("another condext instance holds " + path)
+		}
+
+		return nil, flockError
+	}
+
+	fileLock := &FileLock{path: path, file: lockFile}
+
+	pidError := fileLock.writePid()
+
+	if pidError != nil {
+		fileLock.Release()
+		return nil, pidError
+	}
+
+	return fileLock, nil
+}
+
+func (fileLock *FileLock) Release() error {
+
+	unlockError := syscall.Flock(int(fileLock.file.Fd()), syscall.LOCK_UN)
+
+	closeError := fileLock.file.Close()
+
+	if unlockError != nil {
+		return unlockError
+	}
+
+	return closeError
+}
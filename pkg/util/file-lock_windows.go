@@ -0,0 +1,46 @@
+//go:build windows
+// +build windows
+
+package util
+
+import (
+	"errors"
+	"os"
+)
+
+// AcquireFileLock relies on exclusive create, a lock file left by a crash has to be removed by hand
+func AcquireFileLock(path string) (*FileLock, error) {
+
+	lockFile, lockFileError := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+
+	if lockFileError != nil {
+
+		if os.IsExist(lockFileError) {
+			return nil, errors.New("another condext instance holds " + path + ", remove it if no instance is running")
+		}
+
+		return nil, lockFileError
+	}
+
+	fileLock := &FileLock{path: path, file: lockFile}
+
+	pidError := fileLock.writePid()
+
+	if pidError != nil {
+		fileLock.Release()
+		return nil, pidError
+	}
+
+	return fileLock, nil
+}
+
+func (fileLock *FileLock) Release() error {
+
+	closeError := fileLock.file.Close()
+
+	if closeError != nil {
+		return closeError
+	}
+
+	return os.Remove(fileLock.path)
+}
@@ -0,0 +1,309 @@
+package util
+
+import (
+	"math"
+	"time"
+)
+
+// GetPeriodReturns gives the return of each period with the external flow into it removed
+func GetPeriodReturns(values []float64, flows []float64) []float64 {
+
+	periodReturns := []float64{}
+
+	for i := 1; i < len(values); i++ {
+		if values[i-1] != 0 {
+			periodReturns = append(periodReturns, (values[i]-flows[i])/values[i-1]-1)
+		}
+	}
+
+	return periodReturns
+}
+
+// DatedReturn is the return of the period that ended at EndedAt
+type DatedReturn struct {
+	EndedAt time.Time
+	Return  float64
+}
+
+// GetDatedPeriodReturns is GetPeriodReturns keyed by the end of each period, so returns from different series can be
+// matched up even when one of them left a period out
+func GetDatedPeriodReturns(values []float64, flows []float64, times []time.Time) []DatedReturn {
+
+	datedReturns := []DatedReturn{}
+
+	for i := 1; i < len(values); i++ {
+		if values[i-1] != 0 {
+			datedReturns = append(datedReturns, DatedReturn{EndedAt: times[i], Return: (values[i]-flows[i])/values[i-1] - 1})
+		}
+	}
+
+	return datedReturns
+}
+
+// JoinDatedReturns pairs the returns of two series that ended on the same day, a day only one series has is dropped
+func JoinDatedReturns(datedReturnsA []DatedReturn, datedReturnsB []DatedReturn) ([]float64, []float64) {
+
+	returnsByDay := map[string]float64{}
+
+	for _, element := range datedReturnsB {
+		returnsByDay[element.EndedAt.Format("2006-01-02")] = element.Return
+	}
+
+	returnsA := []float64{}
+	returnsB := []float64{}
+
+	for _, element := range datedReturnsA {
+
+		returnB, returnFound := returnsByDay[element.EndedAt.Format("2006-01-02")]
+
+		if returnFound == false {
+			continue
+		}
+
+		returnsA = append(returnsA, element.Return)
+		returnsB = append(returnsB, returnB)
+	}
+
+	return returnsA, returnsB
+}
+
+// GetPeriodsPerYear annualizes by how far apart the snapshots actually are, daily snapshots on trading days come out
+// near 252
+func GetPeriodsPerYear(times []time.Time) float64 {
+
+	if len(times) < 2 {
+		return 0
+	}
+
+	years := times[len(times)-1].Sub(times[0]).Hours() / 24 / 365.25
+
+	if years <= 0 {
+		return 0
+	}
+
+	return float64(len(times)-1) / years
+}
+
+func GetTimeWeightedReturn(periodReturns []float64) float64 {
+
+	growth := 1.0
+
+	for _, periodReturn := range periodReturns {
+		growth = growth * (1 + periodReturn)
+	}
+
+	return growth - 1
+}
+
+func getNetPresentValue(rate float64, cashFlows []float64, years []float64) float64 {
+
+	presentValue := 0.0
+
+	for i, cashFlow := range cashFlows {
+		presentValue = presentValue + cashFlow/math.Pow(1+rate, years[i])
+	}
+
+	return presentValue
+}
+
+// GetMoneyWeightedReturn solves the annualized internal rate of return treating the starting value and flows as investments
+func GetMoneyWeightedReturn(values []float64, flows []float64, times []time.Time) float64 {
+
+	if len(values) < 2 {
+		return 0
+	}
+
+	cashFlows := []float64{-values[0]}
+	years := []float64{0}
+
+	for i := 1; i < len(values); i++ {
+
+		yearsSinceStart := times[i].Sub(times[0]).Hours() / 24 / 365
+
+		if i == len(values)-1 {
+			cashFlows = append(cashFlows, values[i]-flows[i])
+		} else {
+			cashFlows = append(cashFlows, -flows[i])
+		}
+
+		years = append(years, yearsSinceStart)
+	}
+
+	if years[len(years)-1] <= 0 {
+		return 0
+	}
+
+	lowRate := -0.9999
+	highRate := 100.0
+
+	if getNetPresentValue(lowRate, cashFlows, years)*getNetPresentValue(highRate, cashFlows, years) > 0 {
+		return 0
+	}
+
+	for i := 0; i < 200; i++ {
+
+		midRate := (lowRate + highRate) / 2
+
+		if getNetPresentValue(lowRate, cashFlows, years)*getNetPresentValue(midRate, cashFlows, years) <= 0 {
+			highRate = midRate
+		} else {
+			lowRate = midRate
+		}
+	}
+
+	return (lowRate + highRate) / 2
+}
+
+func GetMean(numbers []float64) float64 {
+
+	if len(numbers) == 0 {
+		return 0
+	}
+
+	total := 0.0
+
+	for _, number := range numbers {
+		total = total + number
+	}
+
+	return total / float64(len(numbers))
+}
+
+func GetStandardDeviation(numbers []float64) float64 {
+
+	if len(numbers) < 2 {
+		return 0
+	}
+
+	mean := GetMean(numbers)
+	squaredTotal := 0.0
+
+	for _, number := range numbers {
+		squaredTotal = squaredTotal + (number-mean)*(number-mean)
+	}
+
+	return math.Sqrt(squaredTotal / float64(len(numbers)-1))
+}
+
+func GetAnnualizedVolatility(periodReturns []float64, periodsPerYear float64) float64 {
+	return GetStandardDeviation(periodReturns) * math.Sqrt(periodsPerYear)
+}
+
+func GetSharpeRatio(periodReturns []float64, annualRiskFreeRate float64, periodsPerYear float64) float64 {
+
+	volatility := GetAnnualizedVolatility(periodReturns, periodsPerYear)
+
+	if volatility == 0 {
+		return 0
+	}
+
+	return (GetMean(periodReturns)*periodsPerYear - annualRiskFreeRate) / volatility
+}
+
+func GetSortinoRatio(periodReturns []float64, annualRiskFreeRate float64, periodsPerYear float64) float64 {
+
+	if periodsPerYear == 0 {
+		return 0
+	}
+
+	periodRiskFreeRate := annualRiskFreeRate / periodsPerYear
+	squaredDownside := 0.0
+
+	for _, periodReturn := range periodReturns {
+		if periodReturn < periodRiskFreeRate {
+			squaredDownside = squaredDownside + (periodReturn-periodRiskFreeRate)*(periodReturn-periodRiskFreeRate)
+		}
+	}
+
+	if len(periodReturns) == 0 || squaredDownside == 0 {
+		return 0
+	}
+
+	downsideDeviation := math.Sqrt(squaredDownside/float64(len(periodReturns))) * math.Sqrt(periodsPerYear)
+
+	return (GetMean(periodReturns)*periodsPerYear - annualRiskFreeRate) / downsideDeviation
+}
+
+// GetMaxDrawdown is the largest fall from a peak of the growth of the period returns
+func GetMaxDrawdown(periodReturns []float64) float64 {
+
+	growth := 1.0
+	peakGrowth := 1.0
+	maxDrawdown := 0.0
+
+	for _, periodReturn := range periodReturns {
+
+		growth = growth * (1 + periodReturn)
+
+		if growth > peakGrowth {
+			peakGrowth = growth
+		}
+
+		drawdown := growth/peakGrowth - 1
+
+		if drawdown < maxDrawdown {
+			maxDrawdown = drawdown
+		}
+	}
+
+	return maxDrawdown
+}
+
+func GetCovariance(numbersA []float64, numbersB []float64) float64 {
+
+	if len(numbersA) < 2 || len(numbersA) != len(numbersB) {
+		return 0
+	}
+
+	meanA := GetMean(numbersA)
+	meanB := GetMean(numbersB)
+	total := 0.0
+
+	for i := range numbersA {
+		total = total + (numbersA[i]-meanA)*(numbersB[i]-meanB)
+	}
+
+	return total / float64(len(numbersA)-1)
+}
+
+func GetBeta(periodReturns []float64, benchmarkReturns []float64) float64 {
+
+	benchmarkVariance := GetCovariance(benchmarkReturns, benchmarkReturns)
+
+	if benchmarkVariance == 0 {
+		return 0
+	}
+
+	return GetCovariance(periodReturns, benchmarkReturns) / benchmarkVariance
+}
+
+// GetActiveReturns needs returns paired up by JoinDatedReturns, series of different lengths have nothing to compare
+func GetActiveReturns(periodReturns []float64, benchmarkReturns []float64) []float64 {
+
+	activeReturns := []float64{}
+
+	if len(periodReturns) != len(benchmarkReturns) {
+		return activeReturns
+	}
+
+	for i := range periodReturns {
+		activeReturns = append(activeReturns, periodReturns[i]-benchmarkReturns[i])
+	}
+
+	return activeReturns
+}
+
+func GetTrackingError(periodReturns []float64, benchmarkReturns []float64, periodsPerYear float64) float64 {
+	return GetAnnualizedVolatility(GetActiveReturns(periodReturns, benchmarkReturns), periodsPerYear)
+}
+
+func GetInformationRatio(periodReturns []float64, benchmarkReturns []float64, periodsPerYear float64) float64 {
+
+	trackingError := GetTrackingError(periodReturns, benchmarkReturns, periodsPerYear)
+
+	if trackingError == 0 {
+		return 0
+	}
+
+	return GetMean(GetActiveReturns(periodReturns, benchmarkReturns)) * periodsPerYear / trackingError
+}
@@ -0,0 +1,297 @@
+package util
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const performanceTolerance = 1e-6
+
+func floatsAlmostEqual(a []float64, b []float64) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > performanceTolerance {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestGetPeriodReturns(t *testing.T) {
+
+	testCases := []struct {
+		name          string
+		values        []float64
+		flows         []float64
+		periodReturns []float64
+	}{
+		{"no flows", []float64{100, 110, 99}, []float64{0, 0, 0}, []float64{0.1, -0.1}},
+		{"deposit is taken out of the return", []float64{100, 150, 165}, []float64{0, 40, 0}, []float64{0.1, 0.1}},
+		{"withdrawal is added back", []float64{100, 70}, []float64{0, -40}, []float64{0.1}},
+		{"empty starting value is skipped", []float64{0, 100, 110}, []float64{0, 100, 0}, []float64{0.1}},
+		{"single value has no periods", []float64{100}, []float64{0}, []float64{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			periodReturns := GetPeriodReturns(testCase.values, testCase.flows)
+
+			if floatsAlmostEqual(periodReturns, testCase.periodReturns) == false {
+				t.Errorf("GetPeriodReturns = %v, want %v", periodReturns, testCase.periodReturns)
+			}
+		})
+	}
+}
+
+func TestGetTimeWeightedReturn(t *testing.T) {
+
+	testCases := []struct {
+		name          string
+		periodReturns []float64
+		result        float64
+	}{
+		{"no periods", []float64{}, 0},
+		{"compounds", []float64{0.1, 0.1}, 0.21},
+		{"loss after gain", []float64{0.5, -0.5}, -0.25},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			result := GetTimeWeightedReturn(testCase.periodReturns)
+
+			if math.Abs(result-testCase.result) > performanceTolerance {
+				t.Errorf("GetTimeWeightedReturn = %v, want %v", result, testCase.result)
+			}
+		})
+	}
+}
+
+func TestGetMoneyWeightedReturn(t *testing.T) {
+
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name   string
+		values []float64
+		flows  []float64
+		times  []time.Time
+		result float64
+	}{
+		{"single value", []float64{100}, []float64{0}, []time.Time{start}, 0},
+		{"no time passed", []float64{100, 110}, []float64{0, 0}, []time.Time{start, start}, 0},
+		{"one year without flows", []float64{100, 110}, []float64{0, 0}, []time.Time{start, start.AddDate(0, 0, 365)}, 0.1},
+		{
+			"deposit in the middle",
+			[]float64{100, 200, 231},
+			[]float64{0, 100, 0},
+			[]time.Time{start, start.AddDate(0, 0, 365), start.AddDate(0, 0, 730)},
+			0.1,
+		},
+		{
+			"losing year",
+			[]float64{100, 80},
+			[]float64{0, 0},
+			[]time.Time{start, start.AddDate(0, 0, 365)},
+			-0.2,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			result := GetMoneyWeightedReturn(testCase.values, testCase.flows, testCase.times)
+
+			if math.Abs(result-testCase.result) > performanceTolerance {
+				t.Errorf("GetMoneyWeightedReturn = %v, want %v", result, testCase.result)
+			}
+		})
+	}
+}
+
+func TestGetSortinoRatio(t *testing.T) {
+
+	testCases := []struct {
+		name               string
+		periodReturns      []float64
+		annualRiskFreeRate float64
+		periodsPerYear     float64
+		result             float64
+	}{
+		{"no periods", []float64{}, 0, 252, 0},
+		{"no downside", []float64{0.1, 0.2}, 0, 1, 0},
+		{"no periods per year", []float64{0.2, -0.1}, 0, 0, 0},
+		{"one down period", []float64{0.2, -0.1}, 0, 1, 0.05 / math.Sqrt(0.005)},
+		{"risk free rate raises the bar", []float64{0.2, 0.01}, 0.04, 1, (0.105 - 0.04) / math.Sqrt(0.0009/2)},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			result := GetSortinoRatio(testCase.periodReturns, testCase.annualRiskFreeRate, testCase.periodsPerYear)
+
+			if math.Abs(result-testCase.result) > performanceTolerance {
+				t.Errorf("GetSortinoRatio = %v, want %v", result, testCase.result)
+			}
+		})
+	}
+}
+
+func TestGetMaxDrawdown(t *testing.T) {
+
+	testCases := []struct {
+		name          string
+		periodReturns []float64
+		result        float64
+	}{
+		{"no periods", []float64{}, 0},
+		{"only gains", []float64{0.1, 0.2}, 0},
+		{"fall from a later peak", []float64{0.1, -0.5, 0.2}, -0.5},
+		{"losses compound", []float64{-0.1, -0.1}, -0.19},
+		{"deepest of two falls", []float64{-0.1, 0.5, -0.2, -0.25}, -0.4},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			result := GetMaxDrawdown(testCase.periodReturns)
+
+			if math.Abs(result-testCase.result) > performanceTolerance {
+				t.Errorf("GetMaxDrawdown = %v, want %v", result, testCase.result)
+			}
+		})
+	}
+}
+
+func TestJoinDatedReturns(t *testing.T) {
+
+	day := func(dayOfMonth int, hour int) time.Time {
+		return time.Date(2021, time.March, dayOfMonth, hour, 0, 0, 0, time.UTC)
+	}
+
+	testCases := []struct {
+		name     string
+		returnsA []DatedReturn
+		returnsB []DatedReturn
+		joinedA  []float64
+		joinedB  []float64
+	}{
+		{
+			"same days",
+			[]DatedReturn{{day(1, 16), 0.1}, {day(2, 16), 0.2}},
+			[]DatedReturn{{day(1, 16), 0.01}, {day(2, 16), 0.02}},
+			[]float64{0.1, 0.2},
+			[]float64{0.01, 0.02},
+		},
+		{
+			"benchmark missing a day",
+			[]DatedReturn{{day(1, 16), 0.1}, {day(2, 16), 0.2}, {day(3, 16), 0.3}},
+			[]DatedReturn{{day(1, 16), 0.01}, {day(3, 16), 0.03}},
+			[]float64{0.1, 0.3},
+			[]float64{0.01, 0.03},
+		},
+		{
+			"portfolio missing a day",
+			[]DatedReturn{{day(2, 16), 0.2}},
+			[]DatedReturn{{day(1, 16), 0.01}, {day(2, 16), 0.02}},
+			[]float64{0.2},
+			[]float64{0.02},
+		},
+		{
+			"matched by day not time",
+			[]DatedReturn{{day(1, 9), 0.1}},
+			[]DatedReturn{{day(1, 20), 0.01}},
+			[]float64{0.1},
+			[]float64{0.01},
+		},
+		{
+			"nothing in common",
+			[]DatedReturn{{day(1, 16), 0.1}},
+			[]DatedReturn{{day(2, 16), 0.02}},
+			[]float64{},
+			[]float64{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			joinedA, joinedB := JoinDatedReturns(testCase.returnsA, testCase.returnsB)
+
+			if floatsAlmostEqual(joinedA, testCase.joinedA) == false || floatsAlmostEqual(joinedB, testCase.joinedB) == false {
+				t.Errorf("JoinDatedReturns = %v %v, want %v %v", joinedA, joinedB, testCase.joinedA, testCase.joinedB)
+			}
+		})
+	}
+}
+
+func TestGetPeriodsPerYear(t *testing.T) {
+
+	start := time.Date(2021, time.January, 4, 16, 0, 0, 0, time.UTC)
+
+	everyDays := func(count int, days int) []time.Time {
+
+		times := []time.Time{}
+
+		for i := 0; i < count; i++ {
+			times = append(times, start.Add(time.Duration(i*days*24)*time.Hour))
+		}
+
+		return times
+	}
+
+	testCases := []struct {
+		name           string
+		times          []time.Time
+		periodsPerYear float64
+	}{
+		{"no snapshots", []time.Time{}, 0},
+		{"one snapshot", everyDays(1, 1), 0},
+		{"same time", []time.Time{start, start}, 0},
+		{"daily", everyDays(11, 1), 365.25},
+		{"weekly", everyDays(11, 7), 365.25 / 7},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			periodsPerYear := GetPeriodsPerYear(testCase.times)
+
+			if math.Abs(periodsPerYear-testCase.periodsPerYear) > performanceTolerance {
+				t.Errorf("GetPeriodsPerYear = %v, want %v", periodsPerYear, testCase.periodsPerYear)
+			}
+		})
+	}
+}
+
+func TestGetActiveReturns(t *testing.T) {
+
+	testCases := []struct {
+		name             string
+		periodReturns    []float64
+		benchmarkReturns []float64
+		activeReturns    []float64
+	}{
+		{"paired", []float64{0.1, -0.05}, []float64{0.08, -0.01}, []float64{0.02, -0.04}},
+		{"different lengths", []float64{0.1, 0.2}, []float64{0.1}, []float64{}},
+		{"empty", []float64{}, []float64{}, []float64{}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			activeReturns := GetActiveReturns(testCase.periodReturns, testCase.benchmarkReturns)
+
+			if floatsAlmostEqual(activeReturns, testCase.activeReturns) == false {
+				t.Errorf("GetActiveReturns = %v, want %v", activeReturns, testCase.activeReturns)
+			}
+		})
+	}
+}
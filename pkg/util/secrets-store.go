@@ -0,0 +1,320 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const secretsFileVersion = 1
+
+// Broker credentials are saved per environment as <environment>.alpaca_key and <environment>.alpaca_secret
+const (
+	SecretAlpacaKey    = "alpaca_key"
+	SecretAlpacaSecret = "alpaca_secret"
+)
+
+// secretsFile is what is written to disk, only the salt and nonce are readable without the passphrase
+type secretsFile struct {
+	Version int
+	Salt    []byte
+	Nonce   []byte
+	Sealed  []byte
+}
+
+// SecretsStore keeps named secrets encrypted with a key derived from a passphrase
+type SecretsStore struct {
+	path       string
+	passphrase []byte
+	secrets    map[string]string
+}
+
+func deriveSecretsKey(passphrase []byte, salt []byte) (*[32]byte, error) {
+
+	derivedKey, deriveError := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+
+	if deriveError != nil {
+		return nil, deriveError
+	}
+
+	secretsKey := [32]byte{}
+	copy(secretsKey[:], derivedKey)
+
+	return &secretsKey, nil
+}
+
+// OpenSecretsStore decrypts the store at path, a missing file gives an empty store that is created on Save
+func OpenSecretsStore(path string, passphrase []byte) (*SecretsStore, error) {
+
+	secretsStore := &SecretsStore{
+		path:       path,
+		passphrase: passphrase,
+		secrets:    map[string]string{},
+	}
+
+	fileContents, readError := ioutil.ReadFile(path)
+
+	if os.IsNotExist(readError) {
+		return secretsStore, nil
+	}
+
+	if readError != nil {
+		return nil, readError
+	}
+
+	storedFile := secretsFile{}
+
+	unmarshalError := json.Unmarshal(fileContents, &storedFile)
+
+	if unmarshalError != nil {
+		return nil, errors.New(path + " is not a secrets file, " + unmarshalError.Error())
+	}
+
+	if storedFile.Version != secretsFileVersion || len(storedFile.Nonce) != 24 {
+		return nil, errors.New(path + " has an unsupported secrets file version")
+	}
+
+	secretsKey, deriveError := deriveSecretsKey(passphrase, storedFile.Salt)
+
+	if deriveError != nil {
+		return nil, deriveError
+	}
+
+	nonce := [24]byte{}
+	copy(nonce[:], storedFile.Nonce)
+
+	opened, openOk := secretbox.Open(nil, storedFile.Sealed, &nonce, secretsKey)
+
+	if openOk == false {
+		return nil, errors.New("can not decrypt " + path + ", the passphrase is wrong or the file was modified")
+	}
+
+	unmarshalError = json.Unmarshal(opened, &secretsStore.secrets)
+
+	if unmarshalError != nil {
+		return nil, unmarshalError
+	}
+
+	return secretsStore, nil
+}
+
+func (secretsStore *SecretsStore) Get(name string) (string, bool) {
+
+	secretValue, secretFound := secretsStore.secrets[name]
+
+	return secretValue, secretFound
+}
+
+func (secretsStore *SecretsStore) Set(name string, value string) {
+	secretsStore.secrets[name] = value
+}
+
+// Names returns the stored secret names sorted, never the values
+func (secretsStore *SecretsStore) Names() []string {
+
+	secretNames := []string{}
+
+	for secretName := range secretsStore.secrets {
+		secretNames = append(secretNames, secretName)
+	}
+
+	sort.Strings(secretNames)
+
+	return secretNames
+}
+
+// Save encrypts the store with a fresh salt and nonce and replaces the file in one rename
+func (secretsStore *SecretsStore) Save() error {
+
+	storedFile := secretsFile{
+		Version: secretsFileVersion,
+		Salt:    make([]byte, 16),
+		Nonce:   make([]byte, 24),
+	}
+
+	_, saltError := io.ReadFull(rand.Reader, storedFile.Salt)
+
+	if saltError != nil {
+		return saltError
+	}
+
+	_, nonceError := io.ReadFull(rand.Reader, storedFile.Nonce)
+
+	if nonceError != nil {
+		return nonceError
+	}
+
+	secretsKey, deriveError := deriveSecretsKey(secretsStore.passphrase, storedFile.Salt)
+
+	if deriveError != nil {
+		return deriveError
+	}
+
+	plainSecrets, marshalError := json.Marshal(secretsStore.secrets)
+
+	if marshalError != nil {
+		return marshalError
+	}
+
+	nonce := [24]byte{}
+	copy(nonce[:], storedFile.Nonce)
+
+	storedFile.Sealed = secretbox.Seal(nil, plainSecrets, &nonce, secretsKey)
+
+	fileContents, marshalError := json.MarshalIndent(storedFile, "", "  ")
+
+	if marshalError != nil {
+		return marshalError
+	}
+
+	writeError := ioutil.WriteFile(secretsStore.path+".tmp", fileContents, 0600)
+
+	if writeError != nil {
+		return writeError
+	}
+
+	return os.Rename(secretsStore.path+".tmp", secretsStore.path)
+}
+
+// Rotate re-encrypts every secret under a new passphrase
+func (secretsStore *SecretsStore) Rotate(newPassphrase []byte) error {
+
+	secretsStore.passphrase = newPassphrase
+
+	return secretsStore.Save()
+}
+
+// ReadSecret reads a value from a file, from stdin when the path is - or empty, prompting without echo on a terminal
+func ReadSecret(path string, prompt string) (string, error) {
+
+	if path != "" && path != "-" {
+
+		fileContents, readError := ioutil.ReadFile(path)
+
+		if readError != nil {
+			return "", readError
+		}
+
+		return strings.TrimRight(string(fileContents), "\r\n"), nil
+	}
+
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+
+		os.Stderr.WriteString(prompt)
+
+		secretValue, readError := terminal.ReadPassword(int(os.Stdin.Fd()))
+		os.Stderr.WriteString("\n")
+
+		if readError != nil {
+			return "", readError
+		}
+
+		return string(secretValue), nil
+	}
+
+	stdinContents, readError := ioutil.ReadAll(os.Stdin)
+
+	if readError != nil {
+		return "", readError
+	}
+
+	return strings.TrimRight(string(stdinContents), "\r\n"), nil
+}
+
+// ReadSecretsPassphrase takes the passphrase from CONDEXT_SECRETS_PASSPHRASE, the file in
+// CONDEXT_SECRETS_PASSPHRASE_FILE, or a terminal prompt, the variable prefix lets rotate ask for the new one
+func ReadSecretsPassphrase(variablePrefix string, prompt string) ([]byte, error) {
+
+	passphrase, passphraseSet := os.LookupEnv(variablePrefix)
+
+	if passphraseSet == false {
+
+		passphraseFile := os.Getenv(variablePrefix + "_FILE")
+
+		if passphraseFile == "" && terminal.IsTerminal(int(os.Stdin.Fd())) == false {
+			return nil, errors.New("no secrets passphrase, set " + variablePrefix + " or " + variablePrefix + "_FILE")
+		}
+
+		var readError error
+
+		passphrase, readError = ReadSecret(passphraseFile, prompt)
+
+		if readError != nil {
+			return nil, readError
+		}
+	}
+
+	if passphrase == "" {
+		return nil, errors.New("the secrets passphrase can not be empty")
+	}
+
+	return []byte(passphrase), nil
+}
+
+// SecretsPath is the store file, secrets.enc unless SecretsFile is set. A relative path from the config file is
+// resolved against the directory of that file so the store is found wherever condext is started from
+func (config *ConfigStruct) SecretsPath() string {
+
+	secretsFile := config.SecretsFile
+
+	if secretsFile == "" {
+		secretsFile = "secrets.enc"
+	}
+
+	if filepath.IsAbs(secretsFile) == true {
+		return secretsFile
+	}
+
+	return filepath.Join(config.configDirectory, secretsFile)
+}
+
+// LoadCredentials fills missing broker credentials for the environment from the secrets store, the simulator needs none
+func (config *ConfigStruct) LoadCredentials(environmentName string, environment *EnvironmentConfig) error {
+
+	if environmentName == EnvironmentSim || (environment.AlpacaApi != "" && environment.AlpacaSecret != "") {
+		return nil
+	}
+
+	_, statError := os.Stat(config.SecretsPath())
+
+	if statError != nil {
+		return errors.New("environment " + environmentName + " has no credentials in the config and " + config.SecretsPath() +
+			" can not be read, run condext secrets set " + environmentName + "." + SecretAlpacaKey)
+	}
+
+	passphrase, passphraseError := ReadSecretsPassphrase("CONDEXT_SECRETS_PASSPHRASE", "Secrets passphrase: ")
+
+	if passphraseError != nil {
+		return passphraseError
+	}
+
+	secretsStore, openError := OpenSecretsStore(config.SecretsPath(), passphrase)
+
+	if openError != nil {
+		return openError
+	}
+
+	if environment.AlpacaApi == "" {
+		environment.AlpacaApi, _ = secretsStore.Get(environmentName + "." + SecretAlpacaKey)
+	}
+
+	if environment.AlpacaSecret == "" {
+		environment.AlpacaSecret, _ = secretsStore.Get(environmentName + "." + SecretAlpacaSecret)
+	}
+
+	if environment.AlpacaApi == "" || environment.AlpacaSecret == "" {
+		return errors.New(config.SecretsPath() + " has no " + environmentName + "." + SecretAlpacaKey + " and " +
+			environmentName + "." + SecretAlpacaSecret)
+	}
+
+	return nil
+}
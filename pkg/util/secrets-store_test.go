@@ -0,0 +1,65 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretsPath(t *testing.T) {
+
+	configDirectory, directoryError := ioutil.TempDir("", "condext-test")
+
+	if directoryError != nil {
+		t.Fatal(directoryError)
+	}
+
+	defer os.RemoveAll(configDirectory)
+
+	testCases := []struct {
+		name        string
+		secretsFile string
+		environment string
+		secretsPath string
+	}{
+		{"default next to the config", "", "", filepath.Join(configDirectory, "secrets.enc")},
+		{"relative to the config", "keys/store.enc", "", filepath.Join(configDirectory, "keys/store.enc")},
+		{"absolute path", "/var/lib/condext/secrets.enc", "", "/var/lib/condext/secrets.enc"},
+		{"environment is relative to the working directory", "keys/store.enc", "other.enc", "other.enc"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			configFile := filepath.Join(configDirectory, "config.yaml")
+
+			writeError := ioutil.WriteFile(configFile, []byte("SecretsFile: \""+testCase.secretsFile+"\"\n"), 0600)
+
+			if writeError != nil {
+				t.Fatal(writeError)
+			}
+
+			if testCase.environment != "" {
+				os.Setenv("CONDEXT_SECRETS_FILE", testCase.environment)
+				defer os.Unsetenv("CONDEXT_SECRETS_FILE")
+			}
+
+			configStruct, _, loadError := LoadConfig(ConfigFlags{ConfigFile: configFile})
+
+			if loadError != nil {
+				t.Fatal(loadError)
+			}
+
+			if configStruct.SecretsPath() != testCase.secretsPath {
+				t.Errorf("SecretsPath = %s, want %s", configStruct.SecretsPath(), testCase.secretsPath)
+			}
+		})
+	}
+
+	withoutConfigFile := ConfigStruct{}
+
+	if withoutConfigFile.SecretsPath() != "secrets.enc" {
+		t.Errorf("SecretsPath without a config file = %s, want secrets.enc", withoutConfigFile.SecretsPath())
+	}
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"errors"
+	"time"
+)
+
+// ParseWindowTime turns HH:MM into minutes after midnight
+func ParseWindowTime(windowTime string) (int, error) {
+
+	parsedTime, parseError := time.Parse("15:04", windowTime)
+
+	if parseError != nil {
+		return 0, errors.New("trade window times must be HH:MM, got " + windowTime)
+	}
+
+	return parsedTime.Hour()*60 + parsedTime.Minute(), nil
+}
+
+func ValidateTradeWindow(windowStart string, windowEnd string) error {
+
+	if windowStart == "" && windowEnd == "" {
+		return nil
+	}
+
+	startMinutes, startError := ParseWindowTime(windowStart)
+
+	if startError != nil {
+		return startError
+	}
+
+	endMinutes, endError := ParseWindowTime(windowEnd)
+
+	if endError != nil {
+		return endError
+	}
+
+	if endMinutes <= startMinutes {
+		return errors.New("the trade window has to end after it starts")
+	}
+
+	return nil
+}
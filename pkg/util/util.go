@@ -48,4 +48,9 @@ func GetPercentage(number float64, percent float64) float64 {
 
 func GetDecimalPercentage(number decimal.Decimal, percent decimal.Decimal) decimal.Decimal {
 	return number.Mul(percent).Div(decimal.NewFromFloat(100))
-}
\ No newline at end of file
+}
+
+func DecimalToFloat(number decimal.Decimal) float64 {
+	retVal, _ := number.Float64()
+	return retVal
+}